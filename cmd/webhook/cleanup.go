@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/spf13/cobra"
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/cern"
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/pkg/config"
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/provider"
+)
+
+// newCleanupCommand creates the cleanup command, removing the aliases owned by this webhook
+// instance from the ingress nodes, e.g. to decommission a cluster or recover from a bad state.
+//
+// Only the endpoints matching --domain-filter are removed, all of them without a domain filter, and
+// the protected aliases are kept. The planned changes are printed, and only applied with --confirm.
+func newCleanupCommand() *cobra.Command {
+	var confirm bool
+	cmd := &cobra.Command{
+		Use:   "cleanup",
+		Short: "Remove the owned aliases from the ingress nodes",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			cfg, err := commandConfig(cmd)
+			if err != nil {
+				return err
+			}
+			return cleanup(cmd.OutOrStdout(), cfg, confirm)
+		},
+	}
+	cmd.Flags().BoolVar(&confirm, "confirm", false, "Remove the printed aliases, which are only planned without it")
+	return cmd
+}
+
+// cleanup prints the removal of the owned aliases to out, and applies it when confirmed, logging to
+// stderr.
+func cleanup(out io.Writer, cfg *config.Config, confirm bool) error {
+	ctx, backend, k8sClient, err := commandBackend(cfg)
+	if err != nil {
+		return err
+	}
+	nodes, err := backend.GetIngressNodes(ctx, cfg.IngressLabels)
+	if err != nil {
+		return fmt.Errorf("failed to get ingress nodes: %w", err)
+	}
+	// The servers carry the owner key of the instance managing them, LanDB devices do not.
+	if cfg.Backend != cern.BackendLanDB {
+		nodes = cern.OwnedNodes(nodes, cfg.OwnerID)
+	}
+
+	desired, removed := provider.CleanupDesired(cfg, nodes)
+	plans, err := provider.PlanDesired(ctx, cfg, backend, k8sClient, nodes, desired)
+	if err != nil {
+		return err
+	}
+	if err := writePlansTable(out, plans); err != nil {
+		return err
+	}
+	if len(plans) == 0 {
+		return nil
+	}
+
+	switch {
+	case !confirm:
+		return fmt.Errorf("refusing to remove the aliases of %d endpoints from %d nodes without --confirm", len(removed), len(plans))
+	case cfg.DryRun:
+		_, err := fmt.Fprintln(out, "Dry run, no changes applied")
+		return err
+	}
+	if err := provider.SyncDesired(ctx, cfg, backend, k8sClient, nodes, desired); err != nil {
+		return fmt.Errorf("failed to clean up the ingress nodes: %w", err)
+	}
+	_, err = fmt.Fprintf(out, "Removed the aliases of %d endpoints from %d nodes\n", len(removed), len(plans))
+	return err
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/cern"
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/k8s"
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/log"
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/pkg/config"
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/provider"
+)
+
+// Output formats of the commands.
+const (
+	// outputText prints human-readable lines.
+	outputText = "text"
+	// outputTable prints an aligned table, one item per line.
+	outputTable = "table"
+	// outputJSON prints indented JSON, for automation.
+	outputJSON = "json"
+)
+
+// writeJSON writes v to out as indented JSON.
+func writeJSON(out io.Writer, v any) error {
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+// commandConfig loads the configuration of the flags shared by the commands.
+func commandConfig(cmd *cobra.Command) (*config.Config, error) {
+	cfg, err := loadConfig(cmd.Root().PersistentFlags())
+	if err != nil {
+		return nil, fmt.Errorf("failed to load configuration: %w", err)
+	}
+	return cfg, nil
+}
+
+// commandBackend sets up the logger, writing to stderr so that it does not mix with the output of
+// the command, and the backend of a one-off command. The returned context carries the logger.
+func commandBackend(cfg *config.Config) (context.Context, cern.Backend, *k8s.Client, error) {
+	logger, err := newLogger(cfg, os.Stderr)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	ctx := log.NewContext(context.Background(), logger)
+
+	k8sClient, err := k8s.NewClient(cfg)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to create Kubernetes client: %w", err)
+	}
+	backend, _, err := provider.NewBackend(ctx, cfg, k8sClient, logger)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return ctx, backend, k8sClient, nil
+}
+
+// readInput reads the file given to a command, or in when the file is -.
+func readInput(in io.Reader, file string) ([]byte, error) {
+	var data []byte
+	var err error
+	if file == "-" {
+		data, err = io.ReadAll(in)
+	} else {
+		data, err = os.ReadFile(file)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", file, err)
+	}
+	return data, nil
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/cern"
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/k8s"
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/log"
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/security"
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/tlsconfig"
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/provider"
+)
+
+// Defines the shells the completion command generates scripts for.
+const (
+	shellBash = "bash"
+	shellZsh  = "zsh"
+	shellFish = "fish"
+)
+
+// newCompletionCommand creates the completion command, printing the script completing the
+// commands, the flags, and the values of the enumerated flags of the webhook in the given shell.
+//
+// It replaces the default completion command of cobra, so that it is documented along with the
+// other commands and does not load the configuration.
+func newCompletionCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "completion " + shellBash + "|" + shellZsh + "|" + shellFish,
+		Short: "Print the shell completion script of the webhook",
+		Long: `Print the script completing the commands and flags of the webhook in the given shell.
+
+Load the completions in the current shell with:
+
+  bash: source <(webhook completion bash)
+  zsh:  source <(webhook completion zsh)
+  fish: webhook completion fish | source
+
+or write the script to the completion directory of the shell to load them in every session.`,
+		ValidArgs:             []string{shellBash, shellZsh, shellFish},
+		Args:                  cobra.MatchAll(cobra.ExactArgs(1), cobra.OnlyValidArgs),
+		DisableFlagsInUseLine: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			out := cmd.OutOrStdout()
+			switch args[0] {
+			case shellBash:
+				return cmd.Root().GenBashCompletionV2(out, true)
+			case shellZsh:
+				return cmd.Root().GenZshCompletion(out)
+			case shellFish:
+				return cmd.Root().GenFishCompletion(out, true)
+			default:
+				return fmt.Errorf("unsupported shell %q", args[0])
+			}
+		},
+	}
+}
+
+// configFlagValues lists the values completed for the configuration flags taking one of a fixed
+// set of values. The other flags complete file names, as cobra does by default.
+var configFlagValues = map[string][]string{
+	"log-level":         {"trace", "debug", "info", "warn", "error"},
+	"log-format":        {string(log.FormatConsole), string(log.FormatJSON)},
+	"log-color":         {string(log.ColorAuto), string(log.ColorAlways), string(log.ColorNever)},
+	"health-critical":   provider.HealthComponents,
+	Backend:             {cern.BackendNova, cern.BackendLanDB, cern.BackendFake},
+	"baremetal-backend": {cern.BackendNova, cern.BackendLanDB},
+	OpenStackAuthType:   {cern.AuthTypePassword, cern.AuthTypeKerberos, cern.AuthTypeOIDCAccessToken},
+	"node-discovery":    {k8s.DiscoveryLabel, k8s.DiscoveryService, k8s.DiscoveryEndpointSlice, k8s.DiscoveryWorkload},
+	"node-address-type": {k8s.AddressTypeExternalIP, k8s.AddressTypeInternalIP, k8s.AddressTypeAuto},
+	"kube-backend":      {k8s.KubeBackendCluster, k8s.KubeBackendFake},
+	"os-cassette-mode":  {cern.CassetteOff, cern.CassetteRecord, cern.CassetteReplay},
+	"orphan-scan":       {cern.OrphanScanOff, cern.OrphanScanReport, cern.OrphanScanRepair},
+	"tls-min-version":   tlsconfig.Versions,
+	"tls-cipher-suites": tlsconfig.CipherSuiteNames(),
+	"tls-profile":       tlsconfig.Profiles,
+	"security-checks":   security.Modes,
+}
+
+// registerConfigFlagCompletions registers the completion of the values of the enumerated
+// configuration flags on the root command.
+func registerConfigFlagCompletions(root *cobra.Command) {
+	for name, values := range configFlagValues {
+		registerFlagValues(root, name, values...)
+	}
+}
+
+// registerFlagValues registers the fixed values completed for the given flag of the command.
+func registerFlagValues(cmd *cobra.Command, name string, values ...string) {
+	// Registering fails only for unknown or already registered flags, a programming error.
+	if err := cmd.RegisterFlagCompletionFunc(name, cobra.FixedCompletions(values, cobra.ShellCompDirectiveNoFileComp)); err != nil {
+		panic(fmt.Sprintf("failed to register the completion of --%s: %v", name, err))
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/cern"
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/pkg/config"
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/provider"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+// newDiffCommand creates the diff command, printing the per-node metadata changes that would bring
+// the ingress nodes to the desired endpoints read from a file, without applying them.
+//
+// The file holds either the full list of desired endpoints, as a JSON array, or the changes
+// ExternalDNS posts to /records, as a JSON object.
+func newDiffCommand() *cobra.Command {
+	var file, output string
+	cmd := &cobra.Command{
+		Use:   "diff",
+		Short: "Print the node changes of desired endpoints without applying them",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			if output != outputTable && output != outputJSON {
+				return fmt.Errorf("invalid --output %q, expected %s or %s", output, outputTable, outputJSON)
+			}
+			cfg, err := commandConfig(cmd)
+			if err != nil {
+				return err
+			}
+			data, err := readInput(cmd.InOrStdin(), file)
+			if err != nil {
+				return err
+			}
+			return diff(cmd.OutOrStdout(), cfg, data, output)
+		},
+	}
+	cmd.Flags().StringVarP(&file, "file", "f", "", "File of the desired endpoints or of the ExternalDNS changes to diff, - for stdin")
+	cmd.Flags().StringVarP(&output, "output", "o", outputTable, "Output format (table, json)")
+	registerFlagValues(cmd, "output", outputTable, outputJSON)
+	_ = cmd.MarkFlagRequired("file")
+	return cmd
+}
+
+// diff prints the changes bringing the ingress nodes to the desired endpoints of data to out in
+// the given output format, logging to stderr.
+func diff(out io.Writer, cfg *config.Config, data []byte, output string) error {
+	ctx, backend, k8sClient, err := commandBackend(cfg)
+	if err != nil {
+		return err
+	}
+	nodes, err := backend.GetIngressNodes(ctx, cfg.IngressLabels)
+	if err != nil {
+		return fmt.Errorf("failed to get ingress nodes: %w", err)
+	}
+
+	desired, err := decodeDesired(data, cern.ParseEndpointsFromMetadata(nodes, cfg.OwnerID))
+	if err != nil {
+		return fmt.Errorf("failed to decode the desired endpoints: %w", err)
+	}
+	plans, err := provider.PlanDesired(ctx, cfg, backend, k8sClient, nodes, desired)
+	if err != nil {
+		return err
+	}
+
+	if output == outputJSON {
+		return writeJSON(out, plans)
+	}
+	return writePlansTable(out, plans)
+}
+
+// decodeDesired decodes the desired endpoints from a JSON array of endpoints, or applies the
+// ExternalDNS changes of a JSON object to the current endpoints, as ApplyChanges does.
+func decodeDesired(data []byte, current []*endpoint.Endpoint) ([]*endpoint.Endpoint, error) {
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("[")) {
+		var desired []*endpoint.Endpoint
+		if err := json.Unmarshal(data, &desired); err != nil {
+			return nil, err
+		}
+		return desired, nil
+	}
+
+	var changes plan.Changes
+	if err := json.Unmarshal(data, &changes); err != nil {
+		return nil, err
+	}
+	desired, _ := cern.DesiredEndpoints(current, &changes)
+	return desired, nil
+}
+
+// writePlansTable writes the plans as an aligned table, one metadata key per line.
+func writePlansTable(out io.Writer, plans []cern.NodePlan) error {
+	if len(plans) == 0 {
+		_, err := fmt.Fprintln(out, "No changes")
+		return err
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SERVER\tID\tCHANGE\tKEY\tVALUE")
+	for _, nodePlan := range plans {
+		keys := make([]string, 0, len(nodePlan.Update))
+		for key := range nodePlan.Update {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			fmt.Fprintf(w, "%s\t%s\tupdate\t%s\t%s\n", nodePlan.Server, nodePlan.ID, key, nodePlan.Update[key])
+		}
+		for _, key := range nodePlan.Delete {
+			fmt.Fprintf(w, "%s\t%s\tdelete\t%s\t\n", nodePlan.Server, nodePlan.ID, key)
+		}
+	}
+	return w.Flush()
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/cern"
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/k8s"
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/log"
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/version"
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/pkg/config"
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/provider"
+)
+
+// Checks run by the doctor command, in order.
+const (
+	doctorCheckConfiguration = "configuration"
+	doctorCheckKubernetesAPI = "kubernetes-api"
+	doctorCheckIngressNodes  = "ingress-nodes"
+	doctorCheckOpenStackAuth = "openstack-auth"
+	doctorCheckNovaList      = "nova-list"
+	doctorCheckMetadataWrite = "metadata-write"
+	doctorCheckLanDBAuth     = "landb-auth"
+)
+
+// Outcomes of a check of the doctor command.
+const (
+	doctorPass = "pass"
+	doctorFail = "fail"
+	doctorSkip = "skip"
+)
+
+// errDoctorFailed is returned by the doctor command when a check failed, after the report is printed.
+var errDoctorFailed = errors.New("some checks failed")
+
+// doctorCheck is the outcome of a single check of the doctor command.
+type doctorCheck struct {
+	// Name is the name of the check.
+	Name string `json:"name"`
+	// Status is pass, fail or skip.
+	Status string `json:"status"`
+	// Duration is how long the check took.
+	Duration string `json:"duration"`
+	// Detail is what the check found, the error of a failed check, or why it was skipped.
+	Detail string `json:"detail"`
+}
+
+// doctorReport is the outcome of the doctor command, meant to be attached to support tickets.
+type doctorReport struct {
+	// Version is the version of the webhook.
+	Version string `json:"version"`
+	// Checks holds the outcome of every check, in the order they ran.
+	Checks []doctorCheck `json:"checks"`
+}
+
+// run runs a check, recording its outcome and how long it took, and reports whether it passed.
+func (r *doctorReport) run(name string, check func() (string, error)) bool {
+	start := time.Now()
+	detail, err := check()
+	result := doctorCheck{Name: name, Status: doctorPass, Duration: time.Since(start).Round(time.Millisecond).String(), Detail: detail}
+	if err != nil {
+		result.Status, result.Detail = doctorFail, err.Error()
+	}
+	r.Checks = append(r.Checks, result)
+	return err == nil
+}
+
+// skip records a check that did not run, and why.
+func (r *doctorReport) skip(name, reason string) {
+	r.Checks = append(r.Checks, doctorCheck{Name: name, Status: doctorSkip, Duration: "0s", Detail: reason})
+}
+
+// failed reports whether a check failed.
+func (r *doctorReport) failed() bool {
+	for _, check := range r.Checks {
+		if check.Status == doctorFail {
+			return true
+		}
+	}
+	return false
+}
+
+// newDoctorCommand creates the doctor command, running a battery of checks of the configuration,
+// the credentials and the permissions of the webhook, and printing a pass/fail report, e.g. to
+// attach to a support ticket.
+//
+// The checks depending on a failed check are skipped, so that the report points at the root cause.
+func newDoctorCommand() *cobra.Command {
+	var output string
+	var timeout time.Duration
+	var skipWrite bool
+	cmd := &cobra.Command{
+		Use:   "doctor",
+		Short: "Check the configuration, credentials and permissions, and print a report",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			if output != outputTable && output != outputJSON {
+				return fmt.Errorf("invalid --output %q, expected %s or %s", output, outputTable, outputJSON)
+			}
+			report := runDoctor(cmd.Root().PersistentFlags(), timeout, skipWrite)
+			if err := writeDoctorReport(cmd.OutOrStdout(), report, output); err != nil {
+				return err
+			}
+			if report.failed() {
+				return errDoctorFailed
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVarP(&output, "output", "o", outputTable, "Output format of the report (table, json)")
+	registerFlagValues(cmd, "output", outputTable, outputJSON)
+	cmd.Flags().DurationVar(&timeout, "timeout", 30*time.Second, "Maximum duration of every check")
+	cmd.Flags().BoolVar(&skipWrite, "skip-write", false, "Skip the check writing and deleting the "+cern.CanaryMetadataKey+" metadata key on an ingress node")
+	return cmd
+}
+
+// runDoctor runs the checks on the configuration of the flags, logging to stderr, and returns
+// their report.
+func runDoctor(flags *pflag.FlagSet, timeout time.Duration, skipWrite bool) *doctorReport {
+	report := &doctorReport{Version: version.Get().String()}
+
+	var cfg *config.Config
+	var logger log.Logger
+	if !report.run(doctorCheckConfiguration, func() (string, error) {
+		var err error
+		if cfg, err = loadConfig(flags); err != nil {
+			return "", err
+		}
+		if logger, err = newLogger(cfg, os.Stderr); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("backend %s, owner %s, node discovery %s", cfg.Backend, cfg.OwnerID, cfg.NodeDiscovery), nil
+	}) {
+		for _, name := range []string{doctorCheckKubernetesAPI, doctorCheckIngressNodes, doctorCheckOpenStackAuth, doctorCheckNovaList, doctorCheckMetadataWrite} {
+			report.skip(name, "invalid configuration")
+		}
+		return report
+	}
+
+	check := func(name string, fn func(ctx context.Context) (string, error)) bool {
+		return report.run(name, func() (string, error) {
+			ctx, cancel := context.WithTimeout(log.NewContext(context.Background(), logger), timeout)
+			defer cancel()
+			return fn(ctx)
+		})
+	}
+
+	var k8sClient *k8s.Client
+	kubernetesOK := check(doctorCheckKubernetesAPI, func(ctx context.Context) (string, error) {
+		var err error
+		if k8sClient, err = k8s.NewClient(cfg); err != nil {
+			return "", fmt.Errorf("failed to create Kubernetes client: %w", err)
+		}
+		if err := k8sClient.Reachable(ctx); err != nil {
+			return "", err
+		}
+		return "the nodes may be listed", nil
+	})
+	if kubernetesOK {
+		check(doctorCheckIngressNodes, func(ctx context.Context) (string, error) {
+			nodes, err := k8sClient.GetIngressNodes(ctx, cfg.IngressLabels)
+			if err != nil {
+				return "", fmt.Errorf("failed to get ingress nodes: %w", err)
+			}
+			if len(nodes) == 0 {
+				return "", fmt.Errorf("no node matches --ingress-label %s with the %s node discovery", strings.Join(cfg.IngressLabels, " or "), cfg.NodeDiscovery)
+			}
+			return fmt.Sprintf("%d nodes match --ingress-label %s", len(nodes), strings.Join(cfg.IngressLabels, " or ")), nil
+		})
+	} else {
+		report.skip(doctorCheckIngressNodes, "Kubernetes API unavailable")
+	}
+
+	if cern.NeedsLanDB(cfg) {
+		check(doctorCheckLanDBAuth, func(ctx context.Context) (string, error) {
+			if _, err := cern.NewLanDBClient(ctx, cfg); err != nil {
+				return "", err
+			}
+			return "authenticated to " + cfg.LanDBURL, nil
+		})
+	}
+	if cfg.Backend == cern.BackendLanDB {
+		for _, name := range []string{doctorCheckOpenStackAuth, doctorCheckNovaList, doctorCheckMetadataWrite} {
+			report.skip(name, "not used by the landb backend")
+		}
+		return report
+	}
+
+	var client *cern.Client
+	if !check(doctorCheckOpenStackAuth, func(ctx context.Context) (string, error) {
+		var err error
+		if client, err = provider.NewOpenStackClient(ctx, cfg); err != nil {
+			return "", err
+		}
+		if err := client.CheckAuth(ctx); err != nil {
+			return "", err
+		}
+		if cfg.Backend == cern.BackendFake {
+			return "in-memory servers of the fake backend", nil
+		}
+		return fmt.Sprintf("authenticated to %s with the %s auth type", cfg.OpenStackAuthURL, cfg.OpenStackAuthType), nil
+	}) {
+		report.skip(doctorCheckNovaList, "OpenStack authentication failed")
+		report.skip(doctorCheckMetadataWrite, "OpenStack authentication failed")
+		return report
+	}
+
+	manager := cern.NewManager(client, k8sClient, cfg, logger)
+	check(doctorCheckNovaList, func(ctx context.Context) (string, error) {
+		start := time.Now()
+		count, err := manager.CheckListServers(ctx)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%d servers listed in %s", count, time.Since(start).Round(time.Millisecond)), nil
+	})
+
+	switch {
+	case skipWrite:
+		report.skip(doctorCheckMetadataWrite, "--skip-write")
+	case cfg.DryRun:
+		report.skip(doctorCheckMetadataWrite, "--dry-run")
+	case !kubernetesOK:
+		report.skip(doctorCheckMetadataWrite, "Kubernetes API unavailable")
+	default:
+		check(doctorCheckMetadataWrite, func(ctx context.Context) (string, error) {
+			nodes, err := manager.GetIngressNodes(ctx, cfg.IngressLabels)
+			if err != nil {
+				return "", fmt.Errorf("failed to get ingress nodes: %w", err)
+			}
+			if len(nodes) == 0 {
+				return "", errors.New("no ingress node matches an OpenStack server")
+			}
+			if err := manager.CheckMetadataWrite(ctx, nodes[0].ID); err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("%s written and deleted on server %s", cern.CanaryMetadataKey, nodes[0].Name), nil
+		})
+	}
+	return report
+}
+
+// writeDoctorReport writes the report to out in the given output format.
+func writeDoctorReport(out io.Writer, report *doctorReport, output string) error {
+	if output == outputJSON {
+		return writeJSON(out, report)
+	}
+
+	if _, err := fmt.Fprintf(out, "Webhook %s\n\n", report.Version); err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "CHECK\tSTATUS\tDURATION\tDETAIL")
+	for _, check := range report.Checks {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", check.Name, strings.ToUpper(check.Status), check.Duration, check.Detail)
+	}
+	return w.Flush()
+}
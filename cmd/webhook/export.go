@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/log"
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/pkg/config"
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/provider"
+	"sigs.k8s.io/yaml"
+)
+
+// newExportCommand creates the export command, dumping the managed aliases of the ingress nodes,
+// with the nodes carrying them and the persisted desired endpoints, as YAML.
+func newExportCommand() *cobra.Command {
+	var file string
+	cmd := &cobra.Command{
+		Use:   "export",
+		Short: "Export the managed aliases to a YAML file",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			cfg, err := commandConfig(cmd)
+			if err != nil {
+				return err
+			}
+			return exportAliases(cmd.OutOrStdout(), cfg, file)
+		},
+	}
+	cmd.Flags().StringVarP(&file, "file", "f", "-", "File the aliases are exported to, - for stdout")
+	return cmd
+}
+
+// exportAliases writes the export of the aliases to file, or to out when file is -, logging to
+// stderr.
+func exportAliases(out io.Writer, cfg *config.Config, file string) error {
+	ctx, backend, k8sClient, err := commandBackend(cfg)
+	if err != nil {
+		return err
+	}
+	nodes, err := backend.GetIngressNodes(ctx, cfg.IngressLabels)
+	if err != nil {
+		return fmt.Errorf("failed to get ingress nodes: %w", err)
+	}
+	export, err := provider.NewExport(ctx, cfg, k8sClient, nodes)
+	if err != nil {
+		return err
+	}
+
+	data, err := yaml.Marshal(export)
+	if err != nil {
+		return fmt.Errorf("failed to encode the export: %w", err)
+	}
+	if file == "-" {
+		_, err = out.Write(data)
+		return err
+	}
+	if err := os.WriteFile(file, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write %s: %w", file, err)
+	}
+	log.FromContext(ctx).Info("Exported %d records to %s", len(export.Records), file)
+	return nil
+}
+
+// newImportCommand creates the import command, bringing the ingress nodes to the aliases of a file
+// written by export. The aliases missing from the file are removed.
+//
+// The planned changes are printed, and only applied with --confirm.
+func newImportCommand() *cobra.Command {
+	var file string
+	var confirm bool
+	cmd := &cobra.Command{
+		Use:   "import",
+		Short: "Apply the aliases of a file written by export",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			cfg, err := commandConfig(cmd)
+			if err != nil {
+				return err
+			}
+			data, err := readInput(cmd.InOrStdin(), file)
+			if err != nil {
+				return err
+			}
+			var export provider.Export
+			if err := yaml.UnmarshalStrict(data, &export); err != nil {
+				return fmt.Errorf("failed to decode %s: %w", file, err)
+			}
+			return importAliases(cmd.OutOrStdout(), cfg, &export, confirm)
+		},
+	}
+	cmd.Flags().StringVarP(&file, "file", "f", "", "File written by export to import, - for stdin")
+	cmd.Flags().BoolVar(&confirm, "confirm", false, "Apply the printed changes, which are only planned without it")
+	_ = cmd.MarkFlagRequired("file")
+	return cmd
+}
+
+// importAliases prints the changes bringing the ingress nodes to the exported aliases to out, and
+// applies them when confirmed, logging to stderr.
+func importAliases(out io.Writer, cfg *config.Config, export *provider.Export, confirm bool) error {
+	ctx, backend, k8sClient, err := commandBackend(cfg)
+	if err != nil {
+		return err
+	}
+	if export.Owner != cfg.OwnerID {
+		log.FromContext(ctx).Warn("Importing the aliases exported by owner %q as owner %q", export.Owner, cfg.OwnerID)
+	}
+	nodes, err := backend.GetIngressNodes(ctx, cfg.IngressLabels)
+	if err != nil {
+		return fmt.Errorf("failed to get ingress nodes: %w", err)
+	}
+
+	desired := export.DesiredEndpoints()
+	plans, err := provider.PlanDesired(ctx, cfg, backend, k8sClient, nodes, desired)
+	if err != nil {
+		return err
+	}
+	if err := writePlansTable(out, plans); err != nil {
+		return err
+	}
+	if len(plans) == 0 {
+		return nil
+	}
+
+	switch {
+	case !confirm:
+		return fmt.Errorf("refusing to import %d endpoints on %d nodes without --confirm", len(desired), len(plans))
+	case cfg.DryRun:
+		_, err := fmt.Fprintln(out, "Dry run, no changes applied")
+		return err
+	}
+	if err := provider.SyncDesired(ctx, cfg, backend, k8sClient, nodes, desired); err != nil {
+		return fmt.Errorf("failed to import the aliases: %w", err)
+	}
+	_, err = fmt.Fprintf(out, "Imported %d endpoints on %d nodes\n", len(desired), len(plans))
+	return err
+}
@@ -8,67 +8,149 @@
 package main
 
 import (
+	"context"
+	"fmt"
+	"io"
 	"os"
 
+	"github.com/spf13/pflag"
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/cern"
 	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/log"
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/security"
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/tracing"
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/version"
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/pkg/config"
 	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/pkg/webhook"
 	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/provider"
 )
 
 // main is the entry point of the application.
 //
+// It runs the command named by the arguments, see newRootCommand, serving the webhook by default.
+func main() {
+	if err := newRootCommand().Execute(); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+}
+
+// serve runs the webhook server with the configuration of the parsed flags, until the application
+// is terminated.
+//
 // It performs the following steps:
 //  1. Loads the application configuration from command-line flags and environment variables.
 //     This is a critical first step as it dictates the behavior of the entire application.
 //     If configuration loading fails, the application will exit with a non-zero status code.
-//  2. Sets up the global logger with the log level specified in the configuration.
+//  2. Sets up the logger with the log level specified in the configuration.
 //     This ensures that all subsequent log messages are filtered and formatted correctly.
 //     A default logger is used for logging configuration errors that occur before the
 //     final logger is configured.
-//  3. Creates a new provider instance, passing in the loaded configuration.
+//  3. Creates a new provider instance, passing in the loaded configuration and the logger.
 //     The provider is responsible for the business logic of interacting with the
 //     CERN Cloud DNS service.
-//  4. Creates a new webhook server, passing in the provider and configuration.
+//  4. Creates a new webhook server, passing in the provider, configuration and logger.
 //     The server is responsible for handling HTTP requests from ExternalDNS and
 //     delegating them to the provider.
 //  5. Starts the webhook server, which begins listening for incoming requests.
 //     This is a blocking call, and the application will continue to run until the
 //     server is stopped.
-func main() {
+func serve(flags *pflag.FlagSet) {
 	// Load configuration from flags and environment variables.
 	// We use a dedicated configuration package to keep this logic separate from the main application logic.
 	// This makes it easier to manage configuration and add new options in the future.
-	cfg, err := loadConfig()
+	cfg, err := loadConfig(flags)
 	if err != nil {
 		// If configuration loading fails, we need to log the error and exit.
-		// Since the global logger is not yet configured, we create a temporary one with the default log level.
-		log.GlobalLogger = log.NewLogger(log.DefaultLogLevel)
-		log.GlobalLogger.Error("failed to load configuration: %v", err)
+		// Since the logger is not yet configured, we create a temporary one with the default log level.
+		log.NewLogger(log.DefaultLogLevel).Error("failed to load configuration: %v", err)
 		os.Exit(1)
 	}
 
-	// Set up the global logger based on the configured log level.
-	// The log level is parsed from a string to a log.Level type.
-	// If the log level is invalid, a warning is logged, and the default log level is used.
-	logLevel, ok := log.LevelFromString(cfg.LogLevel)
-	if !ok {
-		log.GlobalLogger = log.NewLogger(log.DefaultLogLevel)
-		log.GlobalLogger.Warn("invalid log level '%s', using default '%s'", cfg.LogLevel, log.LevelNames[log.DefaultLogLevel])
-		logLevel = log.DefaultLogLevel
+	logger, err := newLogger(cfg, nil)
+	if err != nil {
+		log.NewLogger(log.DefaultLogLevel).Error("%v", err)
+		os.Exit(1)
+	}
+	// The global logger is only the fallback of the contexts carrying no logger.
+	log.GlobalLogger = logger
+	logger.Info("Starting the CERN Cloud webhook %s", version.Get())
+
+	// Run the security self-checks, refusing to start on any finding in strict mode.
+	if cfg.SecurityChecks != security.ModeOff {
+		findings := security.Check(cfg)
+		for _, finding := range findings {
+			logger.Warn("Security check: %s", finding)
+		}
+		if cfg.SecurityChecks == security.ModeStrict && len(findings) > 0 {
+			logger.Error("refusing to start: %d security checks failed in strict mode", len(findings))
+			os.Exit(1)
+		}
+	}
+
+	// Set up the export of the traces, if configured. The pending spans are flushed when main returns.
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Options{
+		Endpoint:    cfg.TracingEndpoint,
+		SampleRatio: cfg.TracingSampleRatio,
+	})
+	if err != nil {
+		logger.Error("failed to set up tracing: %v", err)
+		os.Exit(1)
 	}
-	log.GlobalLogger = log.NewLogger(logLevel)
+	defer func() {
+		if err := shutdownTracing(context.Background()); err != nil {
+			logger.Error("failed to flush the traces: %v", err)
+		}
+	}()
 
 	// Create a new provider instance.
 	// The provider encapsulates the logic for interacting with the CERN Cloud DNS service.
 	// It is initialized with the application configuration, which it uses to configure its own behavior.
-	p := provider.NewProvider(cfg)
+	p := provider.NewProvider(cfg, logger)
 
 	// Create a new webhook server.
 	// The server is responsible for handling HTTP requests from ExternalDNS.
 	// It is initialized with the provider and the application configuration.
-	srv := webhook.NewServer(p, cfg)
+	srv := webhook.NewServer(p, cfg, logger)
 
 	// Start the webhook server.
 	// This is a blocking call that will run until the application is terminated.
 	srv.Run()
 }
+
+// newLogger sets up the logger from the configuration, writing to output, os.Stdout if nil, unless
+// a log file or syslog is configured.
+func newLogger(cfg *config.Config, output io.Writer) (log.Logger, error) {
+	// The log level is parsed from a string to a log.Level type.
+	// If the log level is invalid, a warning is logged, and the default log level is used.
+	logLevel, ok := log.LevelFromString(cfg.LogLevel)
+	if !ok {
+		log.NewLogger(log.DefaultLogLevel).Warn("invalid log level '%s', using default '%s'", cfg.LogLevel, log.LevelNames[log.DefaultLogLevel])
+		logLevel = log.DefaultLogLevel
+	}
+	// The output format is validated with the rest of the configuration.
+	logFormat, _ := log.FormatFromString(cfg.LogFormat)
+	// The configured credentials are scrubbed from every message, should one end up in a debug log,
+	// including the ones read from files. The rotated ones are added as they are read.
+	secrets := []string{cfg.OpenStackPassword, cfg.OpenStackAccessToken, cfg.LanDBPassword, cfg.DebugToken}
+	secrets = append(secrets, cern.CredentialSecrets(cfg)...)
+	// The color mode is validated with the rest of the configuration.
+	logColor, _ := log.ColorModeFromString(cfg.LogColor)
+	opts := log.Options{Level: logLevel, Format: logFormat, Color: logColor, Caller: cfg.LogCaller, Secrets: secrets, Output: output}
+	if cfg.LogFile != "" {
+		opts.Output = log.NewFileWriter(log.FileOptions{
+			Path:       cfg.LogFile,
+			MaxSize:    cfg.LogFileMaxSize,
+			MaxAge:     cfg.LogFileMaxAge,
+			MaxBackups: cfg.LogFileMaxBackups,
+			Compress:   cfg.LogFileCompress,
+		})
+	}
+	if cfg.LogSyslog {
+		out, err := log.NewSyslogWriter(cfg.LogSyslogTag, logFormat)
+		if err != nil {
+			return nil, fmt.Errorf("failed to set up the syslog output: %w", err)
+		}
+		opts.Output = out
+	}
+	return log.NewLoggerWithOptions(opts), nil
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/spf13/cobra"
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/cern"
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/pkg/config"
+)
+
+// newMigrateCommand creates the migrate command, rewriting the aliases the ingress nodes carry in
+// older or hand-maintained formats into the canonical format of the webhook, e.g. when adopting a
+// cluster whose aliases were managed by scripts.
+func newMigrateCommand() *cobra.Command {
+	var output string
+	cmd := &cobra.Command{
+		Use:   "migrate",
+		Short: "Rewrite the aliases of legacy formats into the canonical format",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			if output != outputTable && output != outputJSON {
+				return fmt.Errorf("invalid --output %q, expected %s or %s", output, outputTable, outputJSON)
+			}
+			cfg, err := commandConfig(cmd)
+			if err != nil {
+				return err
+			}
+			return migrate(cmd.OutOrStdout(), cfg, output)
+		},
+	}
+	cmd.Flags().StringVarP(&output, "output", "o", outputTable, "Output format of the changes (table, json)")
+	registerFlagValues(cmd, "output", outputTable, outputJSON)
+	return cmd
+}
+
+// migrate rewrites the aliases of the ingress nodes into the canonical format, unless in dry-run
+// mode, and prints the changes to out in the given output format, logging to stderr.
+func migrate(out io.Writer, cfg *config.Config, output string) error {
+	ctx, backend, _, err := commandBackend(cfg)
+	if err != nil {
+		return err
+	}
+	manager, ok := backend.(*cern.Manager)
+	if !ok {
+		return fmt.Errorf("migrate only supports the %s backend, LanDB aliases have no metadata format", cern.BackendNova)
+	}
+	nodes, err := manager.GetIngressNodes(ctx, cfg.IngressLabels)
+	if err != nil {
+		return fmt.Errorf("failed to get ingress nodes: %w", err)
+	}
+
+	plans, migrateErr := manager.Migrate(ctx, nodes, cfg.DryRun)
+	if output == outputJSON {
+		err = writeJSON(out, plans)
+	} else {
+		err = writePlansTable(out, plans)
+	}
+	if err != nil {
+		return err
+	}
+	if migrateErr != nil {
+		return fmt.Errorf("failed to migrate the ingress nodes: %w", migrateErr)
+	}
+	if cfg.DryRun && len(plans) > 0 && output != outputJSON {
+		_, err = fmt.Fprintln(out, "Dry run, no changes applied")
+	}
+	return err
+}
@@ -3,51 +3,186 @@ package main
 
 import (
 	"fmt"
+	"net/url"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/cern"
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/k8s"
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/log"
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/security"
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/tlsconfig"
 	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/pkg/config"
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/provider"
+	"k8s.io/apimachinery/pkg/labels"
 )
 
 const (
-	OpenStackAuthURL         = "os-auth-url"
-	OpenStackProjectName     = "os-project-name"
-	OpenStackUserDomainName  = "os-user-domain-name"
-	OpenStackProjectDomainID = "os-project-domain-id"
-	OpenStackUsername        = "os-username"
-	OpenStackPassword        = "os-password"
-	OpenStackRegionName      = "os-region-name"
+	OpenStackAuthURL           = "os-auth-url"
+	OpenStackProjectName       = "os-project-name"
+	OpenStackUserDomainName    = "os-user-domain-name"
+	OpenStackProjectDomainID   = "os-project-domain-id"
+	OpenStackUsername          = "os-username"
+	OpenStackPassword          = "os-password"
+	OpenStackPasswordFile      = "os-password-file"
+	OpenStackRegionName        = "os-region-name"
+	OpenStackAuthType          = "os-auth-type"
+	OpenStackKeytab            = "os-keytab"
+	OpenStackKerberosPrincipal = "os-kerberos-principal"
+	OpenStackKrb5Config        = "os-krb5-config"
+	OpenStackIdentityProvider  = "os-identity-provider"
+	OpenStackProtocol          = "os-protocol"
+	OpenStackAccessToken       = "os-access-token"
+	OpenStackAccessTokenFile   = "os-access-token-file"
+	OpenStackComputeAPIVersion = "os-compute-api-version"
+	OpenStackCAFile            = "os-ca-file"
+	OpenStackInsecure          = "os-insecure-skip-verify"
+	Backend                    = "backend"
+	LanDBURL                   = "landb-url"
+	LanDBUsername              = "landb-username"
+	LanDBPassword              = "landb-password"
 )
 
+// addConfigFlags defines the flags of the configuration on the given flag set.
+//
+// Each flag is defined with a name, a default value, and a description.
+// The descriptions are used to generate the help text for the application.
+func addConfigFlags(flags *pflag.FlagSet) {
+	flags.String("listen-address", "0.0.0.0", "The IP address to listen on")
+	flags.Int("listen-port", 8888, "The port to listen on")
+	flags.Int("health-listen-port", 0, "Port of a separate listener for the health, metrics and debug endpoints (default: served on --listen-port)")
+	flags.String("debug-token", "", "Bearer token protecting the /debug/loglevel endpoint, which is disabled when empty")
+	flags.String("oidc-issuer-url", "", "URL of the OIDC issuer whose bearer tokens the requests to the webhook API must carry, e.g. the Kubernetes service account issuer (default: no authentication)")
+	flags.String("oidc-audience", "", "Audience the OIDC tokens must be intended for")
+	flags.StringSlice("oidc-subjects", nil, "Subjects whose OIDC tokens are accepted, e.g. system:serviceaccount:external-dns:external-dns (default: any)")
+	flags.String("oidc-ca-file", "", "CA certificates of the OIDC issuer (default: the system ones)")
+	flags.String("tls-min-version", tlsconfig.Version12, "Minimum TLS version of the connections to OpenStack, LanDB and the OIDC issuer (1.2, 1.3)")
+	flags.StringSlice("tls-cipher-suites", nil, "TLS 1.2 cipher suites of the connections to OpenStack, LanDB and the OIDC issuer, by IANA name (default: those of --tls-profile)")
+	flags.String("tls-profile", tlsconfig.ProfileDefault, "TLS profile of the connections to OpenStack, LanDB and the OIDC issuer (default, strict for the FIPS-approved cipher suites and curves)")
+	flags.String("security-checks", security.ModeWarn, "What the security self-checks do on startup (off, warn, strict to refuse to start when they find anything)")
+	flags.Bool("allow-root", false, "Allow running as root without the security self-checks reporting it")
+	flags.String("log-level", "info", "Log level (trace, debug, info, warn, error)")
+	flags.String("log-format", string(log.DefaultFormat), "Log output format (console, json)")
+	flags.String("log-color", string(log.ColorAuto), "When the console log format uses colors (auto, always, never); auto disables them when not writing to a terminal or when NO_COLOR is set")
+	flags.Bool("log-caller", false, "Add the file and line of the code logging every message")
+	flags.Int("log-sampling", 1, "Log only 1 in N requests to the endpoints polled by ExternalDNS and the probes below the warning level (1 logs every request)")
+	flags.String("log-file", "", "File the logs are written to, with size and age based rotation (default: stdout)")
+	flags.Bool("log-syslog", false, "Send the logs to the local syslog daemon or journald instead of stdout")
+	flags.String("log-syslog-tag", log.DefaultSyslogTag, "Tag of the logs sent to syslog")
+	flags.Int("log-file-max-size", 100, "Size in megabytes at which the log file is rotated")
+	flags.Duration("log-file-max-age", 7*24*time.Hour, "How long rotated log files are kept, rounded up to whole days (0 keeps them forever)")
+	flags.Int("log-file-max-backups", 5, "Number of rotated log files kept (0 keeps them all)")
+	flags.Bool("log-file-compress", false, "Compress the rotated log files with gzip")
+	flags.StringSlice("health-critical", provider.DefaultHealthCritical, "Components whose failure fails /healthz, the others only degrading it ("+strings.Join(provider.HealthComponents, ", ")+")")
+	flags.Duration("health-max-cache-age", 10*time.Minute, "How old the last listing of the OpenStack servers may get before the cache component fails (0 disables the check)")
+	flags.String("tracing-endpoint", "", "URL of the OTLP/HTTP endpoint the traces are exported to, e.g. http://otel-collector:4318 (default: tracing disabled)")
+	flags.Float64("tracing-sample-ratio", 1, "Fraction of the traces started by the webhook that are exported, between 0 and 1")
+	flags.String(Backend, cern.BackendNova, "Where aliases are stored (nova, landb, fake)")
+	flags.String("fake-fixture", "", "YAML file of the Kubernetes objects seeding the fake backend, whose Nodes define the in-memory servers")
+	flags.String("baremetal-backend", cern.BackendNova, "Where the aliases of Ironic bare-metal nodes are stored with the nova backend (nova, landb)")
+	flags.StringSlice("baremetal-flavors", []string{}, "Flavor names of bare-metal nodes, when flavor extra specs are not visible")
+	flags.String(LanDBURL, "https://network.cern.ch/sc/soap/soap.fcgi?v=6", "LanDB SOAP API URL for the landb backend")
+	flags.String("landb-interface", "", "LanDB interface carrying the aliases, {device} is replaced by the device name (default: the interface named after the device)")
+	flags.String(LanDBUsername, "", "LanDB Username for the landb backend")
+	flags.String(LanDBPassword, "", "LanDB Password for the landb backend")
+	flags.String(OpenStackAuthURL, "", "OpenStack Auth URL")
+	flags.String(OpenStackProjectName, "", "OpenStack Project Name")
+	flags.String(OpenStackUserDomainName, "", "OpenStack User Domain Name")
+	flags.String(OpenStackProjectDomainID, "", "OpenStack Project Domain ID")
+	flags.String(OpenStackUsername, "", "OpenStack Username")
+	flags.String(OpenStackPassword, "", "OpenStack Password")
+	flags.String(OpenStackPasswordFile, "", "File containing the OpenStack Password, watched for rotations")
+	flags.String(OpenStackRegionName, "", "OpenStack Region Name")
+	flags.StringSlice("os-failover-auth-urls", nil, "OpenStack Auth URLs tried in order when the primary one is unavailable")
+	flags.StringSlice("os-failover-regions", nil, "OpenStack regions tried in order when the primary one is unavailable")
+	flags.String(OpenStackAuthType, cern.AuthTypePassword, "OpenStack auth type (password, v3kerberos, v3oidcaccesstoken)")
+	flags.String(OpenStackKeytab, "", "Kerberos keytab for the v3kerberos auth type")
+	flags.String(OpenStackKerberosPrincipal, "", "Kerberos principal (user@REALM) for the v3kerberos auth type")
+	flags.String(OpenStackKrb5Config, "/etc/krb5.conf", "Kerberos configuration file")
+	flags.String(OpenStackIdentityProvider, "sssd", "Keystone federation identity provider for federated auth types")
+	flags.String(OpenStackProtocol, "kerberos", "Keystone federation protocol for federated auth types")
+	flags.String(OpenStackAccessToken, "", "OIDC access token for the v3oidcaccesstoken auth type")
+	flags.String(OpenStackAccessTokenFile, "", "File containing the OIDC access token for the v3oidcaccesstoken auth type")
+	flags.String(OpenStackComputeAPIVersion, cern.DefaultComputeMicroversion, "Compute API microversion to pin, or latest")
+	flags.String(OpenStackCAFile, "", "CA certificates of the OpenStack APIs (default: the system ones)")
+	flags.Bool(OpenStackInsecure, false, "Skip the verification of the TLS certificates of the OpenStack APIs, reported by the security self-checks")
+	flags.Bool("dry-run", false, "Run in dry-run mode")
+	flags.StringArray("ingress-label", []string{"node-role.kubernetes.io/ingress"}, "Kubernetes label selector of the ingress nodes, e.g. role=ingress,zone in (a,b); repeat to include the nodes matching any of several selectors")
+	flags.String("node-discovery", k8s.DiscoveryLabel, "How ingress nodes are discovered among the labeled nodes (label, service, endpointslice, workload)")
+	flags.String("node-address-type", k8s.AddressTypeAuto, "Node address reported as the target of the aliases (ExternalIP, InternalIP, auto to prefer ExternalIP)")
+	flags.String("ingress-service", "", "namespace/name of the ingress controller Service for the service and endpointslice node discoveries")
+	flags.String("ingress-workload", "", "namespace/kind/name of the ingress controller DaemonSet or Deployment for the workload node discovery, e.g. ingress-nginx/daemonset/ingress-nginx-controller")
+	flags.String("kube-backend", k8s.KubeBackendCluster, "Kubernetes backend: cluster, or fake to serve static objects for local development")
+	flags.String("kube-fake-objects", "", "YAML file of the Nodes (and other objects) served by the fake Kubernetes backend")
+	flags.Float32("kube-api-qps", 5, "Maximum rate of Kubernetes API requests per second")
+	flags.Int("kube-api-burst", 10, "Number of Kubernetes API requests allowed above --kube-api-qps in bursts")
+	flags.Bool("require-node-ready", true, "Exclude ingress nodes whose Ready condition is not True")
+	flags.Bool("exclude-unschedulable-nodes", true, "Exclude cordoned ingress nodes")
+	flags.Bool("honor-exclude-from-load-balancers", true, "Exclude ingress nodes labeled or annotated with node.kubernetes.io/exclude-from-external-load-balancers")
+	flags.StringSlice("domain-filter", []string{}, "Filter domains")
+	flags.StringSlice("exclude-domains", []string{}, "Exclude domains")
+	flags.String("txt-prefix", "", "TXT record prefix")
+	flags.String("txt-suffix", "", "TXT record suffix")
+	flags.StringSlice("server-statuses", cern.DefaultServerStatuses, "OpenStack server statuses accepted for ingress nodes")
+	flags.Duration("server-cache-ttl", 30*time.Second, "How long to cache the OpenStack server listing (0 disables the cache)")
+	flags.Bool("warm-up", false, "List the ingress nodes and servers at startup, failing /readyz until done, so the first sync after a restart finds warm caches")
+	flags.Duration("warm-up-timeout", 2*time.Minute, "How long the startup warm-up is retried before the webhook becomes ready anyway")
+	flags.Duration("snapshot-ttl", 10*time.Second, "How long the ingress nodes read by Records are reused by the following ApplyChanges (0 disables the snapshot)")
+	flags.Int("retry-max-attempts", 4, "Total attempts for OpenStack operations failing with transient errors")
+	flags.Duration("retry-initial-backoff", 500*time.Millisecond, "Maximum delay before the first retry of an OpenStack operation")
+	flags.Duration("retry-max-backoff", 10*time.Second, "Maximum delay between two attempts of an OpenStack operation")
+	flags.String("os-cassette", "", "YAML file the OpenStack API interactions are recorded to or replayed from, e.g. to capture responses for tests")
+	flags.String("os-cassette-mode", cern.CassetteOff, "Whether the OpenStack API interactions are recorded to or replayed from --os-cassette (off, record, replay)")
+	flags.Float64("api-rate-limit", 10, "Maximum OpenStack API requests per second (0 disables the limit)")
+	flags.Int("api-rate-burst", 20, "OpenStack API requests allowed above the rate limit in a burst")
+	flags.Int("sync-concurrency", 4, "Maximum number of ingress nodes updated in parallel")
+	flags.Bool("rollback-on-failure", true, "Restore the previous metadata of updated nodes when a sync fails halfway")
+	flags.Int("metadata-replace-threshold", 3, "Number of per-key Nova calls from which a node's metadata is replaced in a single call (0 disables)")
+	flags.Int("metadata-max-items", 128, "Maximum number of metadata items of a server allowed by the Nova quota, the capacity the metadata utilization is reported against")
+	flags.Int("write-verify-attempts", 2, "Number of times a node's metadata is read back after a write and corrected if it does not match (0 disables)")
+	flags.String("owner-id", "default", "Identifier of this webhook instance written to the managed servers")
+	flags.String("orphan-scan", cern.OrphanScanOff, "Handling of owned aliases left on non-ingress servers (off, report, repair)")
+	flags.Bool("verify-propagation", false, "Check that applied changes show up in DNS")
+	flags.StringSlice("dns-servers", []string{"137.138.16.5:53", "137.138.17.5:53"}, "DNS servers (host:port) queried to verify propagation")
+	flags.Duration("propagation-timeout", 15*time.Minute, "How long to wait for changes to show up in DNS")
+	flags.Duration("propagation-interval", 30*time.Second, "Delay between two DNS lookups while verifying propagation")
+	flags.Bool("leader-elect", false, "Elect a leader among the replicas through a Lease, only the leader writes to OpenStack")
+	flags.String("leader-elect-namespace", "default", "Namespace of the leader election Lease")
+	flags.String("leader-elect-lease-name", "external-dns-cern-webhook", "Name of the leader election Lease")
+	flags.Bool("standalone", false, "Reconcile the aliases against the DNSEndpoint resources directly, without ExternalDNS")
+	flags.Duration("standalone-resync-interval", time.Minute, "Delay between two reconciliations in standalone mode, on top of the ones triggered by DNSEndpoint changes")
+	flags.Bool("cern-alias-crd", false, "Apply the per-alias settings declared by CernAlias resources (requires the CRD)")
+	flags.String("state-configmap", "", "namespace/name of the ConfigMap persisting the last applied state across restarts (disabled if empty)")
+	flags.Bool("events", true, "Emit Kubernetes Events summarizing the outcome of every sync")
+	flags.String("event-object", "", "namespace/kind/name of the Pod, DaemonSet or Deployment the Events are emitted on, defaults to the webhook's own Pod")
+	flags.Bool("node-event-sync", true, "Reconcile the aliases as soon as ingress nodes are added, removed or relabeled")
+	flags.Duration("node-event-debounce", 5*time.Second, "How long node events must settle before a reconciliation")
+	flags.Duration("auth-check-interval", 5*time.Minute, "Delay between two checks of the OpenStack credentials backing /readyz (0 to disable)")
+	flags.StringSlice("protected-aliases", []string{}, "DNS names or /regex/ patterns that are never deleted")
+
+	// The failure injection flags are meant for staging environments only, and hidden from the help.
+	flags.Float64("chaos-nova-error-rate", 0, "Fraction of the OpenStack API requests failed with a 503, between 0 and 1")
+	flags.Duration("chaos-nova-latency", 0, "Maximum random delay added to every OpenStack API request")
+	flags.Float64("chaos-k8s-error-rate", 0, "Fraction of the Kubernetes API requests failed, between 0 and 1")
+	flags.Duration("chaos-k8s-latency", 0, "Maximum random delay added to every Kubernetes API request")
+	for _, name := range []string{"chaos-nova-error-rate", "chaos-nova-latency", "chaos-k8s-error-rate", "chaos-k8s-latency"} {
+		// Hiding fails only for unknown flags, a programming error.
+		if err := flags.MarkHidden(name); err != nil {
+			panic(fmt.Sprintf("failed to hide --%s: %v", name, err))
+		}
+	}
+}
+
 // loadConfig initializes and returns the application's configuration.
 //
-// This function is responsible for defining all command-line flags, setting up viper
-// to read from environment variables, and then populating the config.Config struct.
+// This function is responsible for setting up viper to read the parsed flags, defined by
+// addConfigFlags, and the environment variables, and then populating the config.Config struct.
 // This approach centralizes all command-line and environment variable handling in the
 // cmd package, cleanly separating it from the application's core configuration definition.
-func loadConfig() (*config.Config, error) {
-	// Define command-line flags using the pflag library.
-	// Each flag is defined with a name, a default value, and a description.
-	// The descriptions are used to generate the help text for the application.
-	pflag.String("listen-address", "0.0.0.0", "The IP address to listen on")
-	pflag.Int("listen-port", 8888, "The port to listen on")
-	pflag.String("log-level", "info", "Log level (debug, info, warn, error)")
-	pflag.String(OpenStackAuthURL, "", "OpenStack Auth URL")
-	pflag.String(OpenStackProjectName, "", "OpenStack Project Name")
-	pflag.String(OpenStackUserDomainName, "", "OpenStack User Domain Name")
-	pflag.String(OpenStackProjectDomainID, "", "OpenStack Project Domain ID")
-	pflag.String(OpenStackUsername, "", "OpenStack Username")
-	pflag.String(OpenStackPassword, "", "OpenStack Password")
-	pflag.String(OpenStackRegionName, "", "OpenStack Region Name")
-	pflag.Bool("dry-run", false, "Run in dry-run mode")
-	pflag.String("ingress-label", "node-role.kubernetes.io/ingress", "Label to filter ingress nodes")
-	pflag.StringSlice("domain-filter", []string{}, "Filter domains")
-	pflag.StringSlice("exclude-domains", []string{}, "Exclude domains")
-	pflag.String("txt-prefix", "", "TXT record prefix")
-	pflag.String("txt-suffix", "", "TXT record suffix")
-	pflag.Parse()
-
+func loadConfig(flags *pflag.FlagSet) (*config.Config, error) {
 	// Initialize viper to manage configuration.
 	// Viper is a powerful library that can read configuration from various sources,
 	// including environment variables, config files, and remote key-value stores.
@@ -62,7 +197,7 @@ func loadConfig() (*config.Config, error) {
 	// Bind the pflag command-line flags to viper.
 	// This allows viper to read the values of the flags and makes them available
 	// through the viper interface.
-	if err := v.BindPFlags(pflag.CommandLine); err != nil {
+	if err := v.BindPFlags(flags); err != nil {
 		return nil, err
 	}
 
@@ -76,7 +211,19 @@ func loadConfig() (*config.Config, error) {
 		OpenStackProjectDomainID,
 		OpenStackUsername,
 		OpenStackPassword,
+		OpenStackPasswordFile,
 		OpenStackRegionName,
+		OpenStackAuthType,
+		OpenStackKeytab,
+		OpenStackKerberosPrincipal,
+		OpenStackKrb5Config,
+		OpenStackIdentityProvider,
+		OpenStackProtocol,
+		OpenStackAccessToken,
+		OpenStackAccessTokenFile,
+		OpenStackComputeAPIVersion,
+		LanDBUsername,
+		LanDBPassword,
 	} {
 		envVar := strings.ToUpper(strings.ReplaceAll(key, "-", "_"))
 		if err := v.BindEnv(key, envVar); err != nil {
@@ -88,36 +235,332 @@ func loadConfig() (*config.Config, error) {
 	// The GetString and GetInt methods are used to retrieve the values of the
 	// configuration options.
 	cfg := &config.Config{
-		ListenAddress:            v.GetString("listen-address"),
-		ListenPort:               v.GetInt("listen-port"),
-		LogLevel:                 v.GetString("log-level"),
-		OpenStackAuthURL:         v.GetString(OpenStackAuthURL),
-		OpenStackProjectName:     v.GetString(OpenStackProjectName),
-		OpenStackUserDomainName:  v.GetString(OpenStackUserDomainName),
-		OpenStackProjectDomainID: v.GetString(OpenStackProjectDomainID),
-		OpenStackUsername:        v.GetString(OpenStackUsername),
-		OpenStackPassword:        v.GetString(OpenStackPassword),
-		OpenStackRegionName:      v.GetString(OpenStackRegionName),
-		DryRun:                   v.GetBool("dry-run"),
-		IngressLabel:             v.GetString("ingress-label"),
-		DomainFilter:             v.GetStringSlice("domain-filter"),
-		ExcludeDomains:           v.GetStringSlice("exclude-domains"),
-		TXTPrefix:                v.GetString("txt-prefix"),
-		TXTSuffix:                v.GetString("txt-suffix"),
-	}
-
-	// Validate that all required OpenStack configuration parameters are present.
-	requiredConfigs := []struct {
+		ListenAddress:                 v.GetString("listen-address"),
+		ListenPort:                    v.GetInt("listen-port"),
+		HealthListenPort:              v.GetInt("health-listen-port"),
+		DebugToken:                    v.GetString("debug-token"),
+		OIDCIssuerURL:                 v.GetString("oidc-issuer-url"),
+		OIDCAudience:                  v.GetString("oidc-audience"),
+		OIDCSubjects:                  v.GetStringSlice("oidc-subjects"),
+		OIDCCAFile:                    v.GetString("oidc-ca-file"),
+		TLSMinVersion:                 v.GetString("tls-min-version"),
+		TLSCipherSuites:               v.GetStringSlice("tls-cipher-suites"),
+		TLSProfile:                    v.GetString("tls-profile"),
+		SecurityChecks:                v.GetString("security-checks"),
+		AllowRoot:                     v.GetBool("allow-root"),
+		LogFormat:                     v.GetString("log-format"),
+		LogColor:                      v.GetString("log-color"),
+		LogCaller:                     v.GetBool("log-caller"),
+		LogSampling:                   v.GetInt("log-sampling"),
+		LogFile:                       v.GetString("log-file"),
+		LogSyslog:                     v.GetBool("log-syslog"),
+		LogSyslogTag:                  v.GetString("log-syslog-tag"),
+		LogFileMaxSize:                v.GetInt("log-file-max-size"),
+		LogFileMaxAge:                 v.GetDuration("log-file-max-age"),
+		LogFileMaxBackups:             v.GetInt("log-file-max-backups"),
+		LogFileCompress:               v.GetBool("log-file-compress"),
+		HealthCritical:                v.GetStringSlice("health-critical"),
+		HealthMaxCacheAge:             v.GetDuration("health-max-cache-age"),
+		TracingEndpoint:               v.GetString("tracing-endpoint"),
+		TracingSampleRatio:            v.GetFloat64("tracing-sample-ratio"),
+		LogLevel:                      v.GetString("log-level"),
+		Backend:                       v.GetString(Backend),
+		FakeFixture:                   v.GetString("fake-fixture"),
+		BareMetalBackend:              v.GetString("baremetal-backend"),
+		BareMetalFlavors:              v.GetStringSlice("baremetal-flavors"),
+		LanDBURL:                      v.GetString(LanDBURL),
+		LanDBInterface:                v.GetString("landb-interface"),
+		LanDBUsername:                 v.GetString(LanDBUsername),
+		LanDBPassword:                 v.GetString(LanDBPassword),
+		OpenStackAuthURL:              v.GetString(OpenStackAuthURL),
+		OpenStackProjectName:          v.GetString(OpenStackProjectName),
+		OpenStackUserDomainName:       v.GetString(OpenStackUserDomainName),
+		OpenStackProjectDomainID:      v.GetString(OpenStackProjectDomainID),
+		OpenStackUsername:             v.GetString(OpenStackUsername),
+		OpenStackPassword:             v.GetString(OpenStackPassword),
+		OpenStackPasswordFile:         v.GetString(OpenStackPasswordFile),
+		OpenStackRegionName:           v.GetString(OpenStackRegionName),
+		OpenStackFailoverAuthURLs:     v.GetStringSlice("os-failover-auth-urls"),
+		OpenStackFailoverRegions:      v.GetStringSlice("os-failover-regions"),
+		OpenStackAuthType:             v.GetString(OpenStackAuthType),
+		OpenStackKeytab:               v.GetString(OpenStackKeytab),
+		OpenStackKerberosPrincipal:    v.GetString(OpenStackKerberosPrincipal),
+		OpenStackKrb5Config:           v.GetString(OpenStackKrb5Config),
+		OpenStackIdentityProvider:     v.GetString(OpenStackIdentityProvider),
+		OpenStackProtocol:             v.GetString(OpenStackProtocol),
+		OpenStackAccessToken:          v.GetString(OpenStackAccessToken),
+		OpenStackAccessTokenFile:      v.GetString(OpenStackAccessTokenFile),
+		OpenStackComputeMicroversion:  v.GetString(OpenStackComputeAPIVersion),
+		OpenStackCAFile:               v.GetString(OpenStackCAFile),
+		OpenStackInsecureSkipVerify:   v.GetBool(OpenStackInsecure),
+		DryRun:                        v.GetBool("dry-run"),
+		IngressLabels:                 ingressLabels(v),
+		NodeDiscovery:                 v.GetString("node-discovery"),
+		IngressService:                v.GetString("ingress-service"),
+		NodeAddressType:               v.GetString("node-address-type"),
+		IngressWorkload:               v.GetString("ingress-workload"),
+		KubeBackend:                   v.GetString("kube-backend"),
+		KubeFakeObjects:               v.GetString("kube-fake-objects"),
+		KubeAPIQPS:                    float32(v.GetFloat64("kube-api-qps")),
+		KubeAPIBurst:                  v.GetInt("kube-api-burst"),
+		RequireNodeReady:              v.GetBool("require-node-ready"),
+		ExcludeUnschedulableNodes:     v.GetBool("exclude-unschedulable-nodes"),
+		HonorExcludeFromLoadBalancers: v.GetBool("honor-exclude-from-load-balancers"),
+		DomainFilter:                  v.GetStringSlice("domain-filter"),
+		ExcludeDomains:                v.GetStringSlice("exclude-domains"),
+		TXTPrefix:                     v.GetString("txt-prefix"),
+		TXTSuffix:                     v.GetString("txt-suffix"),
+		ServerStatuses:                v.GetStringSlice("server-statuses"),
+		ServerCacheTTL:                v.GetDuration("server-cache-ttl"),
+		SnapshotTTL:                   v.GetDuration("snapshot-ttl"),
+		WarmUp:                        v.GetBool("warm-up"),
+		WarmUpTimeout:                 v.GetDuration("warm-up-timeout"),
+		RetryMaxAttempts:              v.GetInt("retry-max-attempts"),
+		RetryInitialBackoff:           v.GetDuration("retry-initial-backoff"),
+		RetryMaxBackoff:               v.GetDuration("retry-max-backoff"),
+		OpenStackCassette:             v.GetString("os-cassette"),
+		OpenStackCassetteMode:         v.GetString("os-cassette-mode"),
+		APIRateLimit:                  v.GetFloat64("api-rate-limit"),
+		APIRateBurst:                  v.GetInt("api-rate-burst"),
+		SyncConcurrency:               v.GetInt("sync-concurrency"),
+		RollbackOnFailure:             v.GetBool("rollback-on-failure"),
+		MetadataReplaceThreshold:      v.GetInt("metadata-replace-threshold"),
+		MetadataMaxItems:              v.GetInt("metadata-max-items"),
+		WriteVerifyAttempts:           v.GetInt("write-verify-attempts"),
+		OwnerID:                       v.GetString("owner-id"),
+		OrphanScan:                    v.GetString("orphan-scan"),
+		VerifyPropagation:             v.GetBool("verify-propagation"),
+		DNSServers:                    v.GetStringSlice("dns-servers"),
+		PropagationTimeout:            v.GetDuration("propagation-timeout"),
+		PropagationInterval:           v.GetDuration("propagation-interval"),
+		LeaderElect:                   v.GetBool("leader-elect"),
+		LeaderElectNamespace:          v.GetString("leader-elect-namespace"),
+		LeaderElectLeaseName:          v.GetString("leader-elect-lease-name"),
+		Standalone:                    v.GetBool("standalone"),
+		StandaloneResyncInterval:      v.GetDuration("standalone-resync-interval"),
+		CernAliasCRD:                  v.GetBool("cern-alias-crd"),
+		StateConfigMap:                v.GetString("state-configmap"),
+		Events:                        v.GetBool("events"),
+		EventObject:                   v.GetString("event-object"),
+		NodeEventSync:                 v.GetBool("node-event-sync"),
+		NodeEventDebounce:             v.GetDuration("node-event-debounce"),
+		AuthCheckInterval:             v.GetDuration("auth-check-interval"),
+		ProtectedAliases:              v.GetStringSlice("protected-aliases"),
+		ChaosNovaErrorRate:            v.GetFloat64("chaos-nova-error-rate"),
+		ChaosNovaLatency:              v.GetDuration("chaos-nova-latency"),
+		ChaosK8sErrorRate:             v.GetFloat64("chaos-k8s-error-rate"),
+		ChaosK8sLatency:               v.GetDuration("chaos-k8s-latency"),
+	}
+
+	// Validate that all required backend configuration parameters are present.
+	// The OpenStack credentials that are required depend on the selected auth type.
+	type requiredConfig struct {
 		value string
 		name  string
-	}{
-		{cfg.OpenStackAuthURL, OpenStackAuthURL},
-		{cfg.OpenStackProjectName, OpenStackProjectName},
-		{cfg.OpenStackUserDomainName, OpenStackUserDomainName},
-		{cfg.OpenStackProjectDomainID, OpenStackProjectDomainID},
-		{cfg.OpenStackUsername, OpenStackUsername},
-		{cfg.OpenStackPassword, OpenStackPassword},
-		{cfg.OpenStackRegionName, OpenStackRegionName},
+	}
+	var requiredConfigs []requiredConfig
+
+	switch cfg.Backend {
+	case cern.BackendNova:
+		requiredConfigs = append(requiredConfigs,
+			requiredConfig{cfg.OpenStackAuthURL, OpenStackAuthURL},
+			requiredConfig{cfg.OpenStackProjectName, OpenStackProjectName},
+			requiredConfig{cfg.OpenStackProjectDomainID, OpenStackProjectDomainID},
+			requiredConfig{cfg.OpenStackRegionName, OpenStackRegionName},
+		)
+	case cern.BackendLanDB:
+	case cern.BackendFake:
+		// The fake backend replaces the Kubernetes client too, both being seeded from the fixture.
+		if cfg.FakeFixture == "" {
+			return nil, fmt.Errorf("missing required configuration: --fake-fixture")
+		}
+		cfg.KubeBackend, cfg.KubeFakeObjects = k8s.KubeBackendFake, cfg.FakeFixture
+	default:
+		return nil, fmt.Errorf("invalid --%s %q", Backend, cfg.Backend)
+	}
+
+	switch cfg.BareMetalBackend {
+	case cern.BackendNova, cern.BackendLanDB:
+	default:
+		return nil, fmt.Errorf("invalid --baremetal-backend %q", cfg.BareMetalBackend)
+	}
+
+	// LanDB credentials are needed by the landb backend, and by the nova backend for the nodes whose
+	// aliases are written directly to LanDB.
+	if cern.NeedsLanDB(cfg) {
+		requiredConfigs = append(requiredConfigs,
+			requiredConfig{cfg.LanDBURL, LanDBURL},
+			requiredConfig{cfg.LanDBUsername, LanDBUsername},
+			requiredConfig{cfg.LanDBPassword, LanDBPassword},
+		)
+	}
+
+	switch {
+	case cfg.Backend != cern.BackendNova:
+		// The OpenStack credentials are only used by the nova backend.
+	case cfg.OpenStackAuthType == cern.AuthTypePassword:
+		requiredConfigs = append(requiredConfigs,
+			requiredConfig{cfg.OpenStackUserDomainName, OpenStackUserDomainName},
+			requiredConfig{cfg.OpenStackUsername, OpenStackUsername},
+		)
+		if cfg.OpenStackPassword == "" && cfg.OpenStackPasswordFile == "" {
+			return nil, fmt.Errorf("missing required configuration: --%s or --%s", OpenStackPassword, OpenStackPasswordFile)
+		}
+	case cfg.OpenStackAuthType == cern.AuthTypeKerberos:
+		requiredConfigs = append(requiredConfigs,
+			requiredConfig{cfg.OpenStackKeytab, OpenStackKeytab},
+			requiredConfig{cfg.OpenStackKerberosPrincipal, OpenStackKerberosPrincipal},
+		)
+	case cfg.OpenStackAuthType == cern.AuthTypeOIDCAccessToken:
+		if cfg.OpenStackAccessToken == "" && cfg.OpenStackAccessTokenFile == "" {
+			return nil, fmt.Errorf("missing required configuration: --%s or --%s", OpenStackAccessToken, OpenStackAccessTokenFile)
+		}
+	default:
+		return nil, fmt.Errorf("invalid --%s %q", OpenStackAuthType, cfg.OpenStackAuthType)
+	}
+
+	switch cfg.OpenStackCassetteMode {
+	case cern.CassetteOff:
+	case cern.CassetteRecord, cern.CassetteReplay:
+		if cfg.OpenStackCassette == "" {
+			return nil, fmt.Errorf("missing required configuration: --os-cassette")
+		}
+	default:
+		return nil, fmt.Errorf("invalid --os-cassette-mode %q", cfg.OpenStackCassetteMode)
+	}
+
+	switch cfg.OrphanScan {
+	case cern.OrphanScanOff, cern.OrphanScanReport, cern.OrphanScanRepair:
+	default:
+		return nil, fmt.Errorf("invalid --orphan-scan %q", cfg.OrphanScan)
+	}
+
+	if cfg.OIDCIssuerURL != "" {
+		if u, err := url.Parse(cfg.OIDCIssuerURL); err != nil || u.Scheme != "https" || u.Host == "" {
+			return nil, fmt.Errorf("invalid --oidc-issuer-url %q: must be an https URL", cfg.OIDCIssuerURL)
+		}
+		if cfg.OIDCAudience == "" {
+			return nil, fmt.Errorf("missing required configuration: --oidc-audience")
+		}
+	}
+
+	if !slices.Contains(security.Modes, cfg.SecurityChecks) {
+		return nil, fmt.Errorf("invalid --security-checks %q", cfg.SecurityChecks)
+	}
+
+	if _, err := tlsconfig.New(cfg); err != nil {
+		return nil, fmt.Errorf("invalid TLS configuration: %w", err)
+	}
+
+	if _, ok := log.FormatFromString(cfg.LogFormat); !ok {
+		return nil, fmt.Errorf("invalid --log-format %q", cfg.LogFormat)
+	}
+
+	if _, ok := log.ColorModeFromString(cfg.LogColor); !ok {
+		return nil, fmt.Errorf("invalid --log-color %q", cfg.LogColor)
+	}
+
+	if cfg.LogSampling < 1 {
+		return nil, fmt.Errorf("--log-sampling must be at least 1")
+	}
+
+	if cfg.LogFile != "" && cfg.LogSyslog {
+		return nil, fmt.Errorf("--log-file and --log-syslog are mutually exclusive")
+	}
+	if cfg.LogFile != "" && cfg.LogFileMaxSize <= 0 {
+		return nil, fmt.Errorf("--log-file-max-size must be positive")
+	}
+	if cfg.LogFileMaxAge < 0 || cfg.LogFileMaxBackups < 0 {
+		return nil, fmt.Errorf("--log-file-max-age and --log-file-max-backups must not be negative")
+	}
+
+	for _, component := range cfg.HealthCritical {
+		if !slices.Contains(provider.HealthComponents, component) {
+			return nil, fmt.Errorf("invalid --health-critical component %q", component)
+		}
+	}
+	if cfg.HealthMaxCacheAge < 0 {
+		return nil, fmt.Errorf("--health-max-cache-age must not be negative")
+	}
+
+	if cfg.TracingSampleRatio < 0 || cfg.TracingSampleRatio > 1 {
+		return nil, fmt.Errorf("--tracing-sample-ratio must be between 0 and 1")
+	}
+
+	if cfg.HealthListenPort != 0 && cfg.HealthListenPort == cfg.ListenPort {
+		return nil, fmt.Errorf("--health-listen-port must differ from --listen-port")
+	}
+
+	if len(cfg.IngressLabels) == 0 {
+		return nil, fmt.Errorf("missing required configuration: --ingress-label")
+	}
+	for _, selector := range cfg.IngressLabels {
+		if _, err := labels.Parse(selector); err != nil {
+			return nil, fmt.Errorf("invalid --ingress-label %q: %w", selector, err)
+		}
+	}
+
+	switch cfg.NodeDiscovery {
+	case k8s.DiscoveryLabel:
+	case k8s.DiscoveryService, k8s.DiscoveryEndpointSlice:
+		if cfg.IngressService == "" {
+			return nil, fmt.Errorf("missing required configuration: --ingress-service")
+		}
+	case k8s.DiscoveryWorkload:
+		if _, _, _, err := k8s.ParseWorkload(cfg.IngressWorkload); err != nil {
+			return nil, fmt.Errorf("invalid --ingress-workload: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("invalid --node-discovery %q", cfg.NodeDiscovery)
+	}
+
+	if cfg.EventObject != "" {
+		if _, _, _, err := k8s.ParseEventObject(cfg.EventObject); err != nil {
+			return nil, fmt.Errorf("invalid --event-object: %w", err)
+		}
+	}
+
+	switch cfg.NodeAddressType {
+	case k8s.AddressTypeExternalIP, k8s.AddressTypeInternalIP, k8s.AddressTypeAuto:
+	default:
+		return nil, fmt.Errorf("invalid --node-address-type %q", cfg.NodeAddressType)
+	}
+
+	switch cfg.KubeBackend {
+	case k8s.KubeBackendCluster:
+	case k8s.KubeBackendFake:
+		if cfg.KubeFakeObjects == "" {
+			return nil, fmt.Errorf("missing required configuration: --kube-fake-objects")
+		}
+	default:
+		return nil, fmt.Errorf("invalid --kube-backend %q", cfg.KubeBackend)
+	}
+
+	if cfg.MetadataMaxItems <= 0 {
+		return nil, fmt.Errorf("--metadata-max-items must be positive")
+	}
+
+	if cfg.KubeAPIQPS <= 0 || cfg.KubeAPIBurst <= 0 {
+		return nil, fmt.Errorf("--kube-api-qps and --kube-api-burst must be positive")
+	}
+
+	if cfg.ChaosNovaErrorRate < 0 || cfg.ChaosNovaErrorRate > 1 || cfg.ChaosK8sErrorRate < 0 || cfg.ChaosK8sErrorRate > 1 {
+		return nil, fmt.Errorf("--chaos-nova-error-rate and --chaos-k8s-error-rate must be between 0 and 1")
+	}
+	if cfg.ChaosNovaLatency < 0 || cfg.ChaosK8sLatency < 0 {
+		return nil, fmt.Errorf("--chaos-nova-latency and --chaos-k8s-latency must not be negative")
+	}
+
+	if cfg.WarmUp && cfg.WarmUpTimeout <= 0 {
+		return nil, fmt.Errorf("--warm-up-timeout must be positive")
+	}
+
+	if cfg.NodeEventSync && cfg.NodeEventDebounce <= 0 {
+		return nil, fmt.Errorf("--node-event-debounce must be positive")
+	}
+
+	if cfg.VerifyPropagation && cfg.PropagationInterval <= 0 {
+		return nil, fmt.Errorf("--propagation-interval must be positive")
 	}
 
 	for _, required := range requiredConfigs {
@@ -128,3 +571,22 @@ func loadConfig() (*config.Config, error) {
 
 	return cfg, nil
 }
+
+// ingressLabels returns the ingress node selectors. The flag is repeated to pass several selectors,
+// while the environment variable separates them with semicolons, since selectors contain commas.
+func ingressLabels(v *viper.Viper) []string {
+	switch value := v.Get("ingress-label").(type) {
+	case []string:
+		return value
+	case string:
+		var selectors []string
+		for _, selector := range strings.Split(value, ";") {
+			if selector = strings.TrimSpace(selector); selector != "" {
+				selectors = append(selectors, selector)
+			}
+		}
+		return selectors
+	default:
+		return nil
+	}
+}
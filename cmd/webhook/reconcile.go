@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/spf13/cobra"
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/cern"
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/pkg/config"
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/provider"
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+// Sources of the desired endpoints of a one-off reconciliation.
+const (
+	reconcileSourceFile     = "file"
+	reconcileSourceState    = "state"
+	reconcileSourceMetadata = "metadata"
+)
+
+// reconcileReport is the outcome of a one-off reconciliation.
+type reconcileReport struct {
+	// Source is where the desired endpoints were read from: file, state or metadata.
+	Source string `json:"source"`
+	// Endpoints is the number of desired endpoints.
+	Endpoints int `json:"endpoints"`
+	// Nodes is the number of ingress nodes.
+	Nodes int `json:"nodes"`
+	// DryRun reports whether the changes were only planned.
+	DryRun bool `json:"dryRun"`
+	// Changes holds the changes of every node that changes.
+	Changes []cern.NodePlan `json:"changes"`
+	// Error is the error of a failed sync.
+	Error string `json:"error,omitempty"`
+}
+
+// newReconcileCommand creates the reconcile command, bringing the ingress nodes to the desired
+// endpoints once and exiting, e.g. to run the sync as a Kubernetes Job during maintenance instead
+// of a long-lived server.
+//
+// The desired endpoints are read from --file, as with diff, or else from the persisted state, or
+// else from the node metadata, the aliases being only re-distributed over the current nodes as the
+// server does on node changes.
+func newReconcileCommand() *cobra.Command {
+	var file, output string
+	cmd := &cobra.Command{
+		Use:   "reconcile",
+		Short: "Apply the desired aliases once, print a report and exit",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			if output != outputTable && output != outputJSON {
+				return fmt.Errorf("invalid --output %q, expected %s or %s", output, outputTable, outputJSON)
+			}
+			cfg, err := commandConfig(cmd)
+			if err != nil {
+				return err
+			}
+			var data []byte
+			if file != "" {
+				if data, err = readInput(cmd.InOrStdin(), file); err != nil {
+					return err
+				}
+			}
+			return reconcile(cmd.OutOrStdout(), cfg, data, output)
+		},
+	}
+	cmd.Flags().StringVarP(&file, "file", "f", "", "File of the desired endpoints or of the ExternalDNS changes to apply, - for stdin (default: the persisted state, or the node metadata)")
+	cmd.Flags().StringVarP(&output, "output", "o", outputTable, "Output format of the report (table, json)")
+	registerFlagValues(cmd, "output", outputTable, outputJSON)
+	return cmd
+}
+
+// reconcile brings the ingress nodes to the desired endpoints of data, nil for the persisted state
+// or the node metadata, and prints the report to out in the given output format, logging to stderr.
+// The report is printed even when the sync fails.
+func reconcile(out io.Writer, cfg *config.Config, data []byte, output string) error {
+	ctx, backend, k8sClient, err := commandBackend(cfg)
+	if err != nil {
+		return err
+	}
+	nodes, err := backend.GetIngressNodes(ctx, cfg.IngressLabels)
+	if err != nil {
+		return fmt.Errorf("failed to get ingress nodes: %w", err)
+	}
+
+	current := cern.ParseEndpointsFromMetadata(nodes, cfg.OwnerID)
+	report := reconcileReport{Source: reconcileSourceFile, Nodes: len(nodes), DryRun: cfg.DryRun}
+	var desired []*endpoint.Endpoint
+	if data != nil {
+		if desired, err = decodeDesired(data, current); err != nil {
+			return fmt.Errorf("failed to decode the desired endpoints: %w", err)
+		}
+	} else {
+		report.Source = reconcileSourceState
+		if desired, err = provider.StateDesired(ctx, cfg, k8sClient); err != nil {
+			return err
+		}
+		if desired == nil {
+			report.Source, desired = reconcileSourceMetadata, current
+		}
+	}
+	report.Endpoints = len(desired)
+
+	if report.Changes, err = provider.PlanDesired(ctx, cfg, backend, k8sClient, nodes, desired); err != nil {
+		return err
+	}
+	var syncErr error
+	if !cfg.DryRun && len(report.Changes) > 0 {
+		if syncErr = provider.SyncDesired(ctx, cfg, backend, k8sClient, nodes, desired); syncErr != nil {
+			report.Error = syncErr.Error()
+		} else if err := provider.SaveDesired(ctx, cfg, k8sClient, desired); err != nil {
+			return fmt.Errorf("failed to save the state: %w", err)
+		}
+	}
+
+	if err := writeReconcileReport(out, &report, output); err != nil {
+		return err
+	}
+	if syncErr != nil {
+		return fmt.Errorf("failed to reconcile the ingress nodes: %w", syncErr)
+	}
+	return nil
+}
+
+// writeReconcileReport writes the report to out in the given output format.
+func writeReconcileReport(out io.Writer, report *reconcileReport, output string) error {
+	if output == outputJSON {
+		return writeJSON(out, report)
+	}
+
+	if err := writePlansTable(out, report.Changes); err != nil {
+		return err
+	}
+	outcome := "applied"
+	switch {
+	case report.Error != "":
+		outcome = "failed"
+	case report.DryRun:
+		outcome = "planned (dry run)"
+	}
+	_, err := fmt.Fprintf(out, "Reconciled %d endpoints from the %s over %d nodes: changes of %d nodes %s\n",
+		report.Endpoints, report.Source, report.Nodes, len(report.Changes), outcome)
+	return err
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+// fixture is the file of the fake Kubernetes objects and OpenStack servers of the commands: two
+// ingress nodes, ingress-node-1 carrying app.cern.ch.
+const fixture = "../../deploy/fake-nodes.yaml"
+
+// runCommand runs the webhook command with the given arguments against the fake backends seeded
+// from the objects file, with stdin as its input, and returns its output.
+func runCommand(t *testing.T, objects, stdin string, args ...string) (string, error) {
+	t.Helper()
+	root := newRootCommand()
+	var out bytes.Buffer
+	root.SetOut(&out)
+	root.SetIn(strings.NewReader(stdin))
+	root.SetArgs(append(args,
+		"--backend=fake", "--fake-fixture="+objects,
+		"--kube-backend=fake", "--kube-fake-objects="+objects,
+		"--log-level=error",
+	))
+	err := root.Execute()
+	return out.String(), err
+}
+
+// changedServers returns the names of the servers changed by a reconciliation.
+func changedServers(report *reconcileReport) []string {
+	var servers []string
+	for _, change := range report.Changes {
+		servers = append(servers, change.Server)
+	}
+	return servers
+}
+
+func TestReconcile(t *testing.T) {
+	// The persisted state restricts app.cern.ch to the nodes of zone cern-geneva-a.
+	stateFixture := filepath.Join(t.TempDir(), "objects.yaml")
+	nodes, err := os.ReadFile(fixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state := `---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  namespace: dns
+  name: webhook-state
+data:
+  state.json: '{"owner": "default", "aliases": ["app.cern.ch"], "desired": [{"dnsName": "app.cern.ch", "recordType": "A", "providerSpecific": [{"name": "webhook/cern-node-selector", "value": "topology.kubernetes.io/zone=cern-geneva-a"}]}]}'
+`
+	if err := os.WriteFile(stateFixture, append(nodes, []byte(state)...), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name          string
+		fixture       string
+		stdin         string
+		args          []string
+		wantSource    string
+		wantEndpoints int
+		wantServers   []string
+		wantDryRun    bool
+	}{
+		{
+			name:          "file",
+			fixture:       fixture,
+			stdin:         `[{"dnsName": "web.cern.ch", "recordType": "A"}]`,
+			args:          []string{"--file=-"},
+			wantSource:    reconcileSourceFile,
+			wantEndpoints: 1,
+			wantServers:   []string{"ingress-node-1", "ingress-node-2"},
+		},
+		{
+			name:          "file dry run",
+			fixture:       fixture,
+			stdin:         `[{"dnsName": "web.cern.ch", "recordType": "A"}]`,
+			args:          []string{"--file=-", "--dry-run"},
+			wantSource:    reconcileSourceFile,
+			wantEndpoints: 1,
+			wantServers:   []string{"ingress-node-1", "ingress-node-2"},
+			wantDryRun:    true,
+		},
+		{
+			name:          "state",
+			fixture:       stateFixture,
+			args:          []string{"--state-configmap=dns/webhook-state"},
+			wantSource:    reconcileSourceState,
+			wantEndpoints: 1,
+			wantServers:   []string{"ingress-node-1"},
+		},
+		{
+			// The nodes of the fixture are marked by the default owner, their aliases are foreign.
+			name:       "state of another owner",
+			fixture:    stateFixture,
+			args:       []string{"--state-configmap=dns/webhook-state", "--owner-id=other"},
+			wantSource: reconcileSourceMetadata,
+		},
+		{
+			name:          "metadata",
+			fixture:       fixture,
+			wantSource:    reconcileSourceMetadata,
+			wantEndpoints: 1,
+			wantServers:   []string{"ingress-node-1", "ingress-node-2"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := runCommand(t, tt.fixture, tt.stdin, append([]string{"reconcile", "--output=json"}, tt.args...)...)
+			if err != nil {
+				t.Fatalf("reconcile error = %v", err)
+			}
+			var report reconcileReport
+			if err := json.Unmarshal([]byte(out), &report); err != nil {
+				t.Fatalf("failed to decode the report %q: %v", out, err)
+			}
+			if report.Source != tt.wantSource || report.Endpoints != tt.wantEndpoints || report.Nodes != 2 || report.DryRun != tt.wantDryRun || report.Error != "" {
+				t.Errorf("report = %+v, want source %s, %d endpoints, 2 nodes, dry run %t and no error", report, tt.wantSource, tt.wantEndpoints, tt.wantDryRun)
+			}
+			if servers := changedServers(&report); strings.Join(servers, ",") != strings.Join(tt.wantServers, ",") {
+				t.Errorf("changed servers = %v, want %v", servers, tt.wantServers)
+			}
+		})
+	}
+}
+
+func TestReconcileTable(t *testing.T) {
+	out, err := runCommand(t, fixture, "", "reconcile", "--dry-run")
+	if err != nil {
+		t.Fatalf("reconcile error = %v", err)
+	}
+	if !strings.Contains(out, "Reconciled 1 endpoints from the metadata over 2 nodes: changes of 2 nodes planned (dry run)") {
+		t.Errorf("reconcile output = %q, want the summary of the planned changes", out)
+	}
+}
+
+func TestReconcileInvalidFile(t *testing.T) {
+	if _, err := runCommand(t, fixture, "not json", "reconcile", "--file=-"); err == nil {
+		t.Errorf("reconcile of an invalid file expected an error")
+	}
+}
+
+func TestIngressLabels(t *testing.T) {
+	tests := []struct {
+		name  string
+		value any
+		want  []string
+	}{
+		{name: "Repeated flag", value: []string{"role=ingress,zone in (a,b)", "legacy-ingress"}, want: []string{"role=ingress,zone in (a,b)", "legacy-ingress"}},
+		{name: "Environment variable", value: "role=ingress,zone in (a,b); legacy-ingress", want: []string{"role=ingress,zone in (a,b)", "legacy-ingress"}},
+		{name: "Empty selectors skipped", value: " ; ", want: nil},
+		{name: "Unset", want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := viper.New()
+			if tt.value != nil {
+				v.Set("ingress-label", tt.value)
+			}
+			if got := ingressLabels(v); !slices.Equal(got, tt.want) {
+				t.Errorf("ingressLabels() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCommands(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		env     map[string]string
+		wantOut string
+		wantErr string
+	}{
+		{name: "version", args: []string{"version"}, wantOut: "Webhook API: v"},
+		{name: "version as JSON", args: []string{"version", "-o", "json"}, wantOut: `"webhookAPIVersion"`},
+		{name: "valid configuration", args: []string{"validate"}, wantOut: "Configuration is valid"},
+		{name: "shared flag after the command", args: []string{"validate", "--kube-api-qps=0"}, wantErr: "--kube-api-qps"},
+		{name: "shared flag before the command", args: []string{"--kube-api-qps=0", "validate"}, wantErr: "--kube-api-qps"},
+		{name: "environment variable", args: []string{"validate"}, env: map[string]string{"KUBE_API_QPS": "0"}, wantErr: "--kube-api-qps"},
+		{name: "unknown command", args: []string{"unknown"}, wantErr: "unknown"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+			out, err := runCommand(t, fixture, "", tt.args...)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want an error mentioning %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("error = %v", err)
+			}
+			if !strings.Contains(out, tt.wantOut) {
+				t.Errorf("output = %q, want %q", out, tt.wantOut)
+			}
+		})
+	}
+}
+
+func TestCompletion(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		wantOut []string
+		wantErr bool
+	}{
+		{name: "bash", args: []string{"completion", "bash"}, wantOut: []string{"# bash completion V2 for webhook"}},
+		{name: "zsh", args: []string{"completion", "zsh"}, wantOut: []string{"#compdef webhook"}},
+		{name: "fish", args: []string{"completion", "fish"}, wantOut: []string{"# fish completion for webhook"}},
+		{name: "unsupported shell", args: []string{"completion", "powershell"}, wantErr: true},
+		{name: "missing shell", args: []string{"completion"}, wantErr: true},
+		{name: "commands", args: []string{"__complete", ""}, wantOut: []string{"serve", "list-records", "reconcile", "completion"}},
+		{name: "enumerated flag values", args: []string{"__complete", "--log-level", ""}, wantOut: []string{"trace", "debug", "error"}},
+		{name: "command flag values", args: []string{"__complete", "version", "--output", ""}, wantOut: []string{"text", "json"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := newRootCommand()
+			var out bytes.Buffer
+			root.SetOut(&out)
+			root.SetArgs(tt.args)
+			err := root.Execute()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			for _, want := range tt.wantOut {
+				if !strings.Contains(out.String(), want) {
+					t.Errorf("output = %q, want %q", out.String(), want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/cern"
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/pkg/config"
+)
+
+// newListRecordsCommand creates the list-records command, printing the endpoints currently managed
+// on the ingress nodes, with their targets and the nodes carrying them.
+func newListRecordsCommand() *cobra.Command {
+	var output string
+	cmd := &cobra.Command{
+		Use:   "list-records",
+		Short: "List the endpoints managed on the ingress nodes",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			if output != outputTable && output != outputJSON {
+				return fmt.Errorf("invalid --output %q, expected %s or %s", output, outputTable, outputJSON)
+			}
+			cfg, err := commandConfig(cmd)
+			if err != nil {
+				return err
+			}
+			return listRecords(cmd.OutOrStdout(), cfg, output)
+		},
+	}
+	cmd.Flags().StringVarP(&output, "output", "o", outputTable, "Output format (table, json)")
+	registerFlagValues(cmd, "output", outputTable, outputJSON)
+	return cmd
+}
+
+// listRecords prints the managed endpoints to out in the given output format, logging to stderr.
+func listRecords(out io.Writer, cfg *config.Config, output string) error {
+	ctx, backend, _, err := commandBackend(cfg)
+	if err != nil {
+		return err
+	}
+	nodes, err := backend.GetIngressNodes(ctx, cfg.IngressLabels)
+	if err != nil {
+		return fmt.Errorf("failed to get ingress nodes: %w", err)
+	}
+
+	records := cern.ManagedRecords(nodes, cfg.OwnerID)
+	if output == outputJSON {
+		return writeJSON(out, records)
+	}
+	return writeRecordsTable(out, records)
+}
+
+// writeRecordsTable writes the records as an aligned table, one record per line.
+func writeRecordsTable(out io.Writer, records []cern.ManagedRecord) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tTYPE\tTARGETS\tNODES")
+	for _, record := range records {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", record.Name, record.Type, strings.Join(record.Targets, ","), strings.Join(record.Nodes, ","))
+	}
+	return w.Flush()
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+// newRootCommand creates the root command of the webhook.
+//
+// The flags of the configuration, and their environment variables, are shared by every command.
+// Without a command the webhook is served, as with the serve command, so that the deployments
+// predating the commands keep working.
+func newRootCommand() *cobra.Command {
+	root := &cobra.Command{
+		Use:   "webhook",
+		Short: "ExternalDNS webhook provider managing CERN Cloud landb-alias metadata",
+		Long: `The webhook serves the ExternalDNS webhook provider API, writing the DNS names of the
+cluster to the landb-alias metadata of its ingress nodes. The other commands help operate it.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			serve(cmd.Root().PersistentFlags())
+			return nil
+		},
+		// The errors are printed by main, and the usage is only printed on demand.
+		SilenceErrors: true,
+		SilenceUsage:  true,
+		CompletionOptions: cobra.CompletionOptions{
+			DisableDefaultCmd: true,
+		},
+	}
+	addConfigFlags(root.PersistentFlags())
+	registerConfigFlagCompletions(root)
+
+	root.AddCommand(
+		newServeCommand(),
+		newVersionCommand(),
+		newValidateCommand(),
+		newListRecordsCommand(),
+		newDiffCommand(),
+		newCleanupCommand(),
+		newExportCommand(),
+		newImportCommand(),
+		newReconcileCommand(),
+		newMigrateCommand(),
+		newDoctorCommand(),
+		newCompletionCommand(),
+	)
+	return root
+}
+
+// newServeCommand creates the serve command, running the webhook server.
+func newServeCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "serve",
+		Short: "Serve the webhook, the default command",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			serve(cmd.Root().PersistentFlags())
+			return nil
+		},
+	}
+}
+
+// newValidateCommand creates the validate command, checking the configuration of the flags and
+// environment variables without connecting to any API, e.g. before rolling out a change.
+func newValidateCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "validate",
+		Short: "Validate the configuration without connecting to any API",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			if _, err := loadConfig(cmd.Root().PersistentFlags()); err != nil {
+				return fmt.Errorf("invalid configuration: %w", err)
+			}
+			_, err := fmt.Fprintln(cmd.OutOrStdout(), "Configuration is valid")
+			return err
+		},
+	}
+}
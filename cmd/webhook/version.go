@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/spf13/cobra"
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/version"
+)
+
+// newVersionCommand creates the version command, printing the build metadata of the webhook and
+// the version of the webhook API it implements.
+//
+// It does not load the configuration, so that it runs anywhere, even without credentials.
+func newVersionCommand() *cobra.Command {
+	var output string
+	cmd := &cobra.Command{
+		Use:   "version",
+		Short: "Print the version of the webhook and of the webhook API it implements",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return printVersion(cmd.OutOrStdout(), output)
+		},
+	}
+	cmd.Flags().StringVarP(&output, "output", "o", outputText, "Output format (text, json)")
+	registerFlagValues(cmd, "output", outputText, outputJSON)
+	return cmd
+}
+
+// printVersion prints the build metadata to out in the given output format.
+func printVersion(out io.Writer, output string) error {
+	info := version.Get()
+	switch output {
+	case outputText:
+		_, err := fmt.Fprintf(out, "Version:     %s\nCommit:      %s\nBuild date:  %s\nGo version:  %s\nWebhook API: v%s\n",
+			info.Version, info.Commit, info.BuildDate, info.GoVersion, info.WebhookAPIVersion)
+		return err
+	case outputJSON:
+		return writeJSON(out, info)
+	default:
+		return fmt.Errorf("invalid --output %q, expected %s or %s", output, outputText, outputJSON)
+	}
+}
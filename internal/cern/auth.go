@@ -0,0 +1,210 @@
+package cern
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gophercloud/gophercloud/v2"
+	"github.com/gophercloud/gophercloud/v2/openstack"
+	krbclient "github.com/jcmturner/gokrb5/v8/client"
+	krbconfig "github.com/jcmturner/gokrb5/v8/config"
+	"github.com/jcmturner/gokrb5/v8/keytab"
+	"github.com/jcmturner/gokrb5/v8/spnego"
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/pkg/config"
+)
+
+// Supported values of the OpenStack authentication type.
+// They follow the plugin names used by keystoneauth and the OS_AUTH_TYPE variable.
+const (
+	// AuthTypePassword authenticates with a username and password.
+	AuthTypePassword = "password"
+	// AuthTypeKerberos authenticates with a Kerberos keytab through Keystone federation.
+	// This is the preferred credential type for service accounts at CERN.
+	AuthTypeKerberos = "v3kerberos"
+	// AuthTypeOIDCAccessToken authenticates with an OIDC access token through Keystone federation.
+	AuthTypeOIDCAccessToken = "v3oidcaccesstoken"
+)
+
+// authenticate authenticates the provider client with the configured credential type.
+func authenticate(ctx context.Context, provider *gophercloud.ProviderClient, cfg *config.Config) error {
+	switch cfg.OpenStackAuthType {
+	case "", AuthTypePassword:
+		password, err := openStackPassword(cfg)
+		if err != nil {
+			return err
+		}
+		opts := gophercloud.AuthOptions{
+			IdentityEndpoint: cfg.OpenStackAuthURL,
+			Username:         cfg.OpenStackUsername,
+			Password:         password,
+			DomainName:       cfg.OpenStackUserDomainName,
+			TenantName:       cfg.OpenStackProjectName,
+			// Let gophercloud transparently re-authenticate when the Keystone token expires,
+			// instead of requiring a pod restart after hours of runtime.
+			AllowReauth: true,
+		}
+		return openstack.Authenticate(ctx, provider, opts)
+	case AuthTypeKerberos, AuthTypeOIDCAccessToken:
+		return authenticateFederated(ctx, provider, cfg)
+	default:
+		return fmt.Errorf("unsupported OpenStack auth type %q", cfg.OpenStackAuthType)
+	}
+}
+
+// authenticateFederated obtains an unscoped token from the Keystone federation endpoint and
+// exchanges it for a token scoped to the configured project.
+//
+// The unscoped token cannot be reused once it expires, so re-authentication goes through the
+// identity provider again on a throw-away copy of the provider client, mirroring what gophercloud
+// does for password authentication.
+func authenticateFederated(ctx context.Context, provider *gophercloud.ProviderClient, cfg *config.Config) error {
+	scope := func(ctx context.Context, client *gophercloud.ProviderClient) error {
+		unscoped, err := federatedToken(ctx, &client.HTTPClient, cfg)
+		if err != nil {
+			return err
+		}
+
+		opts := &gophercloud.AuthOptions{
+			IdentityEndpoint: cfg.OpenStackAuthURL,
+			TokenID:          unscoped,
+			Scope: &gophercloud.AuthScope{
+				ProjectName: cfg.OpenStackProjectName,
+				DomainID:    cfg.OpenStackProjectDomainID,
+			},
+		}
+		return openstack.AuthenticateV3(ctx, client, opts, gophercloud.EndpointOpts{})
+	}
+
+	if err := scope(ctx, provider); err != nil {
+		return err
+	}
+
+	tac := *provider
+	tac.SetThrowaway(true)
+	tac.ReauthFunc = nil
+	if err := tac.SetTokenAndAuthResult(nil); err != nil {
+		return err
+	}
+	provider.ReauthFunc = func(ctx context.Context) error {
+		if err := scope(ctx, &tac); err != nil {
+			return err
+		}
+		provider.CopyTokenFrom(&tac)
+		return nil
+	}
+
+	return nil
+}
+
+// federatedToken requests an unscoped token from the Keystone federation endpoint of the configured
+// identity provider and protocol.
+func federatedToken(ctx context.Context, httpClient *http.Client, cfg *config.Config) (string, error) {
+	url := fmt.Sprintf("%s/OS-FEDERATION/identity_providers/%s/protocols/%s/auth",
+		strings.TrimSuffix(cfg.OpenStackAuthURL, "/"), cfg.OpenStackIdentityProvider, cfg.OpenStackProtocol)
+
+	var resp *http.Response
+	switch cfg.OpenStackAuthType {
+	case AuthTypeKerberos:
+		kt, err := keytab.Load(cfg.OpenStackKeytab)
+		if err != nil {
+			return "", fmt.Errorf("failed to load keytab %s: %w", cfg.OpenStackKeytab, err)
+		}
+		krbCfg, err := krbconfig.Load(cfg.OpenStackKrb5Config)
+		if err != nil {
+			return "", fmt.Errorf("failed to load kerberos config %s: %w", cfg.OpenStackKrb5Config, err)
+		}
+		username, realm, ok := strings.Cut(cfg.OpenStackKerberosPrincipal, "@")
+		if !ok {
+			realm = krbCfg.LibDefaults.DefaultRealm
+		}
+
+		krb := krbclient.NewWithKeytab(username, realm, kt, krbCfg, krbclient.DisablePAFXFAST(true))
+		defer krb.Destroy()
+		if err := krb.Login(); err != nil {
+			return "", fmt.Errorf("kerberos login as %s failed: %w", cfg.OpenStackKerberosPrincipal, err)
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return "", err
+		}
+		resp, err = spnego.NewClient(krb, httpClient, "").Do(req)
+		if err != nil {
+			return "", fmt.Errorf("kerberos federation request failed: %w", err)
+		}
+	case AuthTypeOIDCAccessToken:
+		accessToken, err := oidcAccessToken(cfg)
+		if err != nil {
+			return "", err
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, nil)
+		if err != nil {
+			return "", err
+		}
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+		resp, err = httpClient.Do(req)
+		if err != nil {
+			return "", fmt.Errorf("OIDC federation request failed: %w", err)
+		}
+	default:
+		return "", fmt.Errorf("auth type %q does not use federation", cfg.OpenStackAuthType)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		return "", fmt.Errorf("federation request to %s returned %s", url, resp.Status)
+	}
+	token := resp.Header.Get("X-Subject-Token")
+	if token == "" {
+		return "", fmt.Errorf("federation response from %s did not contain a token", url)
+	}
+	return token, nil
+}
+
+// oidcAccessToken returns the configured OIDC access token, reading it from a file if needed.
+// The file is read on every authentication so that rotated tokens are picked up.
+func oidcAccessToken(cfg *config.Config) (string, error) {
+	if cfg.OpenStackAccessToken != "" {
+		return cfg.OpenStackAccessToken, nil
+	}
+	data, err := os.ReadFile(cfg.OpenStackAccessTokenFile)
+	if err != nil {
+		return "", fmt.Errorf("failed to read access token file: %w", err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// openStackPassword returns the configured OpenStack password, reading it from a file if needed.
+// The file is read on every connection, so a rotated password is used once the session is rebuilt.
+func openStackPassword(cfg *config.Config) (string, error) {
+	if cfg.OpenStackPassword != "" || cfg.OpenStackPasswordFile == "" {
+		return cfg.OpenStackPassword, nil
+	}
+	data, err := os.ReadFile(cfg.OpenStackPasswordFile)
+	if err != nil {
+		return "", fmt.Errorf("failed to read password file: %w", err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// CredentialSecrets returns the OpenStack credentials read from the password and access token
+// files, to be scrubbed from the logs like the ones configured directly. The files that cannot be
+// read are skipped, the authentication reports them.
+func CredentialSecrets(cfg *config.Config) []string {
+	var secrets []string
+	if cfg.OpenStackPasswordFile != "" {
+		if data, err := os.ReadFile(cfg.OpenStackPasswordFile); err == nil {
+			secrets = append(secrets, strings.TrimSpace(string(data)))
+		}
+	}
+	if cfg.OpenStackAccessTokenFile != "" {
+		if data, err := os.ReadFile(cfg.OpenStackAccessTokenFile); err == nil {
+			secrets = append(secrets, strings.TrimSpace(string(data)))
+		}
+	}
+	return secrets
+}
@@ -0,0 +1,103 @@
+package cern
+
+import (
+	"context"
+	"sort"
+
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/pkg/config"
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+// Supported alias backends.
+const (
+	// BackendNova writes aliases to the `landb-alias` metadata of the Nova servers, which the
+	// CERN cloud propagates to LanDB.
+	BackendNova = "nova"
+	// BackendLanDB writes aliases directly to LanDB through its SOAP API.
+	BackendLanDB = "landb"
+	// BackendFake writes aliases to the metadata of in-memory servers, for end-to-end tests
+	// without CERN credentials.
+	BackendFake = "fake"
+)
+
+// NeedsLanDB reports whether some aliases are written directly to LanDB with the configuration: all
+// of them with the landb backend, and with the nova backend those of the bare-metal nodes or of the
+// nodes whose aliases must be attached to a specific interface.
+func NeedsLanDB(cfg *config.Config) bool {
+	return cfg.Backend == BackendLanDB || cfg.Backend == BackendNova && (cfg.BareMetalBackend == BackendLanDB || cfg.LanDBInterface != "")
+}
+
+// Backend stores the LanDB aliases of a set of ingress nodes.
+//
+// Every backend reports the aliases currently carried by a node as `landb-alias*` keys in
+// IngressNode.Metadata, so the endpoints can be reconstructed the same way regardless of where
+// the aliases are stored.
+type Backend interface {
+	// GetIngressNodes retrieves the ingress nodes matching the label, with their current aliases.
+	GetIngressNodes(ctx context.Context, labelSelectors []string) ([]IngressNode, error)
+
+	// SyncState synchronizes the aliases of all ingress nodes to match the desired endpoints.
+	SyncState(ctx context.Context, nodes []IngressNode, endpoints []*endpoint.Endpoint) error
+
+	// Plan returns the changes SyncState would make to the ingress nodes, without applying them.
+	Plan(nodes []IngressNode, endpoints []*endpoint.Endpoint) []NodePlan
+
+	// State returns the current and desired aliases of every ingress node, and the changes
+	// SyncState would make to them.
+	State(nodes []IngressNode, endpoints []*endpoint.Endpoint) []NodeState
+}
+
+// NodePlan is the set of metadata changes planned for a single ingress node.
+type NodePlan struct {
+	// Server is the name of the server.
+	Server string `json:"server"`
+	// ID is the ID of the server.
+	ID string `json:"id"`
+	// Update holds the keys to set and their new values.
+	Update map[string]string `json:"update,omitempty"`
+	// Delete holds the keys to remove.
+	Delete []string `json:"delete,omitempty"`
+}
+
+// planNodesMetadata diffs the current and desired metadata of every node and returns the plans of
+// the nodes that change. current and desired are aligned with nodes.
+func planNodesMetadata(nodes []IngressNode, current, desired []map[string]string) []NodePlan {
+	plans := []NodePlan{}
+	for i, node := range nodes {
+		toUpdate, toDelete := DiffMetadata(current[i], desired[i])
+		if len(toUpdate) == 0 && len(toDelete) == 0 {
+			continue
+		}
+		sort.Strings(toDelete)
+		plans = append(plans, NodePlan{Server: node.Name, ID: node.ID, Update: toUpdate, Delete: toDelete})
+	}
+	return plans
+}
+
+// NodeState is the current and desired managed metadata of a single ingress node.
+type NodeState struct {
+	// Server is the name of the server.
+	Server string `json:"server"`
+	// ID is the ID of the server.
+	ID string `json:"id"`
+	// Current holds the managed metadata the node carries.
+	Current map[string]string `json:"current"`
+	// Desired holds the managed metadata the node should carry.
+	Desired map[string]string `json:"desired"`
+	// Update holds the keys to set and their new values to reach the desired metadata.
+	Update map[string]string `json:"update,omitempty"`
+	// Delete holds the keys to remove to reach the desired metadata.
+	Delete []string `json:"delete,omitempty"`
+}
+
+// nodesState returns the state of every node, with the diff of its current and desired metadata.
+// current and desired are aligned with nodes.
+func nodesState(nodes []IngressNode, current, desired []map[string]string) []NodeState {
+	states := make([]NodeState, len(nodes))
+	for i, node := range nodes {
+		toUpdate, toDelete := DiffMetadata(current[i], desired[i])
+		sort.Strings(toDelete)
+		states[i] = NodeState{Server: node.Name, ID: node.ID, Current: current[i], Desired: desired[i], Update: toUpdate, Delete: toDelete}
+	}
+	return states
+}
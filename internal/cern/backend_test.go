@@ -0,0 +1,60 @@
+package cern
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/gophercloud/gophercloud/v2/openstack/compute/v2/servers"
+)
+
+func TestPlanNodesMetadata(t *testing.T) {
+	nodes := []IngressNode{
+		{Server: servers.Server{ID: "a", Name: "node-a"}},
+		{Server: servers.Server{ID: "b", Name: "node-b"}},
+	}
+	current := []map[string]string{
+		{"landb-alias": "foo.cern.ch--load-0-"},
+		{"landb-alias": "foo.cern.ch--load-1-", "landb-alias2": "bar.cern.ch--load-1-"},
+	}
+	desired := []map[string]string{
+		{"landb-alias": "foo.cern.ch--load-0-"},
+		{"landb-alias": "baz.cern.ch--load-1-"},
+	}
+
+	expected := []NodePlan{
+		{Server: "node-b", ID: "b", Update: map[string]string{"landb-alias": "baz.cern.ch--load-1-"}, Delete: []string{"landb-alias2"}},
+	}
+	if got := planNodesMetadata(nodes, current, desired); !reflect.DeepEqual(got, expected) {
+		t.Errorf("planNodesMetadata() = %v, want %v", got, expected)
+	}
+}
+
+func TestNodesState(t *testing.T) {
+	nodes := []IngressNode{
+		{Server: servers.Server{ID: "a", Name: "node-a"}},
+		{Server: servers.Server{ID: "b", Name: "node-b"}},
+	}
+	current := []map[string]string{
+		{"landb-alias": "foo.cern.ch--load-0-"},
+		{"landb-alias": "foo.cern.ch--load-1-", "landb-alias2": "bar.cern.ch--load-1-", "landb-alias3": "qux.cern.ch--load-1-"},
+	}
+	desired := []map[string]string{
+		{"landb-alias": "foo.cern.ch--load-0-"},
+		{"landb-alias": "baz.cern.ch--load-1-"},
+	}
+
+	expected := []NodeState{
+		{Server: "node-a", ID: "a", Current: current[0], Desired: desired[0], Update: map[string]string{}, Delete: []string{}},
+		{
+			Server:  "node-b",
+			ID:      "b",
+			Current: current[1],
+			Desired: desired[1],
+			Update:  map[string]string{"landb-alias": "baz.cern.ch--load-1-"},
+			Delete:  []string{"landb-alias2", "landb-alias3"},
+		},
+	}
+	if got := nodesState(nodes, current, desired); !reflect.DeepEqual(got, expected) {
+		t.Errorf("nodesState() = %v, want %v", got, expected)
+	}
+}
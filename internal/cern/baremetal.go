@@ -0,0 +1,28 @@
+package cern
+
+import "strings"
+
+// IsBareMetal reports whether a server is backed by an Ironic bare-metal node.
+//
+// Bare-metal flavors request no virtual resources and a single custom resource class, e.g.
+// `resources:VCPU=0` and `resources:CUSTOM_BAREMETAL_P1=1`. The flavor extra specs are only
+// reported from compute microversion 2.47 and may be hidden by policy, so flavors can also be
+// listed explicitly by name.
+func IsBareMetal(flavor map[string]any, flavors map[string]struct{}) bool {
+	if name, ok := flavor["original_name"].(string); ok {
+		if _, ok := flavors[name]; ok {
+			return true
+		}
+	}
+
+	extraSpecs, ok := flavor["extra_specs"].(map[string]any)
+	if !ok || extraSpecs["resources:VCPU"] != "0" {
+		return false
+	}
+	for key := range extraSpecs {
+		if strings.HasPrefix(key, "resources:CUSTOM_") {
+			return true
+		}
+	}
+	return false
+}
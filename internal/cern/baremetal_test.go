@@ -0,0 +1,47 @@
+package cern
+
+import "testing"
+
+func TestIsBareMetal(t *testing.T) {
+	flavors := map[string]struct{}{"p1.dl8040": {}}
+
+	tests := []struct {
+		name     string
+		flavor   map[string]any
+		expected bool
+	}{
+		{
+			name:     "Custom resource class",
+			flavor:   map[string]any{"original_name": "p1.other", "extra_specs": map[string]any{"resources:VCPU": "0", "resources:CUSTOM_BAREMETAL_P1": "1"}},
+			expected: true,
+		},
+		{
+			name:     "Listed flavor",
+			flavor:   map[string]any{"original_name": "p1.dl8040"},
+			expected: true,
+		},
+		{
+			name:     "Virtual machine",
+			flavor:   map[string]any{"original_name": "m2.large", "extra_specs": map[string]any{"hw:cpu_policy": "dedicated"}},
+			expected: false,
+		},
+		{
+			name:     "Custom resource with virtual CPUs",
+			flavor:   map[string]any{"extra_specs": map[string]any{"resources:CUSTOM_GPU": "1"}},
+			expected: false,
+		},
+		{
+			name:     "No flavor details",
+			flavor:   map[string]any{"id": "1234"},
+			expected: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsBareMetal(tt.flavor, flavors); got != tt.expected {
+				t.Errorf("IsBareMetal() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package cern
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gophercloud/gophercloud/v2/openstack/compute/v2/servers"
+)
+
+// serverIndex is a listing of OpenStack servers indexed by UUID and by name.
+//
+// The index is built once per listing, so matching the ingress nodes against the servers of large
+// projects costs a lookup per node instead of a scan of every server on each request. It is shared
+// by the concurrent requests and must not be modified.
+type serverIndex struct {
+	// servers holds the servers in the order of the listing.
+	servers []servers.Server
+	// byID maps the UUIDs of the servers to their index in servers.
+	byID map[string]int
+	// byName maps the names of the servers to their indexes in servers, several servers possibly
+	// sharing a name.
+	byName map[string][]int
+}
+
+// newServerIndex indexes a listing of servers.
+func newServerIndex(list []servers.Server) *serverIndex {
+	if list == nil {
+		list = []servers.Server{}
+	}
+	index := &serverIndex{
+		servers: list,
+		byID:    make(map[string]int, len(list)),
+		byName:  make(map[string][]int, len(list)),
+	}
+	for i, server := range list {
+		index.byID[server.ID] = i
+		index.byName[server.Name] = append(index.byName[server.Name], i)
+	}
+	return index
+}
+
+// server returns the server with the given UUID.
+func (x *serverIndex) server(id string) (*servers.Server, bool) {
+	i, ok := x.byID[id]
+	if !ok {
+		return nil, false
+	}
+	return &x.servers[i], true
+}
+
+// named calls fn with every server with the given name, in the order of the listing.
+func (x *serverIndex) named(name string, fn func(*servers.Server)) {
+	for _, i := range x.byName[name] {
+		fn(&x.servers[i])
+	}
+}
+
+// serverCache holds the last listing of OpenStack servers, indexed, for a limited time.
+//
+// ExternalDNS calls Records and ApplyChanges back to back within the same sync window.
+// Caching the listing lets both calls share a single scan of the project instead of
+// re-listing hundreds of servers twice. A zero TTL disables the cache.
+type serverCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	index   *serverIndex
+	expires time.Time
+}
+
+// get returns the cached listing if it has not expired yet.
+func (c *serverCache) get() (*serverIndex, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.index == nil || time.Now().After(c.expires) {
+		return nil, false
+	}
+	return c.index, true
+}
+
+// set indexes a new listing of servers, stores it unless the cache is disabled, and returns it.
+func (c *serverCache) set(list []servers.Server) *serverIndex {
+	index := newServerIndex(list)
+	if c.ttl <= 0 {
+		return index
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.index = index
+	c.expires = time.Now().Add(c.ttl)
+	return index
+}
+
+// invalidate drops the cached listing, forcing the next lookup to hit the OpenStack API.
+func (c *serverCache) invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.index = nil
+}
@@ -0,0 +1,46 @@
+package cern
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// CanaryMetadataKey is the metadata key written, then deleted, to check that the metadata of a
+// server may be written. It is neither an alias key nor the owner key, so that the check never
+// changes the aliases of the server.
+const CanaryMetadataKey = "external-dns-cern-canary"
+
+// CheckListServers lists the servers from the compute API, bypassing the cache, and returns how
+// many were listed, e.g. to measure the latency of the listing.
+func (m *Manager) CheckListServers(ctx context.Context) (int, error) {
+	m.InvalidateCache()
+	index, err := m.listServers(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return len(index.servers), nil
+}
+
+// CheckMetadataWrite checks that the metadata of the server may be written, by setting the canary
+// key, reading it back, and deleting it. The key is deleted even when reading it back fails.
+func (m *Manager) CheckMetadataWrite(ctx context.Context, serverID string) (err error) {
+	value := time.Now().UTC().Format(time.RFC3339)
+	if err := m.UpdateNodeMetadata(ctx, serverID, map[string]string{CanaryMetadataKey: value}, nil); err != nil {
+		return err
+	}
+	defer func() {
+		if deleteErr := m.UpdateNodeMetadata(ctx, serverID, nil, []string{CanaryMetadataKey}); deleteErr != nil && err == nil {
+			err = deleteErr
+		}
+	}()
+
+	metadata, err := m.getNodeMetadata(ctx, serverID)
+	if err != nil {
+		return err
+	}
+	if metadata[CanaryMetadataKey] != value {
+		return fmt.Errorf("metadata key %s of server %s was not written", CanaryMetadataKey, serverID)
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+package cern
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestManagerCheckMetadataWrite(t *testing.T) {
+	t.Run("Canary key is written and deleted", func(t *testing.T) {
+		metadata := map[string]string{"landb-alias": "a--load-1-"}
+		m := newMetadataServer(t, metadata, 0)
+		if err := m.CheckMetadataWrite(context.Background(), "id"); err != nil {
+			t.Errorf("CheckMetadataWrite() error = %v", err)
+		}
+		if want := map[string]string{"landb-alias": "a--load-1-"}; !reflect.DeepEqual(metadata, want) {
+			t.Errorf("metadata = %v, want %v", metadata, want)
+		}
+	})
+
+	t.Run("Dropped write is reported", func(t *testing.T) {
+		metadata := map[string]string{}
+		m := newMetadataServer(t, metadata, 1)
+		if err := m.CheckMetadataWrite(context.Background(), "id"); err == nil {
+			t.Error("CheckMetadataWrite() error = nil, want an error")
+		}
+		if _, ok := metadata[CanaryMetadataKey]; ok {
+			t.Errorf("metadata = %v, want the canary key deleted", metadata)
+		}
+	})
+}
@@ -0,0 +1,180 @@
+package cern
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Modes of the OpenStack cassette.
+const (
+	// CassetteOff sends the OpenStack requests to the network only.
+	CassetteOff = "off"
+	// CassetteRecord sends the OpenStack requests to the network, and records the interactions to
+	// the cassette file.
+	CassetteRecord = "record"
+	// CassetteReplay answers the OpenStack requests with the interactions of the cassette file,
+	// without network access.
+	CassetteReplay = "replay"
+)
+
+// redacted replaces the secrets of the recorded interactions.
+const redacted = "REDACTED"
+
+// Interaction is a request to OpenStack and its response, as recorded in a cassette.
+type Interaction struct {
+	// Method is the method of the request.
+	Method string `json:"method"`
+	// URL is the URL of the request.
+	URL string `json:"url"`
+	// RequestBody is the body of the request, redacted for the Keystone authentication requests.
+	RequestBody string `json:"requestBody,omitempty"`
+	// Status is the status code of the response.
+	Status int `json:"status"`
+	// Header holds the headers of the response, the Keystone tokens redacted.
+	Header http.Header `json:"header,omitempty"`
+	// Body is the body of the response.
+	Body string `json:"body,omitempty"`
+}
+
+// Cassette is the list of the interactions with OpenStack recorded to a YAML file, e.g. to capture
+// the responses of the CERN cloud once and replay them in tests, pagination and error bodies
+// included, without live credentials.
+type Cassette struct {
+	// Interactions holds the interactions in the order they were recorded.
+	Interactions []Interaction `json:"interactions"`
+}
+
+// cassetteTransport records the OpenStack interactions to a cassette file, or replays them.
+//
+// The cassette is written after every recorded interaction, so that it is complete even when the
+// process is killed. A request is replayed with the first interaction not replayed yet that has
+// the same method and URL, so that repeated requests get the successive recorded responses.
+type cassetteTransport struct {
+	// base sends the recorded requests, nil when replaying.
+	base http.RoundTripper
+	path string
+
+	// mu guards cassette and replayed.
+	mu       sync.Mutex
+	cassette Cassette
+	// replayed flags the interactions already replayed.
+	replayed []bool
+}
+
+// newCassetteTransport returns the transport of the cassette mode: base itself when off, base
+// recording to the file, or the transport replaying the file.
+func newCassetteTransport(base http.RoundTripper, mode, path string) (http.RoundTripper, error) {
+	switch mode {
+	case "", CassetteOff:
+		return base, nil
+	case CassetteRecord:
+		return &cassetteTransport{base: base, path: path}, nil
+	case CassetteReplay:
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the cassette: %w", err)
+		}
+		t := &cassetteTransport{path: path}
+		if err := yaml.Unmarshal(data, &t.cassette); err != nil {
+			return nil, fmt.Errorf("failed to decode the cassette %s: %w", path, err)
+		}
+		t.replayed = make([]bool, len(t.cassette.Interactions))
+		return t, nil
+	default:
+		return nil, fmt.Errorf("invalid cassette mode %q", mode)
+	}
+}
+
+// RoundTrip records or replays the interaction of the request.
+func (t *cassetteTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var requestBody []byte
+	if req.Body != nil {
+		var err error
+		if requestBody, err = io.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+		req.Body = io.NopCloser(bytes.NewReader(requestBody))
+	}
+
+	if t.base == nil {
+		return t.replay(req)
+	}
+	return t.record(req, requestBody)
+}
+
+// replay answers the request with the first matching interaction not replayed yet.
+func (t *cassetteTransport) replay(req *http.Request) (*http.Response, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for i, interaction := range t.cassette.Interactions {
+		if t.replayed[i] || interaction.Method != req.Method || interaction.URL != req.URL.String() {
+			continue
+		}
+		t.replayed[i] = true
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", interaction.Status, http.StatusText(interaction.Status)),
+			StatusCode:    interaction.Status,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        interaction.Header.Clone(),
+			Body:          io.NopCloser(strings.NewReader(interaction.Body)),
+			ContentLength: int64(len(interaction.Body)),
+			Request:       req,
+		}, nil
+	}
+	return nil, fmt.Errorf("no interaction recorded in %s for %s %s", t.path, req.Method, req.URL)
+}
+
+// record sends the request and records its interaction.
+func (t *cassetteTransport) record(req *http.Request, requestBody []byte) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		// Network errors are not recorded, the request fails in replay mode instead.
+		return nil, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	interaction := Interaction{
+		Method:      req.Method,
+		URL:         req.URL.String(),
+		RequestBody: string(requestBody),
+		Status:      resp.StatusCode,
+		Header:      resp.Header.Clone(),
+		Body:        string(body),
+	}
+	// The credentials and tokens are never written to the cassette.
+	if strings.HasSuffix(req.URL.Path, "/auth/tokens") && len(requestBody) > 0 {
+		interaction.RequestBody = redacted
+	}
+	if interaction.Header.Get("X-Subject-Token") != "" {
+		interaction.Header.Set("X-Subject-Token", redacted)
+	}
+	interaction.Header.Del("Set-Cookie")
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.cassette.Interactions = append(t.cassette.Interactions, interaction)
+	data, err := yaml.Marshal(&t.cassette)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode the cassette: %w", err)
+	}
+	if err := os.WriteFile(t.path, data, 0o600); err != nil {
+		return nil, fmt.Errorf("failed to write the cassette: %w", err)
+	}
+	return resp, nil
+}
@@ -0,0 +1,92 @@
+package cern
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gophercloud/gophercloud/v2"
+)
+
+// newTransportClient creates a client of the compute API at endpoint sending its requests with transport.
+func newTransportClient(endpoint string, transport http.RoundTripper) *Client {
+	provider := &gophercloud.ProviderClient{HTTPClient: http.Client{Transport: transport}}
+	return &Client{compute: &gophercloud.ServiceClient{ProviderClient: provider, Endpoint: endpoint + "/"}}
+}
+
+func TestCassetteTransport(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.URL.Path == "/servers/detail" && r.URL.Query().Get("marker") == "":
+			_ = json.NewEncoder(w).Encode(map[string]any{
+				"servers":       []map[string]any{{"id": "a", "name": "node-a", "status": "ACTIVE"}},
+				"servers_links": []map[string]string{{"rel": "next", "href": server.URL + "/servers/detail?marker=a"}},
+			})
+		case r.URL.Path == "/servers/detail":
+			_ = json.NewEncoder(w).Encode(map[string]any{"servers": []map[string]any{{"id": "b", "name": "node-b", "status": "ACTIVE"}}})
+		case r.URL.Path == "/auth/tokens":
+			w.Header().Set("X-Subject-Token", "secret-token")
+			w.WriteHeader(http.StatusCreated)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"itemNotFound": {"code": 404, "message": "Instance could not be found."}}`))
+		}
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "cassette.yaml")
+	recorder, err := newCassetteTransport(http.DefaultTransport, CassetteRecord, path)
+	if err != nil {
+		t.Fatalf("newCassetteTransport() error = %v", err)
+	}
+	client := newTransportClient(server.URL, recorder)
+
+	recorded, err := client.ListServers(ctx)
+	if err != nil || len(recorded) != 2 {
+		t.Fatalf("ListServers() = %v, %v, want the servers of both pages", recorded, err)
+	}
+	if _, err := client.GetMetadata(ctx, "missing"); !gophercloud.ResponseCodeIs(err, http.StatusNotFound) {
+		t.Fatalf("GetMetadata() error = %v, want a 404", err)
+	}
+	req, _ := http.NewRequest(http.MethodPost, server.URL+"/auth/tokens", strings.NewReader(`{"password": "secret-password"}`))
+	resp, err := recorder.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("RoundTrip() error = %v", err)
+	}
+	resp.Body.Close()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read the cassette: %v", err)
+	}
+	if strings.Contains(string(data), "secret") {
+		t.Errorf("cassette = %s, want the credentials and tokens redacted", data)
+	}
+
+	// The interactions are replayed once the server is gone.
+	server.Close()
+	replayer, err := newCassetteTransport(nil, CassetteReplay, path)
+	if err != nil {
+		t.Fatalf("newCassetteTransport() error = %v", err)
+	}
+	client = newTransportClient(server.URL, replayer)
+
+	replayed, err := client.ListServers(ctx)
+	if err != nil || len(replayed) != 2 || replayed[0].ID != "a" || replayed[1].ID != "b" {
+		t.Errorf("replayed ListServers() = %v, %v, want the recorded servers", replayed, err)
+	}
+	if _, err := client.GetMetadata(ctx, "missing"); !gophercloud.ResponseCodeIs(err, http.StatusNotFound) {
+		t.Errorf("replayed GetMetadata() error = %v, want the recorded 404", err)
+	}
+	if _, err := client.ListServers(ctx); err == nil || !strings.Contains(err.Error(), "no interaction recorded") {
+		t.Errorf("ListServers() beyond the cassette error = %v, want no interaction recorded", err)
+	}
+}
@@ -0,0 +1,72 @@
+package cern
+
+import (
+	"context"
+	"strings"
+
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/k8s"
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/log"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+// ApplyCernAliases applies the settings declared by CernAlias resources to the A endpoints of the
+// matching DNS names, and retains the current aliases they protect.
+//
+// A CernAlias node selector, and the LanDB interface requirement derived from its interface,
+// replace the node selector property set through the endpoint annotations. The endpoints are copied
+// before being changed, so the caller's endpoints keep their own properties. CernAlias resources with
+// an invalid node selector are ignored, and logged to the logger of ctx.
+func ApplyCernAliases(ctx context.Context, current, desired []*endpoint.Endpoint, aliases []k8s.CernAlias) []*endpoint.Endpoint {
+	selectors := make(map[string]string, len(aliases))
+	var protected []string
+	for _, alias := range aliases {
+		name := normalizeDNSName(alias.Spec.Alias)
+		if alias.Spec.Protected {
+			protected = append(protected, name)
+		}
+
+		selector, err := cernAliasSelector(alias.Spec)
+		if err != nil {
+			log.FromContext(ctx).Error("Ignoring the node selector of CernAlias %s: %v", alias.Name, err)
+			continue
+		}
+		if selector != "" {
+			selectors[name] = selector
+		}
+	}
+
+	// The protected names are plain DNS names, never patterns.
+	desired = (&ProtectedAliases{names: stringSet(protected)}).RetainProtected(ctx, current, desired)
+
+	result := make([]*endpoint.Endpoint, len(desired))
+	for i, ep := range desired {
+		selector, ok := selectors[normalizeDNSName(ep.DNSName)]
+		if !ok || ep.RecordType != endpoint.RecordTypeA {
+			result[i] = ep
+			continue
+		}
+		ep = ep.DeepCopy()
+		ep.SetProviderSpecificProperty(NodeSelectorProperty, selector)
+		result[i] = ep
+	}
+	return result
+}
+
+// cernAliasSelector returns the node selector of a CernAlias, combining its node selector and
+// the LanDB interface requirement. It is empty when neither is set.
+func cernAliasSelector(spec k8s.CernAliasSpec) (string, error) {
+	var requirements []string
+	if spec.NodeSelector != "" {
+		requirements = append(requirements, spec.NodeSelector)
+	}
+	if spec.Interface != "" {
+		requirements = append(requirements, LanDBInterfaceLabel+"="+spec.Interface)
+	}
+
+	selector := strings.Join(requirements, ",")
+	if _, err := labels.Parse(selector); err != nil {
+		return "", err
+	}
+	return selector, nil
+}
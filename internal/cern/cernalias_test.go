@@ -0,0 +1,54 @@
+package cern
+
+import (
+	"context"
+	"testing"
+
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/k8s"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+func TestApplyCernAliases(t *testing.T) {
+	alias := func(spec k8s.CernAliasSpec) k8s.CernAlias {
+		return k8s.CernAlias{ObjectMeta: metav1.ObjectMeta{Name: spec.Alias}, Spec: spec}
+	}
+	aliases := []k8s.CernAlias{
+		alias(k8s.CernAliasSpec{Alias: "zoned.cern.ch", NodeSelector: "zone=a", Interface: "eth1"}),
+		alias(k8s.CernAliasSpec{Alias: "kept.cern.ch", Protected: true}),
+		alias(k8s.CernAliasSpec{Alias: "invalid.cern.ch", NodeSelector: "zone in ("}),
+	}
+
+	annotated := endpoint.NewEndpoint("zoned.cern.ch", endpoint.RecordTypeA, "")
+	annotated.SetProviderSpecificProperty(NodeSelectorProperty, "zone=b")
+	invalid := endpoint.NewEndpoint("invalid.cern.ch", endpoint.RecordTypeA, "")
+	current := []*endpoint.Endpoint{
+		endpoint.NewEndpoint("kept.cern.ch", endpoint.RecordTypeA, ""),
+		endpoint.NewEndpoint("removed.cern.ch", endpoint.RecordTypeA, ""),
+	}
+
+	got := ApplyCernAliases(context.Background(), current, []*endpoint.Endpoint{annotated, invalid}, aliases)
+
+	selectors := make(map[string]string)
+	for _, ep := range got {
+		selectors[ep.DNSName], _ = ep.GetProviderSpecificProperty(NodeSelectorProperty)
+	}
+	expected := map[string]string{
+		"zoned.cern.ch":   "zone=a," + LanDBInterfaceLabel + "=eth1",
+		"invalid.cern.ch": "",
+		"kept.cern.ch":    "",
+	}
+	if len(selectors) != len(expected) {
+		t.Fatalf("ApplyCernAliases() = %v, want %v", selectors, expected)
+	}
+	for name, selector := range expected {
+		if got, ok := selectors[name]; !ok || got != selector {
+			t.Errorf("node selector of %s = %q, want %q", name, got, selector)
+		}
+	}
+
+	// The caller's endpoint is left untouched.
+	if value, _ := annotated.GetProviderSpecificProperty(NodeSelectorProperty); value != "zone=b" {
+		t.Errorf("annotated endpoint selector changed to %q", value)
+	}
+}
@@ -0,0 +1,228 @@
+package cern
+
+import (
+	"cmp"
+	"slices"
+	"sort"
+
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+// DesiredEndpoints applies a plan to the current set of endpoints and returns the resulting desired set.
+// Endpoints are matched by DNS name, record type and set identifier, so updates that only change targets
+// or provider-specific properties replace the matching endpoint instead of being treated as delete-then-create.
+// The returned bool reports whether the plan changes anything at all; callers can use it to skip no-op syncs.
+//
+// Only the endpoints of the plan are indexed. The current endpoints, which may number tens of thousands, are
+// merged with them in a single pass in key order, so that they are not copied into a map: besides the returned
+// slice, the memory used is proportional to the size of the plan. Current endpoints sorted by key, as returned by
+// ParseEndpointsFromMetadata, are not copied at all. The desired endpoints are returned sorted by key.
+func DesiredEndpoints(current []*endpoint.Endpoint, changes *plan.Changes) ([]*endpoint.Endpoint, bool) {
+	edits := planEdits(changes)
+	keys := make([]endpoint.EndpointKey, 0, len(edits))
+	for key := range edits {
+		keys = append(keys, key)
+	}
+	slices.SortFunc(keys, compareEndpointKeys)
+
+	current = sortedEndpoints(current)
+	result := make([]*endpoint.Endpoint, 0, len(current)+len(changes.Create))
+	changed := false
+	for i, j := 0, 0; i < len(current) || j < len(keys); {
+		// Current endpoints untouched by the plan are kept as is.
+		if j == len(keys) || (i < len(current) && compareEndpointKeys(current[i].Key(), keys[j]) < 0) {
+			result = append(result, current[i])
+			i++
+			continue
+		}
+
+		var ep *endpoint.Endpoint
+		if i < len(current) && compareEndpointKeys(current[i].Key(), keys[j]) == 0 {
+			ep = current[i]
+			i++
+		}
+		ep, edited := applyEdits(ep, edits[keys[j]])
+		changed = changed || edited
+		if ep != nil {
+			result = append(result, ep)
+		}
+		j++
+	}
+
+	return result, changed
+}
+
+// EndpointProperties indexes the provider-specific properties of endpoints by key.
+//
+// The node metadata only records which names are aliased where, so the endpoints reconstructed from
+// it lack the properties ExternalDNS set, e.g. the node selector. They are restored from the desired
+// endpoints last applied, so that ExternalDNS sees the properties it planned and does not update the
+// endpoints again on every loop, and so that the endpoints left untouched by a plan keep them.
+type EndpointProperties map[endpoint.EndpointKey]endpoint.ProviderSpecific
+
+// NewEndpointProperties indexes the provider-specific properties of the given endpoints, skipping
+// the endpoints without any.
+func NewEndpointProperties(endpoints []*endpoint.Endpoint) EndpointProperties {
+	properties := make(EndpointProperties)
+	for _, ep := range endpoints {
+		if len(ep.ProviderSpecific) > 0 {
+			properties[ep.Key()] = ep.ProviderSpecific
+		}
+	}
+	return properties
+}
+
+// Restore sets the provider-specific properties indexed for the key of the endpoint on it, and
+// returns the endpoint. The properties are copied, so the endpoint can be modified.
+func (p EndpointProperties) Restore(ep *endpoint.Endpoint) *endpoint.Endpoint {
+	if properties, ok := p[ep.Key()]; ok {
+		ep.ProviderSpecific = slices.Clone(properties)
+	}
+	return ep
+}
+
+// planEdits returns the edits of a plan to the endpoint of every key it touches, in the order they apply: a nil
+// endpoint deletes the endpoint, and others replace it.
+//
+// Deletions are applied first, then updates, then creations. UpdateOld and UpdateNew are paired by key; an old
+// endpoint without a matching new one is removed, and a new endpoint without a matching old one is added.
+func planEdits(changes *plan.Changes) map[endpoint.EndpointKey][]*endpoint.Endpoint {
+	edits := make(map[endpoint.EndpointKey][]*endpoint.Endpoint, len(changes.Delete)+len(changes.UpdateNew)+len(changes.Create))
+	for _, ep := range changes.Delete {
+		edits[ep.Key()] = append(edits[ep.Key()], nil)
+	}
+
+	updated := make(map[endpoint.EndpointKey]struct{}, len(changes.UpdateNew))
+	for _, ep := range changes.UpdateNew {
+		updated[ep.Key()] = struct{}{}
+	}
+	for _, old := range changes.UpdateOld {
+		if _, ok := updated[old.Key()]; !ok {
+			edits[old.Key()] = append(edits[old.Key()], nil)
+		}
+	}
+
+	for _, ep := range changes.UpdateNew {
+		edits[ep.Key()] = append(edits[ep.Key()], ep)
+	}
+	for _, ep := range changes.Create {
+		edits[ep.Key()] = append(edits[ep.Key()], ep)
+	}
+	return edits
+}
+
+// applyEdits applies the edits of a key to its current endpoint, nil when absent, and returns the resulting
+// endpoint, nil when deleted, and whether any edit changed the endpoint.
+func applyEdits(ep *endpoint.Endpoint, edits []*endpoint.Endpoint) (*endpoint.Endpoint, bool) {
+	changed := false
+	for _, edit := range edits {
+		switch {
+		case edit == nil:
+			changed = changed || ep != nil
+		case ep == nil || !sameEndpoint(ep, edit):
+			changed = true
+		}
+		ep = edit
+	}
+	return ep, changed
+}
+
+// sortedEndpoints returns the endpoints sorted by key, without duplicate keys. The endpoints are returned as is
+// when already sorted, and otherwise copied, the last endpoint of a key winning.
+func sortedEndpoints(endpoints []*endpoint.Endpoint) []*endpoint.Endpoint {
+	if slices.IsSortedFunc(endpoints, compareEndpointsStrictly) {
+		return endpoints
+	}
+
+	sorted := slices.Clone(endpoints)
+	slices.SortStableFunc(sorted, compareEndpoints)
+	unique := sorted[:0]
+	for _, ep := range sorted {
+		if len(unique) > 0 && compareEndpoints(unique[len(unique)-1], ep) == 0 {
+			unique[len(unique)-1] = ep
+			continue
+		}
+		unique = append(unique, ep)
+	}
+	return unique
+}
+
+// sameEndpoint reports whether two endpoints with the same key are equivalent.
+func sameEndpoint(a, b *endpoint.Endpoint) bool {
+	if !a.Targets.Same(b.Targets) || len(a.ProviderSpecific) != len(b.ProviderSpecific) {
+		return false
+	}
+	for _, prop := range a.ProviderSpecific {
+		if value, ok := b.GetProviderSpecificProperty(prop.Name); !ok || value != prop.Value {
+			return false
+		}
+	}
+	return true
+}
+
+// compareEndpointKeys orders endpoint keys by DNS name, record type and set identifier.
+func compareEndpointKeys(a, b endpoint.EndpointKey) int {
+	return cmp.Or(
+		cmp.Compare(a.DNSName, b.DNSName),
+		cmp.Compare(a.RecordType, b.RecordType),
+		cmp.Compare(a.SetIdentifier, b.SetIdentifier),
+	)
+}
+
+// compareEndpoints orders endpoints by key.
+func compareEndpoints(a, b *endpoint.Endpoint) int {
+	return compareEndpointKeys(a.Key(), b.Key())
+}
+
+// compareEndpointsStrictly orders endpoints by key, endpoints of the same key comparing as less
+// than each other, so that slices.IsSortedFunc reports duplicate keys as out of order.
+func compareEndpointsStrictly(a, b *endpoint.Endpoint) int {
+	if c := compareEndpoints(a, b); c != 0 {
+		return c
+	}
+	return -1
+}
+
+// StripTTL clears the TTL of every endpoint, since LanDB aliases have no TTL concept.
+// It returns the DNS names of the endpoints whose TTL was dropped.
+func StripTTL(endpoints []*endpoint.Endpoint) []string {
+	var dropped []string
+	for _, ep := range endpoints {
+		if ep.RecordTTL.IsConfigured() {
+			dropped = append(dropped, ep.DNSName)
+			ep.RecordTTL = 0
+		}
+	}
+	return dropped
+}
+
+// ChangedNames returns the DNS names of the A endpoints present in desired but not in current,
+// and the ones present in current but not in desired.
+func ChangedNames(current, desired []*endpoint.Endpoint) ([]string, []string) {
+	names := func(endpoints []*endpoint.Endpoint) map[string]struct{} {
+		set := make(map[string]struct{}, len(endpoints))
+		for _, ep := range endpoints {
+			if ep.RecordType == endpoint.RecordTypeA {
+				set[normalizeDNSName(ep.DNSName)] = struct{}{}
+			}
+		}
+		return set
+	}
+	currentNames, desiredNames := names(current), names(desired)
+
+	var created, deleted []string
+	for name := range desiredNames {
+		if _, ok := currentNames[name]; !ok {
+			created = append(created, name)
+		}
+	}
+	for name := range currentNames {
+		if _, ok := desiredNames[name]; !ok {
+			deleted = append(deleted, name)
+		}
+	}
+	sort.Strings(created)
+	sort.Strings(deleted)
+	return created, deleted
+}
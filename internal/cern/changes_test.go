@@ -0,0 +1,269 @@
+package cern
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/gophercloud/gophercloud/v2/openstack/compute/v2/servers"
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/log"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+func TestDesiredEndpoints(t *testing.T) {
+	current := []*endpoint.Endpoint{
+		endpoint.NewEndpoint("foo.cern.ch", endpoint.RecordTypeA, "10.0.0.1"),
+		endpoint.NewEndpoint("bar.cern.ch", endpoint.RecordTypeA, "10.0.0.1"),
+	}
+
+	tests := []struct {
+		name        string
+		changes     *plan.Changes
+		wantNames   []string
+		wantTargets map[string]string
+		wantChanged bool
+	}{
+		{
+			name:        "Empty plan",
+			changes:     &plan.Changes{},
+			wantNames:   []string{"bar.cern.ch", "foo.cern.ch"},
+			wantChanged: false,
+		},
+		{
+			name: "Create new",
+			changes: &plan.Changes{
+				Create: []*endpoint.Endpoint{endpoint.NewEndpoint("baz.cern.ch", endpoint.RecordTypeA, "10.0.0.1")},
+			},
+			wantNames:   []string{"bar.cern.ch", "baz.cern.ch", "foo.cern.ch"},
+			wantChanged: true,
+		},
+		{
+			name: "Create existing is a no-op",
+			changes: &plan.Changes{
+				Create: []*endpoint.Endpoint{endpoint.NewEndpoint("foo.cern.ch", endpoint.RecordTypeA, "10.0.0.1")},
+			},
+			wantNames:   []string{"bar.cern.ch", "foo.cern.ch"},
+			wantChanged: false,
+		},
+		{
+			name: "Delete missing is a no-op",
+			changes: &plan.Changes{
+				Delete: []*endpoint.Endpoint{endpoint.NewEndpoint("baz.cern.ch", endpoint.RecordTypeA)},
+			},
+			wantNames:   []string{"bar.cern.ch", "foo.cern.ch"},
+			wantChanged: false,
+		},
+		{
+			name: "Delete with different record type keeps endpoint",
+			changes: &plan.Changes{
+				Delete: []*endpoint.Endpoint{endpoint.NewEndpoint("foo.cern.ch", endpoint.RecordTypeCNAME)},
+			},
+			wantNames:   []string{"bar.cern.ch", "foo.cern.ch"},
+			wantChanged: false,
+		},
+		{
+			name: "Update targets only",
+			changes: &plan.Changes{
+				UpdateOld: []*endpoint.Endpoint{endpoint.NewEndpoint("foo.cern.ch", endpoint.RecordTypeA, "10.0.0.1")},
+				UpdateNew: []*endpoint.Endpoint{endpoint.NewEndpoint("foo.cern.ch", endpoint.RecordTypeA, "10.0.0.2")},
+			},
+			wantNames:   []string{"bar.cern.ch", "foo.cern.ch"},
+			wantTargets: map[string]string{"foo.cern.ch": "10.0.0.2"},
+			wantChanged: true,
+		},
+		{
+			name: "Identical update is a no-op",
+			changes: &plan.Changes{
+				UpdateOld: []*endpoint.Endpoint{endpoint.NewEndpoint("foo.cern.ch", endpoint.RecordTypeA, "10.0.0.1")},
+				UpdateNew: []*endpoint.Endpoint{endpoint.NewEndpoint("foo.cern.ch", endpoint.RecordTypeA, "10.0.0.1")},
+			},
+			wantNames:   []string{"bar.cern.ch", "foo.cern.ch"},
+			wantChanged: false,
+		},
+		{
+			name: "Update with unmatched old removes it",
+			changes: &plan.Changes{
+				UpdateOld: []*endpoint.Endpoint{endpoint.NewEndpoint("foo.cern.ch", endpoint.RecordTypeA, "10.0.0.1")},
+				UpdateNew: []*endpoint.Endpoint{endpoint.NewEndpoint("foo.cern.ch", endpoint.RecordTypeA, "10.0.0.1").WithSetIdentifier("b")},
+			},
+			wantNames:   []string{"bar.cern.ch", "foo.cern.ch"},
+			wantChanged: true,
+		},
+		{
+			name: "Delete then create of the same endpoint",
+			changes: &plan.Changes{
+				Delete: []*endpoint.Endpoint{endpoint.NewEndpoint("foo.cern.ch", endpoint.RecordTypeA, "10.0.0.1")},
+				Create: []*endpoint.Endpoint{endpoint.NewEndpoint("foo.cern.ch", endpoint.RecordTypeA, "10.0.0.3")},
+			},
+			wantNames:   []string{"bar.cern.ch", "foo.cern.ch"},
+			wantTargets: map[string]string{"foo.cern.ch": "10.0.0.3"},
+			wantChanged: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, changed := DesiredEndpoints(current, tt.changes)
+			if changed != tt.wantChanged {
+				t.Errorf("DesiredEndpoints() changed = %v, want %v", changed, tt.wantChanged)
+			}
+
+			var gotNames []string
+			for _, ep := range got {
+				gotNames = append(gotNames, ep.DNSName)
+				if want, ok := tt.wantTargets[ep.DNSName]; ok && ep.Targets[0] != want {
+					t.Errorf("DesiredEndpoints() %s targets = %v, want %s", ep.DNSName, ep.Targets, want)
+				}
+			}
+			if !reflect.DeepEqual(gotNames, tt.wantNames) {
+				t.Errorf("DesiredEndpoints() = %v, want %v", gotNames, tt.wantNames)
+			}
+		})
+	}
+}
+
+func TestDesiredEndpointsDuplicateKeys(t *testing.T) {
+	current := []*endpoint.Endpoint{
+		endpoint.NewEndpoint("foo.cern.ch", endpoint.RecordTypeA, "10.0.0.1"),
+		endpoint.NewEndpoint("bar.cern.ch", endpoint.RecordTypeA, "10.0.0.1"),
+		endpoint.NewEndpoint("foo.cern.ch", endpoint.RecordTypeA, "10.0.0.2"),
+	}
+
+	got, changed := DesiredEndpoints(current, &plan.Changes{})
+	if changed {
+		t.Errorf("DesiredEndpoints() changed = true, want false")
+	}
+	if len(got) != 2 || got[0].DNSName != "bar.cern.ch" || got[1].DNSName != "foo.cern.ch" || got[1].Targets[0] != "10.0.0.2" {
+		t.Errorf("DesiredEndpoints() = %v, want bar.cern.ch and the last foo.cern.ch", got)
+	}
+	if current[0].Targets[0] != "10.0.0.1" || current[1].DNSName != "bar.cern.ch" {
+		t.Errorf("DesiredEndpoints() reordered the current endpoints: %v", current)
+	}
+}
+
+func TestEndpointPropertiesRestore(t *testing.T) {
+	known := []*endpoint.Endpoint{
+		endpoint.NewEndpoint("zone.cern.ch", endpoint.RecordTypeA, "10.0.0.9").WithProviderSpecific(NodeSelectorProperty, "zone=a"),
+		endpoint.NewEndpoint("plain.cern.ch", endpoint.RecordTypeA, "10.0.0.9"),
+	}
+	properties := NewEndpointProperties(known)
+
+	current := []*endpoint.Endpoint{
+		endpoint.NewEndpoint("zone.cern.ch", endpoint.RecordTypeA, "10.0.0.1"),
+		endpoint.NewEndpoint("plain.cern.ch", endpoint.RecordTypeA, "10.0.0.1"),
+		endpoint.NewEndpoint("other.cern.ch", endpoint.RecordTypeA, "10.0.0.1"),
+	}
+	for _, ep := range current {
+		properties.Restore(ep)
+	}
+
+	if value, ok := current[0].GetProviderSpecificProperty(NodeSelectorProperty); !ok || value != "zone=a" {
+		t.Errorf("zone.cern.ch node selector = %q, %v, want zone=a", value, ok)
+	}
+	if !current[0].Targets.Same(endpoint.Targets{"10.0.0.1"}) {
+		t.Errorf("zone.cern.ch targets = %v, want the current ones", current[0].Targets)
+	}
+	for _, ep := range current[1:] {
+		if len(ep.ProviderSpecific) != 0 {
+			t.Errorf("%s properties = %v, want none", ep.DNSName, ep.ProviderSpecific)
+		}
+	}
+
+	// The restored properties are copies.
+	current[0].SetProviderSpecificProperty(NodeSelectorProperty, "zone=b")
+	if value, _ := known[0].GetProviderSpecificProperty(NodeSelectorProperty); value != "zone=a" {
+		t.Errorf("known node selector = %q after modifying the restored endpoint, want zone=a", value)
+	}
+
+	// Once restored, a plan that only lists another endpoint keeps them.
+	current = []*endpoint.Endpoint{properties.Restore(endpoint.NewEndpoint("zone.cern.ch", endpoint.RecordTypeA, "10.0.0.1"))}
+	desired, changed := DesiredEndpoints(current, &plan.Changes{Create: []*endpoint.Endpoint{endpoint.NewEndpoint("new.cern.ch", endpoint.RecordTypeA)}})
+	if !changed || len(desired) != 2 {
+		t.Fatalf("DesiredEndpoints() = %v, %v, want two endpoints", desired, changed)
+	}
+	if value, _ := desired[1].GetProviderSpecificProperty(NodeSelectorProperty); desired[1].DNSName != "zone.cern.ch" || value != "zone=a" {
+		t.Errorf("desired %s node selector = %q, want zone=a", desired[1].DNSName, value)
+	}
+}
+
+func TestStripTTL(t *testing.T) {
+	endpoints := []*endpoint.Endpoint{
+		endpoint.NewEndpointWithTTL("foo.cern.ch", endpoint.RecordTypeA, 300),
+		endpoint.NewEndpoint("bar.cern.ch", endpoint.RecordTypeA),
+	}
+
+	dropped := StripTTL(endpoints)
+	if !reflect.DeepEqual(dropped, []string{"foo.cern.ch"}) {
+		t.Errorf("StripTTL() dropped = %v, want [foo.cern.ch]", dropped)
+	}
+	for _, ep := range endpoints {
+		if ep.RecordTTL.IsConfigured() {
+			t.Errorf("StripTTL() left TTL %d on %s", ep.RecordTTL, ep.DNSName)
+		}
+	}
+}
+
+func TestChangedNames(t *testing.T) {
+	current := []*endpoint.Endpoint{
+		endpoint.NewEndpoint("kept.cern.ch", endpoint.RecordTypeA),
+		endpoint.NewEndpoint("removed.cern.ch", endpoint.RecordTypeA),
+	}
+	desired := []*endpoint.Endpoint{
+		endpoint.NewEndpoint("KEPT.cern.ch.", endpoint.RecordTypeA),
+		endpoint.NewEndpoint("added.cern.ch", endpoint.RecordTypeA),
+		endpoint.NewEndpoint("txt.cern.ch", endpoint.RecordTypeTXT),
+	}
+
+	created, deleted := ChangedNames(current, desired)
+	if !reflect.DeepEqual(created, []string{"added.cern.ch"}) {
+		t.Errorf("ChangedNames() created = %v, want [added.cern.ch]", created)
+	}
+	if !reflect.DeepEqual(deleted, []string{"removed.cern.ch"}) {
+		t.Errorf("ChangedNames() deleted = %v, want [removed.cern.ch]", deleted)
+	}
+}
+
+// benchmarkEndpointSet returns ingress nodes carrying the aliases of the given number of endpoints
+// and the changes of an ExternalDNS sync creating, updating and deleting a hundred of them.
+func benchmarkEndpointSet(size int) ([]IngressNode, *plan.Changes) {
+	var aliases []string
+	for i := range size {
+		aliases = append(aliases, fmt.Sprintf("app-%05d.cern.ch", i))
+	}
+
+	nodes := make([]IngressNode, 10)
+	for n := range nodes {
+		nodeAliases := make([]string, len(aliases))
+		for i, alias := range aliases {
+			nodeAliases[i] = formatAlias(alias, n)
+		}
+		nodes[n] = IngressNode{
+			Server:  servers.Server{ID: fmt.Sprintf("node-%d", n), Metadata: packAliases(nodeAliases)},
+			Address: fmt.Sprintf("10.0.0.%d", n),
+		}
+	}
+
+	changes := &plan.Changes{}
+	for i := range 100 {
+		changes.Create = append(changes.Create, endpoint.NewEndpoint(fmt.Sprintf("new-%03d.cern.ch", i), endpoint.RecordTypeA))
+		changes.UpdateOld = append(changes.UpdateOld, endpoint.NewEndpoint(aliases[2*i], endpoint.RecordTypeA))
+		changes.UpdateNew = append(changes.UpdateNew, endpoint.NewEndpoint(aliases[2*i], endpoint.RecordTypeA, "10.0.1.1"))
+		changes.Delete = append(changes.Delete, endpoint.NewEndpoint(aliases[2*i+1], endpoint.RecordTypeA))
+	}
+	return nodes, changes
+}
+
+// BenchmarkDesiredState measures the computation of an ApplyChanges call on 10000 endpoints carried
+// by 10 nodes: reading the current endpoints, applying the changes and generating the metadata.
+func BenchmarkDesiredState(b *testing.B) {
+	nodes, changes := benchmarkEndpointSet(10000)
+	logger := log.NewNopLogger()
+
+	b.ReportAllocs()
+	for b.Loop() {
+		current := ParseEndpointsFromMetadata(nodes, "default")
+		desired, _ := DesiredEndpoints(current, changes)
+		GenerateNodesMetadata(logger, nodes, desired, "default")
+	}
+}
@@ -1,46 +1,193 @@
 package cern
 
 import (
-	"crypto/tls"
+	"context"
+	"crypto/x509"
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
+	"os"
+	"strings"
+	"sync"
 
-	"github.com/gophercloud/gophercloud"
-	"github.com/gophercloud/gophercloud/openstack"
+	"github.com/gophercloud/gophercloud/v2"
+	"github.com/gophercloud/gophercloud/v2/openstack"
+	"github.com/gophercloud/gophercloud/v2/openstack/utils"
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/chaos"
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/log"
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/metrics"
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/tlsconfig"
 	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/pkg/config"
+	"golang.org/x/time/rate"
+)
+
+const (
+	// DefaultComputeMicroversion is the compute API microversion pinned by default, so the
+	// metadata semantics do not depend on the Nova version of the cell serving the request.
+	DefaultComputeMicroversion = "2.60"
+	// ComputeMicroversionLatest requests the highest microversion supported by the endpoint.
+	ComputeMicroversionLatest = "latest"
 )
 
 // Client wraps the Gophercloud compute client.
+//
+// Several Keystone/compute endpoints can be configured. The client connects to the first one that
+// works, and fails over to the next ones when the current endpoint becomes unreachable, so the
+// webhook keeps working during the planned maintenance of one CERN cloud endpoint.
 type Client struct {
-	Compute *gophercloud.ServiceClient
+	// endpoints are the configurations of the endpoints, in order of preference.
+	endpoints []*config.Config
+	// transport sends the requests of every endpoint, recording or replaying them with a cassette.
+	transport http.RoundTripper
+
+	// mu guards the fields below, which are swapped on failover.
+	mu sync.RWMutex
+	// current is the index of the endpoint in use.
+	current int
+	// compute is the compute client of the endpoint in use.
+	compute *gophercloud.ServiceClient
+	// provider is the authenticated provider client backing compute.
+	provider *gophercloud.ProviderClient
+}
+
+// NewClient creates a new OpenStack compute client, connected to the first working endpoint.
+func NewClient(ctx context.Context, cfg *config.Config) (*Client, error) {
+	transport, err := newTransport(cfg)
+	if err != nil {
+		return nil, err
+	}
+	c := &Client{endpoints: openStackEndpoints(cfg), transport: transport, current: -1}
+	if err := c.Failover(ctx, -1); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// openStackEndpoints returns the configuration of every endpoint, in order of preference: every
+// region of the primary auth URL, then every region of the failover auth URLs.
+func openStackEndpoints(cfg *config.Config) []*config.Config {
+	authURLs := append([]string{cfg.OpenStackAuthURL}, cfg.OpenStackFailoverAuthURLs...)
+	regions := append([]string{cfg.OpenStackRegionName}, cfg.OpenStackFailoverRegions...)
+
+	endpoints := make([]*config.Config, 0, len(authURLs)*len(regions))
+	for _, authURL := range authURLs {
+		for _, region := range regions {
+			endpoint := *cfg
+			endpoint.OpenStackAuthURL = authURL
+			endpoint.OpenStackRegionName = region
+			endpoints = append(endpoints, &endpoint)
+		}
+	}
+	return endpoints
+}
+
+// Compute returns the compute client of the endpoint in use.
+func (c *Client) Compute() *gophercloud.ServiceClient {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.compute
+}
+
+// Endpoint returns the index of the endpoint in use, to be passed to Failover.
+func (c *Client) Endpoint() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.current
+}
+
+// CanFailover reports whether other endpoints are configured.
+func (c *Client) CanFailover() bool {
+	return len(c.endpoints) > 1
 }
 
-// NewClient creates a new OpenStack compute client.
-func NewClient(cfg *config.Config) (*Client, error) {
-	opts := gophercloud.AuthOptions{
-		IdentityEndpoint: cfg.OpenStackAuthURL,
-		Username:         cfg.OpenStackUsername,
-		Password:         cfg.OpenStackPassword,
-		DomainName:       cfg.OpenStackUserDomainName,
-		TenantName:       cfg.OpenStackProjectName,
+// Failover connects to the first working endpoint after the one at index from, wrapping around.
+//
+// Callers that saw the endpoint at index from fail may call it concurrently: only the first one
+// switches endpoints, the others return immediately once the switch is done.
+func (c *Client) Failover(ctx context.Context, from int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.current != from {
+		return nil
 	}
 
-	// Create a custom HTTP client to handle potential TLS issues or proxies if needed.
-	// For now, we use a standard client but allow for expansion.
+	var errs []error
+	for i := 1; i <= len(c.endpoints); i++ {
+		index := (from + i) % len(c.endpoints)
+		if index == from {
+			continue
+		}
+		endpoint := c.endpoints[index]
+		provider, compute, err := connect(ctx, endpoint, c.transport)
+		if err != nil {
+			log.FromContext(ctx).Warn("Failed to connect to OpenStack endpoint %s (region %s): %v", endpoint.OpenStackAuthURL, endpoint.OpenStackRegionName, err)
+			errs = append(errs, err)
+			continue
+		}
+
+		if from >= 0 {
+			log.FromContext(ctx).Warn("Failed over to OpenStack endpoint %s (region %s)", endpoint.OpenStackAuthURL, endpoint.OpenStackRegionName)
+		}
+		c.current, c.provider, c.compute = index, provider, compute
+		return nil
+	}
+	if from >= 0 {
+		errs = append(errs, errors.New("no other OpenStack endpoint is available"))
+	}
+	return errors.Join(errs...)
+}
+
+// newTransport creates the transport of the OpenStack requests, rate limited, recording or
+// replaying the interactions with the configured cassette, and failing or delaying some of them
+// when failure injection is enabled. The certificates of the OpenStack APIs are verified against
+// the configured CA certificates, unless the verification is disabled.
+func newTransport(cfg *config.Config) (http.RoundTripper, error) {
+	tlsConfig, err := tlsconfig.New(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.OpenStackCAFile != "" {
+		pem, err := os.ReadFile(cfg.OpenStackCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the OpenStack CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in the OpenStack CA file %s", cfg.OpenStackCAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	tlsConfig.InsecureSkipVerify = cfg.OpenStackInsecureSkipVerify
+	var transport http.RoundTripper = &http.Transport{
+		TLSClientConfig: tlsConfig,
+	}
+	transport, err = newCassetteTransport(transport, cfg.OpenStackCassetteMode, cfg.OpenStackCassette)
+	if err != nil {
+		return nil, err
+	}
+	transport = chaosTransport(transport, cfg)
+	if cfg.APIRateLimit > 0 {
+		transport = newRateLimitedTransport(transport, cfg.APIRateLimit, cfg.APIRateBurst)
+	}
+	return transport, nil
+}
+
+// connect authenticates against the given endpoint with the given transport and creates its
+// compute client.
+func connect(ctx context.Context, cfg *config.Config, transport http.RoundTripper) (*gophercloud.ProviderClient, *gophercloud.ServiceClient, error) {
 	httpClient := &http.Client{
-		Transport: &http.Transport{
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: true}, // TODO: Add config for insecure
-		},
+		Transport: transport,
 	}
 
-	provider, err := openstack.NewClient(opts.IdentityEndpoint)
+	provider, err := openstack.NewClient(cfg.OpenStackAuthURL)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create OpenStack client: %w", err)
+		return nil, nil, fmt.Errorf("failed to create OpenStack client: %w", err)
 	}
 	provider.HTTPClient = *httpClient
 
-	if err := openstack.Authenticate(provider, opts); err != nil {
-		return nil, fmt.Errorf("failed to authenticate: %w", err)
+	if err := authenticate(ctx, provider, cfg); err != nil {
+		return nil, nil, fmt.Errorf("failed to authenticate: %w", err)
 	}
 
 	endpointOpts := gophercloud.EndpointOpts{
@@ -49,8 +196,147 @@ func NewClient(cfg *config.Config) (*Client, error) {
 
 	compute, err := openstack.NewComputeV2(provider, endpointOpts)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create compute client: %w", err)
+		return nil, nil, fmt.Errorf("failed to create compute client: %w", err)
+	}
+
+	compute.Microversion, err = negotiateComputeMicroversion(ctx, compute, cfg.OpenStackComputeMicroversion)
+	if err != nil {
+		return nil, nil, err
+	}
+	log.FromContext(ctx).Info("Using compute API microversion %s", compute.Microversion)
+
+	return provider, compute, nil
+}
+
+// isUnreachable reports whether an error means that the endpoint is unavailable rather than the
+// request being rejected: network errors, server errors and timeouts.
+func isUnreachable(err error) bool {
+	var netErr net.Error
+	return isTransient(err) || errors.As(err, &netErr)
+}
+
+// negotiateComputeMicroversion picks the compute API microversion to use, given the requested one.
+//
+// The requested microversion is used if the endpoint supports it. When it is above the endpoint's
+// maximum, the maximum is used instead, and when it is below the minimum an error is returned.
+// If the supported range cannot be discovered, the requested microversion is used as is.
+func negotiateComputeMicroversion(ctx context.Context, compute *gophercloud.ServiceClient, requested string) (string, error) {
+	if requested == "" {
+		requested = DefaultComputeMicroversion
+	}
+
+	supported, err := utils.GetSupportedMicroversions(ctx, compute)
+	if err != nil {
+		if requested == ComputeMicroversionLatest {
+			return "", fmt.Errorf("failed to discover the supported compute microversions: %w", err)
+		}
+		log.FromContext(ctx).Warn("Failed to discover the supported compute microversions, using %s: %v", requested, err)
+		return requested, nil
+	}
+
+	return chooseMicroversion(ctx, supported, requested)
+}
+
+// chooseMicroversion picks a microversion within the supported range for the requested one.
+func chooseMicroversion(ctx context.Context, supported utils.SupportedMicroversions, requested string) (string, error) {
+	maxVersion := fmt.Sprintf("%d.%d", supported.MaxMajor, supported.MaxMinor)
+	if requested == ComputeMicroversionLatest {
+		return maxVersion, nil
+	}
+
+	major, minor, err := utils.ParseMicroversion(requested)
+	if err != nil {
+		return "", fmt.Errorf("invalid compute microversion %q: %w", requested, err)
+	}
+
+	ok, err := supported.IsSupported(requested)
+	if err != nil {
+		return "", err
 	}
+	if ok {
+		return requested, nil
+	}
+
+	if major > supported.MaxMajor || (major == supported.MaxMajor && minor > supported.MaxMinor) {
+		log.FromContext(ctx).Warn("Compute microversion %s is not supported, falling back to %s", requested, maxVersion)
+		return maxVersion, nil
+	}
+	return "", fmt.Errorf("compute microversion %s is below the minimum supported %d.%d", requested, supported.MinMajor, supported.MinMinor)
+}
+
+// Reconnect authenticates again against the endpoint in use, reading the credentials again, and
+// swaps the session of the client for the new one. It is used when the credentials rotated, which
+// gophercloud's re-authentication does not pick up. The current session is kept when the new one
+// cannot be established.
+//
+// The requests keep using the current session while the new one is established, and the new one
+// is dropped if a failover switched endpoints in the meantime, the failover having connected with
+// the new credentials already.
+func (c *Client) Reconnect(ctx context.Context) error {
+	c.mu.RLock()
+	current := c.current
+	c.mu.RUnlock()
 
-	return &Client{Compute: compute}, nil
+	endpoint := c.endpoints[current]
+	provider, compute, err := connect(ctx, endpoint, c.transport)
+	if err != nil {
+		return fmt.Errorf("failed to reconnect to OpenStack endpoint %s (region %s): %w", endpoint.OpenStackAuthURL, endpoint.OpenStackRegionName, err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.current == current {
+		c.provider, c.compute = provider, compute
+	}
+	return nil
+}
+
+// Reauthenticate forces a new Keystone token to be requested.
+// It is used when a request is still rejected with a 401 after gophercloud's own re-authentication.
+func (c *Client) Reauthenticate(ctx context.Context) error {
+	c.mu.RLock()
+	provider := c.provider
+	c.mu.RUnlock()
+
+	err := metrics.ObserveOpenStackCall(OperationReauthenticate, func() error {
+		return provider.Reauthenticate(ctx, provider.Token())
+	})
+	if err != nil {
+		return fmt.Errorf("failed to re-authenticate: %w", err)
+	}
+	return nil
+}
+
+// chaosTransport wraps base with the failure injection configured for the OpenStack requests.
+//
+// The Keystone token requests are spared, so the webhook still starts and re-authenticates, the
+// failures being injected into the compute calls whose retries are under test.
+func chaosTransport(base http.RoundTripper, cfg *config.Config) http.RoundTripper {
+	injector := chaos.New(cfg.ChaosNovaErrorRate, cfg.ChaosNovaLatency)
+	return injector.Transport(base, func(req *http.Request) bool {
+		return strings.HasSuffix(req.URL.Path, "/auth/tokens")
+	})
+}
+
+// rateLimitedTransport throttles the requests sent to OpenStack, so large syncs stay within the
+// API quotas of the CERN cloud instead of getting the service account throttled.
+type rateLimitedTransport struct {
+	base    http.RoundTripper
+	limiter *rate.Limiter
+}
+
+// newRateLimitedTransport wraps base with a limit of requestsPerSecond and the given burst.
+func newRateLimitedTransport(base http.RoundTripper, requestsPerSecond float64, burst int) *rateLimitedTransport {
+	return &rateLimitedTransport{
+		base:    base,
+		limiter: rate.NewLimiter(rate.Limit(requestsPerSecond), max(burst, 1)),
+	}
+}
+
+// RoundTrip waits for the rate limiter before sending the request.
+func (t *rateLimitedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.limiter.Wait(req.Context()); err != nil {
+		return nil, fmt.Errorf("rate limiter: %w", err)
+	}
+	return t.base.RoundTrip(req)
 }
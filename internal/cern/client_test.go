@@ -0,0 +1,273 @@
+package cern
+
+import (
+	"context"
+	"encoding/pem"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gophercloud/gophercloud/v2"
+	"github.com/gophercloud/gophercloud/v2/openstack/utils"
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/pkg/config"
+)
+
+func TestChooseMicroversion(t *testing.T) {
+	supported := utils.SupportedMicroversions{MinMajor: 2, MinMinor: 1, MaxMajor: 2, MaxMinor: 53}
+
+	tests := []struct {
+		name      string
+		requested string
+		expected  string
+		wantErr   bool
+	}{
+		{name: "Supported", requested: "2.26", expected: "2.26"},
+		{name: "Latest", requested: "latest", expected: "2.53"},
+		{name: "Above maximum", requested: "2.60", expected: "2.53"},
+		{name: "Below minimum", requested: "2.0", wantErr: true},
+		{name: "Invalid", requested: "two", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := chooseMicroversion(context.Background(), supported, tt.requested)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("chooseMicroversion() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.expected {
+				t.Errorf("chooseMicroversion() = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestRateLimitedTransport(t *testing.T) {
+	calls := 0
+	transport := newRateLimitedTransport(roundTripperFunc(func(*http.Request) (*http.Response, error) {
+		calls++
+		return &http.Response{StatusCode: http.StatusOK}, nil
+	}), 0.001, 1)
+
+	req, _ := http.NewRequest(http.MethodGet, "https://openstack.cern.ch", nil)
+	if _, err := transport.RoundTrip(req); err != nil {
+		t.Fatalf("RoundTrip() error = %v", err)
+	}
+
+	// The burst is exhausted, so the next request cannot be sent before its context expires.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := transport.RoundTrip(req.WithContext(ctx)); err == nil {
+		t.Errorf("RoundTrip() expected rate limiter error")
+	}
+	if calls != 1 {
+		t.Errorf("expected 1 request to be sent, got %d", calls)
+	}
+}
+
+func TestNewTransportVerifiesCertificates(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	caFile := filepath.Join(t.TempDir(), "ca.crt")
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(caFile, ca, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		cfg     *config.Config
+		wantErr bool
+	}{
+		{name: "system CAs", cfg: &config.Config{}, wantErr: true},
+		{name: "CA file", cfg: &config.Config{OpenStackCAFile: caFile}},
+		{name: "insecure", cfg: &config.Config{OpenStackInsecureSkipVerify: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transport, err := newTransport(tt.cfg)
+			if err != nil {
+				t.Fatalf("newTransport() error = %v", err)
+			}
+			req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+			resp, err := transport.RoundTrip(req)
+			if err == nil {
+				resp.Body.Close()
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("RoundTrip() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	if _, err := newTransport(&config.Config{OpenStackCAFile: filepath.Join(t.TempDir(), "missing")}); err == nil {
+		t.Errorf("newTransport() with a missing CA file expected an error")
+	}
+}
+
+func TestOpenStackEndpoints(t *testing.T) {
+	cfg := &config.Config{
+		OpenStackAuthURL:          "https://keystone.cern.ch/v3",
+		OpenStackRegionName:       "cern",
+		OpenStackFailoverAuthURLs: []string{"https://keystone-2.cern.ch/v3"},
+		OpenStackFailoverRegions:  []string{"pdc"},
+	}
+
+	var got [][2]string
+	for _, endpoint := range openStackEndpoints(cfg) {
+		got = append(got, [2]string{endpoint.OpenStackAuthURL, endpoint.OpenStackRegionName})
+	}
+	expected := [][2]string{
+		{"https://keystone.cern.ch/v3", "cern"},
+		{"https://keystone.cern.ch/v3", "pdc"},
+		{"https://keystone-2.cern.ch/v3", "cern"},
+		{"https://keystone-2.cern.ch/v3", "pdc"},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("openStackEndpoints() = %v, want %v", got, expected)
+	}
+	if cfg.OpenStackRegionName != "cern" {
+		t.Errorf("openStackEndpoints() modified the configuration")
+	}
+}
+
+func TestClientFailoverAlreadySwitched(t *testing.T) {
+	compute := &gophercloud.ServiceClient{}
+	client := &Client{endpoints: []*config.Config{{}, {}}, current: 1, compute: compute}
+
+	// Another caller already failed over from endpoint 0, so nothing is reconnected.
+	if err := client.Failover(context.Background(), 0); err != nil {
+		t.Fatalf("Failover() error = %v", err)
+	}
+	if client.Endpoint() != 1 || client.Compute() != compute {
+		t.Errorf("Failover() switched endpoints, want no change")
+	}
+}
+
+func TestClientReconnectWithoutLock(t *testing.T) {
+	// Keystone hangs until released, then fails.
+	authenticating, release := make(chan struct{}), make(chan struct{})
+	keystone := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(authenticating)
+		<-release
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer keystone.Close()
+
+	compute := &gophercloud.ServiceClient{}
+	endpoint := &config.Config{OpenStackAuthURL: keystone.URL + "/v3/", OpenStackUsername: "user", OpenStackUserDomainName: "default", OpenStackPassword: "password"}
+	client := &Client{endpoints: []*config.Config{endpoint}, transport: http.DefaultTransport, compute: compute}
+
+	reconnected := make(chan error, 1)
+	go func() { reconnected <- client.Reconnect(context.Background()) }()
+	select {
+	case <-authenticating:
+	case err := <-reconnected:
+		t.Fatalf("Reconnect() error = %v before authenticating", err)
+	}
+
+	// The requests keep using the current session while the new one is established.
+	got := make(chan *gophercloud.ServiceClient, 1)
+	go func() { got <- client.Compute() }()
+	select {
+	case c := <-got:
+		if c != compute {
+			t.Errorf("Compute() = %p during the reconnection, want the current session %p", c, compute)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("Compute() blocked during the reconnection")
+	}
+
+	close(release)
+	if err := <-reconnected; err == nil {
+		t.Fatal("Reconnect() error = nil, want the authentication failure")
+	}
+	if client.Compute() != compute {
+		t.Errorf("Reconnect() replaced the session after failing")
+	}
+}
+
+func TestClientRequestsBoundToContext(t *testing.T) {
+	// Nova hangs until the request is abandoned, which the server only notices once the body is read.
+	nova := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		<-r.Context().Done()
+	}))
+	defer nova.Close()
+	client := newTransportClient(nova.URL, http.DefaultTransport)
+
+	tests := []struct {
+		name string
+		call func(ctx context.Context) error
+	}{
+		{name: "ListServers", call: func(ctx context.Context) error {
+			_, err := client.ListServers(ctx)
+			return err
+		}},
+		{name: "GetMetadata", call: func(ctx context.Context) error {
+			_, err := client.GetMetadata(ctx, "a")
+			return err
+		}},
+		{name: "UpdateMetadata", call: func(ctx context.Context) error {
+			return client.UpdateMetadata(ctx, "a", map[string]string{"landb-alias": "foo.cern.ch--load-0-"})
+		}},
+		{name: "SetMetadata", call: func(ctx context.Context) error {
+			return client.SetMetadata(ctx, "a", map[string]string{"landb-alias": "foo.cern.ch--load-0-"})
+		}},
+		{name: "DeleteMetadatum", call: func(ctx context.Context) error {
+			return client.DeleteMetadatum(ctx, "a", "landb-alias")
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+
+			done := make(chan error, 1)
+			go func() { done <- tt.call(ctx) }()
+			select {
+			case err := <-done:
+				if !errors.Is(err, context.DeadlineExceeded) {
+					t.Errorf("%s() error = %v, want %v", tt.name, err, context.DeadlineExceeded)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("%s() still running after its context expired", tt.name)
+			}
+		})
+	}
+}
+
+func TestIsUnreachable(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected bool
+	}{
+		{name: "Connection refused", err: &net.OpError{Op: "dial", Err: errors.New("connection refused")}, expected: true},
+		{name: "Service unavailable", err: gophercloud.ErrUnexpectedResponseCode{Actual: http.StatusServiceUnavailable}, expected: true},
+		{name: "Not found", err: gophercloud.ErrUnexpectedResponseCode{Actual: http.StatusNotFound}, expected: false},
+		{name: "No error", err: nil, expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isUnreachable(tt.err); got != tt.expected {
+				t.Errorf("isUnreachable(%v) = %v, want %v", tt.err, got, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package cern
+
+import (
+	"context"
+
+	"github.com/gophercloud/gophercloud/v2/openstack/compute/v2/servers"
+	"github.com/gophercloud/gophercloud/v2/pagination"
+)
+
+// ComputeAPI is the part of the compute API the Manager depends on.
+//
+// The Client implements it with gophercloud against the endpoint in use, while the retries,
+// failover and re-authentication stay in the Manager, so that they can be unit tested against an
+// in-memory implementation without network access.
+type ComputeAPI interface {
+	// ListServers lists all the servers, in every status, with their metadata.
+	ListServers(ctx context.Context) ([]servers.Server, error)
+	// GetMetadata returns the metadata of a server.
+	GetMetadata(ctx context.Context, serverID string) (map[string]string, error)
+	// UpdateMetadata sets the given metadata keys of a server, keeping the other keys.
+	UpdateMetadata(ctx context.Context, serverID string, metadata map[string]string) error
+	// SetMetadata replaces the whole metadata of a server.
+	SetMetadata(ctx context.Context, serverID string, metadata map[string]string) error
+	// DeleteMetadatum deletes a metadata key of a server.
+	DeleteMetadatum(ctx context.Context, serverID, key string) error
+}
+
+var _ ComputeAPI = (*Client)(nil)
+
+// ListServers lists all the servers of the endpoint in use, following the pagination.
+func (c *Client) ListServers(ctx context.Context) ([]servers.Server, error) {
+	var serverList []servers.Server
+	err := servers.List(c.Compute(), servers.ListOpts{}).EachPage(ctx, func(_ context.Context, page pagination.Page) (bool, error) {
+		pageServers, err := servers.ExtractServers(page)
+		if err != nil {
+			return false, err
+		}
+		serverList = append(serverList, pageServers...)
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return serverList, nil
+}
+
+// GetMetadata returns the metadata of a server.
+func (c *Client) GetMetadata(ctx context.Context, serverID string) (map[string]string, error) {
+	return servers.Metadata(ctx, c.Compute(), serverID).Extract()
+}
+
+// UpdateMetadata sets the given metadata keys of a server, keeping the other keys.
+func (c *Client) UpdateMetadata(ctx context.Context, serverID string, metadata map[string]string) error {
+	_, err := servers.UpdateMetadata(ctx, c.Compute(), serverID, servers.MetadataOpts(metadata)).Extract()
+	return err
+}
+
+// SetMetadata replaces the whole metadata of a server.
+func (c *Client) SetMetadata(ctx context.Context, serverID string, metadata map[string]string) error {
+	_, err := servers.ResetMetadata(ctx, c.Compute(), serverID, servers.MetadataOpts(metadata)).Extract()
+	return err
+}
+
+// DeleteMetadatum deletes a metadata key of a server.
+func (c *Client) DeleteMetadatum(ctx context.Context, serverID, key string) error {
+	return servers.DeleteMetadatum(ctx, c.Compute(), serverID, key).ExtractErr()
+}
@@ -0,0 +1,204 @@
+package cern
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"net/http"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/gophercloud/gophercloud/v2"
+	"github.com/gophercloud/gophercloud/v2/openstack/compute/v2/servers"
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/log"
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+// memoryCompute is an in-memory ComputeAPI, failing the writes of the servers listed in failures
+// with the given errors, one per write, before applying them. A nil error lets its write through.
+type memoryCompute struct {
+	mu       sync.Mutex
+	metadata map[string]map[string]string
+	failures map[string][]error
+}
+
+func (c *memoryCompute) ListServers(context.Context) ([]servers.Server, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var list []servers.Server
+	for id, metadata := range c.metadata {
+		list = append(list, servers.Server{ID: id, Name: id, Status: "ACTIVE", Metadata: maps.Clone(metadata)})
+	}
+	return list, nil
+}
+
+func (c *memoryCompute) GetMetadata(_ context.Context, serverID string) (map[string]string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return maps.Clone(c.metadata[serverID]), nil
+}
+
+func (c *memoryCompute) UpdateMetadata(_ context.Context, serverID string, metadata map[string]string) error {
+	return c.write(serverID, func(current map[string]string) { maps.Copy(current, metadata) })
+}
+
+func (c *memoryCompute) SetMetadata(_ context.Context, serverID string, metadata map[string]string) error {
+	return c.write(serverID, func(current map[string]string) {
+		clear(current)
+		maps.Copy(current, metadata)
+	})
+}
+
+func (c *memoryCompute) DeleteMetadatum(_ context.Context, serverID, key string) error {
+	return c.write(serverID, func(current map[string]string) { delete(current, key) })
+}
+
+// write applies a write to the metadata of a server, unless a failure is pending for it.
+func (c *memoryCompute) write(serverID string, apply func(map[string]string)) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if failures := c.failures[serverID]; len(failures) > 0 {
+		c.failures[serverID] = failures[1:]
+		if failures[0] != nil {
+			return failures[0]
+		}
+	}
+	apply(c.metadata[serverID])
+	return nil
+}
+
+// newComputeManager creates a Manager of the in-memory compute API, without OpenStack client.
+func newComputeManager(compute ComputeAPI, maxAttempts int) *Manager {
+	return &Manager{
+		compute:     compute,
+		cache:       &serverCache{},
+		retry:       retryPolicy{maxAttempts: maxAttempts},
+		concurrency: 1,
+		rollback:    true,
+		ownerID:     "default",
+		managed:     make(map[string]struct{}),
+		departed:    make(map[string]IngressNode),
+		logger:      log.NewNopLogger(),
+	}
+}
+
+func TestManagerSyncStateCompute(t *testing.T) {
+	unavailable := gophercloud.ErrUnexpectedResponseCode{Actual: http.StatusServiceUnavailable}
+	rejected := gophercloud.ErrUnexpectedResponseCode{Actual: http.StatusBadRequest}
+	desired := []*endpoint.Endpoint{endpoint.NewEndpoint("app.cern.ch", endpoint.RecordTypeA, "10.0.0.1")}
+
+	tests := []struct {
+		name        string
+		maxAttempts int
+		failures    map[string][]error
+		wantErr     bool
+		wantFailed  []string
+		wantRolled  []string
+		wantAliases map[string]string
+	}{
+		{
+			name:        "Transient error is retried",
+			maxAttempts: 2,
+			failures:    map[string][]error{"b": {unavailable}},
+			wantAliases: map[string]string{"a": "app.cern.ch--load-0-", "b": "app.cern.ch--load-1-"},
+		},
+		{
+			name:        "Exhausted retries roll the other nodes back",
+			maxAttempts: 2,
+			failures:    map[string][]error{"b": {unavailable, unavailable}},
+			wantErr:     true,
+			wantFailed:  []string{"b"},
+			wantRolled:  []string{"a", "b"},
+			wantAliases: map[string]string{"a": "", "b": ""},
+		},
+		{
+			name:        "Permanent error is not retried",
+			maxAttempts: 3,
+			failures:    map[string][]error{"b": {rejected}},
+			wantErr:     true,
+			wantFailed:  []string{"b"},
+			wantRolled:  []string{"a", "b"},
+			wantAliases: map[string]string{"a": "", "b": ""},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			compute := &memoryCompute{
+				metadata: map[string]map[string]string{"a": {"other": "x"}, "b": {}},
+				failures: tt.failures,
+			}
+			m := newComputeManager(compute, tt.maxAttempts)
+			nodes := []IngressNode{
+				{Server: servers.Server{ID: "a", Name: "a", Metadata: map[string]string{"other": "x"}}},
+				{Server: servers.Server{ID: "b", Name: "b", Metadata: map[string]string{}}},
+			}
+
+			err := m.SyncState(context.Background(), nodes, desired)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SyncState() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			var syncErr *SyncError
+			if errors.As(err, &syncErr) {
+				if !reflect.DeepEqual(syncErr.Failed, tt.wantFailed) || !reflect.DeepEqual(syncErr.RolledBack, tt.wantRolled) {
+					t.Errorf("SyncError = %+v, want failed %v and rolled back %v", syncErr, tt.wantFailed, tt.wantRolled)
+				}
+			}
+			for id, alias := range tt.wantAliases {
+				if got := compute.metadata[id]["landb-alias"]; got != alias {
+					t.Errorf("landb-alias of %s = %q, want %q", id, got, alias)
+				}
+			}
+			if compute.metadata["a"]["other"] != "x" {
+				t.Errorf("metadata of a = %v, want the unmanaged key kept", compute.metadata["a"])
+			}
+		})
+	}
+}
+
+// unreadableCompute is a memoryCompute whose metadata cannot be read back.
+type unreadableCompute struct {
+	*memoryCompute
+}
+
+func (c unreadableCompute) GetMetadata(context.Context, string) (map[string]string, error) {
+	return nil, gophercloud.ErrUnexpectedResponseCode{Actual: http.StatusServiceUnavailable}
+}
+
+func TestManagerReplaceKeepsKeysWrittenSinceListing(t *testing.T) {
+	desired := []*endpoint.Endpoint{endpoint.NewEndpoint("app.cern.ch", endpoint.RecordTypeA, "10.0.0.1")}
+
+	tests := []struct {
+		name       string
+		unreadable bool
+	}{
+		{name: "Metadata read again before the replace"},
+		{name: "Unreadable metadata updated key by key", unreadable: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// A key was added to the server after it was listed.
+			memory := &memoryCompute{metadata: map[string]map[string]string{"a": {"other": "x", "added": "y"}}}
+			var compute ComputeAPI = memory
+			if tt.unreadable {
+				compute = unreadableCompute{memory}
+			}
+			m := newComputeManager(compute, 1)
+			m.replaceThreshold = 1
+			nodes := []IngressNode{{Server: servers.Server{ID: "a", Name: "a", Metadata: map[string]string{"other": "x"}}}}
+
+			if err := m.SyncState(context.Background(), nodes, desired); err != nil {
+				t.Fatalf("SyncState() error = %v", err)
+			}
+			got := memory.metadata["a"]
+			if got["landb-alias"] != "app.cern.ch--load-0-" {
+				t.Errorf("landb-alias of a = %q, want %q", got["landb-alias"], "app.cern.ch--load-0-")
+			}
+			if got["other"] != "x" || got["added"] != "y" {
+				t.Errorf("metadata of a = %v, want the unmanaged keys kept", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,197 @@
+package cern
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+
+	"github.com/gophercloud/gophercloud/v2"
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/pkg/config"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// FakeMetadataAnnotation is the annotation of the Nodes of the fake backend fixture holding the
+// initial metadata of the servers backing them, as a JSON object.
+const FakeMetadataAnnotation = "webhook.cern.ch/fake-metadata"
+
+// fakeComputeEndpoint is the endpoint of the in-memory compute API, never resolved.
+const fakeComputeEndpoint = "http://fake-compute/"
+
+// NewFakeClient creates a client of an in-memory compute API serving a server per Node of the
+// fixture, e.g. to exercise the plan/apply loop in CI without CERN credentials.
+//
+// The ID of every server is the UUID in the providerID of its Node, or the name of the Node when
+// the providerID holds none. The servers are ACTIVE, and their initial metadata is read from the
+// FakeMetadataAnnotation of the Node. Metadata writes beyond the configured quota of metadata
+// items are rejected, as Nova does.
+func NewFakeClient(nodes []corev1.Node, cfg *config.Config) (*Client, error) {
+	compute := &fakeCompute{servers: make(map[string]*fakeServer), maxItems: cfg.MetadataMaxItems}
+	for _, node := range nodes {
+		server := &fakeServer{ID: node.Name, Name: node.Name, Status: "ACTIVE", Metadata: map[string]string{}}
+		if serverID, ok := ServerIDFromProviderID(node.Spec.ProviderID); ok {
+			server.ID = serverID
+		}
+		if annotation, ok := node.Annotations[FakeMetadataAnnotation]; ok {
+			if err := json.Unmarshal([]byte(annotation), &server.Metadata); err != nil {
+				return nil, fmt.Errorf("invalid %s annotation of node %s: %w", FakeMetadataAnnotation, node.Name, err)
+			}
+		}
+		compute.servers[server.ID] = server
+		compute.order = append(compute.order, server.ID)
+	}
+
+	provider := &gophercloud.ProviderClient{HTTPClient: http.Client{Transport: chaosTransport(handlerTransport{compute.handler()}, cfg)}}
+	return &Client{
+		endpoints: []*config.Config{cfg},
+		provider:  provider,
+		compute:   &gophercloud.ServiceClient{ProviderClient: provider, Endpoint: fakeComputeEndpoint, Microversion: DefaultComputeMicroversion},
+	}, nil
+}
+
+// handlerTransport serves the requests of an HTTP client with a handler, in process.
+type handlerTransport struct {
+	handler http.Handler
+}
+
+// RoundTrip serves the request with the handler.
+func (t handlerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	recorder := httptest.NewRecorder()
+	t.handler.ServeHTTP(recorder, req)
+	resp := recorder.Result()
+	resp.Request = req
+	return resp, nil
+}
+
+// fakeServer is a server of the in-memory compute API.
+type fakeServer struct {
+	ID       string            `json:"id"`
+	Name     string            `json:"name"`
+	Status   string            `json:"status"`
+	Metadata map[string]string `json:"metadata"`
+}
+
+// fakeCompute is an in-memory compute API, serving the calls of the Manager.
+type fakeCompute struct {
+	// maxItems is the quota of metadata items of a server.
+	maxItems int
+
+	// mu guards servers.
+	mu sync.Mutex
+	// servers holds the servers by ID.
+	servers map[string]*fakeServer
+	// order holds the IDs of the servers, in the order they are listed.
+	order []string
+}
+
+// handler returns the handler of the compute API calls made by the Manager.
+func (c *fakeCompute) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /servers/detail", c.listServers)
+	mux.HandleFunc("GET /servers/{id}/metadata", c.getMetadata)
+	mux.HandleFunc("POST /servers/{id}/metadata", c.updateMetadata)
+	mux.HandleFunc("PUT /servers/{id}/metadata", c.updateMetadata)
+	mux.HandleFunc("DELETE /servers/{id}/metadata/{key}", c.deleteMetadatum)
+	mux.HandleFunc("GET /limits", func(w http.ResponseWriter, _ *http.Request) {
+		writeFakeJSON(w, http.StatusOK, map[string]any{"limits": map[string]any{"absolute": map[string]int{"maxServerMeta": c.maxItems}}})
+	})
+	return mux
+}
+
+// listServers lists the servers, with their metadata.
+func (c *fakeCompute) listServers(w http.ResponseWriter, _ *http.Request) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	list := make([]fakeServer, 0, len(c.order))
+	for _, id := range c.order {
+		server := *c.servers[id]
+		server.Metadata = maps.Clone(server.Metadata)
+		list = append(list, server)
+	}
+	writeFakeJSON(w, http.StatusOK, map[string]any{"servers": list})
+}
+
+// getMetadata returns the metadata of a server.
+func (c *fakeCompute) getMetadata(w http.ResponseWriter, r *http.Request) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	server, ok := c.server(w, r)
+	if !ok {
+		return
+	}
+	writeFakeJSON(w, http.StatusOK, map[string]any{"metadata": server.Metadata})
+}
+
+// updateMetadata merges the metadata of the request into the metadata of a server, or replaces it
+// with a PUT, rejecting the requests exceeding the quota.
+func (c *fakeCompute) updateMetadata(w http.ResponseWriter, r *http.Request) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	server, ok := c.server(w, r)
+	if !ok {
+		return
+	}
+	var body struct {
+		Metadata map[string]string `json:"metadata"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeFakeError(w, http.StatusBadRequest, "badRequest", err.Error())
+		return
+	}
+
+	metadata := maps.Clone(server.Metadata)
+	if r.Method == http.MethodPut {
+		metadata = map[string]string{}
+	}
+	maps.Copy(metadata, body.Metadata)
+	if c.maxItems > 0 && len(metadata) > c.maxItems {
+		writeFakeError(w, http.StatusForbidden, "forbidden", fmt.Sprintf("Quota exceeded for metadata_items: Requested %d, but already used 0 of %d metadata_items", len(metadata), c.maxItems))
+		return
+	}
+	server.Metadata = metadata
+	writeFakeJSON(w, http.StatusOK, map[string]any{"metadata": metadata})
+}
+
+// deleteMetadatum deletes a metadata key of a server.
+func (c *fakeCompute) deleteMetadatum(w http.ResponseWriter, r *http.Request) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	server, ok := c.server(w, r)
+	if !ok {
+		return
+	}
+	key := r.PathValue("key")
+	if _, ok := server.Metadata[key]; !ok {
+		writeFakeError(w, http.StatusNotFound, "itemNotFound", fmt.Sprintf("Metadata item was not found: %s", key))
+		return
+	}
+	delete(server.Metadata, key)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// server returns the server of the request, writing a not found error when there is none.
+func (c *fakeCompute) server(w http.ResponseWriter, r *http.Request) (*fakeServer, bool) {
+	server, ok := c.servers[r.PathValue("id")]
+	if !ok {
+		writeFakeError(w, http.StatusNotFound, "itemNotFound", fmt.Sprintf("Instance %s could not be found.", r.PathValue("id")))
+	}
+	return server, ok
+}
+
+// writeFakeJSON writes a JSON response of the in-memory compute API.
+func writeFakeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+// writeFakeError writes an error response of the in-memory compute API, in the format of Nova.
+func writeFakeError(w http.ResponseWriter, status int, kind, message string) {
+	writeFakeJSON(w, status, map[string]any{kind: map[string]any{"code": status, "message": message}})
+}
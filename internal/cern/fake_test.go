@@ -0,0 +1,81 @@
+package cern
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/k8s"
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/log"
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/pkg/config"
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+func TestFakeClient(t *testing.T) {
+	cfg := &config.Config{
+		Backend:          BackendFake,
+		KubeBackend:      k8s.KubeBackendFake,
+		KubeFakeObjects:  "../../deploy/fake-nodes.yaml",
+		NodeDiscovery:    k8s.DiscoveryLabel,
+		NodeAddressType:  k8s.AddressTypeAuto,
+		ServerStatuses:   DefaultServerStatuses,
+		RetryMaxAttempts: 1,
+		SyncConcurrency:  1,
+		MetadataMaxItems: 3,
+		OwnerID:          "default",
+	}
+	k8sClient, err := k8s.NewClient(cfg)
+	if err != nil {
+		t.Fatalf("k8s.NewClient() error = %v", err)
+	}
+	nodes, err := k8s.FakeNodes(cfg.KubeFakeObjects)
+	if err != nil {
+		t.Fatalf("FakeNodes() error = %v", err)
+	}
+	client, err := NewFakeClient(nodes, cfg)
+	if err != nil {
+		t.Fatalf("NewFakeClient() error = %v", err)
+	}
+	m := NewManager(client, k8sClient, cfg, log.NewLogger(log.LevelError))
+	ctx := context.Background()
+	labels := []string{"node-role.kubernetes.io/ingress"}
+
+	ingressNodes, err := m.GetIngressNodes(ctx, labels)
+	if err != nil {
+		t.Fatalf("GetIngressNodes() error = %v", err)
+	}
+	if len(ingressNodes) != 2 || ingressNodes[0].Metadata["landb-alias"] != "app.cern.ch--load-1-" || len(ingressNodes[1].Metadata) != 0 {
+		t.Fatalf("GetIngressNodes() = %+v, want the servers seeded from the fixture", ingressNodes)
+	}
+
+	desired := []*endpoint.Endpoint{endpoint.NewEndpoint("new.cern.ch", endpoint.RecordTypeA, "10.0.0.1")}
+	if err := m.SyncState(ctx, ingressNodes, desired); err != nil {
+		t.Fatalf("SyncState() error = %v", err)
+	}
+	m.InvalidateCache()
+	if ingressNodes, err = m.GetIngressNodes(ctx, labels); err != nil {
+		t.Fatalf("GetIngressNodes() error = %v", err)
+	}
+	if got := ParseEndpointsFromMetadata(ingressNodes, "default"); len(got) != 1 || got[0].DNSName != "new.cern.ch" {
+		t.Errorf("endpoints after SyncState() = %v, want new.cern.ch", got)
+	}
+
+	// The quota of metadata items is enforced as Nova does.
+	serverID := ingressNodes[0].ID
+	err = m.UpdateNodeMetadata(ctx, serverID, map[string]string{"a": "1", "b": "2", "c": "3"}, nil)
+	if err == nil {
+		t.Error("UpdateNodeMetadata() beyond the quota error = nil, want an error")
+	}
+	metadata, err := m.getNodeMetadata(ctx, serverID)
+	if err != nil {
+		t.Fatalf("getNodeMetadata() error = %v", err)
+	}
+	want := map[string]string{
+		"landb-alias":       "new.cern.ch--load-0-",
+		ownedMetadataPrefix: ownershipMarkers("default", "new.cern.ch--load-0-"),
+		OwnerMetadataKey:    "default",
+	}
+	if !reflect.DeepEqual(metadata, want) {
+		t.Errorf("metadata = %v, want %v", metadata, want)
+	}
+}
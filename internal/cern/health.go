@@ -0,0 +1,158 @@
+package cern
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gophercloud/gophercloud/v2/openstack/compute/v2/limits"
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/log"
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/metrics"
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/pkg/config"
+)
+
+// OperationGetLimits is the operation label of the OpenStack call used to check authentication.
+const OperationGetLimits = "get-limits"
+
+// CheckAuth makes a lightweight authenticated call to the compute API, so that an expired or
+// revoked credential is reported without waiting for the next sync to fail.
+// An unreachable endpoint triggers a failover to the next configured endpoint first.
+func (c *Client) CheckAuth(ctx context.Context) error {
+	check := func() error {
+		return limits.Get(ctx, c.Compute(), limits.GetOpts{}).Err
+	}
+
+	endpoint := c.Endpoint()
+	err := metrics.ObserveOpenStackCall(OperationGetLimits, check)
+	if isUnreachable(err) && c.CanFailover() {
+		if failoverErr := c.Failover(ctx, endpoint); failoverErr != nil {
+			err = errors.Join(err, failoverErr)
+		} else {
+			err = metrics.ObserveOpenStackCall(OperationGetLimits, check)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get compute limits: %w", err)
+	}
+	return nil
+}
+
+// AuthChecker periodically checks that the OpenStack credentials still work.
+//
+// The result of the last check is exposed through Err, which backs the /readyz endpoint, and
+// through the auth health metric.
+type AuthChecker struct {
+	check    func(ctx context.Context) error
+	interval time.Duration
+
+	// mu guards err.
+	mu  sync.Mutex
+	err error
+}
+
+// NewAuthChecker creates a checker of the credentials of the given client.
+func NewAuthChecker(client *Client, cfg *config.Config) *AuthChecker {
+	return &AuthChecker{check: client.CheckAuth, interval: cfg.AuthCheckInterval}
+}
+
+// Run checks the credentials immediately, then at every interval until the context is cancelled.
+func (c *AuthChecker) Run(ctx context.Context) {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		c.runCheck(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Err returns the error of the last check, or nil if it succeeded.
+func (c *AuthChecker) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+// runCheck runs a single check and records its result.
+func (c *AuthChecker) runCheck(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, c.interval)
+	defer cancel()
+
+	err := c.check(ctx)
+	if isUnauthorized(err) {
+		metrics.CountError(metrics.ErrorSourceKeystoneAuth)
+	}
+	if err != nil {
+		log.FromContext(ctx).Error("OpenStack authentication check failed: %v", err)
+		metrics.OpenStackAuthHealthy.Set(0)
+	} else {
+		metrics.OpenStackAuthHealthy.Set(1)
+	}
+
+	c.mu.Lock()
+	if c.err != nil && err == nil {
+		log.FromContext(ctx).Info("OpenStack authentication check recovered")
+	}
+	c.err = err
+	c.mu.Unlock()
+}
+
+// computeHealth tracks the health of the compute API, as observed by the calls of a Manager.
+type computeHealth struct {
+	// maxListingAge is how old the last listing of the servers may get, zero for no limit.
+	maxListingAge time.Duration
+
+	// mu guards err and listedAt.
+	mu sync.Mutex
+	// err is the error of the last call that found the compute API unreachable, nil once a call succeeds.
+	err error
+	// listedAt is when the servers were last listed from the compute API, or when the Manager was created.
+	listedAt time.Time
+}
+
+// observe records the outcome of a call. Only the errors of an unreachable or failing compute API
+// are recorded, a rejected request says nothing about the health of the API.
+func (h *computeHealth) observe(err error) {
+	if err != nil && !isUnreachable(err) {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.err = err
+}
+
+// listed records a successful listing of the servers.
+func (h *computeHealth) listed() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.listedAt = time.Now()
+}
+
+// ComputeHealth reports whether the compute API answered the last call of the Manager, returning
+// the error of the call otherwise. It makes no call itself.
+func (m *Manager) ComputeHealth(context.Context) error {
+	m.health.mu.Lock()
+	defer m.health.mu.Unlock()
+	if m.health.err != nil {
+		return fmt.Errorf("compute API unavailable: %w", m.health.err)
+	}
+	return nil
+}
+
+// CacheHealth reports whether the servers were listed from the compute API recently enough for
+// the aliases reported to ExternalDNS to be trusted. The cached listings are refreshed on the
+// ExternalDNS polls, so a stale listing means that the polls stopped or keep failing.
+func (m *Manager) CacheHealth(context.Context) error {
+	m.health.mu.Lock()
+	defer m.health.mu.Unlock()
+	if age := time.Since(m.health.listedAt); m.health.maxListingAge > 0 && age > m.health.maxListingAge {
+		return fmt.Errorf("servers last listed %s ago", age.Round(time.Second))
+	}
+	return nil
+}
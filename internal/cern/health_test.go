@@ -0,0 +1,87 @@
+package cern
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gophercloud/gophercloud/v2"
+)
+
+func TestAuthCheckerRunCheck(t *testing.T) {
+	var failure error
+	checker := &AuthChecker{
+		check:    func(context.Context) error { return failure },
+		interval: time.Minute,
+	}
+
+	checker.runCheck(context.Background())
+	if err := checker.Err(); err != nil {
+		t.Errorf("Err() = %v after a successful check, want nil", err)
+	}
+
+	failure = errors.New("token expired")
+	checker.runCheck(context.Background())
+	if err := checker.Err(); !errors.Is(err, failure) {
+		t.Errorf("Err() = %v after a failed check, want %v", err, failure)
+	}
+
+	failure = nil
+	checker.runCheck(context.Background())
+	if err := checker.Err(); err != nil {
+		t.Errorf("Err() = %v after recovering, want nil", err)
+	}
+}
+
+func TestManagerComputeHealth(t *testing.T) {
+	unavailable := gophercloud.ErrUnexpectedResponseCode{Actual: http.StatusServiceUnavailable}
+	notFound := gophercloud.ErrUnexpectedResponseCode{Actual: http.StatusNotFound}
+
+	tests := []struct {
+		name    string
+		calls   []error
+		healthy bool
+	}{
+		{name: "no call", healthy: true},
+		{name: "unavailable", calls: []error{unavailable}, healthy: false},
+		{name: "rejected request", calls: []error{notFound}, healthy: true},
+		{name: "rejected request after an outage", calls: []error{unavailable, notFound}, healthy: false},
+		{name: "recovered", calls: []error{unavailable, nil}, healthy: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &Manager{}
+			for _, err := range tt.calls {
+				m.health.observe(err)
+			}
+			if err := m.ComputeHealth(context.Background()); (err == nil) != tt.healthy {
+				t.Errorf("ComputeHealth() = %v, want healthy %v", err, tt.healthy)
+			}
+		})
+	}
+}
+
+func TestManagerCacheHealth(t *testing.T) {
+	tests := []struct {
+		name     string
+		maxAge   time.Duration
+		listedAt time.Time
+		healthy  bool
+	}{
+		{name: "fresh", maxAge: time.Minute, listedAt: time.Now(), healthy: true},
+		{name: "stale", maxAge: time.Minute, listedAt: time.Now().Add(-time.Hour), healthy: false},
+		{name: "no limit", listedAt: time.Now().Add(-time.Hour), healthy: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &Manager{health: computeHealth{maxListingAge: tt.maxAge, listedAt: tt.listedAt}}
+			if err := m.CacheHealth(context.Background()); (err == nil) != tt.healthy {
+				t.Errorf("CacheHealth() = %v, want healthy %v", err, tt.healthy)
+			}
+		})
+	}
+}
@@ -0,0 +1,460 @@
+package cern
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gophercloud/gophercloud/v2/openstack/compute/v2/servers"
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/k8s"
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/log"
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/metrics"
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/tlsconfig"
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/pkg/config"
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+// LanDB SOAP operations used by the LanDB backend.
+const (
+	landbOpGetAuthToken      = "getAuthToken"
+	landbOpGetDeviceInfo     = "getDeviceInfo"
+	landbOpInterfaceAddAlias = "interfaceAddAlias"
+	landbOpInterfaceDelAlias = "interfaceRemoveAlias"
+	landbNamespace           = "urn:NetworkService"
+	landbAuthTypeCERN        = "CERN"
+	soapEnvelopeNamespace    = "http://schemas.xmlsoap.org/soap/envelope/"
+)
+
+// soapParam is a named parameter of a LanDB SOAP operation. Parameters are kept in order.
+type soapParam struct {
+	name  string
+	value string
+}
+
+// soapFault is the fault returned by the LanDB SOAP API.
+type soapFault struct {
+	Code   string `xml:"faultcode"`
+	String string `xml:"faultstring"`
+}
+
+// soapResponse is the envelope of a LanDB SOAP response.
+type soapResponse struct {
+	Body struct {
+		Fault   *soapFault `xml:"Fault"`
+		Content []byte     `xml:",innerxml"`
+	} `xml:"Body"`
+}
+
+// landbDeviceInfo is the subset of the getDeviceInfo response used by the LanDB backend.
+type landbDeviceInfo struct {
+	Interfaces []struct {
+		Name      string   `xml:"Name"`
+		IPAliases []string `xml:"IPAliases>item"`
+	} `xml:"getDeviceInfoResponse>DeviceInfo>Interfaces>item"`
+}
+
+// LanDBClient is a minimal client for the CERN LanDB SOAP API.
+type LanDBClient struct {
+	url        string
+	username   string
+	password   string
+	httpClient *http.Client
+
+	mu    sync.Mutex
+	token string
+}
+
+// NewLanDBClient creates a new LanDB client and authenticates it.
+func NewLanDBClient(ctx context.Context, cfg *config.Config) (*LanDBClient, error) {
+	tlsConfig, err := tlsconfig.New(cfg)
+	if err != nil {
+		return nil, err
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+
+	c := &LanDBClient{
+		url:        cfg.LanDBURL,
+		username:   cfg.LanDBUsername,
+		password:   cfg.LanDBPassword,
+		httpClient: &http.Client{Transport: transport},
+	}
+	if err := c.login(ctx); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// login requests a new LanDB authentication token.
+func (c *LanDBClient) login(ctx context.Context) error {
+	var resp struct {
+		Token string `xml:"getAuthTokenResponse>token"`
+	}
+	err := c.do(ctx, "", landbOpGetAuthToken, []soapParam{
+		{"Login", c.username},
+		{"Password", c.password},
+		{"Type", landbAuthTypeCERN},
+	}, &resp)
+	if err != nil {
+		return fmt.Errorf("failed to authenticate to LanDB: %w", err)
+	}
+
+	c.mu.Lock()
+	c.token = resp.Token
+	c.mu.Unlock()
+	return nil
+}
+
+// call runs an authenticated LanDB operation, logging in again once if the token was rejected.
+func (c *LanDBClient) call(ctx context.Context, operation string, params []soapParam, out any) error {
+	c.mu.Lock()
+	token := c.token
+	c.mu.Unlock()
+
+	err := c.do(ctx, token, operation, params, out)
+	var fault *soapFault
+	if err == nil || !errors.As(err, &fault) || !strings.Contains(strings.ToLower(fault.String), "token") {
+		return err
+	}
+
+	log.FromContext(ctx).Warn("LanDB token rejected during %s, logging in again", operation)
+	if err := c.login(ctx); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	token = c.token
+	c.mu.Unlock()
+	return c.do(ctx, token, operation, params, out)
+}
+
+// do sends a single SOAP request and decodes the response body into out.
+func (c *LanDBClient) do(ctx context.Context, token, operation string, params []soapParam, out any) error {
+	var body bytes.Buffer
+	fmt.Fprintf(&body, `<?xml version="1.0" encoding="UTF-8"?><soap:Envelope xmlns:soap=%q xmlns:landb=%q>`, soapEnvelopeNamespace, landbNamespace)
+	if token != "" {
+		body.WriteString("<soap:Header><landb:Auth><token>")
+		if err := xml.EscapeText(&body, []byte(token)); err != nil {
+			return err
+		}
+		body.WriteString("</token></landb:Auth></soap:Header>")
+	}
+	fmt.Fprintf(&body, "<soap:Body><landb:%s>", operation)
+	for _, param := range params {
+		fmt.Fprintf(&body, "<%s>", param.name)
+		if err := xml.EscapeText(&body, []byte(param.value)); err != nil {
+			return err
+		}
+		fmt.Fprintf(&body, "</%s>", param.name)
+	}
+	fmt.Fprintf(&body, "</landb:%s></soap:Body></soap:Envelope>", operation)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/xml; charset=utf-8")
+	req.Header.Set("SOAPAction", landbNamespace+"#"+operation)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("LanDB %s request failed: %w", operation, err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read LanDB %s response: %w", operation, err)
+	}
+
+	var envelope soapResponse
+	if err := xml.Unmarshal(data, &envelope); err != nil {
+		return fmt.Errorf("failed to decode LanDB %s response (%s): %w", operation, resp.Status, err)
+	}
+	if envelope.Body.Fault != nil {
+		return envelope.Body.Fault
+	}
+	if out == nil {
+		return nil
+	}
+	// The body content is a sequence of elements, wrap it so it can be decoded as a document.
+	wrapped := append(append([]byte("<Body>"), envelope.Body.Content...), []byte("</Body>")...)
+	if err := xml.Unmarshal(wrapped, out); err != nil {
+		return fmt.Errorf("failed to decode LanDB %s response: %w", operation, err)
+	}
+	return nil
+}
+
+// Error implements the error interface.
+func (f *soapFault) Error() string {
+	return fmt.Sprintf("LanDB fault %s: %s", f.Code, f.String)
+}
+
+// DeviceInterfaces returns the interfaces of a LanDB device and their aliases.
+func (c *LanDBClient) DeviceInterfaces(ctx context.Context, device string) (map[string][]string, error) {
+	var info landbDeviceInfo
+	if err := c.call(ctx, landbOpGetDeviceInfo, []soapParam{{"DeviceName", device}}, &info); err != nil {
+		return nil, fmt.Errorf("failed to get LanDB device %s: %w", device, err)
+	}
+
+	interfaces := make(map[string][]string, len(info.Interfaces))
+	for _, iface := range info.Interfaces {
+		interfaces[iface.Name] = iface.IPAliases
+	}
+	return interfaces, nil
+}
+
+// AddAlias attaches an alias to a LanDB interface.
+func (c *LanDBClient) AddAlias(ctx context.Context, iface, alias string) error {
+	if err := c.call(ctx, landbOpInterfaceAddAlias, []soapParam{{"InterfaceName", iface}, {"Alias", alias}}, nil); err != nil {
+		return fmt.Errorf("failed to add alias %s to %s: %w", alias, iface, err)
+	}
+	return nil
+}
+
+// RemoveAlias detaches an alias from a LanDB interface.
+func (c *LanDBClient) RemoveAlias(ctx context.Context, iface, alias string) error {
+	if err := c.call(ctx, landbOpInterfaceDelAlias, []soapParam{{"InterfaceName", iface}, {"Alias", alias}}, nil); err != nil {
+		return fmt.Errorf("failed to remove alias %s from %s: %w", alias, iface, err)
+	}
+	return nil
+}
+
+// LanDBBackend manages aliases directly in LanDB instead of through Nova metadata.
+//
+// Kubernetes node names are used as LanDB device names, and aliases are attached to the
+// device interface named after the node. Since LanDB stores every alias individually,
+// the 254-character splitting of the Nova metadata does not apply.
+type LanDBBackend struct {
+	client    *LanDBClient
+	k8sClient *k8s.Client
+	// nodeFilter drops the Kubernetes nodes that cannot serve traffic.
+	nodeFilter k8s.NodeFilter
+	// interfaceTemplate names the interface carrying the aliases of every device, with `{device}`
+	// replaced by the device name. Empty picks the interface named after the device.
+	interfaceTemplate string
+	// ownerID is the owner ID of the webhook instance, whose aliases are the managed ones.
+	ownerID string
+	// logger logs the messages not tied to a request, whose messages go to the logger of their context.
+	logger log.Logger
+}
+
+// NewLanDBBackend creates a new LanDB backend, logging to the given logger.
+func NewLanDBBackend(client *LanDBClient, k8sClient *k8s.Client, cfg *config.Config, logger log.Logger) *LanDBBackend {
+	return &LanDBBackend{
+		client:            client,
+		k8sClient:         k8sClient,
+		nodeFilter:        NewNodeFilter(cfg),
+		interfaceTemplate: cfg.LanDBInterface,
+		ownerID:           cfg.OwnerID,
+		logger:            logger,
+	}
+}
+
+// GetIngressNodes retrieves the LanDB devices of the Kubernetes nodes matching any of the label selectors.
+func (b *LanDBBackend) GetIngressNodes(ctx context.Context, labelSelectors []string) ([]IngressNode, error) {
+	k8sNodes, err := b.k8sClient.GetIngressNodes(ctx, labelSelectors)
+	if err != nil {
+		metrics.CountError(metrics.ErrorSourceK8sList)
+		return nil, fmt.Errorf("failed to get ingress nodes from k8s: %w", err)
+	}
+	k8sNodes = b.nodeFilter.Filter(ctx, k8sNodes)
+
+	nodes := make([]IngressNode, 0, len(k8sNodes))
+	for _, k8sNode := range k8sNodes {
+		device := landbDeviceName(k8sNode.Name)
+		iface, aliases, err := b.deviceAliases(ctx, device, k8sNode.Labels[LanDBInterfaceLabel])
+		if err != nil {
+			return nil, err
+		}
+		if iface == "" {
+			log.FromContext(ctx).Warn("LanDB device %s has no interface, skipping", device)
+			continue
+		}
+
+		nodes = append(nodes, IngressNode{
+			Server: servers.Server{
+				ID:       device,
+				Name:     k8sNode.Name,
+				Metadata: packAliases(aliases),
+			},
+			Labels:    k8sNode.Labels,
+			Interface: iface,
+		})
+	}
+
+	// Sort by device name for deterministic behavior
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].ID < nodes[j].ID
+	})
+
+	// The aliases live in LanDB, the Nova metadata quota does not apply.
+	observeAliasUsage(nodes, 0)
+	return nodes, nil
+}
+
+// landbDeviceName returns the LanDB device name of a host: its uppercased short hostname.
+func landbDeviceName(hostname string) string {
+	return strings.ToUpper(strings.SplitN(hostname, ".", 2)[0])
+}
+
+// deviceAliases returns the interface carrying the aliases of a LanDB device and the aliases on it
+// that are managed by the webhook. The interface is empty if the device has no matching interface.
+//
+// The interface is, in order of precedence, the one named by iface, the one named by the interface
+// template, or the interface named after the device.
+func (b *LanDBBackend) deviceAliases(ctx context.Context, device, iface string) (string, []string, error) {
+	interfaces, err := b.client.DeviceInterfaces(ctx, device)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if iface == "" {
+		iface = strings.ReplaceAll(b.interfaceTemplate, "{device}", device)
+	}
+	iface = pickInterface(device, iface, interfaces)
+	if iface == "" {
+		return "", nil, nil
+	}
+
+	// Only the aliases in the webhook format are reported, manually added aliases are left alone.
+	var managed []string
+	for _, alias := range interfaces[iface] {
+		if strings.Contains(alias, "--load-") {
+			managed = append(managed, alias)
+		}
+	}
+	return iface, managed, nil
+}
+
+// pickInterface returns the interface of a device matching name case-insensitively, or the one
+// picked by landbInterface if name is empty. It returns an empty string if there is no match.
+func pickInterface(device, name string, interfaces map[string][]string) string {
+	if name == "" {
+		return landbInterface(device, interfaces)
+	}
+	for iface := range interfaces {
+		if strings.EqualFold(iface, name) {
+			return iface
+		}
+	}
+	return ""
+}
+
+// landbInterface picks the interface carrying the aliases of a device: the interface named after
+// the device if present, otherwise the first one in name order.
+func landbInterface(device string, interfaces map[string][]string) string {
+	names := make([]string, 0, len(interfaces))
+	for name := range interfaces {
+		if strings.EqualFold(strings.SplitN(name, ".", 2)[0], device) {
+			return name
+		}
+		names = append(names, name)
+	}
+	if len(names) == 0 {
+		return ""
+	}
+	sort.Strings(names)
+	return names[0]
+}
+
+// Plan returns the alias changes SyncState would make to the ingress nodes, expressed as changes
+// to their `landb-alias*` keys.
+func (b *LanDBBackend) Plan(nodes []IngressNode, endpoints []*endpoint.Endpoint) []NodePlan {
+	current, desired := b.nodesMetadata(nodes, endpoints)
+	return planNodesMetadata(nodes, current, desired)
+}
+
+// State returns the current and desired aliases of every ingress node, as `landb-alias*` keys.
+func (b *LanDBBackend) State(nodes []IngressNode, endpoints []*endpoint.Endpoint) []NodeState {
+	current, desired := b.nodesMetadata(nodes, endpoints)
+	return nodesState(nodes, current, desired)
+}
+
+// nodesMetadata returns the current and desired `landb-alias*` keys of every node, aligned with nodes.
+func (b *LanDBBackend) nodesMetadata(nodes []IngressNode, endpoints []*endpoint.Endpoint) ([]map[string]string, []map[string]string) {
+	desired := GenerateNodesMetadata(b.logger, nodes, endpoints, b.ownerID)
+	current := make([]map[string]string, len(nodes))
+	for i, node := range nodes {
+		current[i] = aliasMetadata(node.Metadata)
+	}
+	return current, desired
+}
+
+// SyncState synchronizes the aliases of all ingress nodes to match the desired endpoints.
+func (b *LanDBBackend) SyncState(ctx context.Context, nodes []IngressNode, endpoints []*endpoint.Endpoint) error {
+	desired := GenerateNodesAliases(log.FromContext(ctx), nodes, endpoints, b.ownerID)
+
+	var errs []error
+	for i, node := range nodes {
+		errs = append(errs, b.syncAliases(ctx, node.Interface, unpackAliases(node.Metadata), desired[i]))
+	}
+	return errors.Join(errs...)
+}
+
+// syncAliases brings the aliases on a LanDB interface from the current to the desired ones.
+// New aliases are added before stale ones are removed, so DNS names never disappear midway.
+func (b *LanDBBackend) syncAliases(ctx context.Context, iface string, currentAliases, desired []string) error {
+	current := make(map[string]struct{})
+	for _, alias := range currentAliases {
+		current[alias] = struct{}{}
+	}
+	wanted := make(map[string]struct{})
+	for _, alias := range desired {
+		wanted[alias] = struct{}{}
+	}
+
+	var errs []error
+	for alias := range wanted {
+		if _, ok := current[alias]; ok {
+			continue
+		}
+		log.FromContext(ctx).Info("Adding LanDB alias %s to %s", alias, iface)
+		if err := b.client.AddAlias(ctx, iface, alias); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for alias := range current {
+		if _, ok := wanted[alias]; ok {
+			continue
+		}
+		log.FromContext(ctx).Info("Removing LanDB alias %s from %s", alias, iface)
+		if err := b.client.RemoveAlias(ctx, iface, alias); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// SetLanDBBackend makes the manager write the aliases of some nodes directly to LanDB: bare-metal
+// nodes, since the Nova metadata of Ironic instances is not propagated to LanDB at CERN, and nodes
+// whose aliases must be attached to a specific interface.
+func (m *Manager) SetLanDBBackend(backend *LanDBBackend) {
+	m.landb = backend
+}
+
+// usesLanDB reports whether the aliases of a node are written directly to LanDB.
+func (m *Manager) usesLanDB(node IngressNode) bool {
+	if node.Labels[LanDBInterfaceLabel] != "" && m.landb == nil {
+		m.logger.Warn("Server %s requires LanDB interface %s, but no LanDB credentials are configured", node.Name, node.Labels[LanDBInterfaceLabel])
+	}
+	return m.landb != nil && (node.BareMetal || m.landb.interfaceTemplate != "" || node.Labels[LanDBInterfaceLabel] != "")
+}
+
+// loadLanDBAliases replaces the aliases reported in the Nova metadata of a node by the ones on its
+// LanDB interface. It returns false if the LanDB device has no matching interface.
+func (m *Manager) loadLanDBAliases(ctx context.Context, node *IngressNode) (bool, error) {
+	iface, aliases, err := m.landb.deviceAliases(ctx, landbDeviceName(node.Name), node.Labels[LanDBInterfaceLabel])
+	if err != nil || iface == "" {
+		return false, err
+	}
+	node.Interface = iface
+	node.Metadata = replaceAliasMetadata(node.Metadata, packAliases(aliases))
+	return true, nil
+}
@@ -0,0 +1,91 @@
+package cern
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/pkg/config"
+)
+
+func TestLanDBClientDeviceInterfaces(t *testing.T) {
+	logins := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		switch {
+		case strings.Contains(string(body), "<landb:getAuthToken>"):
+			logins++
+			_, _ = io.WriteString(w, `<Envelope><Body><getAuthTokenResponse><token>token-`+string(rune('0'+logins))+`</token></getAuthTokenResponse></Body></Envelope>`)
+		case strings.Contains(string(body), "<token>token-1</token>"):
+			_, _ = io.WriteString(w, `<Envelope><Body><Fault><faultcode>SOAP-ENV:Client</faultcode><faultstring>Invalid token</faultstring></Fault></Body></Envelope>`)
+		default:
+			_, _ = io.WriteString(w, `<Envelope><Body><getDeviceInfoResponse><DeviceInfo><Interfaces>
+				<item><Name>NODE-1.CERN.CH</Name><IPAliases><item>a.cern.ch--load-1-</item><item>manual</item></IPAliases></item>
+			</Interfaces></DeviceInfo></getDeviceInfoResponse></Body></Envelope>`)
+		}
+	}))
+	defer server.Close()
+
+	client, err := NewLanDBClient(context.Background(), &config.Config{LanDBURL: server.URL, LanDBUsername: "user", LanDBPassword: "pass"})
+	if err != nil {
+		t.Fatalf("NewLanDBClient() error = %v", err)
+	}
+
+	interfaces, err := client.DeviceInterfaces(context.Background(), "NODE-1")
+	if err != nil {
+		t.Fatalf("DeviceInterfaces() error = %v", err)
+	}
+
+	expected := map[string][]string{"NODE-1.CERN.CH": {"a.cern.ch--load-1-", "manual"}}
+	if !reflect.DeepEqual(interfaces, expected) {
+		t.Errorf("DeviceInterfaces() = %v, want %v", interfaces, expected)
+	}
+	if logins != 2 {
+		t.Errorf("expected a second login after the token was rejected, got %d logins", logins)
+	}
+}
+
+func TestLanDBInterface(t *testing.T) {
+	tests := []struct {
+		name       string
+		interfaces map[string][]string
+		expected   string
+	}{
+		{name: "Named after device", interfaces: map[string][]string{"A.CERN.CH": nil, "NODE-1.CERN.CH": nil}, expected: "NODE-1.CERN.CH"},
+		{name: "First by name", interfaces: map[string][]string{"B.CERN.CH": nil, "A.CERN.CH": nil}, expected: "A.CERN.CH"},
+		{name: "No interface", interfaces: map[string][]string{}, expected: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := landbInterface("NODE-1", tt.interfaces); got != tt.expected {
+				t.Errorf("landbInterface() = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestPickInterface(t *testing.T) {
+	interfaces := map[string][]string{"NODE-1.CERN.CH": nil, "NODE-1-IPMI.CERN.CH": nil}
+	tests := []struct {
+		name     string
+		iface    string
+		expected string
+	}{
+		{name: "Default interface", iface: "", expected: "NODE-1.CERN.CH"},
+		{name: "Named interface", iface: "node-1-ipmi.cern.ch", expected: "NODE-1-IPMI.CERN.CH"},
+		{name: "Missing interface", iface: "NODE-1-ETH2.CERN.CH", expected: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := pickInterface("NODE-1", tt.iface, interfaces); got != tt.expected {
+				t.Errorf("pickInterface() = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,14 @@
+package cern
+
+import (
+	"os"
+	"testing"
+
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/log"
+)
+
+func TestMain(m *testing.M) {
+	// The contexts carrying no logger log through the global logger, which is normally set up by main.
+	log.GlobalLogger = log.NewLogger(log.LevelError)
+	os.Exit(m.Run())
+}
@@ -2,82 +2,413 @@ package cern
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 
-	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
-	"github.com/gophercloud/gophercloud/pagination"
+	"github.com/gophercloud/gophercloud/v2/openstack/compute/v2/servers"
 	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/k8s"
 	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/log"
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/metrics"
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/tracing"
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/pkg/config"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	corev1 "k8s.io/api/core/v1"
 	"sigs.k8s.io/external-dns/endpoint"
 )
 
+// DefaultServerStatuses are the server statuses accepted for ingress nodes by default.
+// Besides ACTIVE, they include the transitional states of routine maintenance, so that the
+// aliases of a rebooting or migrating node do not flap.
+var DefaultServerStatuses = []string{"ACTIVE", "REBOOT", "HARD_REBOOT", "MIGRATING", "RESIZE", "VERIFY_RESIZE"}
+
 // Manager handles the interaction with OpenStack servers and metadata.
 type Manager struct {
+	// compute makes the compute API calls.
+	compute ComputeAPI
+	// client fails over to another endpoint and re-authenticates, nil when compute is not backed by
+	// an OpenStack client, e.g. in tests.
 	client    *Client
 	k8sClient *k8s.Client
+	// nodeFilter drops the Kubernetes nodes that cannot serve traffic.
+	nodeFilter k8s.NodeFilter
+	// addressType is the type of the node address reported as a target of the aliases.
+	addressType string
+	cache       *serverCache
+	retry       retryPolicy
+	// concurrency is the maximum number of nodes updated in parallel.
+	concurrency int
+	// rollback enables restoring the previous metadata after a partial sync failure.
+	rollback bool
+	// replaceThreshold is the number of per-key Nova calls from which the whole metadata of a node
+	// is replaced in a single call instead. Zero disables replacing.
+	replaceThreshold int
+	// verifyAttempts is the number of times the metadata of a node is read back after a write to
+	// check it against the desired state. Zero disables the verification.
+	verifyAttempts int
+	// metadataMaxItems is the Nova quota of metadata items of a server, against which the metadata
+	// utilization of the nodes is reported.
+	metadataMaxItems int
+	// ownerID is written to the owner key of the managed servers.
+	ownerID string
+	// orphanScan is the orphan scan mode run on every sync.
+	orphanScan string
+	// statuses holds the server statuses accepted for ingress nodes.
+	statuses map[string]struct{}
+	// bareMetalFlavors holds the names of the flavors of bare-metal nodes.
+	bareMetalFlavors map[string]struct{}
+	// landb writes the aliases of some nodes directly to LanDB, nil to always use Nova metadata.
+	landb *LanDBBackend
+	// health tracks the health of the compute API.
+	health computeHealth
+	// logger logs the messages not tied to a request, whose messages go to the logger of their context.
+	logger log.Logger
+
+	// mu guards managed and departed.
+	mu sync.Mutex
+	// managed holds the IDs of the servers that have been ingress nodes since the webhook started.
+	managed map[string]struct{}
+	// departed holds the managed servers that left the ingress set and still carry aliases.
+	departed map[string]IngressNode
 }
 
-// NewManager creates a new Manager.
-func NewManager(client *Client, k8sClient *k8s.Client) *Manager {
+// NewManager creates a new Manager, logging to the given logger.
+func NewManager(client *Client, k8sClient *k8s.Client, cfg *config.Config, logger log.Logger) *Manager {
 	return &Manager{
-		client:    client,
-		k8sClient: k8sClient,
+		compute:          client,
+		client:           client,
+		k8sClient:        k8sClient,
+		nodeFilter:       NewNodeFilter(cfg),
+		addressType:      cfg.NodeAddressType,
+		cache:            &serverCache{ttl: cfg.ServerCacheTTL},
+		retry:            newRetryPolicy(cfg),
+		concurrency:      cfg.SyncConcurrency,
+		rollback:         cfg.RollbackOnFailure,
+		replaceThreshold: cfg.MetadataReplaceThreshold,
+		verifyAttempts:   cfg.WriteVerifyAttempts,
+		metadataMaxItems: cfg.MetadataMaxItems,
+		ownerID:          cfg.OwnerID,
+		orphanScan:       cfg.OrphanScan,
+		statuses:         serverStatuses(cfg.ServerStatuses),
+		bareMetalFlavors: stringSet(cfg.BareMetalFlavors),
+		managed:          make(map[string]struct{}),
+		departed:         make(map[string]IngressNode),
+		health:           computeHealth{maxListingAge: cfg.HealthMaxCacheAge, listedAt: time.Now()},
+		logger:           logger,
 	}
 }
 
-// GetIngressNodes retrieves all OpenStack servers that correspond to Kubernetes nodes matching the label.
-func (m *Manager) GetIngressNodes(ctx context.Context, labelKey string) ([]servers.Server, error) {
-	// 1. Get K8s Node Names
-	nodeNames, err := m.k8sClient.GetIngressNodeNames(ctx, labelKey)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get ingress node names from k8s: %w", err)
+// serverStatuses returns the set of accepted server statuses, defaulting to DefaultServerStatuses.
+func serverStatuses(statuses []string) map[string]struct{} {
+	if len(statuses) == 0 {
+		statuses = DefaultServerStatuses
 	}
+	set := make(map[string]struct{}, len(statuses))
+	for _, status := range statuses {
+		set[strings.ToUpper(strings.TrimSpace(status))] = struct{}{}
+	}
+	return set
+}
 
-	// Create a map for O(1) lookups
-	targetNames := make(map[string]struct{})
-	for _, name := range nodeNames {
-		targetNames[name] = struct{}{}
+// stringSet returns the set of the given values.
+func stringSet(values []string) map[string]struct{} {
+	set := make(map[string]struct{}, len(values))
+	for _, value := range values {
+		set[value] = struct{}{}
 	}
+	return set
+}
+
+// InvalidateCache drops the cached OpenStack server listing.
+func (m *Manager) InvalidateCache() {
+	m.cache.invalidate()
+}
+
+// GetIngressNodes retrieves all OpenStack servers that correspond to Kubernetes nodes matching any of the label selectors.
+func (m *Manager) GetIngressNodes(ctx context.Context, labelSelectors []string) (_ []IngressNode, err error) {
+	ctx, span := tracing.Start(ctx, "cern.GetIngressNodes")
+	defer func() { tracing.End(span, err) }()
+
+	// 1. Get K8s Nodes
+	k8sNodes, err := m.k8sClient.GetIngressNodes(ctx, labelSelectors)
+	if err != nil {
+		metrics.CountError(metrics.ErrorSourceK8sList)
+		return nil, fmt.Errorf("failed to get ingress nodes from k8s: %w", err)
+	}
+	k8sNodes = m.nodeFilter.Filter(ctx, k8sNodes)
 
 	// 2. List all OpenStack servers
-	// We list all active servers and filter client-side by name.
-	opts := servers.ListOpts{
-		Status: "ACTIVE",
+	// We list all servers and match them client-side by status, and by UUID or name.
+	index, err := m.listServers(ctx)
+	if err != nil {
+		return nil, err
 	}
+	matchingServers := m.matchServers(ctx, index, k8sNodes)
 
-	pager := servers.List(m.client.Compute, opts)
-	var matchingServers []servers.Server
+	// Nodes whose aliases are written to LanDB report the aliases of their LanDB interface.
+	nodes := matchingServers[:0]
+	for _, node := range matchingServers {
+		node.BareMetal = IsBareMetal(node.Flavor, m.bareMetalFlavors)
+		if m.usesLanDB(node) {
+			ok, err := m.loadLanDBAliases(ctx, &node)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				log.FromContext(ctx).Warn("LanDB device of server %s has no matching interface, skipping", node.Name)
+				continue
+			}
+		}
+		nodes = append(nodes, node)
+	}
+	matchingServers = nodes
 
-	err = pager.EachPage(func(page pagination.Page) (bool, error) {
-		serverList, err := servers.ExtractServers(page)
-		if err != nil {
-			return false, err
+	// 3. Sort by ID for deterministic behavior
+	sort.Slice(matchingServers, func(i, j int) bool {
+		return matchingServers[i].ID < matchingServers[j].ID
+	})
+
+	// 4. Remember which servers left the ingress set, so their aliases are removed on the next sync.
+	m.trackManaged(index, matchingServers)
+	observeAliasUsage(matchingServers, m.metadataMaxItems)
+
+	span.SetAttributes(attribute.Int("servers", len(index.servers)), attribute.Int("nodes", len(matchingServers)))
+	return matchingServers, nil
+}
+
+// matchServers returns the servers of the index backing the Kubernetes nodes, in no particular
+// order, dropping the servers whose status is not accepted.
+//
+// Nodes are matched by the server UUID in their providerID, and by name only when it is absent.
+// Each node costs a lookup in the index, whatever the size of the project.
+func (m *Manager) matchServers(ctx context.Context, index *serverIndex, k8sNodes []corev1.Node) []IngressNode {
+	targetIDs := make(map[string]*corev1.Node)
+	targetNames := make(map[string]*corev1.Node)
+	for i := range k8sNodes {
+		node := &k8sNodes[i]
+		if serverID, ok := ServerIDFromProviderID(node.Spec.ProviderID); ok {
+			targetIDs[serverID] = node
+		} else {
+			targetNames[node.Name] = node
 		}
+	}
 
-		for _, server := range serverList {
-			if _, ok := targetNames[server.Name]; ok {
-				matchingServers = append(matchingServers, server)
+	var matchingServers []IngressNode
+	for serverID, node := range targetIDs {
+		server, ok := index.server(serverID)
+		if !ok || !m.accepted(server) {
+			log.FromContext(ctx).Warn("No active OpenStack server found for ingress node with server ID %s", serverID)
+			continue
+		}
+		matchingServers = append(matchingServers, m.ingressNode(*server, node))
+	}
+	for name, node := range targetNames {
+		index.named(name, func(server *servers.Server) {
+			// A server backing a node by UUID is never matched by name by another node.
+			if _, ok := targetIDs[server.ID]; ok || !m.accepted(server) {
+				return
 			}
+			matchingServers = append(matchingServers, m.ingressNode(*server, node))
+		})
+	}
+	return matchingServers
+}
+
+// accepted reports whether the status of a server is accepted for ingress nodes. Servers in other
+// states, e.g. SHELVED, are dropped and their aliases removed.
+func (m *Manager) accepted(server *servers.Server) bool {
+	_, ok := m.statuses[server.Status]
+	return ok
+}
+
+// ingressNode builds the ingress node of a server backing a Kubernetes node.
+func (m *Manager) ingressNode(server servers.Server, node *corev1.Node) IngressNode {
+	address := k8s.NodeAddress(*node, m.addressType)
+	if address == "" {
+		m.logger.Warn("Node %s has no %s address, its aliases are reported without it", node.Name, m.addressType)
+	}
+	return IngressNode{Server: server, Labels: node.Labels, Address: address}
+}
+
+// trackManaged records the current ingress nodes as managed, and flags the managed servers that are
+// no longer ingress nodes but still carry aliases as departed.
+//
+// Tracking is kept in memory, so servers that left the ingress set while the webhook was not running
+// are not detected.
+func (m *Manager) trackManaged(index *serverIndex, nodes []IngressNode) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	current := make(map[string]struct{}, len(nodes))
+	for _, node := range nodes {
+		current[node.ID] = struct{}{}
+		m.managed[node.ID] = struct{}{}
+		delete(m.departed, node.ID)
+	}
+
+	// The managed servers are looked up in the index, rather than the listing scanned for them.
+	for serverID := range m.managed {
+		if _, ok := current[serverID]; ok {
+			continue
 		}
-		return true, nil
-	})
+		server, ok := index.server(serverID)
+		if !ok {
+			continue
+		}
+		if !carriesManagedAliases(server.Metadata, m.ownerID) {
+			// Nothing left to clean up.
+			delete(m.managed, serverID)
+			delete(m.departed, serverID)
+			continue
+		}
+		if _, ok := m.departed[serverID]; !ok {
+			m.logger.Info("Server %s left the ingress set, its aliases will be removed on the next sync", server.Name)
+		}
+		m.departed[serverID] = IngressNode{Server: *server}
+	}
+}
+
+// cleanupDeparted removes the aliases of the servers that left the ingress set.
+// Failures are logged and the servers are retried on the next sync.
+func (m *Manager) cleanupDeparted(ctx context.Context) {
+	m.mu.Lock()
+	nodes := make([]IngressNode, 0, len(m.departed))
+	for _, node := range m.departed {
+		nodes = append(nodes, node)
+	}
+	m.mu.Unlock()
+
+	if len(nodes) == 0 {
+		return
+	}
+
+	// The foreign aliases of the servers are kept, as by the orphan scan.
+	current := make([]map[string]string, len(nodes))
+	desired := make([]map[string]string, len(nodes))
+	for i, node := range nodes {
+		current[i] = managedMetadata(node.Metadata)
+		desired[i] = ownedMetadata(nil, foreignAliases(node.Metadata, m.ownerID), m.ownerID)
+	}
+
+	_, errs := m.applyNodesMetadata(ctx, nodes, current, desired)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, node := range nodes {
+		if errs[i] != nil {
+			log.FromContext(ctx).Warn("Failed to remove aliases of departed server %s: %v", node.Name, errs[i])
+			continue
+		}
+		log.FromContext(ctx).Info("Removed aliases of departed server %s", node.Name)
+		delete(m.departed, node.ID)
+		delete(m.managed, node.ID)
+	}
+}
+
+// Names of the OpenStack operations, used in logs and as the operation label of the metrics.
+const (
+	OperationListServers     = "list"
+	OperationGetMetadata     = "get-metadata"
+	OperationUpdateMetadata  = "update-metadata"
+	OperationResetMetadata   = "reset-metadata"
+	OperationDeleteMetadatum = "delete-metadatum"
+	OperationReauthenticate  = "reauthenticate"
+)
+
+// do runs an OpenStack operation with retries, re-authenticating once if the token is rejected.
+// Every attempt is recorded in the OpenStack request metrics, the whole operation in a span, and
+// its outcome in the health of the compute API.
+func (m *Manager) do(ctx context.Context, operation string, fn func() error) (err error) {
+	ctx, span := tracing.Start(ctx, "openstack."+operation)
+	defer func() {
+		if source := errorSource(operation, err); source != "" {
+			metrics.CountError(source)
+		}
+		m.health.observe(err)
+		tracing.End(span, err)
+	}()
+
+	observed := func() error {
+		return metrics.ObserveOpenStackCall(operation, fn)
+	}
+
+	if m.client == nil {
+		return m.retry.do(ctx, operation, observed)
+	}
+
+	endpoint := m.client.Endpoint()
+	err = m.retry.do(ctx, operation, observed)
+	if isUnreachable(err) && m.client.CanFailover() {
+		log.FromContext(ctx).Warn("OpenStack endpoint unavailable during %s, failing over: %v", operation, err)
+		if failoverErr := m.client.Failover(ctx, endpoint); failoverErr != nil {
+			return errors.Join(err, failoverErr)
+		}
+		err = m.retry.do(ctx, operation, observed)
+	}
+	if !isUnauthorized(err) {
+		return err
+	}
+
+	log.FromContext(ctx).Warn("Token rejected during %s, re-authenticating", operation)
+	if reauthErr := m.client.Reauthenticate(ctx); reauthErr != nil {
+		return errors.Join(err, reauthErr)
+	}
+	return m.retry.do(ctx, operation, observed)
+}
+
+// errorSource returns the source of the error of an OpenStack operation, as counted in the error
+// metrics, or an empty string if there is no error or it is not counted.
+func errorSource(operation string, err error) string {
+	switch {
+	case err == nil:
+		return ""
+	case isUnauthorized(err):
+		return metrics.ErrorSourceKeystoneAuth
+	case operation == OperationListServers:
+		return metrics.ErrorSourceNovaList
+	case operation == OperationGetMetadata, operation == OperationUpdateMetadata, operation == OperationResetMetadata, operation == OperationDeleteMetadatum:
+		return metrics.ErrorSourceNovaMetadata
+	default:
+		return ""
+	}
+}
+
+// listServers lists all OpenStack servers, indexed, answering from the cache when possible.
+// Servers in every status are listed, so servers leaving the accepted statuses can be cleaned up.
+func (m *Manager) listServers(ctx context.Context) (*serverIndex, error) {
+	if cached, ok := m.cache.get(); ok {
+		trace.SpanFromContext(ctx).AddEvent("Using cached listing of servers")
+		log.FromContext(ctx).Debug("Using cached listing of %d servers", len(cached.servers))
+		return cached, nil
+	}
 
+	var serverList []servers.Server
+	err := m.do(ctx, OperationListServers, func() error {
+		var err error
+		serverList, err = m.compute.ListServers(ctx)
+		return err
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to list openstack servers: %w", err)
 	}
 
-	// 3. Sort for deterministic behavior
-	FilterServers(matchingServers, "")
-
-	return matchingServers, nil
+	m.health.listed()
+	return m.cache.set(serverList), nil
 }
 
 // UpdateNodeMetadata updates the metadata of a specific node.
 func (m *Manager) UpdateNodeMetadata(ctx context.Context, serverID string, toUpdate map[string]string, toDelete []string) error {
 	// Update items
 	if len(toUpdate) > 0 {
-		log.GlobalLogger.Info("Updating metadata for server %s: %v", serverID, toUpdate)
-		_, err := servers.UpdateMetadata(m.client.Compute, serverID, servers.MetadataOpts(toUpdate)).Extract()
+		log.FromContext(ctx).Info("Updating metadata for server %s: %v", serverID, toUpdate)
+		log.FromContext(ctx).Trace("Metadata update payload for server %s: %s", serverID, log.JSON(map[string]any{"metadata": toUpdate}))
+		err := m.do(ctx, OperationUpdateMetadata, func() error {
+			return m.compute.UpdateMetadata(ctx, serverID, toUpdate)
+		})
 		if err != nil {
 			return fmt.Errorf("failed to update metadata for server %s: %w", serverID, err)
 		}
@@ -85,8 +416,10 @@ func (m *Manager) UpdateNodeMetadata(ctx context.Context, serverID string, toUpd
 
 	// Delete items
 	for _, key := range toDelete {
-		log.GlobalLogger.Info("Deleting metadata key %s for server %s", key, serverID)
-		err := servers.DeleteMetadatum(m.client.Compute, serverID, key).ExtractErr()
+		log.FromContext(ctx).Info("Deleting metadata key %s for server %s", key, serverID)
+		err := m.do(ctx, OperationDeleteMetadatum, func() error {
+			return m.compute.DeleteMetadatum(ctx, serverID, key)
+		})
 		if err != nil {
 			// If it's already gone, maybe ignore? But for now report error.
 			return fmt.Errorf("failed to delete metadata key %s for server %s: %w", key, serverID, err)
@@ -96,28 +429,259 @@ func (m *Manager) UpdateNodeMetadata(ctx context.Context, serverID string, toUpd
 	return nil
 }
 
+// ReplaceNodeMetadata replaces the whole metadata of a specific node in a single call.
+func (m *Manager) ReplaceNodeMetadata(ctx context.Context, serverID string, metadata map[string]string) error {
+	log.FromContext(ctx).Info("Replacing metadata for server %s: %v", serverID, metadata)
+	log.FromContext(ctx).Trace("Metadata replace payload for server %s: %s", serverID, log.JSON(map[string]any{"metadata": metadata}))
+	err := m.do(ctx, OperationResetMetadata, func() error {
+		return m.compute.SetMetadata(ctx, serverID, metadata)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to replace metadata for server %s: %w", serverID, err)
+	}
+	return nil
+}
+
+// shouldReplace reports whether a metadata diff is large enough to be committed with a single replace call.
+func (m *Manager) shouldReplace(toUpdate map[string]string, toDelete []string) bool {
+	calls := len(toDelete)
+	if len(toUpdate) > 0 {
+		calls++
+	}
+	return m.replaceThreshold > 0 && calls >= m.replaceThreshold
+}
+
+// SyncError is returned by SyncState when some nodes could not be updated.
+//
+// It reports the exact set of nodes left in an unexpected state so the operator can intervene.
+type SyncError struct {
+	// Failed lists the servers whose update failed.
+	Failed []string
+	// RolledBack lists the servers restored to their previous metadata after the failure.
+	RolledBack []string
+	// Inconsistent lists the servers whose metadata matches neither the previous nor the desired state,
+	// or that kept the desired state while other nodes did not.
+	Inconsistent []string
+	// Err aggregates the underlying errors.
+	Err error
+}
+
+// Error implements the error interface.
+func (e *SyncError) Error() string {
+	return fmt.Sprintf("failed to update nodes %v (rolled back: %v, inconsistent: %v): %v", e.Failed, e.RolledBack, e.Inconsistent, e.Err)
+}
+
+// Unwrap returns the underlying errors.
+func (e *SyncError) Unwrap() error {
+	return e.Err
+}
+
 // SyncState synchronizes the state of all ingress nodes to match the desired endpoints.
-func (m *Manager) SyncState(ctx context.Context, nodes []servers.Server, endpoints []*endpoint.Endpoint) error {
+//
+// If any node fails and rollback is enabled, the nodes that were written to are restored, on a
+// best-effort basis, to the landb-alias metadata they had before the sync.
+func (m *Manager) SyncState(ctx context.Context, nodes []IngressNode, endpoints []*endpoint.Endpoint) (err error) {
+	ctx, span := tracing.Start(ctx, "cern.SyncState", attribute.Int("nodes", len(nodes)), attribute.Int("endpoints", len(endpoints)))
+	defer func() { tracing.End(span, err) }()
+
 	// 1. Calculate desired state for each node.
 	// 2. Diff with current state.
 	// 3. Apply changes.
+	// Capture the previous state before any write, so it can be restored.
+	previous, desired := m.nodesMetadata(log.FromContext(ctx), nodes, endpoints)
 
-	// We process nodes in order (0, 1, 2...).
-	for i, node := range nodes {
-		desiredMetadata := GenerateMetadata(i, endpoints)
-		currentMetadata := node.Metadata
+	// Any write makes the cached listing stale, even if the sync fails halfway.
+	defer m.cache.invalidate()
 
-		toUpdate, toDelete := DiffMetadata(currentMetadata, desiredMetadata)
+	// Servers that are no longer ingress nodes must not keep serving the aliases.
+	m.cleanupDeparted(ctx)
+	m.scanOrphans(ctx, nodes)
+
+	touched, errs := m.applyNodesMetadata(ctx, nodes, previous, desired)
+	err = errors.Join(errs...)
+	if err == nil {
+		m.sweepNodes(ctx, nodes, touched, previous, desired)
+		return nil
+	}
+
+	syncErr := &SyncError{Err: err}
+	var toRestore []int
+	for i, node := range nodes {
+		if errs[i] != nil {
+			syncErr.Failed = append(syncErr.Failed, node.Name)
+		}
+		if touched[i] {
+			toRestore = append(toRestore, i)
+		}
+	}
 
-		if len(toUpdate) > 0 || len(toDelete) > 0 {
-			if err := m.UpdateNodeMetadata(ctx, node.ID, toUpdate, toDelete); err != nil {
-				return err // Return on first error? Or try best effort? "Atomic as possible".
-				// If we fail halfway, we might leave inconsistent state.
-				// But we can't rollback easily.
-				// Returning error will likely cause ExternalDNS to retry.
+	if !m.rollback {
+		// Nodes that were successfully updated now disagree with the ones that failed.
+		for _, i := range toRestore {
+			if errs[i] == nil {
+				syncErr.Inconsistent = append(syncErr.Inconsistent, nodes[i].Name)
 			}
 		}
+		return syncErr
 	}
 
-	return nil
+	// Best-effort rollback: restore the previous metadata of every node that was written to.
+	// The rollback uses a fresh context since the request context may be the reason of the failure.
+	log.FromContext(ctx).Warn("Sync failed, rolling back %d nodes: %v", len(toRestore), err)
+	rollbackNodes := make([]IngressNode, len(toRestore))
+	rollbackCurrent := make([]map[string]string, len(toRestore))
+	rollbackDesired := make([]map[string]string, len(toRestore))
+	for j, i := range toRestore {
+		rollbackNodes[j] = nodes[i]
+		rollbackCurrent[j] = desired[i]
+		rollbackDesired[j] = previous[i]
+	}
+
+	_, rollbackErrs := m.applyNodesMetadata(context.WithoutCancel(ctx), rollbackNodes, rollbackCurrent, rollbackDesired)
+	for j, node := range rollbackNodes {
+		if rollbackErrs[j] != nil {
+			log.FromContext(ctx).Error("Failed to roll back metadata of server %s: %v", node.Name, rollbackErrs[j])
+			syncErr.Inconsistent = append(syncErr.Inconsistent, node.Name)
+		} else {
+			syncErr.RolledBack = append(syncErr.RolledBack, node.Name)
+		}
+	}
+
+	return syncErr
+}
+
+// Plan returns the metadata changes SyncState would make to the ingress nodes, without applying them.
+func (m *Manager) Plan(nodes []IngressNode, endpoints []*endpoint.Endpoint) []NodePlan {
+	current, desired := m.nodesMetadata(m.logger, nodes, endpoints)
+	return planNodesMetadata(nodes, current, desired)
+}
+
+// State returns the current and desired managed metadata of every ingress node, with the changes
+// SyncState would make to them.
+func (m *Manager) State(nodes []IngressNode, endpoints []*endpoint.Endpoint) []NodeState {
+	current, desired := m.nodesMetadata(m.logger, nodes, endpoints)
+	return nodesState(nodes, current, desired)
+}
+
+// nodesMetadata returns the current and desired managed metadata of every node, aligned with nodes.
+// The skipped endpoints are logged to logger.
+func (m *Manager) nodesMetadata(logger log.Logger, nodes []IngressNode, endpoints []*endpoint.Endpoint) ([]map[string]string, []map[string]string) {
+	aliases := GenerateNodesAliases(logger, nodes, endpoints, m.ownerID)
+
+	// The foreign aliases of every node are kept along with the generated ones. The nodes marked by
+	// another webhook instance are left to it, unless they get aliases of this one.
+	current := make([]map[string]string, len(nodes))
+	desired := make([]map[string]string, len(nodes))
+	for i, node := range nodes {
+		current[i] = managedMetadata(node.Metadata)
+		if len(aliases[i]) == 0 && ownedByOther(node.Metadata, m.ownerID) {
+			desired[i] = current[i]
+			continue
+		}
+		desired[i] = ownedMetadata(aliases[i], foreignAliases(node.Metadata, m.ownerID), m.ownerID)
+	}
+	return current, desired
+}
+
+// sweepNodes garbage-collects the stale `landb-alias*` keys of the nodes whose alias set shrank.
+//
+// The diff is computed against the server listing, which may be stale, so the keys beyond the
+// number currently needed are checked against a fresh read of the metadata. Failures are logged
+// and never fail the sync.
+func (m *Manager) sweepNodes(ctx context.Context, nodes []IngressNode, touched []bool, previous, desired []map[string]string) {
+	for i, node := range nodes {
+		needed := len(aliasMetadata(desired[i]))
+		if !touched[i] || node.Interface != "" || needed >= len(aliasMetadata(previous[i])) {
+			continue
+		}
+		if err := m.sweepAliasKeys(ctx, node, needed); err != nil {
+			log.FromContext(ctx).Warn("Failed to garbage-collect alias keys of server %s: %v", node.Name, err)
+		}
+	}
+}
+
+// sweepAliasKeys deletes the `landb-alias*` keys of a node beyond the number currently needed.
+func (m *Manager) sweepAliasKeys(ctx context.Context, node IngressNode, needed int) error {
+	metadata, err := m.getNodeMetadata(ctx, node.ID)
+	if err != nil {
+		return err
+	}
+
+	stale := staleAliasKeys(metadata, needed)
+	if len(stale) == 0 {
+		return nil
+	}
+	log.FromContext(ctx).Warn("Garbage-collecting stale alias keys %v of server %s", stale, node.Name)
+	return m.UpdateNodeMetadata(ctx, node.ID, nil, stale)
+}
+
+// applyNodesMetadata brings every node from its current to its desired metadata.
+//
+// Nodes are updated concurrently by a bounded pool of workers, since slow Nova responses
+// would otherwise make a sync over many ingress nodes take minutes.
+// Every node is attempted even if another one fails. The returned slices are aligned with
+// nodes and report whether a write was attempted on each node, and its error.
+//
+// Large diffs are committed atomically by replacing the whole metadata of the node, see
+// replaceNodeAliases. Every write is then read back to catch writes silently dropped by Nova.
+//
+// The diff and write of every node are traced in a span of their own.
+func (m *Manager) applyNodesMetadata(ctx context.Context, nodes []IngressNode, current, desired []map[string]string) ([]bool, []error) {
+	touched := make([]bool, len(nodes))
+	errs := make([]error, len(nodes))
+	sem := make(chan struct{}, max(m.concurrency, 1))
+	var wg sync.WaitGroup
+
+	for i, node := range nodes {
+		nodeCtx, span := tracing.Start(ctx, "cern.SyncNode", attribute.String("server.id", node.ID), attribute.String("server.name", node.Name))
+		toUpdate, toDelete := DiffMetadata(current[i], desired[i])
+		span.SetAttributes(attribute.Int("metadata.updated", len(toUpdate)), attribute.Int("metadata.deleted", len(toDelete)))
+		if len(toUpdate) == 0 && len(toDelete) == 0 {
+			span.End()
+			continue
+		}
+
+		touched[i] = true
+		wg.Add(1)
+		sem <- struct{}{}
+		replace := m.shouldReplace(toUpdate, toDelete)
+		span.SetAttributes(attribute.Bool("metadata.replaced", replace))
+		go func(ctx context.Context, i int, node IngressNode) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			start := time.Now()
+			defer func() {
+				metrics.ObserveDuration(metrics.NodeUpdateDuration, metrics.Outcome(errs[i]), start)
+				tracing.End(span, errs[i])
+			}()
+			if node.Interface != "" {
+				errs[i] = m.landb.syncAliases(ctx, node.Interface, unpackAliases(current[i]), unpackAliases(desired[i]))
+				return
+			}
+			if replace {
+				errs[i] = m.replaceNodeAliases(ctx, node, desired[i], toUpdate, toDelete)
+			} else {
+				errs[i] = m.UpdateNodeMetadata(ctx, node.ID, toUpdate, toDelete)
+			}
+			if errs[i] == nil && m.verifyAttempts > 0 {
+				errs[i] = m.verifyNodeMetadata(ctx, node, desired[i])
+			}
+		}(nodeCtx, i, node)
+	}
+	wg.Wait()
+
+	return touched, errs
+}
+
+// replaceNodeAliases replaces the whole metadata of a node with the desired aliases. Nova drops
+// every key missing from the replacement, so the keys that are not `landb-alias*` are read again
+// right before rather than taken from the node listing, which misses the keys written since.
+// Failing to read them, the diff is applied key by key instead.
+func (m *Manager) replaceNodeAliases(ctx context.Context, node IngressNode, desired, toUpdate map[string]string, toDelete []string) error {
+	metadata, err := m.getNodeMetadata(ctx, node.ID)
+	if err != nil {
+		log.FromContext(ctx).Warn("Updating the metadata of server %s key by key: %v", node.Name, err)
+		return m.UpdateNodeMetadata(ctx, node.ID, toUpdate, toDelete)
+	}
+	return m.ReplaceNodeMetadata(ctx, node.ID, replaceAliasMetadata(metadata, desired))
 }
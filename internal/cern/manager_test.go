@@ -0,0 +1,465 @@
+package cern
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gophercloud/gophercloud/v2"
+	"github.com/gophercloud/gophercloud/v2/openstack/compute/v2/servers"
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/log"
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/metrics"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+func TestManagerTrackManaged(t *testing.T) {
+	m := &Manager{managed: make(map[string]struct{}), departed: make(map[string]IngressNode), logger: log.NewNopLogger()}
+
+	a := servers.Server{ID: "a", Name: "node-a", Metadata: map[string]string{"landb-alias": "foo.cern.ch--load-0-"}}
+	b := servers.Server{ID: "b", Name: "node-b", Metadata: map[string]string{"landb-alias": "foo.cern.ch--load-1-"}}
+	other := servers.Server{ID: "c", Name: "other", Metadata: map[string]string{"landb-alias": "manual--load-0-"}}
+	all := []servers.Server{a, b, other}
+
+	m.trackManaged(newServerIndex(all), []IngressNode{{Server: a}, {Server: b}})
+	if len(m.departed) != 0 {
+		t.Fatalf("expected no departed servers, got %v", m.departed)
+	}
+
+	// b leaves the ingress set while still carrying aliases.
+	m.trackManaged(newServerIndex(all), []IngressNode{{Server: a}})
+	if _, ok := m.departed["b"]; !ok || len(m.departed) != 1 {
+		t.Errorf("expected only b to be departed, got %v", m.departed)
+	}
+
+	// b comes back before it was cleaned up.
+	m.trackManaged(newServerIndex(all), []IngressNode{{Server: a}, {Server: b}})
+	if len(m.departed) != 0 {
+		t.Errorf("expected no departed servers after b returned, got %v", m.departed)
+	}
+
+	// b leaves again but its aliases are already gone.
+	b.Metadata = map[string]string{}
+	m.trackManaged(newServerIndex([]servers.Server{a, b, other}), []IngressNode{{Server: a}})
+	if len(m.departed) != 0 {
+		t.Errorf("expected no departed servers without aliases, got %v", m.departed)
+	}
+	if _, ok := m.managed["b"]; ok {
+		t.Errorf("expected b to no longer be managed")
+	}
+}
+
+// TestManagerCleanupDeparted checks that the cleanup of a server that left the ingress set removes
+// the aliases of the webhook only, and leaves alone the servers carrying foreign aliases only.
+func TestManagerCleanupDeparted(t *testing.T) {
+	departed := map[string]string{
+		"landb-alias":       "app.cern.ch--load-1-,manual.cern.ch",
+		ownedMetadataPrefix: ownershipMarkers("default", "app.cern.ch--load-1-"),
+		OwnerMetadataKey:    "default",
+		"other":             "x",
+	}
+	foreignOnly := map[string]string{
+		"landb-alias":       "manual.cern.ch",
+		ownedMetadataPrefix: noOwnedAliases,
+		OwnerMetadataKey:    "default",
+	}
+	otherOwner := map[string]string{
+		"landb-alias":       "app.cern.ch--load-0-",
+		ownedMetadataPrefix: ownershipMarkers("cluster-b", "app.cern.ch--load-0-"),
+		OwnerMetadataKey:    "cluster-b",
+	}
+	compute := &memoryCompute{metadata: map[string]map[string]string{
+		"a": {}, "departed": maps.Clone(departed), "foreign-only": maps.Clone(foreignOnly), "other-owner": maps.Clone(otherOwner),
+	}}
+	m := newComputeManager(compute, 1)
+
+	list, err := compute.ListServers(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	index := newServerIndex(list)
+	nodes := func(ids ...string) []IngressNode {
+		var nodes []IngressNode
+		for _, id := range ids {
+			server, _ := index.server(id)
+			nodes = append(nodes, IngressNode{Server: *server})
+		}
+		return nodes
+	}
+	m.trackManaged(index, nodes("a", "departed", "foreign-only", "other-owner"))
+	m.trackManaged(index, nodes("a"))
+	if _, ok := m.departed["departed"]; !ok || len(m.departed) != 1 {
+		t.Fatalf("departed = %v, want only the server carrying aliases of the webhook", m.departed)
+	}
+
+	m.cleanupDeparted(context.Background())
+	want := map[string]string{
+		"landb-alias":       "manual.cern.ch",
+		ownedMetadataPrefix: noOwnedAliases,
+		OwnerMetadataKey:    "default",
+		"other":             "x",
+	}
+	if got := compute.metadata["departed"]; !maps.Equal(got, want) {
+		t.Errorf("metadata of the departed server = %v, want %v", got, want)
+	}
+	if len(m.departed) != 0 {
+		t.Errorf("departed = %v after the cleanup, want none", m.departed)
+	}
+	if got := compute.metadata["foreign-only"]; !maps.Equal(got, foreignOnly) {
+		t.Errorf("metadata of the server carrying foreign aliases only = %v, want it unchanged", got)
+	}
+	if got := compute.metadata["other-owner"]; !maps.Equal(got, otherOwner) {
+		t.Errorf("metadata of the server of another owner = %v, want it unchanged", got)
+	}
+}
+
+func TestManagerSyncStateRollback(t *testing.T) {
+	rejected := gophercloud.ErrUnexpectedResponseCode{Actual: http.StatusBadRequest}
+	desired := []*endpoint.Endpoint{endpoint.NewEndpoint("app.cern.ch", endpoint.RecordTypeA, "10.0.0.1")}
+	initial := map[string]map[string]string{
+		"a": {"other": "x", "landb-alias": "old.cern.ch--load-0-"},
+		"b": {"landb-alias": "old.cern.ch--load-1-"},
+		"c": {},
+	}
+
+	tests := []struct {
+		name             string
+		failures         map[string][]error
+		wantFailed       []string
+		wantRolled       []string
+		wantInconsistent []string
+	}{
+		{
+			name:       "Updated nodes are restored",
+			failures:   map[string][]error{"b": {rejected}},
+			wantFailed: []string{"b"},
+			wantRolled: []string{"a", "b", "c"},
+		},
+		{
+			name:             "Failed rollback leaves the node inconsistent",
+			failures:         map[string][]error{"a": {nil, rejected}, "b": {rejected}},
+			wantFailed:       []string{"b"},
+			wantRolled:       []string{"b", "c"},
+			wantInconsistent: []string{"a"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			compute := &memoryCompute{metadata: make(map[string]map[string]string), failures: tt.failures}
+			var nodes []IngressNode
+			for _, id := range []string{"a", "b", "c"} {
+				compute.metadata[id] = maps.Clone(initial[id])
+				nodes = append(nodes, IngressNode{Server: servers.Server{ID: id, Name: id, Metadata: maps.Clone(initial[id])}})
+			}
+			m := newComputeManager(compute, 1)
+
+			err := m.SyncState(context.Background(), nodes, desired)
+			var syncErr *SyncError
+			if !errors.As(err, &syncErr) {
+				t.Fatalf("SyncState() error = %v, want a *SyncError", err)
+			}
+			if !slices.Equal(syncErr.Failed, tt.wantFailed) || !slices.Equal(syncErr.RolledBack, tt.wantRolled) || !slices.Equal(syncErr.Inconsistent, tt.wantInconsistent) {
+				t.Errorf("SyncError = %+v, want failed %v, rolled back %v and inconsistent %v", syncErr, tt.wantFailed, tt.wantRolled, tt.wantInconsistent)
+			}
+			for id, metadata := range compute.metadata {
+				restored := maps.Equal(metadata, initial[id])
+				if want := !slices.Contains(tt.wantInconsistent, id); restored != want {
+					t.Errorf("metadata of %s = %v, restored %v, want %v", id, metadata, restored, want)
+				}
+			}
+		})
+	}
+}
+
+// slowCompute is a memoryCompute whose writes take a while, recording how many run at once.
+type slowCompute struct {
+	*memoryCompute
+	running, peak atomic.Int32
+}
+
+func (c *slowCompute) UpdateMetadata(ctx context.Context, serverID string, metadata map[string]string) error {
+	running := c.running.Add(1)
+	defer c.running.Add(-1)
+	for {
+		peak := c.peak.Load()
+		if running <= peak || c.peak.CompareAndSwap(peak, running) {
+			break
+		}
+	}
+	time.Sleep(20 * time.Millisecond)
+	return c.memoryCompute.UpdateMetadata(ctx, serverID, metadata)
+}
+
+func TestManagerApplyNodesMetadataConcurrency(t *testing.T) {
+	rejected := gophercloud.ErrUnexpectedResponseCode{Actual: http.StatusBadRequest}
+
+	tests := []struct {
+		name        string
+		concurrency int
+		failing     []string
+	}{
+		{name: "Sequential", concurrency: 1, failing: []string{"n1"}},
+		{name: "Bounded pool", concurrency: 3, failing: []string{"n0", "n4", "n7"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			compute := &slowCompute{memoryCompute: &memoryCompute{metadata: make(map[string]map[string]string), failures: make(map[string][]error)}}
+			for _, id := range tt.failing {
+				compute.failures[id] = []error{rejected}
+			}
+			m := newComputeManager(compute, 1)
+			m.concurrency = tt.concurrency
+
+			var nodes []IngressNode
+			var current, desired []map[string]string
+			for i := range 8 {
+				id := fmt.Sprintf("n%d", i)
+				compute.metadata[id] = map[string]string{}
+				nodes = append(nodes, IngressNode{Server: servers.Server{ID: id, Name: id}})
+				current = append(current, map[string]string{})
+				desired = append(desired, map[string]string{"landb-alias": "app.cern.ch--load-0-"})
+			}
+
+			touched, errs := m.applyNodesMetadata(context.Background(), nodes, current, desired)
+			if peak := compute.peak.Load(); peak != int32(tt.concurrency) {
+				t.Errorf("%d nodes updated at once, want %d", peak, tt.concurrency)
+			}
+			for i, node := range nodes {
+				if !touched[i] {
+					t.Errorf("node %s not touched", node.Name)
+				}
+				if failed := slices.Contains(tt.failing, node.Name); (errs[i] != nil) != failed {
+					t.Errorf("error of node %s = %v, want failed %v", node.Name, errs[i], failed)
+				}
+				if !slices.Contains(tt.failing, node.Name) && compute.metadata[node.ID]["landb-alias"] == "" {
+					t.Errorf("node %s not updated after the failures of the others", node.Name)
+				}
+			}
+		})
+	}
+}
+
+// countingCompute is a memoryCompute counting the listings of the servers.
+type countingCompute struct {
+	*memoryCompute
+	listings atomic.Int32
+}
+
+func (c *countingCompute) ListServers(ctx context.Context) ([]servers.Server, error) {
+	c.listings.Add(1)
+	return c.memoryCompute.ListServers(ctx)
+}
+
+func TestManagerListServersCache(t *testing.T) {
+	tests := []struct {
+		name         string
+		ttl          time.Duration
+		between      func(m *Manager)
+		wantListings int32
+	}{
+		{name: "Cached listing is reused", ttl: time.Minute, between: func(*Manager) {}, wantListings: 1},
+		{name: "Zero TTL disables the cache", between: func(*Manager) {}, wantListings: 2},
+		{
+			name: "Expired listing is listed again",
+			ttl:  time.Minute,
+			between: func(m *Manager) {
+				m.cache.expires = time.Now().Add(-time.Second)
+			},
+			wantListings: 2,
+		},
+		{name: "Invalidated listing is listed again", ttl: time.Minute, between: (*Manager).InvalidateCache, wantListings: 2},
+		{
+			name: "Sync invalidates the listing",
+			ttl:  time.Minute,
+			between: func(m *Manager) {
+				_ = m.SyncState(context.Background(), nil, nil)
+			},
+			wantListings: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			compute := &countingCompute{memoryCompute: &memoryCompute{metadata: map[string]map[string]string{"a": {}}}}
+			m := newComputeManager(compute, 1)
+			m.cache.ttl = tt.ttl
+
+			for i := range 2 {
+				if i > 0 {
+					tt.between(m)
+				}
+				index, err := m.listServers(context.Background())
+				if err != nil {
+					t.Fatalf("listServers() error = %v", err)
+				}
+				if _, ok := index.server("a"); !ok {
+					t.Errorf("listServers() = %v, want server a", index.servers)
+				}
+			}
+			if got := compute.listings.Load(); got != tt.wantListings {
+				t.Errorf("servers listed %d times, want %d", got, tt.wantListings)
+			}
+		})
+	}
+}
+
+func TestManagerMatchServers(t *testing.T) {
+	m := &Manager{statuses: serverStatuses(nil), logger: log.NewNopLogger()}
+	index := newServerIndex([]servers.Server{
+		{ID: "by-id", Name: "renamed", Status: "ACTIVE"},
+		{ID: "shelved", Name: "shelved", Status: "SHELVED_OFFLOADED"},
+		{ID: "by-name-1", Name: "shared", Status: "ACTIVE"},
+		{ID: "by-name-2", Name: "shared", Status: "ACTIVE"},
+		{ID: "claimed", Name: "claimed", Status: "ACTIVE"},
+		{ID: "unrelated", Name: "unrelated", Status: "ACTIVE"},
+	})
+	node := func(name, serverID string) corev1.Node {
+		node := corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: name}}
+		if serverID != "" {
+			node.Spec.ProviderID = "openstack:///" + serverID
+		}
+		return node
+	}
+
+	got := m.matchServers(context.Background(), index, []corev1.Node{
+		node("node-a", "by-id"),
+		node("node-b", "shelved"),
+		node("node-c", "missing"),
+		node("shared", ""),
+		node("node-d", "claimed"),
+		node("claimed", ""),
+	})
+
+	var ids []string
+	for _, node := range got {
+		ids = append(ids, node.ID)
+	}
+	slices.Sort(ids)
+	want := []string{"by-id", "by-name-1", "by-name-2", "claimed"}
+	if !slices.Equal(ids, want) {
+		t.Errorf("matchServers() = %v, want %v", ids, want)
+	}
+}
+
+// benchmarkProject returns the servers of a project of the given size, and the Kubernetes nodes
+// backed by every tenth of them, half matched by UUID and half by name.
+func benchmarkProject(size int) ([]servers.Server, []corev1.Node) {
+	list := make([]servers.Server, size)
+	var nodes []corev1.Node
+	for i := range list {
+		list[i] = servers.Server{
+			ID:       fmt.Sprintf("00000000-0000-0000-0000-%012d", i),
+			Name:     fmt.Sprintf("server-%d", i),
+			Status:   "ACTIVE",
+			Metadata: map[string]string{"landb-alias": fmt.Sprintf("app-%d.cern.ch--load-0-", i)},
+		}
+		switch i % 20 {
+		case 0:
+			nodes = append(nodes, corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: list[i].Name}, Spec: corev1.NodeSpec{ProviderID: "openstack:///" + list[i].ID}})
+		case 10:
+			nodes = append(nodes, corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: list[i].Name}})
+		}
+	}
+	return list, nodes
+}
+
+// BenchmarkManagerMatchServers measures matching the ingress nodes against a cached listing of a
+// 5000 server project, as done on every Records and ApplyChanges call.
+func BenchmarkManagerMatchServers(b *testing.B) {
+	m := &Manager{statuses: serverStatuses(nil), logger: log.NewNopLogger(), managed: make(map[string]struct{}), departed: make(map[string]IngressNode)}
+	list, nodes := benchmarkProject(5000)
+	index := newServerIndex(list)
+	ctx := context.Background()
+
+	b.ReportAllocs()
+	for b.Loop() {
+		matching := m.matchServers(ctx, index, nodes)
+		m.trackManaged(index, matching)
+	}
+}
+
+// BenchmarkServerIndex measures indexing the listing of a 5000 server project, as done once per
+// listing.
+func BenchmarkServerIndex(b *testing.B) {
+	list, _ := benchmarkProject(5000)
+
+	b.ReportAllocs()
+	for b.Loop() {
+		newServerIndex(list)
+	}
+}
+
+func TestManagerShouldReplace(t *testing.T) {
+	tests := []struct {
+		name      string
+		threshold int
+		toUpdate  map[string]string
+		toDelete  []string
+		expected  bool
+	}{
+		{name: "Disabled", threshold: 0, toUpdate: map[string]string{"landb-alias": "a"}, toDelete: []string{"landb-alias2", "landb-alias3"}, expected: false},
+		{name: "Small diff", threshold: 3, toUpdate: map[string]string{"landb-alias": "a"}, toDelete: []string{"landb-alias2"}, expected: false},
+		{name: "Large diff", threshold: 3, toUpdate: map[string]string{"landb-alias": "a"}, toDelete: []string{"landb-alias2", "landb-alias3"}, expected: true},
+		{name: "Only deletions", threshold: 2, toDelete: []string{"landb-alias2", "landb-alias3"}, expected: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &Manager{replaceThreshold: tt.threshold}
+			if got := m.shouldReplace(tt.toUpdate, tt.toDelete); got != tt.expected {
+				t.Errorf("shouldReplace() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestServerStatuses(t *testing.T) {
+	statuses := serverStatuses([]string{"active", " REBOOT "})
+	for _, status := range []string{"ACTIVE", "REBOOT"} {
+		if _, ok := statuses[status]; !ok {
+			t.Errorf("expected status %s to be accepted", status)
+		}
+	}
+	if _, ok := statuses["SHELVED"]; ok {
+		t.Errorf("expected status SHELVED to be rejected")
+	}
+
+	if got := serverStatuses(nil); len(got) != len(DefaultServerStatuses) {
+		t.Errorf("serverStatuses(nil) = %v, want the default statuses", got)
+	}
+}
+
+func TestErrorSource(t *testing.T) {
+	unauthorized := gophercloud.ErrUnexpectedResponseCode{Actual: http.StatusUnauthorized}
+	unavailable := gophercloud.ErrUnexpectedResponseCode{Actual: http.StatusServiceUnavailable}
+
+	tests := []struct {
+		name      string
+		operation string
+		err       error
+		expected  string
+	}{
+		{name: "success", operation: OperationListServers, expected: ""},
+		{name: "expired token", operation: OperationUpdateMetadata, err: errors.Join(unauthorized, errors.New("failed to re-authenticate")), expected: metrics.ErrorSourceKeystoneAuth},
+		{name: "list outage", operation: OperationListServers, err: unavailable, expected: metrics.ErrorSourceNovaList},
+		{name: "metadata write", operation: OperationDeleteMetadatum, err: unavailable, expected: metrics.ErrorSourceNovaMetadata},
+		{name: "metadata read", operation: OperationGetMetadata, err: unavailable, expected: metrics.ErrorSourceNovaMetadata},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := errorSource(tt.operation, tt.err); got != tt.expected {
+				t.Errorf("errorSource(%s, %v) = %q, want %q", tt.operation, tt.err, got, tt.expected)
+			}
+		})
+	}
+}
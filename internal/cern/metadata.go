@@ -2,10 +2,12 @@ package cern
 
 import (
 	"fmt"
+	"slices"
 	"sort"
+	"strconv"
 	"strings"
 
-	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
+	"github.com/gophercloud/gophercloud/v2/openstack/compute/v2/servers"
 	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/log"
 	"sigs.k8s.io/external-dns/endpoint"
 )
@@ -21,38 +23,209 @@ func GenerateMetadata(nodeIndex int, endpoints []*endpoint.Endpoint) map[string]
 	for _, ep := range endpoints {
 		// Only A records are supported for now based on the description
 		if ep.RecordType == endpoint.RecordTypeA {
-			// Format: <alias>--load-<index>-
-			// Note: The prompt implies the alias is the DNS name.
-			// Remove trailing dot if present
-			dnsName := strings.TrimSuffix(ep.DNSName, ".")
-			alias := fmt.Sprintf("%s--load-%d-", dnsName, nodeIndex)
-			aliases = append(aliases, alias)
+			aliases = append(aliases, formatAlias(ep.DNSName, nodeIndex))
 		}
 	}
 
-	// Sort aliases to ensure deterministic output
-	sort.Strings(aliases)
+	return packAliases(aliases)
+}
+
+// GenerateNodesMetadata calculates the required OpenStack metadata for every ingress node.
+//
+// Each endpoint is assigned to the nodes matching its node selector property (all nodes when
+// the property is absent). See GenerateNodesAliases for how load indexes are assigned.
+// The returned slice is aligned with nodes. The skipped endpoints are logged to logger.
+func GenerateNodesMetadata(logger log.Logger, nodes []IngressNode, endpoints []*endpoint.Endpoint, ownerID string) []map[string]string {
+	aliases := GenerateNodesAliases(logger, nodes, endpoints, ownerID)
+
+	metadata := make([]map[string]string, len(nodes))
+	for i := range nodes {
+		metadata[i] = packAliases(aliases[i])
+	}
+	return metadata
+}
+
+// GenerateNodesAliases calculates the aliases every ingress node should carry, before they are packed
+// into metadata keys. The returned slice is aligned with nodes. The skipped endpoints are logged to
+// logger.
+//
+// The load index assignment is persisted in the aliases themselves: a node that already carries an
+// alias for an endpoint keeps its index, so adding or removing a node only changes the aliases of
+// that node. Nodes new to an endpoint get the lowest indexes not in use by the other nodes. Only the
+// aliases managed by the webhook instance with the given owner ID are considered, the foreign ones
+// being left to their owners.
+//
+// The buffers used to assign every endpoint are reused from one endpoint to the next, so the memory
+// used beyond the returned aliases is the index of the current aliases, whatever the number of
+// endpoints.
+func GenerateNodesAliases(logger log.Logger, nodes []IngressNode, endpoints []*endpoint.Endpoint, ownerID string) [][]string {
+	// Index the current load index of every node for every DNS name.
+	current := make([]map[string]int, len(nodes))
+	for i, node := range nodes {
+		current[i] = make(map[string]int, countAliases(node.Metadata))
+		eachManagedAlias(node.Metadata, ownerID, func(alias string) {
+			domain, loadIndex, ok := parseAlias(alias)
+			if !ok {
+				return
+			}
+			if existing, ok := current[i][domain]; !ok || loadIndex < existing {
+				current[i][domain] = loadIndex
+			}
+		})
+	}
+
+	aliases := make([][]string, len(nodes))
+	for i := range aliases {
+		// Most nodes keep about as many aliases as they carry.
+		aliases[i] = make([]string, 0, len(current[i]))
+	}
+	// load counts the aliases assigned to every node so far, to balance the node-count limited aliases.
+	load := make([]int, len(nodes))
+	var buffers loadIndexBuffers
+	for _, ep := range endpoints {
+		// Only A records are supported for now based on the description
+		if ep.RecordType != endpoint.RecordTypeA {
+			continue
+		}
+
+		if err := ValidateAlias(ep.DNSName); err != nil {
+			logger.Error("Skipping endpoint %s: %v", ep.DNSName, err)
+			continue
+		}
+
+		members, err := selectNodes(buffers.members[:0], nodes, ep)
+		buffers.members = members
+		if err != nil {
+			logger.Warn("Skipping endpoint %s: %v", ep.DNSName, err)
+			continue
+		}
+		if len(members) == 0 {
+			logger.Warn("No ingress node matches the node selector of endpoint %s", ep.DNSName)
+			continue
+		}
+
+		domain := strings.TrimSuffix(ep.DNSName, ".")
+		count, err := nodeCount(ep)
+		if err != nil {
+			logger.Warn("Skipping endpoint %s: %v", ep.DNSName, err)
+			continue
+		}
+		if count > 0 {
+			members = spreadNodes(nodes, members, count, current, load, domain)
+		}
+
+		for i, loadIndex := range buffers.assign(members, current, domain) {
+			nodeIndex := members[i]
+			aliases[nodeIndex] = append(aliases[nodeIndex], formatAlias(domain, loadIndex))
+			load[nodeIndex]++
+		}
+	}
+	return aliases
+}
+
+// loadIndexBuffers holds the buffers of the load index assignment of an endpoint, reused for the
+// next endpoints.
+type loadIndexBuffers struct {
+	members    []int
+	assigned   []int
+	unassigned []int
+	used       map[int]struct{}
+}
+
+// assign returns the load index of every member node for a DNS name, aligned with members. The
+// returned slice is only valid until the next call.
+//
+// Members keep the index they currently carry unless another member already claimed it, and the
+// remaining members get the lowest free indexes in node order.
+func (b *loadIndexBuffers) assign(members []int, current []map[string]int, domain string) []int {
+	if b.used == nil {
+		b.used = make(map[int]struct{}, len(members))
+	}
+	clear(b.used)
+	b.assigned = slices.Grow(b.assigned[:0], len(members))[:len(members)]
+	b.unassigned = b.unassigned[:0]
+
+	for i, nodeIndex := range members {
+		loadIndex, ok := current[nodeIndex][domain]
+		if _, taken := b.used[loadIndex]; !ok || taken {
+			b.unassigned = append(b.unassigned, i)
+			continue
+		}
+		b.assigned[i] = loadIndex
+		b.used[loadIndex] = struct{}{}
+	}
+
+	next := 0
+	for _, i := range b.unassigned {
+		for {
+			if _, taken := b.used[next]; !taken {
+				break
+			}
+			next++
+		}
+		b.assigned[i] = next
+		b.used[next] = struct{}{}
+	}
+	return b.assigned
+}
+
+// formatAlias builds the LanDB alias for a DNS name at a given load index.
+// Format: <alias>--load-<index>-
+func formatAlias(dnsName string, loadIndex int) string {
+	// Remove trailing dot if present
+	dnsName = strings.TrimSuffix(dnsName, ".")
+	return dnsName + "--load-" + strconv.Itoa(loadIndex) + "-"
+}
+
+// parseAlias splits a LanDB alias in the `<alias>--load-<index>-` format into its DNS name and load index.
+func parseAlias(alias string) (string, int, bool) {
+	idx := strings.LastIndex(alias, "--load-")
+	if idx == -1 {
+		return "", 0, false
+	}
+	loadIndex, err := strconv.Atoi(strings.TrimSuffix(alias[idx+len("--load-"):], "-"))
+	if err != nil || loadIndex < 0 {
+		return "", 0, false
+	}
+	return alias[:idx], loadIndex, true
+}
 
-	// Distribute aliases into keys: landb-alias, landb-alias2, landb-alias3...
+// packAliases distributes aliases into metadata keys without exceeding the maximum value length.
+// Endpoints that only differ by set identifier map to the same alias, which is kept once.
+func packAliases(aliases []string) map[string]string {
+	return packValues(landbAliasPrefix, aliases)
+}
+
+// packValues distributes comma-separated values into the metadata keys with the given prefix,
+// without exceeding the maximum value length.
+func packValues(prefix string, values []string) map[string]string {
+	// Deduplicate and sort values to ensure deterministic output.
+	unique := slices.Clone(values)
+	slices.Sort(unique)
+	unique = slices.Compact(unique)
+
+	// Distribute values into keys, e.g. landb-alias, landb-alias2, landb-alias3...
 	metadata := make(map[string]string)
 	currentKeyIndex := 1
 	var currentBuilder strings.Builder
+	currentBuilder.Grow(maxMetadataLength)
 	first := true
 
-	for _, alias := range aliases {
-		// Calculate potential length: current + comma (if not first) + alias
-		potentialLen := currentBuilder.Len() + len(alias)
+	for _, value := range unique {
+		// Calculate potential length: current + comma (if not first) + value
+		potentialLen := currentBuilder.Len() + len(value)
 		if !first {
 			potentialLen++ // for comma
 		}
 
 		if potentialLen > maxMetadataLength {
 			// Flush current builder
-			key := getMetadataKey(currentKeyIndex)
+			key := metadataKey(prefix, currentKeyIndex)
 			metadata[key] = currentBuilder.String()
 
 			// Reset builder and increment key index
 			currentBuilder.Reset()
+			currentBuilder.Grow(maxMetadataLength)
 			currentKeyIndex++
 			first = true
 		}
@@ -60,13 +233,13 @@ func GenerateMetadata(nodeIndex int, endpoints []*endpoint.Endpoint) map[string]
 		if !first {
 			currentBuilder.WriteString(",")
 		}
-		currentBuilder.WriteString(alias)
+		currentBuilder.WriteString(value)
 		first = false
 	}
 
 	// Flush remaining
 	if currentBuilder.Len() > 0 {
-		key := getMetadataKey(currentKeyIndex)
+		key := metadataKey(prefix, currentKeyIndex)
 		metadata[key] = currentBuilder.String()
 	}
 
@@ -74,15 +247,115 @@ func GenerateMetadata(nodeIndex int, endpoints []*endpoint.Endpoint) map[string]
 }
 
 func getMetadataKey(index int) string {
+	return metadataKey(landbAliasPrefix, index)
+}
+
+// metadataKey returns the key with the given prefix and index: the prefix itself for 1, the prefix
+// followed by the index otherwise.
+func metadataKey(prefix string, index int) string {
 	if index == 1 {
-		return landbAliasPrefix
+		return prefix
+	}
+	return fmt.Sprintf("%s%d", prefix, index)
+}
+
+// aliasKeyIndex returns the index of a `landb-alias*` key: 1 for `landb-alias`, N for `landb-aliasN`.
+func aliasKeyIndex(key string) (int, bool) {
+	if !strings.HasPrefix(key, landbAliasPrefix) {
+		return 0, false
+	}
+	suffix := strings.TrimPrefix(key, landbAliasPrefix)
+	if suffix == "" {
+		return 1, true
+	}
+	index, err := strconv.Atoi(suffix)
+	if err != nil || index < 2 || getMetadataKey(index) != key {
+		return 0, false
+	}
+	return index, true
+}
+
+// staleAliasKeys returns the sorted `landb-alias*` keys of a server's metadata beyond the first needed ones,
+// including the keys that do not follow the `landb-aliasN` naming.
+func staleAliasKeys(metadata map[string]string, needed int) []string {
+	var stale []string
+	for key := range metadata {
+		if !strings.HasPrefix(key, landbAliasPrefix) {
+			continue
+		}
+		if index, ok := aliasKeyIndex(key); !ok || index > needed {
+			stale = append(stale, key)
+		}
+	}
+	sort.Strings(stale)
+	return stale
+}
+
+// unpackAliases returns the aliases stored in the `landb-alias*` keys of a server's metadata.
+func unpackAliases(metadata map[string]string) []string {
+	aliases := make([]string, 0, countAliases(metadata))
+	eachAlias(metadata, func(alias string) {
+		aliases = append(aliases, alias)
+	})
+	return aliases
+}
+
+// eachAlias calls fn with every alias stored in the `landb-alias*` keys of a server's metadata,
+// without holding them in memory.
+func eachAlias(metadata map[string]string, fn func(alias string)) {
+	for key, value := range metadata {
+		if !strings.HasPrefix(key, landbAliasPrefix) {
+			continue
+		}
+		for alias := range strings.SplitSeq(value, ",") {
+			if alias = strings.TrimSpace(alias); alias != "" {
+				fn(alias)
+			}
+		}
+	}
+}
+
+// countAliases returns an upper bound of the number of aliases stored in the `landb-alias*` keys
+// of a server's metadata, to size the collections holding them.
+func countAliases(metadata map[string]string) int {
+	count := 0
+	for key, value := range metadata {
+		if strings.HasPrefix(key, landbAliasPrefix) {
+			count += strings.Count(value, ",") + 1
+		}
+	}
+	return count
+}
+
+// aliasMetadata returns a copy of the `landb-alias*` keys of a server's metadata.
+func aliasMetadata(metadata map[string]string) map[string]string {
+	aliases := make(map[string]string)
+	for k, v := range metadata {
+		if strings.HasPrefix(k, landbAliasPrefix) {
+			aliases[k] = v
+		}
 	}
-	return fmt.Sprintf("%s%d", landbAliasPrefix, index)
+	return aliases
+}
+
+// replaceAliasMetadata returns a copy of a server's metadata with its `landb-alias*` keys replaced by aliases.
+func replaceAliasMetadata(metadata, aliases map[string]string) map[string]string {
+	replaced := make(map[string]string, len(metadata)+len(aliases))
+	for k, v := range metadata {
+		if !strings.HasPrefix(k, landbAliasPrefix) {
+			replaced[k] = v
+		}
+	}
+	for k, v := range aliases {
+		replaced[k] = v
+	}
+	return replaced
 }
 
 // DiffMetadata compares the current metadata with the desired metadata.
 // It returns a map of updates (keys to set) and a slice of keys to delete.
-// Note: This logic assumes we own all `landb-alias*` keys.
+// Note: This logic assumes we own all `landb-alias*` keys and ownership markers. The foreign
+// aliases they carry are only kept if desired carries them too, see ownedMetadata.
 func DiffMetadata(current map[string]string, desired map[string]string) (map[string]string, []string) {
 	toUpdate := make(map[string]string)
 	toDelete := []string{}
@@ -94,9 +367,10 @@ func DiffMetadata(current map[string]string, desired map[string]string) (map[str
 		}
 	}
 
-	// Check for keys to delete (present in current but not in desired, and starts with landb-alias)
+	// Check for keys to delete (present in current but not in desired, and starts with landb-alias
+	// or holds ownership markers, e.g. when a rollback restores a server that was not marked)
 	for k := range current {
-		if strings.HasPrefix(k, landbAliasPrefix) {
+		if strings.HasPrefix(k, landbAliasPrefix) || strings.HasPrefix(k, ownedMetadataPrefix) || k == OwnerMetadataKey {
 			if _, ok := desired[k]; !ok {
 				toDelete = append(toDelete, k)
 			}
@@ -107,54 +381,125 @@ func DiffMetadata(current map[string]string, desired map[string]string) (map[str
 }
 
 // ParseEndpointsFromMetadata reconstructs endpoints from the `landb-alias` metadata of a set of servers.
+// Only the aliases managed by the webhook instance with the given owner ID are reconstructed, the
+// foreign ones being skipped.
 // This is primarily for the `Records()` call.
 // logic:
 // 1. Iterate all servers.
 // 2. Collect all alias strings.
 // 3. Extract the DNS name from `<dnsname>--load-<index>-`.
 // 4. Deduplicate.
-func ParseEndpointsFromMetadata(nodes []servers.Server) []*endpoint.Endpoint {
-	uniqueDomains := make(map[string]struct{})
+//
+// The endpoints are sorted by key, as DesiredEndpoints expects them.
+func ParseEndpointsFromMetadata(nodes []IngressNode, ownerID string) []*endpoint.Endpoint {
+	domains := parseDomainsFromMetadata(nodes, ownerID)
 
+	result := make([]*endpoint.Endpoint, 0, len(domains))
+	for domain, targets := range domains {
+		result = append(result, newAliasEndpoint(domain, targets))
+	}
+	slices.SortFunc(result, compareEndpoints)
+	return result
+}
+
+// EachEndpointFromMetadata calls fn for every endpoint reconstructed from the `landb-alias` metadata of a set of servers.
+// Unlike ParseEndpointsFromMetadata it never holds the full list of endpoints in memory, which allows callers
+// to stream very large record sets. Iteration stops at the first error returned by fn.
+func EachEndpointFromMetadata(nodes []IngressNode, ownerID string, fn func(*endpoint.Endpoint) error) error {
+	for domain, targets := range parseDomainsFromMetadata(nodes, ownerID) {
+		if err := fn(newAliasEndpoint(domain, targets)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ManagedRecord is an endpoint managed by the webhook, along with the nodes carrying its aliases.
+type ManagedRecord struct {
+	// Name is the DNS name of the endpoint.
+	Name string `json:"name"`
+	// Type is the record type of the endpoint.
+	Type string `json:"type"`
+	// Targets are the targets reported to ExternalDNS, i.e. the addresses of the nodes.
+	Targets []string `json:"targets"`
+	// Nodes are the names of the nodes carrying an alias of the endpoint, sorted.
+	Nodes []string `json:"nodes"`
+}
+
+// ManagedRecords returns the endpoints reconstructed from the `landb-alias` metadata of a set of servers, as
+// reported to ExternalDNS by the webhook instance with the given owner ID, with the nodes carrying them,
+// sorted by name.
+func ManagedRecords(nodes []IngressNode, ownerID string) []ManagedRecord {
+	owners := make(map[string][]string)
 	for _, node := range nodes {
-		for key, value := range node.Metadata {
-			if strings.HasPrefix(key, landbAliasPrefix) {
-				// Value is comma-separated aliases
-				aliases := strings.Split(value, ",")
-				for _, alias := range aliases {
-					alias = strings.TrimSpace(alias)
-					// Parse: foo.cern.ch--load-0-
-					// Find last occurrence of "--load-"
-					idx := strings.LastIndex(alias, "--load-")
-					if idx != -1 {
-						domain := alias[:idx]
-						uniqueDomains[domain] = struct{}{}
-					}
-				}
+		eachManagedAlias(node.Metadata, ownerID, func(alias string) {
+			if idx := strings.LastIndex(alias, "--load-"); idx != -1 {
+				owners[alias[:idx]] = append(owners[alias[:idx]], node.Name)
 			}
-		}
+		})
 	}
 
-	result := make([]*endpoint.Endpoint, 0, len(uniqueDomains))
-	for domain := range uniqueDomains {
-		// ExternalDNS expects endpoints.
-		// Since we don't strictly know the targets (IPs) just from metadata (the metadata *implies* the node IPs),
-		// we might construct Endpoints with dummy targets or try to infer them.
-		// However, for the `Records` call, ExternalDNS mainly cares about "what records do you think you have?".
-		// It uses this to calculate deletions.
-		// If we return a record "foo.cern.ch", ExternalDNS knows it exists.
-		// We set RecordType A.
-		ep := endpoint.NewEndpoint(domain, endpoint.RecordTypeA, "") // Target is implicit/not strictly needed for ownership check?
-		// Actually, ExternalDNS uses targets to check for updates.
-		// But in this provider, the "Target" is effectively the set of Node IPs.
-		// If we return empty targets, ExternalDNS might try to update it every time.
-		// Let's leave targets empty for now or put a placeholder.
-		// Ideally, we should list the IPs of the nodes that *should* be serving this.
-		// But that's expensive to compute here (which nodes have the metadata?).
-		// Let's assume just existence matters for now.
-		result = append(result, ep)
+	domains := parseDomainsFromMetadata(nodes, ownerID)
+	records := make([]ManagedRecord, 0, len(domains))
+	for domain, addresses := range domains {
+		ep := newAliasEndpoint(domain, addresses)
+		names := owners[domain]
+		sort.Strings(names)
+		records = append(records, ManagedRecord{Name: ep.DNSName, Type: ep.RecordType, Targets: ep.Targets, Nodes: slices.Compact(names)})
 	}
-	return result
+	sort.Slice(records, func(i, j int) bool { return records[i].Name < records[j].Name })
+	return records
+}
+
+// parseDomainsFromMetadata returns the deduplicated set of DNS names found in the `landb-alias` metadata of a set of servers,
+// each with the deduplicated addresses of the nodes carrying it.
+//
+// The addresses are kept in slices rather than sets: a name is carried by a handful of nodes, and a set per name
+// would dominate the memory used for large record sets.
+func parseDomainsFromMetadata(nodes []IngressNode, ownerID string) map[string][]string {
+	size := 0
+	for _, node := range nodes {
+		size = max(size, countAliases(node.Metadata))
+	}
+	uniqueDomains := make(map[string][]string, size)
+
+	for _, node := range nodes {
+		eachManagedAlias(node.Metadata, ownerID, func(alias string) {
+			// Parse: foo.cern.ch--load-0-
+			// Find last occurrence of "--load-"
+			idx := strings.LastIndex(alias, "--load-")
+			if idx == -1 {
+				return
+			}
+			domain := alias[:idx]
+			addresses, ok := uniqueDomains[domain]
+			if !ok && node.Address != "" {
+				// Names are usually carried by every node, sizing the addresses once.
+				addresses = make([]string, 0, len(nodes))
+			}
+			if node.Address != "" && !slices.Contains(addresses, node.Address) {
+				addresses = append(addresses, node.Address)
+			}
+			if !ok || node.Address != "" {
+				uniqueDomains[domain] = addresses
+			}
+		})
+	}
+
+	return uniqueDomains
+}
+
+// newAliasEndpoint builds the endpoint reported to ExternalDNS for a managed alias, targeting the
+// addresses of the nodes carrying it. The addresses are sorted in place and used as the targets.
+func newAliasEndpoint(domain string, addresses []string) *endpoint.Endpoint {
+	// ExternalDNS compares the targets of the current and desired endpoints to plan updates, so the
+	// node addresses are reported in the same form as the ingress status, which usually lists the
+	// node IPs. Without any known address a single empty target is kept, as the aliases still exist.
+	if len(addresses) == 0 {
+		return endpoint.NewEndpoint(domain, endpoint.RecordTypeA, "")
+	}
+	sort.Strings(addresses)
+	return endpoint.NewEndpoint(domain, endpoint.RecordTypeA, addresses...)
 }
 
 // FilterServers filters the list of servers based on the ingress label.
@@ -180,6 +525,3 @@ func FilterServers(allServers []servers.Server, labelKey string) []servers.Serve
 
 	return filtered
 }
-
-// Log is a helper to get the logger
-var Log = log.GlobalLogger
@@ -1,12 +1,14 @@
 package cern
 
 import (
+	"errors"
 	"fmt"
 	"reflect"
 	"sort"
 	"testing"
 
-	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
+	"github.com/gophercloud/gophercloud/v2/openstack/compute/v2/servers"
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/log"
 	"sigs.k8s.io/external-dns/endpoint"
 )
 
@@ -95,50 +97,50 @@ func TestGenerateMetadata(t *testing.T) {
 func TestParseEndpointsFromMetadata(t *testing.T) {
 	tests := []struct {
 		name     string
-		nodes    []servers.Server
+		nodes    []IngressNode
 		expected []string // Just check DNS names for simplicity
 	}{
 		{
 			name:     "No metadata",
-			nodes:    []servers.Server{{ID: "1"}},
+			nodes:    []IngressNode{{Server: servers.Server{ID: "1"}}},
 			expected: []string{},
 		},
 		{
 			name: "Single node single alias",
-			nodes: []servers.Server{
-				{
+			nodes: []IngressNode{
+				{Server: servers.Server{
 					Metadata: map[string]string{
 						"landb-alias": "foo.cern.ch--load-0-",
 					},
-				},
+				}},
 			},
 			expected: []string{"foo.cern.ch"},
 		},
 		{
 			name: "Multiple nodes same alias",
-			nodes: []servers.Server{
-				{
+			nodes: []IngressNode{
+				{Server: servers.Server{
 					Metadata: map[string]string{
 						"landb-alias": "foo.cern.ch--load-0-",
 					},
-				},
-				{
+				}},
+				{Server: servers.Server{
 					Metadata: map[string]string{
 						"landb-alias": "foo.cern.ch--load-1-",
 					},
-				},
+				}},
 			},
 			expected: []string{"foo.cern.ch"}, // Deduped
 		},
 		{
 			name: "Multiple keys",
-			nodes: []servers.Server{
-				{
+			nodes: []IngressNode{
+				{Server: servers.Server{
 					Metadata: map[string]string{
 						"landb-alias":  "foo.cern.ch--load-0-",
 						"landb-alias2": "bar.cern.ch--load-0-",
 					},
-				},
+				}},
 			},
 			expected: []string{"foo.cern.ch", "bar.cern.ch"},
 		},
@@ -146,7 +148,7 @@ func TestParseEndpointsFromMetadata(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := ParseEndpointsFromMetadata(tt.nodes)
+			got := ParseEndpointsFromMetadata(tt.nodes, "default")
 			gotNames := make(map[string]bool)
 			for _, ep := range got {
 				gotNames[ep.DNSName] = true
@@ -165,6 +167,86 @@ func TestParseEndpointsFromMetadata(t *testing.T) {
 	}
 }
 
+func TestEachEndpointFromMetadata(t *testing.T) {
+	nodes := []IngressNode{
+		{Server: servers.Server{Metadata: map[string]string{"landb-alias": "foo.cern.ch--load-0-,bar.cern.ch--load-0-"}}},
+		{Server: servers.Server{Metadata: map[string]string{"landb-alias": "foo.cern.ch--load-1-,baz.cern.ch--load-0-"}}},
+	}
+	errStop := errors.New("stop")
+
+	tests := []struct {
+		name      string
+		failAt    int
+		wantCalls int
+		wantErr   error
+	}{
+		{name: "Every endpoint once", wantCalls: 3},
+		{name: "Stops at the first error", failAt: 2, wantCalls: 2, wantErr: errStop},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			seen := make(map[string]bool)
+			err := EachEndpointFromMetadata(nodes, "default", func(ep *endpoint.Endpoint) error {
+				calls++
+				if seen[ep.DNSName] {
+					t.Errorf("EachEndpointFromMetadata() repeated %s", ep.DNSName)
+				}
+				seen[ep.DNSName] = true
+				if calls == tt.failAt {
+					return errStop
+				}
+				return nil
+			})
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("EachEndpointFromMetadata() error = %v, want %v", err, tt.wantErr)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("EachEndpointFromMetadata() called fn %d times, want %d", calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestParseEndpointsFromMetadataTargets(t *testing.T) {
+	nodes := []IngressNode{
+		{Address: "192.0.2.2", Server: servers.Server{Metadata: map[string]string{"landb-alias": "foo.cern.ch--load-0-,bar.cern.ch--load-0-"}}},
+		{Address: "192.0.2.1", Server: servers.Server{Metadata: map[string]string{"landb-alias": "foo.cern.ch--load-1-"}}},
+		{Server: servers.Server{Metadata: map[string]string{"landb-alias": "baz.cern.ch--load-0-"}}},
+	}
+
+	targets := make(map[string]endpoint.Targets)
+	for _, ep := range ParseEndpointsFromMetadata(nodes, "default") {
+		targets[ep.DNSName] = ep.Targets
+	}
+
+	expected := map[string]endpoint.Targets{
+		"foo.cern.ch": {"192.0.2.1", "192.0.2.2"},
+		"bar.cern.ch": {"192.0.2.2"},
+		"baz.cern.ch": {""},
+	}
+	if !reflect.DeepEqual(targets, expected) {
+		t.Errorf("ParseEndpointsFromMetadata() targets = %v, want %v", targets, expected)
+	}
+}
+
+func TestManagedRecords(t *testing.T) {
+	nodes := []IngressNode{
+		{Address: "192.0.2.2", Server: servers.Server{Name: "node-b", Metadata: map[string]string{"landb-alias": "foo.cern.ch--load-0-,bar.cern.ch--load-0-"}}},
+		{Address: "192.0.2.1", Server: servers.Server{Name: "node-a", Metadata: map[string]string{"landb-alias": "foo.cern.ch--load-1-"}}},
+		{Server: servers.Server{Name: "node-c", Metadata: map[string]string{"owner": "default"}}},
+	}
+
+	expected := []ManagedRecord{
+		{Name: "bar.cern.ch", Type: endpoint.RecordTypeA, Targets: []string{"192.0.2.2"}, Nodes: []string{"node-b"}},
+		{Name: "foo.cern.ch", Type: endpoint.RecordTypeA, Targets: []string{"192.0.2.1", "192.0.2.2"}, Nodes: []string{"node-a", "node-b"}},
+	}
+	if got := ManagedRecords(nodes, "default"); !reflect.DeepEqual(got, expected) {
+		t.Errorf("ManagedRecords() = %+v, want %+v", got, expected)
+	}
+}
+
 func TestDiffMetadata(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -208,6 +290,13 @@ func TestDiffMetadata(t *testing.T) {
 			wantUpd: map[string]string{"landb-alias": "bar"},
 			wantDel: []string{}, // "other" should not be deleted
 		},
+		{
+			name:    "Delete owner marker",
+			current: map[string]string{"landb-alias": "foo", OwnerMetadataKey: "default"},
+			desired: map[string]string{"landb-alias": "foo"},
+			wantUpd: map[string]string{},
+			wantDel: []string{OwnerMetadataKey},
+		},
 	}
 
 	for _, tt := range tests {
@@ -226,3 +315,149 @@ func TestDiffMetadata(t *testing.T) {
 		})
 	}
 }
+
+func TestGenerateNodesMetadata(t *testing.T) {
+	nodes := []IngressNode{
+		{Server: servers.Server{ID: "a"}, Labels: map[string]string{"zone": "a"}},
+		{Server: servers.Server{ID: "b"}, Labels: map[string]string{"zone": "b"}},
+		{Server: servers.Server{ID: "c"}, Labels: map[string]string{"zone": "a"}},
+	}
+	endpoints := []*endpoint.Endpoint{
+		{DNSName: "all.cern.ch", RecordType: endpoint.RecordTypeA},
+		endpoint.NewEndpoint("zone-a.cern.ch", endpoint.RecordTypeA).WithProviderSpecific(NodeSelectorProperty, "zone=a"),
+	}
+
+	expected := []map[string]string{
+		{"landb-alias": "all.cern.ch--load-0-,zone-a.cern.ch--load-0-"},
+		{"landb-alias": "all.cern.ch--load-1-"},
+		{"landb-alias": "all.cern.ch--load-2-,zone-a.cern.ch--load-1-"},
+	}
+
+	got := GenerateNodesMetadata(log.NewNopLogger(), nodes, endpoints, "default")
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("GenerateNodesMetadata() = %v, want %v", got, expected)
+	}
+}
+
+func TestGenerateNodesMetadataStableIndexes(t *testing.T) {
+	endpoints := []*endpoint.Endpoint{
+		{DNSName: "foo.cern.ch", RecordType: endpoint.RecordTypeA},
+		{DNSName: "bar.cern.ch.", RecordType: endpoint.RecordTypeA},
+	}
+
+	tests := []struct {
+		name     string
+		nodes    []IngressNode
+		expected []map[string]string
+	}{
+		{
+			name: "Node added before existing nodes",
+			nodes: []IngressNode{
+				{Server: servers.Server{ID: "a"}},
+				{Server: servers.Server{ID: "b", Metadata: map[string]string{"landb-alias": "bar.cern.ch--load-0-,foo.cern.ch--load-0-"}}},
+				{Server: servers.Server{ID: "c", Metadata: map[string]string{"landb-alias": "bar.cern.ch--load-1-,foo.cern.ch--load-1-"}}},
+			},
+			expected: []map[string]string{
+				{"landb-alias": "bar.cern.ch--load-2-,foo.cern.ch--load-2-"},
+				{"landb-alias": "bar.cern.ch--load-0-,foo.cern.ch--load-0-"},
+				{"landb-alias": "bar.cern.ch--load-1-,foo.cern.ch--load-1-"},
+			},
+		},
+		{
+			name: "Node removed leaves the other indexes untouched",
+			nodes: []IngressNode{
+				{Server: servers.Server{ID: "a", Metadata: map[string]string{"landb-alias": "bar.cern.ch--load-0-,foo.cern.ch--load-0-"}}},
+				{Server: servers.Server{ID: "c", Metadata: map[string]string{"landb-alias": "bar.cern.ch--load-2-,foo.cern.ch--load-2-"}}},
+			},
+			expected: []map[string]string{
+				{"landb-alias": "bar.cern.ch--load-0-,foo.cern.ch--load-0-"},
+				{"landb-alias": "bar.cern.ch--load-2-,foo.cern.ch--load-2-"},
+			},
+		},
+		{
+			name: "Duplicate index is reassigned",
+			nodes: []IngressNode{
+				{Server: servers.Server{ID: "a", Metadata: map[string]string{"landb-alias": "bar.cern.ch--load-0-,foo.cern.ch--load-1-"}}},
+				{Server: servers.Server{ID: "b", Metadata: map[string]string{"landb-alias": "bar.cern.ch--load-0-,foo.cern.ch--load-1-"}}},
+			},
+			expected: []map[string]string{
+				{"landb-alias": "bar.cern.ch--load-0-,foo.cern.ch--load-1-"},
+				{"landb-alias": "bar.cern.ch--load-1-,foo.cern.ch--load-0-"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := GenerateNodesMetadata(log.NewNopLogger(), tt.nodes, endpoints, "default")
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("GenerateNodesMetadata() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestReplaceAliasMetadata(t *testing.T) {
+	metadata := map[string]string{
+		"landb-alias":  "old.cern.ch--load-0-",
+		"landb-alias2": "stale.cern.ch--load-0-",
+		"owner":        "ops",
+	}
+	aliases := map[string]string{"landb-alias": "new.cern.ch--load-0-"}
+
+	expected := map[string]string{
+		"landb-alias": "new.cern.ch--load-0-",
+		"owner":       "ops",
+	}
+	if got := replaceAliasMetadata(metadata, aliases); !reflect.DeepEqual(got, expected) {
+		t.Errorf("replaceAliasMetadata() = %v, want %v", got, expected)
+	}
+}
+
+func TestStaleAliasKeys(t *testing.T) {
+	metadata := map[string]string{
+		"landb-alias":   "a--load-0-",
+		"landb-alias2":  "b--load-0-",
+		"landb-alias3":  "c--load-0-",
+		"landb-alias04": "d--load-0-",
+		"landb-aliasx":  "e--load-0-",
+		"owner":         "ops",
+	}
+
+	tests := []struct {
+		name     string
+		needed   int
+		expected []string
+	}{
+		{name: "All needed", needed: 3, expected: []string{"landb-alias04", "landb-aliasx"}},
+		{name: "Shrunk", needed: 1, expected: []string{"landb-alias04", "landb-alias2", "landb-alias3", "landb-aliasx"}},
+		{name: "Empty", needed: 0, expected: []string{"landb-alias", "landb-alias04", "landb-alias2", "landb-alias3", "landb-aliasx"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := staleAliasKeys(metadata, tt.needed); !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("staleAliasKeys() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestGenerateNodesMetadataBalanced(t *testing.T) {
+	nodes := []IngressNode{
+		{Server: servers.Server{ID: "a"}},
+		{Server: servers.Server{ID: "b"}},
+	}
+	endpoints := []*endpoint.Endpoint{
+		endpoint.NewEndpoint("bar.cern.ch", endpoint.RecordTypeA).WithProviderSpecific(NodeCountProperty, "1"),
+		endpoint.NewEndpoint("foo.cern.ch", endpoint.RecordTypeA).WithProviderSpecific(NodeCountProperty, "1"),
+	}
+
+	expected := []map[string]string{
+		{"landb-alias": "bar.cern.ch--load-0-"},
+		{"landb-alias": "foo.cern.ch--load-0-"},
+	}
+	if got := GenerateNodesMetadata(log.NewNopLogger(), nodes, endpoints, "default"); !reflect.DeepEqual(got, expected) {
+		t.Errorf("GenerateNodesMetadata() = %v, want %v", got, expected)
+	}
+}
@@ -0,0 +1,158 @@
+package cern
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/log"
+)
+
+// legacyAlias is an alias found in the `landb-alias*` metadata of a server, in any format.
+type legacyAlias struct {
+	// name is the normalized DNS name of the alias.
+	name string
+	// loadIndex is the load index of the alias, -1 for a plain alias carrying none.
+	loadIndex int
+}
+
+// parseLegacyAlias parses an alias written by hand or by older scripts: upper case names, trailing
+// dots, a missing trailing hyphen after the load index, or no load index at all are accepted.
+func parseLegacyAlias(token string) (legacyAlias, error) {
+	name, loadIndex := token, -1
+	if idx := strings.LastIndex(token, "--load-"); idx != -1 {
+		index, err := strconv.Atoi(strings.TrimSuffix(token[idx+len("--load-"):], "-"))
+		if err != nil || index < 0 {
+			return legacyAlias{}, fmt.Errorf("invalid load index in alias %q", token)
+		}
+		name, loadIndex = token[:idx], index
+	}
+	name = normalizeDNSName(name)
+	if err := ValidateAlias(name); err != nil {
+		return legacyAlias{}, err
+	}
+	return legacyAlias{name: name, loadIndex: loadIndex}, nil
+}
+
+// splitLegacyAliases splits a `landb-alias*` value on commas, semicolons and whitespace.
+func splitLegacyAliases(value string) []string {
+	return strings.FieldsFunc(value, func(r rune) bool {
+		return r == ',' || r == ';' || r == ' ' || r == '\t' || r == '\n' || r == '\r'
+	})
+}
+
+// migrateNodesMetadata returns, aligned with nodes, the current `landb-alias*` metadata of every
+// node, in any format, and the canonical metadata carrying the same aliases, marked as owned by
+// ownerID.
+//
+// The plain aliases, carrying no load index, are given the lowest load index their name does not
+// use yet on any node, in the order of nodes. A node carrying a value that cannot be parsed, or
+// whose aliases live in LanDB, is left as it is; the unparsable values are reported in the
+// returned error.
+func migrateNodesMetadata(nodes []IngressNode, ownerID string) (current, desired []map[string]string, err error) {
+	current = make([]map[string]string, len(nodes))
+	desired = make([]map[string]string, len(nodes))
+	parsed := make([][]legacyAlias, len(nodes))
+	used := make(map[string]map[int]struct{})
+	var errs []error
+
+	for i, node := range nodes {
+		current[i] = managedMetadata(node.Metadata)
+		desired[i] = current[i]
+		if node.Interface != "" {
+			continue
+		}
+
+		var aliases []legacyAlias
+		var nodeErrs []error
+		for _, value := range aliasMetadata(node.Metadata) {
+			for _, token := range splitLegacyAliases(value) {
+				alias, err := parseLegacyAlias(token)
+				if err != nil {
+					nodeErrs = append(nodeErrs, err)
+					continue
+				}
+				aliases = append(aliases, alias)
+			}
+		}
+		if len(nodeErrs) > 0 {
+			errs = append(errs, fmt.Errorf("server %s left as it is: %w", node.Name, errors.Join(nodeErrs...)))
+			continue
+		}
+
+		parsed[i] = aliases
+		for _, alias := range aliases {
+			if alias.loadIndex < 0 {
+				continue
+			}
+			if used[alias.name] == nil {
+				used[alias.name] = make(map[int]struct{})
+			}
+			used[alias.name][alias.loadIndex] = struct{}{}
+		}
+	}
+
+	for i := range nodes {
+		if parsed[i] == nil {
+			continue
+		}
+
+		indexes := make(map[string]int)
+		for _, alias := range parsed[i] {
+			if alias.loadIndex >= 0 {
+				indexes[alias.name] = alias.loadIndex
+			}
+		}
+		// A plain alias is dropped when the node already carries the name with a load index.
+		for _, alias := range parsed[i] {
+			if _, ok := indexes[alias.name]; ok || alias.loadIndex >= 0 {
+				continue
+			}
+			if used[alias.name] == nil {
+				used[alias.name] = make(map[int]struct{})
+			}
+			index := 0
+			for ; ; index++ {
+				if _, ok := used[alias.name][index]; !ok {
+					break
+				}
+			}
+			used[alias.name][index] = struct{}{}
+			indexes[alias.name] = index
+		}
+
+		var aliases []string
+		for _, name := range slices.Sorted(maps.Keys(indexes)) {
+			aliases = append(aliases, formatAlias(name, indexes[name]))
+		}
+		desired[i] = ownedMetadata(aliases, nil, ownerID)
+	}
+	return current, desired, errors.Join(errs...)
+}
+
+// Migrate rewrites the aliases the ingress nodes carry in older or hand-maintained formats into the
+// canonical format, marking the nodes as owned by this webhook instance, and returns the changes of
+// every node that changes. Only the changes are computed in dry-run mode.
+//
+// The nodes carrying values that cannot be parsed are left as they are and logged to the logger of
+// ctx.
+func (m *Manager) Migrate(ctx context.Context, nodes []IngressNode, dryRun bool) ([]NodePlan, error) {
+	current, desired, err := migrateNodesMetadata(nodes, m.ownerID)
+	if err != nil {
+		log.FromContext(ctx).Warn("Some aliases cannot be migrated: %v", err)
+	}
+
+	plans := planNodesMetadata(nodes, current, desired)
+	if dryRun || len(plans) == 0 {
+		return plans, nil
+	}
+
+	// Any write makes the cached listing stale, even if the migration fails halfway.
+	defer m.cache.invalidate()
+	_, errs := m.applyNodesMetadata(ctx, nodes, current, desired)
+	return plans, errors.Join(errs...)
+}
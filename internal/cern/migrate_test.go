@@ -0,0 +1,72 @@
+package cern
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/gophercloud/gophercloud/v2/openstack/compute/v2/servers"
+)
+
+func TestMigrateNodesMetadata(t *testing.T) {
+	nodes := []IngressNode{
+		{Server: servers.Server{Name: "canonical", Metadata: map[string]string{
+			"landb-alias":    "bar.cern.ch--load-0-,foo.cern.ch--load-0-",
+			OwnerMetadataKey: "cluster-a",
+		}}},
+		{Server: servers.Server{Name: "legacy", Metadata: map[string]string{
+			"landb-alias":   "FOO.cern.ch.; baz.cern.ch--load-2",
+			"landb-alias-2": "bar.cern.ch qux.cern.ch",
+			"owner":         "someone",
+		}}},
+		{Server: servers.Server{Name: "duplicate", Metadata: map[string]string{
+			"landb-alias": "foo.cern.ch,foo.cern.ch--load-5-",
+		}}},
+		{Server: servers.Server{Name: "invalid", Metadata: map[string]string{
+			"landb-alias": "foo.cern.ch,-bad-.cern.ch",
+		}}},
+		{Server: servers.Server{Name: "empty", Metadata: map[string]string{"owner": "someone"}}},
+	}
+
+	current, desired, err := migrateNodesMetadata(nodes, "cluster-a")
+	if err == nil {
+		t.Error("migrateNodesMetadata() error = nil, want the invalid alias reported")
+	}
+
+	expected := []map[string]string{
+		// Already canonical and owned, only marked.
+		{
+			"landb-alias":       "bar.cern.ch--load-0-,foo.cern.ch--load-0-",
+			ownedMetadataPrefix: ownershipMarkers("cluster-a", "bar.cern.ch--load-0-", "foo.cern.ch--load-0-"),
+			OwnerMetadataKey:    "cluster-a",
+		},
+		// The plain aliases get the first load index unused by their name.
+		{
+			"landb-alias":       "bar.cern.ch--load-1-,baz.cern.ch--load-2-,foo.cern.ch--load-1-,qux.cern.ch--load-0-",
+			ownedMetadataPrefix: ownershipMarkers("cluster-a", "bar.cern.ch--load-1-", "baz.cern.ch--load-2-", "foo.cern.ch--load-1-", "qux.cern.ch--load-0-"),
+			OwnerMetadataKey:    "cluster-a",
+		},
+		// The plain alias is dropped, as the name already has a load index on the node.
+		{
+			"landb-alias":       "foo.cern.ch--load-5-",
+			ownedMetadataPrefix: ownershipMarkers("cluster-a", "foo.cern.ch--load-5-"),
+			OwnerMetadataKey:    "cluster-a",
+		},
+		// Left as it is.
+		{"landb-alias": "foo.cern.ch,-bad-.cern.ch"},
+		{},
+	}
+	if !reflect.DeepEqual(desired, expected) {
+		t.Errorf("migrateNodesMetadata() desired = %v, want %v", desired, expected)
+	}
+
+	plans := planNodesMetadata(nodes, current, desired)
+	if len(plans) != 3 || plans[0].Server != "canonical" || plans[1].Server != "legacy" || plans[2].Server != "duplicate" {
+		t.Fatalf("planNodesMetadata() = %+v, want changes of the canonical, legacy and duplicate nodes", plans)
+	}
+	if want := map[string]string{ownedMetadataPrefix: expected[0][ownedMetadataPrefix]}; !reflect.DeepEqual(plans[0].Update, want) {
+		t.Errorf("canonical node updates %v, want only the ownership markers", plans[0].Update)
+	}
+	if !reflect.DeepEqual(plans[1].Delete, []string{"landb-alias-2"}) {
+		t.Errorf("legacy node deletes %v, want the legacy key", plans[1].Delete)
+	}
+}
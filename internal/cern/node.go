@@ -0,0 +1,167 @@
+package cern
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gophercloud/gophercloud/v2/openstack/compute/v2/servers"
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/k8s"
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/pkg/config"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+// NodeSelectorProperty is the provider-specific endpoint property that restricts an alias to the
+// ingress nodes matching an additional Kubernetes label selector, e.g. `zone=a`.
+// It is set through the `external-dns.alpha.kubernetes.io/webhook-cern-node-selector` annotation.
+const NodeSelectorProperty = "webhook/cern-node-selector"
+
+// NodeCountProperty is the provider-specific endpoint property that limits the number of ingress
+// nodes carrying the alias. The nodes are then spread across availability zones, so a single zone
+// outage does not take down all the targets of the alias.
+// It is set through the `external-dns.alpha.kubernetes.io/webhook-cern-node-count` annotation.
+const NodeCountProperty = "webhook/cern-node-count"
+
+// LanDBInterfaceLabel is the Kubernetes node label naming the LanDB interface that must carry the
+// aliases of the node, for nodes with several network interfaces. The aliases of such nodes are
+// written directly to LanDB.
+const LanDBInterfaceLabel = "landb.cern.ch/interface"
+
+// openStackProviderIDPrefix is the prefix of the providerID set on nodes by the OpenStack cloud provider.
+const openStackProviderIDPrefix = "openstack://"
+
+// IngressNode is an OpenStack server backing a Kubernetes ingress node.
+type IngressNode struct {
+	servers.Server
+
+	// Labels are the labels of the Kubernetes node backing the server.
+	Labels map[string]string
+
+	// Address is the address of the Kubernetes node reported as a target of the aliases it carries.
+	Address string
+
+	// Interface is the LanDB interface carrying the aliases. It is only set when the aliases are
+	// written directly to LanDB.
+	Interface string
+
+	// BareMetal reports whether the server is an Ironic bare-metal node.
+	BareMetal bool
+}
+
+// SelectNodes returns the indexes of the nodes that should carry the alias of the given endpoint.
+// Without a node selector property every node is selected.
+func SelectNodes(nodes []IngressNode, ep *endpoint.Endpoint) ([]int, error) {
+	members, err := selectNodes(make([]int, 0, len(nodes)), nodes, ep)
+	if err != nil {
+		return nil, err
+	}
+	return members, nil
+}
+
+// selectNodes is SelectNodes, appending the indexes of the selected nodes to dst.
+func selectNodes(dst []int, nodes []IngressNode, ep *endpoint.Endpoint) ([]int, error) {
+	selector := labels.Everything()
+	if value, ok := ep.GetProviderSpecificProperty(NodeSelectorProperty); ok && value != "" {
+		parsed, err := labels.Parse(value)
+		if err != nil {
+			return dst, fmt.Errorf("invalid node selector %q: %w", value, err)
+		}
+		selector = parsed
+	}
+
+	for i, node := range nodes {
+		if selector.Matches(labels.Set(node.Labels)) {
+			dst = append(dst, i)
+		}
+	}
+	return dst, nil
+}
+
+// NewNodeFilter creates the filter of the Kubernetes nodes that can serve traffic from the
+// application configuration.
+func NewNodeFilter(cfg *config.Config) k8s.NodeFilter {
+	return k8s.NodeFilter{
+		RequireReady:         cfg.RequireNodeReady,
+		ExcludeUnschedulable: cfg.ExcludeUnschedulableNodes,
+		HonorExcludeLabel:    cfg.HonorExcludeFromLoadBalancers,
+	}
+}
+
+// ServerIDFromProviderID extracts the Nova server UUID from a Kubernetes node providerID.
+// Both the `openstack:///<uuid>` and `openstack://<region>/<uuid>` forms are supported.
+func ServerIDFromProviderID(providerID string) (string, bool) {
+	if !strings.HasPrefix(providerID, openStackProviderIDPrefix) {
+		return "", false
+	}
+	path := strings.TrimPrefix(providerID, openStackProviderIDPrefix)
+	serverID := path[strings.LastIndex(path, "/")+1:]
+	if serverID == "" {
+		return "", false
+	}
+	return serverID, true
+}
+
+// nodeCount returns the maximum number of nodes that should carry the alias of the given endpoint.
+// Zero means that every selected node carries it.
+func nodeCount(ep *endpoint.Endpoint) (int, error) {
+	value, ok := ep.GetProviderSpecificProperty(NodeCountProperty)
+	if !ok || value == "" {
+		return 0, nil
+	}
+	count, err := strconv.Atoi(value)
+	if err != nil || count < 1 {
+		return 0, fmt.Errorf("invalid node count %q", value)
+	}
+	return count, nil
+}
+
+// spreadNodes picks count nodes among members, spread round-robin across availability zones.
+//
+// Within a zone, the nodes already carrying the alias of domain are picked first so that the
+// selection stays stable across syncs. The other nodes are picked least-loaded first, load being
+// the number of aliases already assigned to each node, so that aliases are balanced across nodes
+// instead of always landing on the first nodes by ID. The returned indexes keep the order of members.
+func spreadNodes(nodes []IngressNode, members []int, count int, current []map[string]int, load []int, domain string) []int {
+	if count >= len(members) {
+		return members
+	}
+
+	zones := make(map[string][]int)
+	for _, nodeIndex := range members {
+		zone := nodes[nodeIndex].AvailabilityZone
+		zones[zone] = append(zones[zone], nodeIndex)
+	}
+
+	names := make([]string, 0, len(zones))
+	for zone, zoneMembers := range zones {
+		names = append(names, zone)
+		sort.SliceStable(zoneMembers, func(i, j int) bool {
+			_, iCarries := current[zoneMembers[i]][domain]
+			_, jCarries := current[zoneMembers[j]][domain]
+			if iCarries != jCarries {
+				return iCarries
+			}
+			return load[zoneMembers[i]] < load[zoneMembers[j]]
+		})
+	}
+	sort.Strings(names)
+
+	picked := make(map[int]struct{}, count)
+	for round := 0; len(picked) < count; round++ {
+		for _, zone := range names {
+			if round < len(zones[zone]) && len(picked) < count {
+				picked[zones[zone][round]] = struct{}{}
+			}
+		}
+	}
+
+	selected := make([]int, 0, count)
+	for _, nodeIndex := range members {
+		if _, ok := picked[nodeIndex]; ok {
+			selected = append(selected, nodeIndex)
+		}
+	}
+	return selected
+}
@@ -0,0 +1,71 @@
+package cern
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/gophercloud/gophercloud/v2/openstack/compute/v2/servers"
+)
+
+func TestServerIDFromProviderID(t *testing.T) {
+	tests := []struct {
+		name       string
+		providerID string
+		expectedID string
+		expectedOk bool
+	}{
+		{name: "Without region", providerID: "openstack:///0b2c8e5a-1f3d-4a6e-9c1b-2d3e4f5a6b7c", expectedID: "0b2c8e5a-1f3d-4a6e-9c1b-2d3e4f5a6b7c", expectedOk: true},
+		{name: "With region", providerID: "openstack://cern/0b2c8e5a-1f3d-4a6e-9c1b-2d3e4f5a6b7c", expectedID: "0b2c8e5a-1f3d-4a6e-9c1b-2d3e4f5a6b7c", expectedOk: true},
+		{name: "Empty", providerID: "", expectedOk: false},
+		{name: "Other cloud provider", providerID: "aws:///eu-west-1a/i-0123456789", expectedOk: false},
+		{name: "Missing UUID", providerID: "openstack:///", expectedOk: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, ok := ServerIDFromProviderID(tt.providerID)
+			if id != tt.expectedID || ok != tt.expectedOk {
+				t.Errorf("ServerIDFromProviderID(%q) = (%q, %v), want (%q, %v)", tt.providerID, id, ok, tt.expectedID, tt.expectedOk)
+			}
+		})
+	}
+}
+
+func TestSpreadNodes(t *testing.T) {
+	nodes := []IngressNode{
+		{Server: servers.Server{ID: "a", AvailabilityZone: "cern-geneva-a"}},
+		{Server: servers.Server{ID: "b", AvailabilityZone: "cern-geneva-a"}},
+		{Server: servers.Server{ID: "c", AvailabilityZone: "cern-geneva-a"}},
+		{Server: servers.Server{ID: "d", AvailabilityZone: "cern-geneva-b"}},
+		{Server: servers.Server{ID: "e", AvailabilityZone: "cern-geneva-c"}},
+	}
+	members := []int{0, 1, 2, 3, 4}
+
+	tests := []struct {
+		name     string
+		count    int
+		current  []map[string]int
+		load     []int
+		expected []int
+	}{
+		{name: "One per zone", count: 3, current: make([]map[string]int, len(nodes)), expected: []int{0, 3, 4}},
+		{name: "Second round", count: 4, current: make([]map[string]int, len(nodes)), expected: []int{0, 1, 3, 4}},
+		{name: "Current carriers preferred", count: 2, current: []map[string]int{nil, nil, {"foo.cern.ch": 0}, nil, nil}, expected: []int{2, 3}},
+		{name: "More than available", count: 10, current: make([]map[string]int, len(nodes)), expected: members},
+		{name: "Least loaded", count: 3, current: make([]map[string]int, len(nodes)), load: []int{2, 0, 1, 0, 0}, expected: []int{1, 3, 4}},
+		{name: "Current carriers before load", count: 1, current: []map[string]int{{"foo.cern.ch": 0}, nil, nil, nil, nil}, load: []int{5, 0, 0, 0, 0}, expected: []int{0}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			load := tt.load
+			if load == nil {
+				load = make([]int, len(nodes))
+			}
+			got := spreadNodes(nodes, members, tt.count, tt.current, load, "foo.cern.ch")
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("spreadNodes() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package cern
+
+import (
+	"context"
+	"strings"
+
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/log"
+)
+
+// OwnerMetadataKey is the metadata key marking the servers whose aliases are managed by a webhook instance.
+// Its value is the configured owner ID, so several clusters can share an OpenStack project.
+const OwnerMetadataKey = "external-dns-cern-owner"
+
+// Supported orphan scan modes.
+const (
+	// OrphanScanOff disables the orphan scan.
+	OrphanScanOff = "off"
+	// OrphanScanReport logs the orphaned servers without modifying them.
+	OrphanScanReport = "report"
+	// OrphanScanRepair removes the aliases of the orphaned servers.
+	OrphanScanRepair = "repair"
+)
+
+// managedMetadata returns a copy of the `landb-alias*` keys, the ownership markers and the owner
+// key of a server's metadata.
+func managedMetadata(metadata map[string]string) map[string]string {
+	managed := aliasMetadata(metadata)
+	for key, value := range metadata {
+		if strings.HasPrefix(key, ownedMetadataPrefix) {
+			managed[key] = value
+		}
+	}
+	if owner, ok := metadata[OwnerMetadataKey]; ok {
+		managed[OwnerMetadataKey] = owner
+	}
+	return managed
+}
+
+// OwnedNodes returns the nodes marked as managed by ownerID, whose aliases this webhook instance may
+// remove.
+func OwnedNodes(nodes []IngressNode, ownerID string) []IngressNode {
+	var owned []IngressNode
+	for _, node := range nodes {
+		if node.Metadata[OwnerMetadataKey] == ownerID {
+			owned = append(owned, node)
+		}
+	}
+	return owned
+}
+
+// findOrphans returns the servers owned by ownerID that still carry aliases but are not ingress nodes.
+func (m *Manager) findOrphans(ctx context.Context, nodes []IngressNode) ([]IngressNode, error) {
+	index, err := m.listServers(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ingress := make(map[string]struct{}, len(nodes))
+	for _, node := range nodes {
+		ingress[node.ID] = struct{}{}
+	}
+
+	var orphans []IngressNode
+	for _, server := range index.servers {
+		if _, ok := ingress[server.ID]; ok {
+			continue
+		}
+		if server.Metadata[OwnerMetadataKey] != m.ownerID || !carriesManagedAliases(server.Metadata, m.ownerID) {
+			continue
+		}
+		orphans = append(orphans, IngressNode{Server: server})
+	}
+	return orphans, nil
+}
+
+// scanOrphans reports or repairs the servers that carry aliases owned by this webhook but are no
+// longer ingress nodes, e.g. nodes that left the ingress set while the webhook was not running.
+// Failures are logged and never fail the sync.
+func (m *Manager) scanOrphans(ctx context.Context, nodes []IngressNode) {
+	if m.orphanScan == "" || m.orphanScan == OrphanScanOff {
+		return
+	}
+
+	orphans, err := m.findOrphans(ctx, nodes)
+	if err != nil {
+		log.FromContext(ctx).Warn("Failed to scan for orphaned aliases: %v", err)
+		return
+	}
+
+	for _, orphan := range orphans {
+		if m.orphanScan != OrphanScanRepair {
+			log.FromContext(ctx).Warn("Server %s is not an ingress node but still carries aliases: %v", orphan.Name, aliasMetadata(orphan.Metadata))
+			continue
+		}
+
+		toUpdate, toDelete := m.removeManagedAliases(orphan.Metadata)
+		log.FromContext(ctx).Info("Removing orphaned aliases of server %s", orphan.Name)
+		if err := m.UpdateNodeMetadata(ctx, orphan.ID, toUpdate, toDelete); err != nil {
+			log.FromContext(ctx).Warn("Failed to remove orphaned aliases of server %s: %v", orphan.Name, err)
+		}
+	}
+}
+
+// removeManagedAliases returns the changes of a server's metadata removing the aliases managed by
+// the webhook instance, the foreign aliases being kept.
+func (m *Manager) removeManagedAliases(metadata map[string]string) (map[string]string, []string) {
+	return DiffMetadata(managedMetadata(metadata), ownedMetadata(nil, foreignAliases(metadata, m.ownerID), m.ownerID))
+}
+
+// carriesManagedAliases reports whether a server's metadata carries aliases managed by the webhook
+// instance with the given owner ID.
+func carriesManagedAliases(metadata map[string]string, ownerID string) bool {
+	found := false
+	eachManagedAlias(metadata, ownerID, func(string) { found = true })
+	return found
+}
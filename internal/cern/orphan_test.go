@@ -0,0 +1,42 @@
+package cern
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gophercloud/gophercloud/v2/openstack/compute/v2/servers"
+)
+
+func TestManagerFindOrphans(t *testing.T) {
+	m := &Manager{cache: &serverCache{ttl: time.Minute}, ownerID: "cluster-a"}
+	m.cache.set([]servers.Server{
+		{ID: "ingress", Metadata: map[string]string{"landb-alias": "foo.cern.ch--load-0-", OwnerMetadataKey: "cluster-a"}},
+		{ID: "orphan", Metadata: map[string]string{"landb-alias": "foo.cern.ch--load-1-", OwnerMetadataKey: "cluster-a"}},
+		{ID: "other-owner", Metadata: map[string]string{"landb-alias": "bar.cern.ch--load-0-", OwnerMetadataKey: "cluster-b"}},
+		{ID: "manual", Metadata: map[string]string{"landb-alias": "manual.cern.ch--load-0-"}},
+		{ID: "cleaned", Metadata: map[string]string{OwnerMetadataKey: "cluster-a"}},
+		{ID: "foreign-only", Metadata: map[string]string{"landb-alias": "manual.cern.ch--load-0-", ownedMetadataPrefix: noOwnedAliases, OwnerMetadataKey: "cluster-a"}},
+	})
+
+	orphans, err := m.findOrphans(context.Background(), []IngressNode{{Server: servers.Server{ID: "ingress"}}})
+	if err != nil {
+		t.Fatalf("findOrphans() error = %v", err)
+	}
+	if len(orphans) != 1 || orphans[0].ID != "orphan" {
+		t.Errorf("findOrphans() = %v, want only the orphan server", orphans)
+	}
+}
+
+func TestOwnedNodes(t *testing.T) {
+	nodes := []IngressNode{
+		{Server: servers.Server{ID: "owned", Metadata: map[string]string{"landb-alias": "foo.cern.ch--load-0-", OwnerMetadataKey: "cluster-a"}}},
+		{Server: servers.Server{ID: "other-owner", Metadata: map[string]string{"landb-alias": "bar.cern.ch--load-0-", OwnerMetadataKey: "cluster-b"}}},
+		{Server: servers.Server{ID: "manual", Metadata: map[string]string{"landb-alias": "manual.cern.ch--load-0-"}}},
+	}
+
+	owned := OwnedNodes(nodes, "cluster-a")
+	if len(owned) != 1 || owned[0].ID != "owned" {
+		t.Errorf("OwnedNodes() = %v, want only the owned server", owned)
+	}
+}
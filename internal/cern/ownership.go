@@ -0,0 +1,140 @@
+package cern
+
+import (
+	"crypto/sha256"
+	"encoding/base32"
+	"slices"
+	"strings"
+)
+
+// ownedMetadataPrefix is the prefix of the metadata keys holding the ownership markers of the
+// aliases: `external-dns-cern-owned`, `external-dns-cern-owned2`, ...
+//
+// The `landb-alias*` values are read by the LanDB propagation of the CERN cloud, which takes every
+// comma-separated entry for an alias, so the markers cannot live in the values themselves. Each
+// marker is instead the token of an alias, see ownershipToken, packed in these keys like the aliases.
+const ownedMetadataPrefix = "external-dns-cern-owned"
+
+// noOwnedAliases is the value of the marker key of a node carrying no alias of the webhook, only
+// foreign ones. The key is kept so the foreign aliases are not taken for the aliases of a node
+// written before the markers existed.
+const noOwnedAliases = "-"
+
+// ownershipTokenLength is the length of the tokens, 40 bits making a collision between the aliases
+// of a node unlikely while packing about 28 tokens in a key.
+const ownershipTokenLength = 8
+
+// ownershipEncoding encodes the tokens with lower case letters and digits.
+var ownershipEncoding = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").WithPadding(base32.NoPadding)
+
+// ownershipToken returns the marker of an alias written by the webhook instance with the given
+// owner ID: the beginning of the SHA-256 of both, so the markers of another cluster, or copied by
+// hand to another node, do not match.
+func ownershipToken(ownerID, alias string) string {
+	sum := sha256.Sum256([]byte(ownerID + "/" + alias))
+	return ownershipEncoding.EncodeToString(sum[:])[:ownershipTokenLength]
+}
+
+// aliasOwnership tells the aliases of a node managed by a webhook instance from the foreign ones,
+// added by hand, by other tools or by other instances to the same `landb-alias*` keys.
+type aliasOwnership struct {
+	// owner is the owner ID of the webhook instance, the tokens being computed with it.
+	owner string
+	// other is set when the node is marked as managed by another webhook instance, all its aliases
+	// being foreign.
+	other bool
+	// tokens are the markers of the managed aliases, nil when the node carries no marker: every
+	// alias of the nodes written before the markers existed is managed.
+	tokens map[string]struct{}
+}
+
+// newAliasOwnership reads the ownership markers of a server's metadata for the webhook instance with
+// the given owner ID.
+func newAliasOwnership(metadata map[string]string, ownerID string) aliasOwnership {
+	ownership := aliasOwnership{owner: ownerID, other: ownedByOther(metadata, ownerID)}
+	for key, value := range metadata {
+		if !strings.HasPrefix(key, ownedMetadataPrefix) {
+			continue
+		}
+		if ownership.tokens == nil {
+			ownership.tokens = make(map[string]struct{})
+		}
+		for token := range strings.SplitSeq(value, ",") {
+			if token = strings.TrimSpace(token); token != "" && token != noOwnedAliases {
+				ownership.tokens[token] = struct{}{}
+			}
+		}
+	}
+	return ownership
+}
+
+// managed reports whether the alias is managed by the webhook instance.
+func (o aliasOwnership) managed(alias string) bool {
+	switch {
+	case o.other:
+		return false
+	case o.tokens == nil:
+		return true
+	}
+	_, ok := o.tokens[ownershipToken(o.owner, alias)]
+	return ok
+}
+
+// ownedByOther reports whether a server's metadata is marked as managed by another webhook instance
+// than the one with the given owner ID.
+func ownedByOther(metadata map[string]string, ownerID string) bool {
+	owner, ok := metadata[OwnerMetadataKey]
+	return ok && owner != ownerID
+}
+
+// eachManagedAlias calls fn with every alias stored in the `landb-alias*` keys of a server's
+// metadata that is managed by the webhook instance with the given owner ID, skipping the foreign
+// ones.
+func eachManagedAlias(metadata map[string]string, ownerID string, fn func(alias string)) {
+	ownership := newAliasOwnership(metadata, ownerID)
+	eachAlias(metadata, func(alias string) {
+		if ownership.managed(alias) {
+			fn(alias)
+		}
+	})
+}
+
+// foreignAliases returns the aliases stored in the `landb-alias*` keys of a server's metadata that
+// are not managed by the webhook instance with the given owner ID, which it must keep.
+func foreignAliases(metadata map[string]string, ownerID string) []string {
+	ownership := newAliasOwnership(metadata, ownerID)
+	if ownership.tokens == nil && !ownership.other {
+		return nil
+	}
+	var foreign []string
+	eachAlias(metadata, func(alias string) {
+		if !ownership.managed(alias) {
+			foreign = append(foreign, alias)
+		}
+	})
+	return foreign
+}
+
+// ownedMetadata returns the metadata of a node carrying the given aliases of the webhook instance
+// with the given owner ID along with the foreign ones: the aliases packed in the `landb-alias*`
+// keys, the markers of the aliases of the webhook, and the owner key. It is empty when there is no
+// alias at all.
+func ownedMetadata(aliases, foreign []string, ownerID string) map[string]string {
+	if len(aliases) == 0 && len(foreign) == 0 {
+		return map[string]string{}
+	}
+
+	metadata := packAliases(append(slices.Clip(aliases), foreign...))
+	tokens := make([]string, 0, len(aliases))
+	for _, alias := range aliases {
+		tokens = append(tokens, ownershipToken(ownerID, alias))
+	}
+	if len(tokens) == 0 {
+		tokens = append(tokens, noOwnedAliases)
+	}
+	for key, value := range packValues(ownedMetadataPrefix, tokens) {
+		metadata[key] = value
+	}
+	metadata[OwnerMetadataKey] = ownerID
+	return metadata
+}
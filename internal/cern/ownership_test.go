@@ -0,0 +1,209 @@
+package cern
+
+import (
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/gophercloud/gophercloud/v2/openstack/compute/v2/servers"
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/log"
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+// ownershipMarkers returns the value of the marker key of a node carrying the given aliases of ownerID.
+func ownershipMarkers(ownerID string, aliases ...string) string {
+	tokens := make([]string, 0, len(aliases))
+	for _, alias := range aliases {
+		tokens = append(tokens, ownershipToken(ownerID, alias))
+	}
+	slices.Sort(tokens)
+	return strings.Join(tokens, ",")
+}
+
+func TestAliasOwnership(t *testing.T) {
+	tests := []struct {
+		name     string
+		metadata map[string]string
+		managed  []string
+		foreign  []string
+	}{
+		{
+			name:     "written before the markers",
+			metadata: map[string]string{"landb-alias": "a.cern.ch--load-0-,b.cern.ch--load-0-", OwnerMetadataKey: "cluster-a"},
+			managed:  []string{"a.cern.ch--load-0-", "b.cern.ch--load-0-"},
+		},
+		{
+			name: "marked",
+			metadata: map[string]string{
+				"landb-alias":       "a.cern.ch--load-0-,manual.cern.ch",
+				"landb-alias2":      "b.cern.ch--load-0-",
+				ownedMetadataPrefix: ownershipMarkers("cluster-a", "a.cern.ch--load-0-", "b.cern.ch--load-0-"),
+				OwnerMetadataKey:    "cluster-a",
+			},
+			managed: []string{"a.cern.ch--load-0-", "b.cern.ch--load-0-"},
+			foreign: []string{"manual.cern.ch"},
+		},
+		{
+			name: "marked by another owner",
+			metadata: map[string]string{
+				"landb-alias":       "a.cern.ch--load-0-",
+				ownedMetadataPrefix: ownershipMarkers("cluster-b", "a.cern.ch--load-0-"),
+				OwnerMetadataKey:    "cluster-a",
+			},
+			foreign: []string{"a.cern.ch--load-0-"},
+		},
+		{
+			name: "owned by another instance",
+			metadata: map[string]string{
+				"landb-alias":       "a.cern.ch--load-0-,manual.cern.ch",
+				ownedMetadataPrefix: ownershipMarkers("cluster-b", "a.cern.ch--load-0-"),
+				OwnerMetadataKey:    "cluster-b",
+			},
+			foreign: []string{"a.cern.ch--load-0-", "manual.cern.ch"},
+		},
+		{
+			name:     "written before the markers by another instance",
+			metadata: map[string]string{"landb-alias": "a.cern.ch--load-0-", OwnerMetadataKey: "cluster-b"},
+			foreign:  []string{"a.cern.ch--load-0-"},
+		},
+		{
+			name: "nothing owned",
+			metadata: map[string]string{
+				"landb-alias":       "manual.cern.ch--load-0-",
+				ownedMetadataPrefix: noOwnedAliases,
+				OwnerMetadataKey:    "cluster-a",
+			},
+			foreign: []string{"manual.cern.ch--load-0-"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var managed []string
+			eachManagedAlias(tt.metadata, "cluster-a", func(alias string) { managed = append(managed, alias) })
+			slices.Sort(managed)
+			if !slices.Equal(managed, tt.managed) {
+				t.Errorf("eachManagedAlias() = %v, want %v", managed, tt.managed)
+			}
+
+			foreign := foreignAliases(tt.metadata, "cluster-a")
+			slices.Sort(foreign)
+			if !slices.Equal(foreign, tt.foreign) {
+				t.Errorf("foreignAliases() = %v, want %v", foreign, tt.foreign)
+			}
+		})
+	}
+}
+
+func TestOwnedMetadata(t *testing.T) {
+	tests := []struct {
+		name    string
+		aliases []string
+		foreign []string
+		want    map[string]string
+	}{
+		{
+			name: "nothing",
+			want: map[string]string{},
+		},
+		{
+			name:    "owned and foreign",
+			aliases: []string{"b.cern.ch--load-0-", "a.cern.ch--load-1-"},
+			foreign: []string{"manual.cern.ch"},
+			want: map[string]string{
+				"landb-alias":       "a.cern.ch--load-1-,b.cern.ch--load-0-,manual.cern.ch",
+				ownedMetadataPrefix: ownershipMarkers("cluster-a", "a.cern.ch--load-1-", "b.cern.ch--load-0-"),
+				OwnerMetadataKey:    "cluster-a",
+			},
+		},
+		{
+			name:    "foreign only",
+			foreign: []string{"manual.cern.ch"},
+			want: map[string]string{
+				"landb-alias":       "manual.cern.ch",
+				ownedMetadataPrefix: noOwnedAliases,
+				OwnerMetadataKey:    "cluster-a",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ownedMetadata(tt.aliases, tt.foreign, "cluster-a"); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ownedMetadata() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestManagerKeepsForeignAliases checks that the aliases added by hand next to the managed ones are
+// neither reported to ExternalDNS nor deleted, while the managed ones are.
+func TestManagerKeepsForeignAliases(t *testing.T) {
+	m := &Manager{logger: log.NewNopLogger(), ownerID: "cluster-a"}
+	node := IngressNode{Server: servers.Server{Name: "node-1", Metadata: map[string]string{
+		"landb-alias":       "old.cern.ch--load-0-,manual.cern.ch--load-0-",
+		ownedMetadataPrefix: ownershipMarkers("cluster-a", "old.cern.ch--load-0-"),
+		OwnerMetadataKey:    "cluster-a",
+	}}}
+
+	current := ParseEndpointsFromMetadata([]IngressNode{node}, "cluster-a")
+	if len(current) != 1 || current[0].DNSName != "old.cern.ch" {
+		t.Fatalf("ParseEndpointsFromMetadata() = %v, want only the managed old.cern.ch", current)
+	}
+
+	endpoints := []*endpoint.Endpoint{endpoint.NewEndpoint("new.cern.ch", endpoint.RecordTypeA, "10.0.0.1")}
+	plans := m.Plan([]IngressNode{node}, endpoints)
+	want := map[string]string{
+		"landb-alias":       "manual.cern.ch--load-0-,new.cern.ch--load-0-",
+		ownedMetadataPrefix: ownershipMarkers("cluster-a", "new.cern.ch--load-0-"),
+	}
+	if len(plans) != 1 || !reflect.DeepEqual(plans[0].Update, want) || len(plans[0].Delete) != 0 {
+		t.Fatalf("Plan() = %+v, want the update %v", plans, want)
+	}
+
+	// Once applied, the metadata is in sync.
+	for key, value := range plans[0].Update {
+		node.Metadata[key] = value
+	}
+	if plans := m.Plan([]IngressNode{node}, endpoints); len(plans) != 0 {
+		t.Errorf("Plan() after applying the changes = %+v, want none", plans)
+	}
+
+	// Removing every managed alias keeps the foreign one.
+	plans = m.Plan([]IngressNode{node}, nil)
+	want = map[string]string{"landb-alias": "manual.cern.ch--load-0-", ownedMetadataPrefix: noOwnedAliases}
+	if len(plans) != 1 || !reflect.DeepEqual(plans[0].Update, want) || len(plans[0].Delete) != 0 {
+		t.Errorf("Plan() without endpoints = %+v, want the update %v", plans, want)
+	}
+}
+
+// TestManagerLeavesOtherOwners checks that the nodes marked by another webhook instance are neither
+// reported to ExternalDNS nor changed, unless they get aliases of this instance.
+func TestManagerLeavesOtherOwners(t *testing.T) {
+	m := &Manager{logger: log.NewNopLogger(), ownerID: "cluster-a"}
+	node := IngressNode{Server: servers.Server{Name: "node-1", Metadata: map[string]string{
+		"landb-alias":       "other.cern.ch--load-0-",
+		ownedMetadataPrefix: ownershipMarkers("cluster-b", "other.cern.ch--load-0-"),
+		OwnerMetadataKey:    "cluster-b",
+	}}}
+
+	if current := ParseEndpointsFromMetadata([]IngressNode{node}, "cluster-a"); len(current) != 0 {
+		t.Errorf("ParseEndpointsFromMetadata() = %v, want none", current)
+	}
+	if plans := m.Plan([]IngressNode{node}, nil); len(plans) != 0 {
+		t.Errorf("Plan() without endpoints = %+v, want none", plans)
+	}
+
+	// The aliases of the other instance are kept along with the new ones.
+	endpoints := []*endpoint.Endpoint{endpoint.NewEndpoint("new.cern.ch", endpoint.RecordTypeA, "10.0.0.1")}
+	plans := m.Plan([]IngressNode{node}, endpoints)
+	want := map[string]string{
+		"landb-alias":       "new.cern.ch--load-0-,other.cern.ch--load-0-",
+		ownedMetadataPrefix: ownershipMarkers("cluster-a", "new.cern.ch--load-0-"),
+		OwnerMetadataKey:    "cluster-a",
+	}
+	if len(plans) != 1 || !reflect.DeepEqual(plans[0].Update, want) {
+		t.Errorf("Plan() = %+v, want the update %v", plans, want)
+	}
+}
@@ -0,0 +1,111 @@
+package cern
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/log"
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/pkg/config"
+)
+
+// PropagationVerifier checks that the aliases written to the ingress nodes show up in DNS.
+//
+// LanDB publishes aliases asynchronously, so a successful metadata write does not guarantee that
+// the DNS records exist. The verifier polls the configured DNS servers until every created name
+// resolves and every deleted name stops resolving, and logs how long it took.
+type PropagationVerifier struct {
+	lookup   func(ctx context.Context, host string) ([]string, error)
+	timeout  time.Duration
+	interval time.Duration
+}
+
+// NewPropagationVerifier creates a verifier resolving against the configured DNS servers.
+func NewPropagationVerifier(cfg *config.Config) *PropagationVerifier {
+	resolver := net.DefaultResolver
+	if len(cfg.DNSServers) > 0 {
+		var next int
+		var mu sync.Mutex
+		dialer := &net.Dialer{}
+		resolver = &net.Resolver{
+			PreferGo: true,
+			// Rotate across the DNS servers so a single unreachable server does not fail every lookup.
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				mu.Lock()
+				server := cfg.DNSServers[next%len(cfg.DNSServers)]
+				next++
+				mu.Unlock()
+				return dialer.DialContext(ctx, network, server)
+			},
+		}
+	}
+
+	return &PropagationVerifier{
+		lookup:   resolver.LookupHost,
+		timeout:  cfg.PropagationTimeout,
+		interval: cfg.PropagationInterval,
+	}
+}
+
+// Verify waits for the created names to resolve and the deleted names to stop resolving.
+// It returns the names that did not reach the expected state before the timeout.
+func (v *PropagationVerifier) Verify(ctx context.Context, created, deleted []string) []string {
+	ctx, cancel := context.WithTimeout(ctx, v.timeout)
+	defer cancel()
+
+	var mu sync.Mutex
+	var failed []string
+	var wg sync.WaitGroup
+	check := func(name string, shouldResolve bool) {
+		defer wg.Done()
+		start := time.Now()
+		if err := v.waitFor(ctx, name, shouldResolve); err != nil {
+			log.FromContext(ctx).Warn("DNS propagation of %s (resolvable: %v) not observed after %s: %v", name, shouldResolve, time.Since(start).Round(time.Second), err)
+			mu.Lock()
+			failed = append(failed, name)
+			mu.Unlock()
+			return
+		}
+		log.FromContext(ctx).Info("DNS propagation of %s (resolvable: %v) observed after %s", name, shouldResolve, time.Since(start).Round(time.Second))
+	}
+
+	for _, name := range created {
+		wg.Add(1)
+		go check(name, true)
+	}
+	for _, name := range deleted {
+		wg.Add(1)
+		go check(name, false)
+	}
+	wg.Wait()
+
+	return failed
+}
+
+// waitFor polls the DNS until name resolves, or stops resolving, as expected.
+func (v *PropagationVerifier) waitFor(ctx context.Context, name string, shouldResolve bool) error {
+	ticker := time.NewTicker(v.interval)
+	defer ticker.Stop()
+
+	for {
+		_, err := v.lookup(ctx, name)
+		var dnsErr *net.DNSError
+		switch {
+		case err == nil && shouldResolve:
+			return nil
+		case err != nil && !shouldResolve && errors.As(err, &dnsErr) && dnsErr.IsNotFound:
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			if err != nil {
+				return err
+			}
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
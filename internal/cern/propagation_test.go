@@ -0,0 +1,40 @@
+package cern
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPropagationVerifierVerify(t *testing.T) {
+	var mu sync.Mutex
+	lookups := make(map[string]int)
+	v := &PropagationVerifier{
+		timeout:  100 * time.Millisecond,
+		interval: time.Millisecond,
+		lookup: func(_ context.Context, host string) ([]string, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			lookups[host]++
+			switch {
+			case host == "created.cern.ch" && lookups[host] > 2:
+				return []string{"188.184.0.1"}, nil
+			case host == "still-there.cern.ch":
+				return []string{"188.184.0.1"}, nil
+			}
+			return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+		},
+	}
+
+	failed := v.Verify(context.Background(), []string{"created.cern.ch", "missing.cern.ch"}, []string{"deleted.cern.ch", "still-there.cern.ch"})
+	sort.Strings(failed)
+
+	expected := []string{"missing.cern.ch", "still-there.cern.ch"}
+	if !reflect.DeepEqual(failed, expected) {
+		t.Errorf("Verify() = %v, want %v", failed, expected)
+	}
+}
@@ -0,0 +1,87 @@
+package cern
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/log"
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+// ProtectedAliases holds the set of DNS names that the provider must never delete.
+// Entries are either plain DNS names, matched exactly, or regular expressions wrapped
+// in slashes (e.g. `/^ingress-.*\.cern\.ch$/`).
+type ProtectedAliases struct {
+	names    map[string]struct{}
+	patterns []*regexp.Regexp
+}
+
+// NewProtectedAliases parses the configured protected alias entries.
+func NewProtectedAliases(entries []string) (*ProtectedAliases, error) {
+	p := &ProtectedAliases{names: make(map[string]struct{})}
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if len(entry) > 1 && strings.HasPrefix(entry, "/") && strings.HasSuffix(entry, "/") {
+			re, err := regexp.Compile(entry[1 : len(entry)-1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid protected alias pattern %q: %w", entry, err)
+			}
+			p.patterns = append(p.patterns, re)
+			continue
+		}
+		p.names[normalizeDNSName(entry)] = struct{}{}
+	}
+	return p, nil
+}
+
+// Contains reports whether the given DNS name is protected.
+func (p *ProtectedAliases) Contains(dnsName string) bool {
+	if p == nil {
+		return false
+	}
+	name := normalizeDNSName(dnsName)
+	if _, ok := p.names[name]; ok {
+		return true
+	}
+	for _, re := range p.patterns {
+		if re.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// RetainProtected adds back any protected endpoint from current that is missing in desired.
+// A warning is logged to the logger of ctx for every endpoint that ExternalDNS planned to remove but
+// was kept.
+func (p *ProtectedAliases) RetainProtected(ctx context.Context, current, desired []*endpoint.Endpoint) []*endpoint.Endpoint {
+	if p == nil || (len(p.names) == 0 && len(p.patterns) == 0) {
+		return desired
+	}
+
+	present := make(map[string]struct{}, len(desired))
+	for _, ep := range desired {
+		present[normalizeDNSName(ep.DNSName)] = struct{}{}
+	}
+
+	for _, ep := range current {
+		name := normalizeDNSName(ep.DNSName)
+		if _, ok := present[name]; ok || !p.Contains(name) {
+			continue
+		}
+		log.FromContext(ctx).Warn("Refusing to delete protected alias %s", name)
+		desired = append(desired, ep)
+		present[name] = struct{}{}
+	}
+	return desired
+}
+
+// normalizeDNSName lowercases a DNS name and removes its trailing dot.
+func normalizeDNSName(name string) string {
+	return strings.ToLower(strings.TrimSuffix(name, "."))
+}
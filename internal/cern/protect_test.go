@@ -0,0 +1,34 @@
+package cern
+
+import "testing"
+
+func TestProtectedAliasesContains(t *testing.T) {
+	protected, err := NewProtectedAliases([]string{"foo.cern.ch", `/^ingress-\d+\.cern\.ch$/`})
+	if err != nil {
+		t.Fatalf("NewProtectedAliases() error = %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		dnsName  string
+		expected bool
+	}{
+		{name: "Exact match", dnsName: "foo.cern.ch", expected: true},
+		{name: "Trailing dot and case", dnsName: "FOO.cern.ch.", expected: true},
+		{name: "Pattern match", dnsName: "ingress-01.cern.ch", expected: true},
+		{name: "Pattern mismatch", dnsName: "ingress-a.cern.ch", expected: false},
+		{name: "Not protected", dnsName: "bar.cern.ch", expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := protected.Contains(tt.dnsName); got != tt.expected {
+				t.Errorf("Contains(%q) = %v, want %v", tt.dnsName, got, tt.expected)
+			}
+		})
+	}
+
+	if _, err := NewProtectedAliases([]string{"/[/"}); err == nil {
+		t.Errorf("NewProtectedAliases() expected error for invalid pattern")
+	}
+}
@@ -0,0 +1,95 @@
+package cern
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/gophercloud/gophercloud/v2"
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/log"
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/pkg/config"
+)
+
+// retryPolicy retries transient OpenStack failures with exponential backoff and full jitter.
+//
+// A single blip of the compute API would otherwise fail the entire ApplyChanges call and force
+// ExternalDNS to re-plan from scratch.
+type retryPolicy struct {
+	// maxAttempts is the total number of attempts, including the first one.
+	maxAttempts int
+	// initialBackoff is the upper bound of the delay before the first retry.
+	initialBackoff time.Duration
+	// maxBackoff caps the delay between two attempts.
+	maxBackoff time.Duration
+}
+
+// newRetryPolicy creates a retry policy from the application configuration.
+func newRetryPolicy(cfg *config.Config) retryPolicy {
+	return retryPolicy{
+		maxAttempts:    cfg.RetryMaxAttempts,
+		initialBackoff: cfg.RetryInitialBackoff,
+		maxBackoff:     cfg.RetryMaxBackoff,
+	}
+}
+
+// do runs fn until it succeeds, fails with a permanent error, the attempts are exhausted or ctx is done.
+func (p retryPolicy) do(ctx context.Context, operation string, fn func() error) error {
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = fn()
+		if err == nil || attempt >= p.maxAttempts || !isTransient(err) {
+			return err
+		}
+
+		delay := p.backoff(attempt)
+		log.FromContext(ctx).Warn("Transient error during %s (attempt %d/%d), retrying in %s: %v", operation, attempt, p.maxAttempts, delay, err)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return errors.Join(err, ctx.Err())
+		case <-timer.C:
+		}
+	}
+}
+
+// backoff returns the delay before the given retry, using exponential backoff with full jitter.
+func (p retryPolicy) backoff(attempt int) time.Duration {
+	ceiling := p.initialBackoff
+	for i := 1; i < attempt && ceiling < p.maxBackoff; i++ {
+		ceiling *= 2
+	}
+	if ceiling > p.maxBackoff {
+		ceiling = p.maxBackoff
+	}
+	if ceiling <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(ceiling) + 1))
+}
+
+// isUnauthorized reports whether an error is a rejected (usually expired) Keystone token.
+func isUnauthorized(err error) bool {
+	if gophercloud.ResponseCodeIs(err, http.StatusUnauthorized) {
+		return true
+	}
+
+	var reauthErr *gophercloud.ErrErrorAfterReauthentication
+	return errors.As(err, &reauthErr) && isUnauthorized(reauthErr.ErrOriginal)
+}
+
+// isTransient reports whether an error is worth retrying: server errors, rate limiting and timeouts.
+func isTransient(err error) bool {
+	var statusErr gophercloud.ErrUnexpectedResponseCode
+	if errors.As(err, &statusErr) {
+		code := statusErr.GetStatusCode()
+		return code >= http.StatusInternalServerError || code == http.StatusTooManyRequests || code == http.StatusRequestTimeout
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
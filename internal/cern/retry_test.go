@@ -0,0 +1,68 @@
+package cern
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/gophercloud/gophercloud/v2"
+)
+
+func TestRetryPolicyDo(t *testing.T) {
+	transient := gophercloud.ErrUnexpectedResponseCode{Actual: 503}
+	permanent := gophercloud.ErrUnexpectedResponseCode{Actual: 404}
+
+	tests := []struct {
+		name      string
+		failures  []error
+		wantCalls int
+		wantErr   bool
+	}{
+		{name: "Success", failures: nil, wantCalls: 1, wantErr: false},
+		{name: "Transient then success", failures: []error{transient, transient}, wantCalls: 3, wantErr: false},
+		{name: "Transient exhausts attempts", failures: []error{transient, transient, transient, transient}, wantCalls: 3, wantErr: true},
+		{name: "Permanent is not retried", failures: []error{permanent}, wantCalls: 1, wantErr: true},
+	}
+
+	policy := retryPolicy{maxAttempts: 3}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			err := policy.do(context.Background(), "test", func() error {
+				calls++
+				if calls <= len(tt.failures) {
+					return tt.failures[calls-1]
+				}
+				return nil
+			})
+			if calls != tt.wantCalls {
+				t.Errorf("do() called fn %d times, want %d", calls, tt.wantCalls)
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("do() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestIsTransient(t *testing.T) {
+	if !isTransient(gophercloud.ErrUnexpectedResponseCode{Actual: 429}) {
+		t.Errorf("isTransient() = false for 429, want true")
+	}
+	if isTransient(errors.New("boom")) {
+		t.Errorf("isTransient() = true for a plain error, want false")
+	}
+}
+
+func TestIsUnauthorized(t *testing.T) {
+	unauthorized := gophercloud.ErrUnexpectedResponseCode{Actual: 401}
+	if !isUnauthorized(unauthorized) {
+		t.Errorf("isUnauthorized() = false for 401, want true")
+	}
+	if !isUnauthorized(&gophercloud.ErrErrorAfterReauthentication{ErrOriginal: unauthorized}) {
+		t.Errorf("isUnauthorized() = false for 401 after re-authentication, want true")
+	}
+	if isUnauthorized(gophercloud.ErrUnexpectedResponseCode{Actual: 503}) {
+		t.Errorf("isUnauthorized() = true for 503, want false")
+	}
+}
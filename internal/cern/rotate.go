@@ -0,0 +1,145 @@
+package cern
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/log"
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/pkg/config"
+)
+
+// credentialRotationDelay is how long the credential files must be left alone before the session
+// is rebuilt, so a rotation writing several files, or a file in several steps, is handled once.
+const credentialRotationDelay = time.Second
+
+// credentialFiles returns the files holding the OpenStack credentials of the configured auth type.
+func credentialFiles(cfg *config.Config) []string {
+	var files []string
+	switch cfg.OpenStackAuthType {
+	case "", AuthTypePassword:
+		if cfg.OpenStackPassword == "" && cfg.OpenStackPasswordFile != "" {
+			files = append(files, cfg.OpenStackPasswordFile)
+		}
+	case AuthTypeKerberos:
+		files = append(files, cfg.OpenStackKeytab)
+	case AuthTypeOIDCAccessToken:
+		if cfg.OpenStackAccessToken == "" && cfg.OpenStackAccessTokenFile != "" {
+			files = append(files, cfg.OpenStackAccessTokenFile)
+		}
+	}
+	return files
+}
+
+// WatchCredentials watches the files holding the OpenStack credentials, e.g. a Kubernetes Secret
+// rotated by Vault or a secret manager, and rebuilds the session of the client with the new
+// credentials once their content changes, so the rotation does not require a restart. It returns
+// without watching anything when the credentials are not read from files.
+//
+// The directories of the files are watched rather than the files themselves, as Kubernetes
+// updates a mounted Secret by swapping a symbolic link to a new directory. The watch stops when
+// the context is cancelled.
+func WatchCredentials(ctx context.Context, client *Client, cfg *config.Config) error {
+	files := credentialFiles(cfg)
+	if len(files) == 0 {
+		return nil
+	}
+
+	return watchFiles(ctx, files, credentialRotationDelay, func(ctx context.Context) {
+		rotateCredentials(ctx, cfg, client.Reconnect)
+	})
+}
+
+// rotateCredentials scrubs the rotated credentials from the logs, before anything may log them, and
+// rebuilds the session with reconnect.
+func rotateCredentials(ctx context.Context, cfg *config.Config, reconnect func(context.Context) error) {
+	log.AddSecret(CredentialSecrets(cfg)...)
+	if err := reconnect(ctx); err != nil {
+		log.FromContext(ctx).Error("Failed to rebuild the OpenStack session with the rotated credentials: %v", err)
+		return
+	}
+	log.FromContext(ctx).Info("Rebuilt the OpenStack session with the rotated credentials")
+}
+
+// watchFiles calls onChange, in a goroutine of its own, whenever the content of some of the files
+// changed and the files were then left alone for delay. The files are read again every delay while
+// some of them cannot be read, e.g. in the middle of their rotation, so the change is reported once
+// they can be read again even when that raises no event of their directories.
+func watchFiles(ctx context.Context, files []string, delay time.Duration, onChange func(context.Context)) error {
+	digests, err := fileDigests(files)
+	if err != nil {
+		return err
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to create the file watcher: %w", err)
+	}
+	watched := make(map[string]bool, len(files))
+	for _, file := range files {
+		dir := filepath.Dir(file)
+		if watched[dir] {
+			continue
+		}
+		if err := watcher.Add(dir); err != nil {
+			_ = watcher.Close()
+			return fmt.Errorf("failed to watch %s: %w", dir, err)
+		}
+		watched[dir] = true
+	}
+
+	go func() {
+		defer watcher.Close()
+
+		timer := time.NewTimer(delay)
+		timer.Stop()
+		defer timer.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case _, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				timer.Reset(delay)
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				log.FromContext(ctx).Warn("Error watching the credential files: %v", err)
+			case <-timer.C:
+				current, err := fileDigests(files)
+				if err != nil {
+					log.FromContext(ctx).Debug("Credential files not readable yet: %v", err)
+					timer.Reset(delay)
+					continue
+				}
+				if maps.Equal(current, digests) {
+					continue
+				}
+				digests = current
+				onChange(ctx)
+			}
+		}
+	}()
+	return nil
+}
+
+// fileDigests returns the SHA-256 digest of the content of every file.
+func fileDigests(files []string) (map[string][sha256.Size]byte, error) {
+	digests := make(map[string][sha256.Size]byte, len(files))
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", file, err)
+		}
+		digests[file] = sha256.Sum256(data)
+	}
+	return digests, nil
+}
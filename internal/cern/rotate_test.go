@@ -0,0 +1,184 @@
+package cern
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/log"
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/pkg/config"
+)
+
+func TestCredentialFiles(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  *config.Config
+		want []string
+	}{
+		{
+			name: "password file",
+			cfg:  &config.Config{OpenStackAuthType: AuthTypePassword, OpenStackPasswordFile: "/secrets/password"},
+			want: []string{"/secrets/password"},
+		},
+		{
+			name: "password set directly",
+			cfg:  &config.Config{OpenStackAuthType: AuthTypePassword, OpenStackPassword: "secret", OpenStackPasswordFile: "/secrets/password"},
+		},
+		{
+			name: "keytab",
+			cfg:  &config.Config{OpenStackAuthType: AuthTypeKerberos, OpenStackKeytab: "/secrets/keytab", OpenStackPasswordFile: "/secrets/password"},
+			want: []string{"/secrets/keytab"},
+		},
+		{
+			name: "access token file",
+			cfg:  &config.Config{OpenStackAuthType: AuthTypeOIDCAccessToken, OpenStackAccessTokenFile: "/secrets/token"},
+			want: []string{"/secrets/token"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := credentialFiles(tt.cfg); !slices.Equal(got, tt.want) {
+				t.Errorf("credentialFiles() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRotateCredentialsRedactsFileSecrets(t *testing.T) {
+	dir := t.TempDir()
+	passwordFile := filepath.Join(dir, "password")
+	if err := os.WriteFile(passwordFile, []byte("rotated-file-password\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config.Config{OpenStackAuthType: AuthTypePassword, OpenStackPasswordFile: passwordFile}
+	if got := CredentialSecrets(cfg); !slices.Equal(got, []string{"rotated-file-password"}) {
+		t.Fatalf("CredentialSecrets() = %v, want the content of the password file", got)
+	}
+
+	// The password only exists in the file: it is scrubbed once rotated, even from the messages
+	// logged while reconnecting with it.
+	var buf bytes.Buffer
+	ctx := log.NewContext(context.Background(), log.NewLoggerWithOptions(log.Options{Level: log.LevelDebug, Output: &buf}))
+	rotateCredentials(ctx, cfg, func(ctx context.Context) error {
+		log.FromContext(ctx).Debug("authenticating with password rotated-file-password")
+		return nil
+	})
+	if strings.Contains(buf.String(), "rotated-file-password") {
+		t.Errorf("output = %q leaks the password of the file", buf.String())
+	}
+	if !strings.Contains(buf.String(), "authenticating with password "+log.Redacted) {
+		t.Errorf("output = %q, want the redacted password", buf.String())
+	}
+}
+
+func TestWatchFiles(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "password")
+	writeFile(t, file, "old")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changes := make(chan struct{}, 10)
+	err := watchFiles(ctx, []string{file}, 10*time.Millisecond, func(context.Context) { changes <- struct{}{} })
+	if err != nil {
+		t.Fatalf("watchFiles() error = %v", err)
+	}
+
+	// Rewriting the same content is not a rotation.
+	writeFile(t, file, "old")
+	expectNoChange(t, changes)
+
+	writeFile(t, file, "new")
+	expectChange(t, changes)
+}
+
+// TestWatchFilesSecretMount rotates the file the way Kubernetes updates a mounted Secret, by
+// swapping the symbolic link to the directory holding the data.
+func TestWatchFilesSecretMount(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "..v1", "password"), "old")
+	symlink(t, "..v1", filepath.Join(dir, "..data"))
+	symlink(t, filepath.Join("..data", "password"), filepath.Join(dir, "password"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changes := make(chan struct{}, 10)
+	err := watchFiles(ctx, []string{filepath.Join(dir, "password")}, 10*time.Millisecond, func(context.Context) { changes <- struct{}{} })
+	if err != nil {
+		t.Fatalf("watchFiles() error = %v", err)
+	}
+
+	writeFile(t, filepath.Join(dir, "..v2", "password"), "new")
+	symlink(t, "..v2", filepath.Join(dir, "..data_tmp"))
+	if err := os.Rename(filepath.Join(dir, "..data_tmp"), filepath.Join(dir, "..data")); err != nil {
+		t.Fatal(err)
+	}
+	expectChange(t, changes)
+}
+
+// TestWatchFilesTemporarilyRemoved removes the file a watched symbolic link points to, outside of the
+// watched directory, and restores it with new content, which raises no event of the watched
+// directory: the file is read again until it can be.
+func TestWatchFilesTemporarilyRemoved(t *testing.T) {
+	dir, target := t.TempDir(), filepath.Join(t.TempDir(), "password")
+	writeFile(t, target, "old")
+	symlink(t, target, filepath.Join(dir, "password"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changes := make(chan struct{}, 10)
+	err := watchFiles(ctx, []string{filepath.Join(dir, "password")}, 10*time.Millisecond, func(context.Context) { changes <- struct{}{} })
+	if err != nil {
+		t.Fatalf("watchFiles() error = %v", err)
+	}
+
+	if err := os.Remove(target); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(dir, "other"), "event")
+	expectNoChange(t, changes)
+
+	writeFile(t, target, "new")
+	expectChange(t, changes)
+}
+
+func writeFile(t *testing.T, name, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(name, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func symlink(t *testing.T, target, name string) {
+	t.Helper()
+	if err := os.Symlink(target, name); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func expectChange(t *testing.T, changes <-chan struct{}) {
+	t.Helper()
+	select {
+	case <-changes:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the change of the file was not reported")
+	}
+}
+
+func expectNoChange(t *testing.T, changes <-chan struct{}) {
+	t.Helper()
+	select {
+	case <-changes:
+		t.Fatal("a change was reported for an unchanged file")
+	case <-time.After(200 * time.Millisecond):
+	}
+}
@@ -0,0 +1,47 @@
+package cern
+
+import (
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/metrics"
+)
+
+// observeAliasUsage exports the number of managed names and of aliases carried by the ingress
+// nodes, overall and per node, along with the metadata keys they use, from their current metadata.
+//
+// With a positive maxItems, the Nova quota of metadata items of a server, the share of that capacity
+// used by the `landb-alias*` keys of every node is exported too, both in keys and in characters.
+//
+// The per-node series are rebuilt from scratch, so the nodes that left the ingress set are dropped.
+func observeAliasUsage(nodes []IngressNode, maxItems int) {
+	names := make(map[string]struct{})
+	aliases := 0
+
+	metrics.NodeAliases.Reset()
+	metrics.NodeMetadataKeys.Reset()
+	metrics.NodeMetadataKeysUtilization.Reset()
+	metrics.NodeMetadataLengthUtilization.Reset()
+	for _, node := range nodes {
+		nodeAliases := unpackAliases(node.Metadata)
+		for _, alias := range nodeAliases {
+			if name, _, ok := parseAlias(alias); ok {
+				names[name] = struct{}{}
+			}
+		}
+		aliases += len(nodeAliases)
+		metrics.NodeAliases.WithLabelValues(node.Name).Set(float64(len(nodeAliases)))
+		keys := aliasMetadata(node.Metadata)
+		metrics.NodeMetadataKeys.WithLabelValues(node.Name).Set(float64(len(keys)))
+		if maxItems <= 0 {
+			continue
+		}
+
+		length := 0
+		for _, value := range keys {
+			length += len(value)
+		}
+		metrics.NodeMetadataKeysUtilization.WithLabelValues(node.Name).Set(float64(len(keys)) / float64(maxItems))
+		metrics.NodeMetadataLengthUtilization.WithLabelValues(node.Name).Set(float64(length) / float64(maxItems*maxMetadataLength))
+	}
+
+	metrics.ManagedNames.Set(float64(len(names)))
+	metrics.Aliases.Set(float64(aliases))
+}
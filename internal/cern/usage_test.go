@@ -0,0 +1,63 @@
+package cern
+
+import (
+	"testing"
+
+	"github.com/gophercloud/gophercloud/v2/openstack/compute/v2/servers"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/metrics"
+)
+
+func TestObserveAliasUsage(t *testing.T) {
+	observeAliasUsage([]IngressNode{{Server: servers.Server{Name: "departed"}}}, 4)
+	observeAliasUsage([]IngressNode{
+		{Server: servers.Server{Name: "node-a", Metadata: map[string]string{
+			"landb-alias":  "foo.cern.ch--load-0-,bar.cern.ch--load-0-",
+			"landb-alias2": "baz.cern.ch--load-0-",
+			"owner":        "cluster-a",
+		}}},
+		{Server: servers.Server{Name: "node-b", Metadata: map[string]string{
+			"landb-alias": "foo.cern.ch--load-1-",
+		}}},
+		{Server: servers.Server{Name: "node-c"}},
+	}, 4)
+
+	tests := []struct {
+		name     string
+		got      float64
+		expected float64
+	}{
+		{name: "managed names", got: testutil.ToFloat64(metrics.ManagedNames), expected: 3},
+		{name: "aliases", got: testutil.ToFloat64(metrics.Aliases), expected: 4},
+		{name: "node-a aliases", got: testutil.ToFloat64(metrics.NodeAliases.WithLabelValues("node-a")), expected: 3},
+		{name: "node-a keys", got: testutil.ToFloat64(metrics.NodeMetadataKeys.WithLabelValues("node-a")), expected: 2},
+		{name: "node-b aliases", got: testutil.ToFloat64(metrics.NodeAliases.WithLabelValues("node-b")), expected: 1},
+		{name: "node-c keys", got: testutil.ToFloat64(metrics.NodeMetadataKeys.WithLabelValues("node-c")), expected: 0},
+		{name: "node-a keys utilization", got: testutil.ToFloat64(metrics.NodeMetadataKeysUtilization.WithLabelValues("node-a")), expected: 0.5},
+		{name: "node-a length utilization", got: testutil.ToFloat64(metrics.NodeMetadataLengthUtilization.WithLabelValues("node-a")), expected: 61.0 / (4 * 254)},
+		{name: "node-c length utilization", got: testutil.ToFloat64(metrics.NodeMetadataLengthUtilization.WithLabelValues("node-c")), expected: 0},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.expected {
+			t.Errorf("%s = %v, want %v", tt.name, tt.got, tt.expected)
+		}
+	}
+
+	// The departed node is not reported anymore.
+	if got := testutil.CollectAndCount(metrics.NodeAliases); got != 3 {
+		t.Errorf("%d node alias series, want 3", got)
+	}
+}
+
+func TestObserveAliasUsageWithoutQuota(t *testing.T) {
+	observeAliasUsage([]IngressNode{{Server: servers.Server{Name: "node-a", Metadata: map[string]string{
+		"landb-alias": "foo.cern.ch--load-0-",
+	}}}}, 0)
+
+	if got := testutil.CollectAndCount(metrics.NodeMetadataKeysUtilization); got != 0 {
+		t.Errorf("%d keys utilization series without a quota, want 0", got)
+	}
+	if got := testutil.ToFloat64(metrics.NodeMetadataKeys.WithLabelValues("node-a")); got != 1 {
+		t.Errorf("node-a keys = %v, want 1", got)
+	}
+}
@@ -0,0 +1,58 @@
+package cern
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// maxDNSNameLength is the maximum length of a DNS name, without its trailing dot.
+	maxDNSNameLength = 253
+	// maxDNSLabelLength is the maximum length of a single DNS label.
+	maxDNSLabelLength = 63
+)
+
+// ValidateAlias checks that a DNS name can be written as a LanDB alias.
+//
+// LanDB silently ignores malformed aliases, so the names are checked up front: only letters,
+// digits and hyphens are allowed, labels cannot start or end with a hyphen and are at most 63
+// characters long, and the generated `<name>--load-<N>-` alias must fit in a single metadata value.
+func ValidateAlias(dnsName string) error {
+	name := strings.TrimSuffix(dnsName, ".")
+	if name == "" {
+		return fmt.Errorf("alias name is empty")
+	}
+	if len(name) > maxDNSNameLength {
+		return fmt.Errorf("alias %q is longer than %d characters", name, maxDNSNameLength)
+	}
+	if strings.Contains(name, "--load-") {
+		return fmt.Errorf("alias %q contains the reserved sequence %q", name, "--load-")
+	}
+	// The load index is at most as long as the number of nodes, three digits leaves plenty of room.
+	if alias := formatAlias(name, 999); len(alias) > maxMetadataLength {
+		return fmt.Errorf("alias %q does not fit in a %d-character metadata value", alias, maxMetadataLength)
+	}
+
+	for _, label := range strings.Split(name, ".") {
+		if label == "" {
+			return fmt.Errorf("alias %q contains an empty label", name)
+		}
+		if len(label) > maxDNSLabelLength {
+			return fmt.Errorf("alias %q has a label longer than %d characters: %q", name, maxDNSLabelLength, label)
+		}
+		if strings.HasPrefix(label, "-") || strings.HasSuffix(label, "-") {
+			return fmt.Errorf("alias %q has a label starting or ending with a hyphen: %q", name, label)
+		}
+		for _, c := range label {
+			if !isAliasChar(c) {
+				return fmt.Errorf("alias %q contains the invalid character %q", name, c)
+			}
+		}
+	}
+	return nil
+}
+
+// isAliasChar reports whether c is allowed in a LanDB alias label.
+func isAliasChar(c rune) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || c == '-'
+}
@@ -0,0 +1,35 @@
+package cern
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateAlias(t *testing.T) {
+	tests := []struct {
+		name    string
+		dnsName string
+		wantErr bool
+	}{
+		{name: "Valid", dnsName: "my-app.cern.ch", wantErr: false},
+		{name: "Trailing dot", dnsName: "my-app.cern.ch.", wantErr: false},
+		{name: "Uppercase", dnsName: "MY-APP.cern.ch", wantErr: false},
+		{name: "Empty", dnsName: "", wantErr: true},
+		{name: "Wildcard", dnsName: "*.cern.ch", wantErr: true},
+		{name: "Underscore", dnsName: "my_app.cern.ch", wantErr: true},
+		{name: "Empty label", dnsName: "my-app..cern.ch", wantErr: true},
+		{name: "Leading hyphen", dnsName: "-app.cern.ch", wantErr: true},
+		{name: "Trailing hyphen", dnsName: "app-.cern.ch", wantErr: true},
+		{name: "Long label", dnsName: strings.Repeat("a", 64) + ".cern.ch", wantErr: true},
+		{name: "Long name", dnsName: strings.Repeat("a.", 124) + "cern.ch", wantErr: true},
+		{name: "Reserved sequence", dnsName: "app--load-1.cern.ch", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateAlias(tt.dnsName); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateAlias(%q) error = %v, wantErr %v", tt.dnsName, err, tt.wantErr)
+			}
+		})
+	}
+}
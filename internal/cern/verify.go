@@ -0,0 +1,73 @@
+package cern
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/log"
+)
+
+// MetadataMismatchError is returned when the metadata of a node read back after a write does not
+// match the desired state.
+//
+// Nova occasionally accepts a metadata write and drops it under load, so a successful write call
+// does not guarantee that the aliases were stored.
+type MetadataMismatchError struct {
+	// Server is the name of the server.
+	Server string
+	// Update holds the desired values of the keys that are missing or hold another value.
+	Update map[string]string
+	// Delete lists the keys that are still present although they should have been deleted.
+	Delete []string
+}
+
+// Error implements the error interface.
+func (e *MetadataMismatchError) Error() string {
+	keys := make([]string, 0, len(e.Update))
+	for key := range e.Update {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return fmt.Sprintf("metadata of server %s does not match the desired state: keys %v missing or different, keys %v not deleted", e.Server, keys, e.Delete)
+}
+
+// getNodeMetadata reads the current metadata of a server, bypassing the server cache.
+func (m *Manager) getNodeMetadata(ctx context.Context, serverID string) (map[string]string, error) {
+	var metadata map[string]string
+	err := m.do(ctx, OperationGetMetadata, func() error {
+		var err error
+		metadata, err = m.compute.GetMetadata(ctx, serverID)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get metadata for server %s: %w", serverID, err)
+	}
+	return metadata, nil
+}
+
+// verifyNodeMetadata reads the metadata of a node back after a write and compares its managed
+// keys with the desired ones. Keys that do not match are written again, up to the configured
+// number of reads, after which a *MetadataMismatchError reports the exact keys left behind.
+func (m *Manager) verifyNodeMetadata(ctx context.Context, node IngressNode, desired map[string]string) error {
+	for attempt := 1; ; attempt++ {
+		metadata, err := m.getNodeMetadata(ctx, node.ID)
+		if err != nil {
+			return err
+		}
+
+		toUpdate, toDelete := DiffMetadata(managedMetadata(metadata), desired)
+		if len(toUpdate) == 0 && len(toDelete) == 0 {
+			return nil
+		}
+
+		mismatch := &MetadataMismatchError{Server: node.Name, Update: toUpdate, Delete: toDelete}
+		if attempt >= m.verifyAttempts {
+			return mismatch
+		}
+		log.FromContext(ctx).Warn("%v, writing it again (read %d/%d)", mismatch, attempt, m.verifyAttempts)
+		if err := m.UpdateNodeMetadata(ctx, node.ID, toUpdate, toDelete); err != nil {
+			return err
+		}
+	}
+}
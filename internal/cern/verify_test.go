@@ -0,0 +1,90 @@
+package cern
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gophercloud/gophercloud/v2"
+)
+
+// newMetadataServer serves the metadata of server "id" from a map, applying the writes only after
+// the first dropped writes have been silently discarded. Deletes are always applied.
+func newMetadataServer(t *testing.T, metadata map[string]string, dropped int) *Manager {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/servers/id/metadata":
+		case r.Method == http.MethodPost && r.URL.Path == "/servers/id/metadata":
+			var body struct {
+				Metadata map[string]string `json:"metadata"`
+			}
+			_ = json.NewDecoder(r.Body).Decode(&body)
+			if dropped > 0 {
+				dropped--
+				break
+			}
+			for key, value := range body.Metadata {
+				metadata[key] = value
+			}
+		case r.Method == http.MethodDelete && strings.HasPrefix(r.URL.Path, "/servers/id/metadata/"):
+			delete(metadata, strings.TrimPrefix(r.URL.Path, "/servers/id/metadata/"))
+			w.WriteHeader(http.StatusNoContent)
+			return
+		default:
+			http.NotFound(w, r)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"metadata": metadata})
+	}))
+	t.Cleanup(server.Close)
+
+	compute := &gophercloud.ServiceClient{ProviderClient: &gophercloud.ProviderClient{}, Endpoint: server.URL + "/"}
+	client := &Client{compute: compute}
+	return &Manager{compute: client, client: client, retry: retryPolicy{maxAttempts: 1}, verifyAttempts: 2}
+}
+
+func TestManagerVerifyNodeMetadata(t *testing.T) {
+	desired := map[string]string{"landb-alias": "a--load-1-", OwnerMetadataKey: "default"}
+	node := IngressNode{}
+	node.ID = "id"
+	node.Name = "node-1"
+
+	t.Run("Matching metadata", func(t *testing.T) {
+		metadata := map[string]string{"landb-alias": "a--load-1-", OwnerMetadataKey: "default", "other": "x"}
+		m := newMetadataServer(t, metadata, 0)
+		if err := m.verifyNodeMetadata(context.Background(), node, desired); err != nil {
+			t.Errorf("verifyNodeMetadata() error = %v", err)
+		}
+	})
+
+	t.Run("Dropped write is written again", func(t *testing.T) {
+		metadata := map[string]string{}
+		m := newMetadataServer(t, metadata, 0)
+		if err := m.verifyNodeMetadata(context.Background(), node, desired); err != nil {
+			t.Errorf("verifyNodeMetadata() error = %v", err)
+		}
+		if !reflect.DeepEqual(metadata, desired) {
+			t.Errorf("metadata = %v, want %v", metadata, desired)
+		}
+	})
+
+	t.Run("Mismatch is reported", func(t *testing.T) {
+		metadata := map[string]string{"landb-alias": "b--load-1-"}
+		m := newMetadataServer(t, metadata, 1)
+		err := m.verifyNodeMetadata(context.Background(), node, desired)
+
+		var mismatch *MetadataMismatchError
+		if !errors.As(err, &mismatch) {
+			t.Fatalf("verifyNodeMetadata() error = %v, want a *MetadataMismatchError", err)
+		}
+		if !reflect.DeepEqual(mismatch.Update, desired) || len(mismatch.Delete) != 0 {
+			t.Errorf("mismatch = %+v, want update %v", mismatch, desired)
+		}
+	})
+}
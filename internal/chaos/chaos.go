@@ -0,0 +1,107 @@
+// Package chaos injects failures and latency into the calls to the external APIs, so the retry
+// behaviour of ExternalDNS and the partial-failure handling of the webhook can be exercised in a
+// staging environment.
+package chaos
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ErrInjected is the error of the calls failed on purpose.
+var ErrInjected = errors.New("failure injected by chaos testing")
+
+// Injector decides which calls fail and how long each one is delayed.
+//
+// A nil Injector injects nothing, so callers can hold one unconditionally.
+type Injector struct {
+	// errorRate is the fraction of the calls that fail, between 0 and 1.
+	errorRate float64
+	// latency is the maximum delay added to every call, the actual delay being uniformly random.
+	latency time.Duration
+	// random returns a number in [0, 1), replaced in tests.
+	random func() float64
+}
+
+// New returns an injector failing the given fraction of the calls and delaying every call by up to
+// latency. It returns nil when both are zero.
+func New(errorRate float64, latency time.Duration) *Injector {
+	if errorRate <= 0 && latency <= 0 {
+		return nil
+	}
+	return &Injector{errorRate: errorRate, latency: latency, random: rand.Float64}
+}
+
+// Inject delays the call and decides whether it fails, returning ErrInjected if so. It returns the
+// error of the context when it is done before the delay elapses.
+func (i *Injector) Inject(ctx context.Context) error {
+	if i == nil {
+		return nil
+	}
+
+	if i.latency > 0 {
+		timer := time.NewTimer(time.Duration(i.random() * float64(i.latency)))
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+
+	if i.errorRate > 0 && i.random() < i.errorRate {
+		return ErrInjected
+	}
+	return nil
+}
+
+// Transport wraps base, answering the failed requests with a 503 Service Unavailable response so
+// they are handled like an outage of the API. Requests for which spare returns true are sent
+// unaltered; spare may be nil.
+func (i *Injector) Transport(base http.RoundTripper, spare func(*http.Request) bool) http.RoundTripper {
+	if i == nil {
+		return base
+	}
+	return &transport{base: base, injector: i, spare: spare}
+}
+
+// transport is the http.RoundTripper returned by Injector.Transport.
+type transport struct {
+	base     http.RoundTripper
+	injector *Injector
+	spare    func(*http.Request) bool
+}
+
+// RoundTrip delays the request, and either fails it or sends it.
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.spare != nil && t.spare(req) {
+		return t.base.RoundTrip(req)
+	}
+
+	err := t.injector.Inject(req.Context())
+	switch {
+	case errors.Is(err, ErrInjected):
+		if req.Body != nil {
+			_ = req.Body.Close()
+		}
+		return &http.Response{
+			Status:        "503 Service Unavailable",
+			StatusCode:    http.StatusServiceUnavailable,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        http.Header{"Content-Type": []string{"text/plain; charset=utf-8"}},
+			Body:          io.NopCloser(strings.NewReader(ErrInjected.Error())),
+			ContentLength: int64(len(ErrInjected.Error())),
+			Request:       req,
+		}, nil
+	case err != nil:
+		return nil, err
+	}
+	return t.base.RoundTrip(req)
+}
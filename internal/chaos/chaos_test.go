@@ -0,0 +1,92 @@
+package chaos
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestInject(t *testing.T) {
+	tests := []struct {
+		name      string
+		errorRate float64
+		random    float64
+		wantErr   error
+	}{
+		{name: "below the error rate", errorRate: 0.2, random: 0.1, wantErr: ErrInjected},
+		{name: "above the error rate", errorRate: 0.2, random: 0.5},
+		{name: "always", errorRate: 1, random: 0.99, wantErr: ErrInjected},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			injector := New(tt.errorRate, 0)
+			injector.random = func() float64 { return tt.random }
+			if err := injector.Inject(context.Background()); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Inject() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestInjectDisabled(t *testing.T) {
+	injector := New(0, 0)
+	if injector != nil {
+		t.Fatalf("New(0, 0) = %v, want nil", injector)
+	}
+	if err := injector.Inject(context.Background()); err != nil {
+		t.Errorf("Inject() error = %v, want nil", err)
+	}
+}
+
+func TestInjectLatency(t *testing.T) {
+	injector := New(0, 100*time.Millisecond)
+	injector.random = func() float64 { return 0.5 }
+
+	start := time.Now()
+	if err := injector.Inject(context.Background()); err != nil {
+		t.Fatalf("Inject() error = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("Inject() returned after %v, want at least 50ms", elapsed)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := injector.Inject(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("Inject() with a canceled context error = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestTransport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	injector := New(1, 0)
+	client := &http.Client{Transport: injector.Transport(http.DefaultTransport, func(r *http.Request) bool {
+		return r.URL.Path == "/spared"
+	})}
+
+	tests := []struct {
+		path string
+		want int
+	}{
+		{path: "/failed", want: http.StatusServiceUnavailable},
+		{path: "/spared", want: http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		resp, err := client.Get(server.URL + tt.path)
+		if err != nil {
+			t.Fatalf("GET %s error = %v", tt.path, err)
+		}
+		_ = resp.Body.Close()
+		if resp.StatusCode != tt.want {
+			t.Errorf("GET %s status = %d, want %d", tt.path, resp.StatusCode, tt.want)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+// Package health aggregates the health of the components of the webhook.
+//
+// Every component, e.g. the Kubernetes API or the OpenStack credentials, registers a check
+// reporting its status. The registry runs them all and derives the overall status, which backs the
+// /healthz endpoint, from the status of the critical components.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Status is the health status of a component, or of the webhook as a whole.
+type Status string
+
+const (
+	// StatusOK reports a healthy component, or that every component is healthy.
+	StatusOK Status = "ok"
+	// StatusDegraded reports that some non-critical components are failing.
+	StatusDegraded Status = "degraded"
+	// StatusFailing reports a failing component, or that some critical components are failing.
+	StatusFailing Status = "failing"
+)
+
+// checkTimeout bounds every check, so that a hanging dependency does not hang the probe.
+const checkTimeout = 5 * time.Second
+
+// Check reports the health of a component, returning nil when it is healthy.
+type Check func(ctx context.Context) error
+
+// Component is the health of a single component.
+type Component struct {
+	// Name is the name of the component, e.g. `kubernetes-api`.
+	Name string `json:"name"`
+	// Status is ok or failing.
+	Status Status `json:"status"`
+	// Critical reports whether the failure of the component fails the webhook as a whole.
+	Critical bool `json:"critical"`
+	// Error is the error of a failing component.
+	Error string `json:"error,omitempty"`
+}
+
+// Report is the health of the webhook, with the detail of every component.
+type Report struct {
+	// Status is ok when every component is healthy, degraded when only non-critical components
+	// fail, and failing when a critical component fails.
+	Status Status `json:"status"`
+	// Components holds the health of every component, in registration order.
+	Components []Component `json:"components"`
+}
+
+// Registry holds the health checks of the components.
+type Registry struct {
+	// critical holds the names of the critical components.
+	critical []string
+
+	// mu guards names and checks.
+	mu     sync.Mutex
+	names  []string
+	checks []Check
+}
+
+// NewRegistry creates a registry where the components with the given names are critical.
+func NewRegistry(critical []string) *Registry {
+	return &Registry{critical: critical}
+}
+
+// Register adds the check of a component.
+func (r *Registry) Register(name string, check Check) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.names = append(r.names, name)
+	r.checks = append(r.checks, check)
+}
+
+// Check runs the checks of every component and aggregates their results.
+//
+// The checks run concurrently, each within checkTimeout.
+func (r *Registry) Check(ctx context.Context) Report {
+	r.mu.Lock()
+	names, checks := slices.Clone(r.names), slices.Clone(r.checks)
+	r.mu.Unlock()
+
+	components := make([]Component, len(checks))
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			checkCtx, cancel := context.WithTimeout(ctx, checkTimeout)
+			defer cancel()
+
+			components[i] = Component{Name: names[i], Status: StatusOK, Critical: slices.Contains(r.critical, names[i])}
+			if err := check(checkCtx); err != nil {
+				components[i].Status = StatusFailing
+				components[i].Error = err.Error()
+			}
+		}()
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusOK, Components: components}
+	for _, component := range components {
+		switch {
+		case component.Status == StatusOK:
+		case component.Critical:
+			report.Status = StatusFailing
+		case report.Status == StatusOK:
+			report.Status = StatusDegraded
+		}
+	}
+	return report
+}
+
+// ServeHTTP serves the health report as JSON, with the 503 Service Unavailable status when a
+// critical component is failing.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	report := r.Check(req.Context())
+
+	w.Header().Set("Content-Type", "application/json")
+	if report.Status == StatusFailing {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	// The status is already sent, an encoding error can only be dropped.
+	_ = json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,72 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRegistry(t *testing.T) {
+	healthy := func(context.Context) error { return nil }
+	failing := func(context.Context) error { return errors.New("unreachable") }
+
+	tests := []struct {
+		name       string
+		checks     map[string]Check
+		wantStatus Status
+		wantCode   int
+	}{
+		{
+			name:       "all healthy",
+			checks:     map[string]Check{"kubernetes-api": healthy, "compute-api": healthy},
+			wantStatus: StatusOK,
+			wantCode:   http.StatusOK,
+		},
+		{
+			name:       "non-critical failing",
+			checks:     map[string]Check{"kubernetes-api": healthy, "compute-api": failing},
+			wantStatus: StatusDegraded,
+			wantCode:   http.StatusOK,
+		},
+		{
+			name:       "critical failing",
+			checks:     map[string]Check{"kubernetes-api": failing, "compute-api": failing},
+			wantStatus: StatusFailing,
+			wantCode:   http.StatusServiceUnavailable,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registry := NewRegistry([]string{"kubernetes-api"})
+			for _, name := range []string{"kubernetes-api", "compute-api"} {
+				registry.Register(name, tt.checks[name])
+			}
+
+			w := httptest.NewRecorder()
+			registry.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+			if w.Code != tt.wantCode {
+				t.Errorf("status code = %d, want %d", w.Code, tt.wantCode)
+			}
+
+			var report Report
+			if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+				t.Fatalf("body %q is not a JSON report: %v", w.Body.String(), err)
+			}
+			if report.Status != tt.wantStatus {
+				t.Errorf("status = %s, want %s", report.Status, tt.wantStatus)
+			}
+			if len(report.Components) != 2 || report.Components[0].Name != "kubernetes-api" || !report.Components[0].Critical || report.Components[1].Critical {
+				t.Fatalf("components = %+v, want kubernetes-api (critical) and compute-api", report.Components)
+			}
+			for _, component := range report.Components {
+				if (component.Status == StatusFailing) != (component.Error != "") {
+					t.Errorf("component %+v reports an error only when failing", component)
+				}
+			}
+		})
+	}
+}
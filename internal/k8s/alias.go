@@ -0,0 +1,149 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/log"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/tools/cache"
+)
+
+// CernAliasGroupVersion is the API group and version of the CernAlias custom resource.
+var CernAliasGroupVersion = schema.GroupVersion{Group: "webhook.cern.ch", Version: "v1alpha1"}
+
+// CernAliasResource is the cluster-scoped CernAlias resource, declaring per-alias settings.
+var CernAliasResource = CernAliasGroupVersion.WithResource("cernaliases")
+
+// CernAliasKind is the kind of the CernAlias custom resource.
+const CernAliasKind = "CernAlias"
+
+// CernAlias declares the settings of a single alias, as an alternative to the endpoint annotations.
+type CernAlias struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec CernAliasSpec `json:"spec"`
+}
+
+// CernAliasSpec holds the settings of an alias. Empty fields leave the settings coming from the
+// endpoint untouched.
+type CernAliasSpec struct {
+	// Alias is the DNS name the settings apply to.
+	Alias string `json:"alias"`
+	// NodeSelector restricts the alias to the ingress nodes matching a Kubernetes label selector.
+	NodeSelector string `json:"nodeSelector,omitempty"`
+	// Protected keeps the alias when ExternalDNS asks for its deletion.
+	Protected bool `json:"protected,omitempty"`
+	// Interface restricts the alias to the ingress nodes whose aliases are carried by the given
+	// LanDB interface.
+	Interface string `json:"interface,omitempty"`
+}
+
+// CernAliases returns the declared CernAlias resources, sorted by name.
+//
+// They are answered from a cache fed by an informer, started on the first call, which blocks until
+// the cache is synced. The CernAlias CRD must be installed.
+func (c *Client) CernAliases(ctx context.Context) ([]CernAlias, error) {
+	informer, err := c.cernAliasInformer(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var aliases []CernAlias
+	for _, obj := range informer.GetStore().List() {
+		alias, err := toCernAlias(obj)
+		if err != nil {
+			log.FromContext(ctx).Error("Ignoring invalid CernAlias: %v", err)
+			continue
+		}
+		aliases = append(aliases, *alias)
+	}
+	sort.Slice(aliases, func(i, j int) bool { return aliases[i].Name < aliases[j].Name })
+	return aliases, nil
+}
+
+// OnCernAliasesChange calls fn whenever a CernAlias is added, changed or removed. The resources
+// already present when the handler is added are ignored.
+//
+// fn is called from the informer goroutine and must not block.
+func (c *Client) OnCernAliasesChange(ctx context.Context, fn func(reason string)) error {
+	informer, err := c.cernAliasInformer(ctx)
+	if err != nil {
+		return err
+	}
+
+	_, err = informer.AddEventHandler(cache.ResourceEventHandlerDetailedFuncs{
+		AddFunc: func(obj any, isInInitialList bool) {
+			if !isInInitialList {
+				fn("cernalias " + objectName(obj) + " added")
+			}
+		},
+		UpdateFunc: func(_, newObj any) {
+			fn("cernalias " + objectName(newObj) + " changed")
+		},
+		DeleteFunc: func(obj any) {
+			fn("cernalias " + objectName(obj) + " removed")
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to watch cernaliases: %w", err)
+	}
+	return nil
+}
+
+// cernAliasInformer returns the CernAlias informer, starting it if needed.
+func (c *Client) cernAliasInformer(ctx context.Context) (cache.SharedIndexInformer, error) {
+	return c.dynamicInformer(ctx, CernAliasResource)
+}
+
+// dynamicInformer returns the informer of a custom resource, started and synced.
+func (c *Client) dynamicInformer(ctx context.Context, resource schema.GroupVersionResource) (cache.SharedIndexInformer, error) {
+	c.mu.Lock()
+	if c.dynamic == nil {
+		c.mu.Unlock()
+		return nil, fmt.Errorf("no dynamic client to watch %s", resource.Resource)
+	}
+	if c.dynamicFactory == nil {
+		c.dynamicFactory = dynamicinformer.NewDynamicSharedInformerFactory(c.dynamic, 0)
+	}
+	informer := c.dynamicFactory.ForResource(resource).Informer()
+
+	// The informers run for the lifetime of the process. Starting the factory only starts the
+	// informers registered since the last start.
+	c.dynamicFactory.Start(wait.NeverStop)
+	c.mu.Unlock()
+
+	if !cache.WaitForCacheSync(ctx.Done(), informer.HasSynced) {
+		return nil, fmt.Errorf("failed to sync the cache of %s: %w", resource.Resource, ctx.Err())
+	}
+	return informer, nil
+}
+
+// toCernAlias converts a CernAlias read through the dynamic client.
+func toCernAlias(obj any) (*CernAlias, error) {
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return nil, fmt.Errorf("unexpected object %T", obj)
+	}
+	var alias CernAlias
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u.Object, &alias); err != nil {
+		return nil, fmt.Errorf("failed to convert cernalias %s: %w", u.GetName(), err)
+	}
+	if alias.Spec.Alias == "" {
+		return nil, fmt.Errorf("cernalias %s has no alias", u.GetName())
+	}
+	return &alias, nil
+}
+
+// objectName returns the name of an informer object, including the final state of a deleted one.
+func objectName(obj any) string {
+	name, _ := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+	return name
+}
@@ -0,0 +1,45 @@
+package k8s
+
+import (
+	"context"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func testCernAlias(name string, spec map[string]any) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": CernAliasGroupVersion.String(),
+		"kind":       CernAliasKind,
+		"metadata":   map[string]any{"name": name},
+		"spec":       spec,
+	}}
+}
+
+func TestClientCernAliases(t *testing.T) {
+	listKinds := map[schema.GroupVersionResource]string{CernAliasResource: CernAliasKind + "List"}
+	c := newClient(fake.NewSimpleClientset())
+	c.dynamic = dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), listKinds,
+		testCernAlias("web", map[string]any{"alias": "web.cern.ch", "nodeSelector": "zone=a", "protected": true}),
+		testCernAlias("api", map[string]any{"alias": "api.cern.ch", "interface": "eth1"}),
+		testCernAlias("invalid", map[string]any{"nodeSelector": "zone=b"}),
+	)
+
+	aliases, err := c.CernAliases(context.Background())
+	if err != nil {
+		t.Fatalf("CernAliases() error = %v", err)
+	}
+	if len(aliases) != 2 {
+		t.Fatalf("CernAliases() = %v, want the 2 valid aliases", aliases)
+	}
+	if aliases[0].Spec != (CernAliasSpec{Alias: "api.cern.ch", Interface: "eth1"}) {
+		t.Errorf("CernAliases()[0] = %+v", aliases[0].Spec)
+	}
+	if aliases[1].Spec != (CernAliasSpec{Alias: "web.cern.ch", NodeSelector: "zone=a", Protected: true}) {
+		t.Errorf("CernAliases()[1] = %+v", aliases[1].Spec)
+	}
+}
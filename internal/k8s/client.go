@@ -3,93 +3,324 @@ package k8s
 import (
 	"context"
 	"fmt"
+	"net/http"
 	"os"
-	"strings"
-
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/chaos"
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/tracing"
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/pkg/config"
+	"go.opentelemetry.io/otel/attribute"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/informers"
+	informersv1 "k8s.io/client-go/informers/core/v1"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/clientcmd"
 )
 
 // Client wraps the Kubernetes client.
 type Client struct {
 	clientset kubernetes.Interface
+	// dynamic reads the custom resources, nil when unavailable.
+	dynamic dynamic.Interface
+
+	// mu guards nodeInformers. It is not held while the caches sync, so a slow informer does not
+	// hold back the others.
+	mu sync.Mutex
+	// nodeInformers holds a shared informer per label selector, watching the nodes matching the
+	// selector and feeding a node cache.
+	nodeInformers map[string]informersv1.NodeInformer
+
+	// discovery is the node discovery mode.
+	discovery string
+	// serviceNamespace and serviceName identify the ingress Service in the service and endpointslice
+	// discovery modes.
+	serviceNamespace, serviceName string
+	// workloadNamespace, workloadKind and workloadName identify the ingress controller workload in
+	// the workload discovery mode.
+	workloadNamespace, workloadKind, workloadName string
+	// namespaceFactories holds an informer factory per namespace, feeding the caches of the
+	// namespaced objects used by the discovery modes. They are started on first use and guarded by mu.
+	namespaceFactories map[string]informers.SharedInformerFactory
+	// dynamicFactory feeds the caches of the custom resources, i.e. CernAliases and DNSEndpoints.
+	// It is started on first use and guarded by mu.
+	dynamicFactory dynamicinformer.DynamicSharedInformerFactory
+
+	// reachMu guards the result of the last reachability check.
+	reachMu        sync.Mutex
+	reachCheckedAt time.Time
+	reachErr       error
+}
+
+// namespaceInformers returns the informer factory of a namespace, with the given informers
+// registered, started and synced.
+func (c *Client) namespaceInformers(ctx context.Context, namespace string, informerOf ...func(informers.SharedInformerFactory) cache.SharedIndexInformer) (informers.SharedInformerFactory, error) {
+	c.mu.Lock()
+	factory, ok := c.namespaceFactories[namespace]
+	if !ok {
+		factory = informers.NewSharedInformerFactoryWithOptions(c.clientset, 0, informers.WithNamespace(namespace))
+		c.namespaceFactories[namespace] = factory
+	}
+
+	synced := make([]cache.InformerSynced, len(informerOf))
+	for i, informer := range informerOf {
+		synced[i] = informer(factory).HasSynced
+	}
+
+	// The informers run for the lifetime of the process. Starting a factory only starts the
+	// informers registered since the last start.
+	factory.Start(wait.NeverStop)
+	c.mu.Unlock()
+
+	if !cache.WaitForCacheSync(ctx.Done(), synced...) {
+		return nil, fmt.Errorf("failed to sync the caches of namespace %s: %w", namespace, ctx.Err())
+	}
+	return factory, nil
 }
 
 // NewClient creates a new Kubernetes client.
-// It tries to use the in-cluster config first, and falls back to KUBECONFIG if set.
-func NewClient() (*Client, error) {
-	var config *rest.Config
+// It tries to use the in-cluster config first, and falls back to KUBECONFIG if set. With the fake
+// backend, the objects of a static file are served instead.
+// The client-side rate limit of the API requests is taken from the application configuration.
+func NewClient(cfg *config.Config) (*Client, error) {
+	if cfg.KubeBackend == KubeBackendFake {
+		clientset, dynamicClient, err := NewFakeClients(cfg.KubeFakeObjects)
+		if err != nil {
+			return nil, err
+		}
+		if injector := chaos.New(cfg.ChaosK8sErrorRate, cfg.ChaosK8sLatency); injector != nil {
+			clientset.PrependReactor("*", "*", chaosReactor(injector))
+			dynamicClient.PrependReactor("*", "*", chaosReactor(injector))
+		}
+		c := newClient(clientset)
+		c.dynamic = dynamicClient
+		return configure(c, cfg)
+	}
+
+	var restConfig *rest.Config
 	var err error
 
 	// Try to load from KUBECONFIG environment variable first (for local dev)
 	if kubeConfigPath := os.Getenv("KUBECONFIG"); kubeConfigPath != "" {
-		config, err = clientcmd.BuildConfigFromFlags("", kubeConfigPath)
+		restConfig, err = clientcmd.BuildConfigFromFlags("", kubeConfigPath)
 	} else {
 		// Fallback to in-cluster config
-		config, err = rest.InClusterConfig()
+		restConfig, err = rest.InClusterConfig()
 	}
 
 	if err != nil {
 		return nil, fmt.Errorf("failed to load kubernetes config: %w", err)
 	}
 
-	clientset, err := kubernetes.NewForConfig(config)
+	restConfig.QPS = cfg.KubeAPIQPS
+	restConfig.Burst = cfg.KubeAPIBurst
+	if injector := chaos.New(cfg.ChaosK8sErrorRate, cfg.ChaosK8sLatency); injector != nil {
+		restConfig.Wrap(func(rt http.RoundTripper) http.RoundTripper {
+			return injector.Transport(rt, nil)
+		})
+	}
+
+	clientset, err := kubernetes.NewForConfig(restConfig)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create kubernetes clientset: %w", err)
 	}
 
-	return &Client{clientset: clientset}, nil
-}
-
-// GetIngressNodeNames retrieves the names of nodes matching the label.
-
-func (c *Client) GetIngressNodeNames(ctx context.Context, labelSelector string) ([]string, error) {
-
-	// Parse label selector? For simplicity, we assume the input is "key=value" or just "key".
-
-	// The standard metav1.ListOptions expects a string like "key=value,key2=value2".
-
-	// The config passes just the key (default "node-role.kubernetes.io/ingress").
-
-	// We need to construct a selector "key=true" or "key exists".
-
-	// If the label is just a key (no '='), we assume existence check.
-
-	var selector string
-
-	if strings.Contains(labelSelector, "=") {
-
-		selector = labelSelector
-
-	} else {
-
-		selector = fmt.Sprintf("%s", labelSelector) // Existence check: just the key name works in some clients, but standard is "key" or "!key".
+	dynamicClient, err := dynamic.NewForConfig(restConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create kubernetes dynamic client: %w", err)
+	}
 
-		// Actually for existence: "key".
+	c := newClient(clientset)
+	c.dynamic = dynamicClient
+	return configure(c, cfg)
+}
 
+// chaosReactor returns a reactor of the fake clients failing or delaying some of the calls, as the
+// failure injection does for the requests of the cluster clients.
+func chaosReactor(injector *chaos.Injector) k8stesting.ReactionFunc {
+	return func(k8stesting.Action) (bool, runtime.Object, error) {
+		if err := injector.Inject(context.Background()); err != nil {
+			return true, nil, apierrors.NewServiceUnavailable(err.Error())
+		}
+		return false, nil, nil
 	}
+}
 
-	nodes, err := c.clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{
+// configure sets the node discovery mode of a client from the application configuration.
+func configure(c *Client, cfg *config.Config) (*Client, error) {
+	var err error
+	c.discovery = cfg.NodeDiscovery
+	c.serviceNamespace, c.serviceName = splitNamespacedName(cfg.IngressService)
+	if cfg.NodeDiscovery == DiscoveryWorkload {
+		c.workloadNamespace, c.workloadKind, c.workloadName, err = ParseWorkload(cfg.IngressWorkload)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
 
-		LabelSelector: selector,
-	})
+// newClient creates a client backed by the given clientset.
+func newClient(clientset kubernetes.Interface) *Client {
+	return &Client{
+		clientset:          clientset,
+		nodeInformers:      make(map[string]informersv1.NodeInformer),
+		namespaceFactories: make(map[string]informers.SharedInformerFactory),
+		discovery:          DiscoveryLabel,
+	}
+}
 
+// GetIngressNodes retrieves the ingress nodes, sorted by name: the nodes matching any of the label
+// selectors, narrowed down by the node discovery mode.
+//
+// Each selector uses the full Kubernetes syntax: equality and set-based requirements, existence
+// checks and several comma-separated requirements, e.g. `role=ingress,zone in (a,b),!legacy`.
+// Several selectors are ORed, which eases migrations between labeling schemes.
+//
+// The nodes are answered from caches fed by an informer per selector, watching the nodes matching
+// it, so the API server is not listed on every ExternalDNS poll. The informer is started on the
+// first call for a selector, which blocks until its cache is synced.
+func (c *Client) GetIngressNodes(ctx context.Context, labelSelectors []string) (nodes []corev1.Node, err error) {
+	ctx, span := tracing.Start(ctx, "k8s.GetIngressNodes", attribute.String("discovery", c.discovery))
+	defer func() {
+		span.SetAttributes(attribute.Int("nodes", len(nodes)))
+		tracing.End(span, err)
+	}()
+
+	nodes, err = c.labeledNodes(ctx, labelSelectors)
 	if err != nil {
+		return nil, err
+	}
 
-		return nil, fmt.Errorf("failed to list nodes with selector %q: %w", selector, err)
-
+	switch c.discovery {
+	case DiscoveryService:
+		return c.serviceNodes(ctx, nodes)
+	case DiscoveryEndpointSlice:
+		return c.endpointSliceNodes(ctx, nodes)
+	case DiscoveryWorkload:
+		return c.workloadNodes(ctx, nodes)
+	default:
+		return nodes, nil
 	}
+}
 
-	var names []string
+// labeledNodes retrieves the nodes matching any of the label selectors, sorted by name.
+func (c *Client) labeledNodes(ctx context.Context, labelSelectors []string) ([]corev1.Node, error) {
+	var nodes []corev1.Node
+	seen := make(map[string]struct{})
+	for _, labelSelector := range labelSelectors {
+		informer, err := c.nodeInformer(ctx, labelSelector)
+		if err != nil {
+			return nil, err
+		}
+
+		cached, err := informer.Lister().List(labels.Everything())
+		if err != nil {
+			return nil, fmt.Errorf("failed to list nodes with selector %q: %w", labelSelector, err)
+		}
+		for _, node := range cached {
+			if _, ok := seen[node.Name]; ok {
+				continue
+			}
+			seen[node.Name] = struct{}{}
+			nodes = append(nodes, *node)
+		}
+	}
 
-	for _, node := range nodes.Items {
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].Name < nodes[j].Name })
+	return nodes, nil
+}
 
-		names = append(names, node.Name)
+// nodeInformer returns the node informer of the label selector, starting it if needed.
+func (c *Client) nodeInformer(ctx context.Context, labelSelector string) (informersv1.NodeInformer, error) {
+	selector, err := labels.Parse(labelSelector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid label selector %q: %w", labelSelector, err)
+	}
+	labelSelector = selector.String()
+
+	c.mu.Lock()
+	informer, ok := c.nodeInformers[labelSelector]
+	if !ok {
+		factory := informers.NewSharedInformerFactoryWithOptions(c.clientset, 0,
+			informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+				options.LabelSelector = labelSelector
+			}))
+		informer = factory.Core().V1().Nodes()
+		// The lister must be requested before the factory is started for the informer to be started.
+		informer.Lister()
+
+		// The informer runs for the lifetime of the process. A caller giving up on the sync leaves
+		// it syncing for the next ones.
+		factory.Start(wait.NeverStop)
+		c.nodeInformers[labelSelector] = informer
+	}
+	c.mu.Unlock()
 
+	if !cache.WaitForCacheSync(ctx.Done(), informer.Informer().HasSynced) {
+		return nil, fmt.Errorf("failed to sync the cache of nodes with selector %q: %w", labelSelector, ctx.Err())
 	}
+	return informer, nil
+}
 
-	return names, nil
+// OnIngressNodesChange calls fn whenever a node starts or stops matching any of the label
+// selectors, or a change of its labels, readiness, cordoning or exclusion may change the set of
+// nodes serving the aliases. In the service and endpointslice discovery modes, changes of the ingress
+// Service and of its endpoints are reported too, and in the workload discovery mode the changes of
+// the pods of the ingress controller workload. The objects already present when the handler is added are ignored.
+//
+// fn is called from the informer goroutines and must not block.
+func (c *Client) OnIngressNodesChange(ctx context.Context, labelSelectors []string, fn func(reason string)) error {
+	for _, labelSelector := range labelSelectors {
+		informer, err := c.nodeInformer(ctx, labelSelector)
+		if err != nil {
+			return err
+		}
+
+		_, err = informer.Informer().AddEventHandler(cache.ResourceEventHandlerDetailedFuncs{
+			AddFunc: func(obj any, isInInitialList bool) {
+				if node, ok := obj.(*corev1.Node); ok && !isInInitialList {
+					fn("node " + node.Name + " added")
+				}
+			},
+			UpdateFunc: func(oldObj, newObj any) {
+				oldNode, oldOK := oldObj.(*corev1.Node)
+				newNode, newOK := newObj.(*corev1.Node)
+				if oldOK && newOK && servingChanged(oldNode, newNode) {
+					fn("node " + newNode.Name + " changed")
+				}
+			},
+			DeleteFunc: func(obj any) {
+				if node, ok := obj.(*corev1.Node); ok {
+					fn("node " + node.Name + " removed")
+				} else {
+					fn("node removed")
+				}
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to watch nodes with selector %q: %w", labelSelector, err)
+		}
+	}
 
+	switch c.discovery {
+	case DiscoveryService, DiscoveryEndpointSlice:
+		return c.onIngressServiceChange(ctx, fn)
+	case DiscoveryWorkload:
+		return c.onIngressWorkloadChange(ctx, fn)
+	default:
+		return nil
+	}
 }
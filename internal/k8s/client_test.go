@@ -0,0 +1,187 @@
+package k8s
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/pkg/config"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	informersv1 "k8s.io/client-go/informers/core/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestClientNodeInformerSyncsWithoutLock(t *testing.T) {
+	clientset := fake.NewSimpleClientset(
+		&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "slow-1", Labels: map[string]string{"role": "slow"}}},
+		&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "fast-1", Labels: map[string]string{"role": "fast"}}},
+	)
+	// The list of the slow nodes fails until released, so their cache does not sync.
+	listing := make(chan struct{})
+	var once sync.Once
+	var released atomic.Bool
+	clientset.PrependReactor("list", "nodes", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if action.(k8stesting.ListAction).GetListRestrictions().Labels.String() == "role=slow" && !released.Load() {
+			once.Do(func() { close(listing) })
+			return true, nil, errors.New("unavailable")
+		}
+		return false, nil, nil
+	})
+	c := newClient(clientset)
+
+	slow := make(chan error, 1)
+	go func() {
+		_, err := c.nodeInformer(context.Background(), "role=slow")
+		slow <- err
+	}()
+	<-listing
+
+	// Another informer syncs while the slow one is still syncing.
+	fast := make(chan informersv1.NodeInformer, 1)
+	go func() {
+		informer, err := c.nodeInformer(context.Background(), "role=fast")
+		if err != nil {
+			t.Errorf("nodeInformer() error = %v while another informer syncs", err)
+		}
+		fast <- informer
+	}()
+	var informer informersv1.NodeInformer
+	select {
+	case informer = <-fast:
+	case <-time.After(5 * time.Second):
+		t.Fatal("nodeInformer() blocked while another informer syncs")
+	}
+	if informer == nil {
+		return
+	}
+	if nodes, _ := informer.Lister().List(labels.Everything()); len(nodes) != 1 || nodes[0].Name != "fast-1" {
+		t.Errorf("nodes = %v, want fast-1", nodes)
+	}
+
+	// A caller giving up on the slow informer leaves it syncing for the next ones.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := c.nodeInformer(ctx, "role=slow"); err == nil {
+		t.Error("nodeInformer() error = nil before the cache synced")
+	}
+
+	released.Store(true)
+	if err := <-slow; err != nil {
+		t.Fatalf("nodeInformer() error = %v", err)
+	}
+	informer, err := c.nodeInformer(context.Background(), "role=slow")
+	if err != nil {
+		t.Fatalf("nodeInformer() error = %v once synced", err)
+	}
+	if nodes, _ := informer.Lister().List(labels.Everything()); len(nodes) != 1 || nodes[0].Name != "slow-1" {
+		t.Errorf("nodes = %v, want slow-1", nodes)
+	}
+}
+
+func TestClientGetIngressNodesSelectors(t *testing.T) {
+	node := func(name string, labels map[string]string) *corev1.Node {
+		return &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels}}
+	}
+	c := newClient(fake.NewSimpleClientset(
+		node("a", map[string]string{"role": "ingress", "zone": "a"}),
+		node("b", map[string]string{"role": "ingress", "zone": "b", "legacy": "true"}),
+		node("c", map[string]string{"role": "ingress", "zone": "c"}),
+		node("d", map[string]string{"role": "worker"}),
+		node("e", map[string]string{"node-role.kubernetes.io/ingress": ""}),
+	))
+
+	tests := []struct {
+		name      string
+		selectors []string
+		want      []string
+		wantErr   bool
+	}{
+		{name: "Equality", selectors: []string{"role=ingress"}, want: []string{"a", "b", "c"}},
+		{name: "Set-based", selectors: []string{"role=ingress,zone in (a,b)"}, want: []string{"a", "b"}},
+		{name: "Negated existence", selectors: []string{"role=ingress,!legacy"}, want: []string{"a", "c"}},
+		{name: "Existence", selectors: []string{"node-role.kubernetes.io/ingress"}, want: []string{"e"}},
+		{name: "Exclusion", selectors: []string{"role notin (ingress)"}, want: []string{"d", "e"}},
+		{name: "Several selectors are ORed", selectors: []string{"zone=c", "node-role.kubernetes.io/ingress", "role=ingress,zone in (b,c)"}, want: []string{"b", "c", "e"}},
+		{name: "Invalid selector", selectors: []string{"role in (ingress"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nodes, err := c.GetIngressNodes(context.Background(), tt.selectors)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GetIngressNodes() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			var names []string
+			for _, node := range nodes {
+				names = append(names, node.Name)
+			}
+			if !slices.Equal(names, tt.want) {
+				t.Errorf("GetIngressNodes() = %v, want %v", names, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewClientRateLimit(t *testing.T) {
+	kubeconfig := filepath.Join(t.TempDir(), "kubeconfig")
+	data := `apiVersion: v1
+kind: Config
+clusters:
+- name: test
+  cluster:
+    server: https://127.0.0.1:6443
+users:
+- name: test
+  user:
+    token: test
+contexts:
+- name: test
+  context:
+    cluster: test
+    user: test
+current-context: test
+`
+	if err := os.WriteFile(kubeconfig, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("KUBECONFIG", kubeconfig)
+
+	tests := []struct {
+		name  string
+		qps   float32
+		burst int
+	}{
+		{name: "Defaults", qps: 5, burst: 10},
+		{name: "Raised", qps: 50, burst: 100},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := NewClient(&config.Config{KubeAPIQPS: tt.qps, KubeAPIBurst: tt.burst, NodeDiscovery: DiscoveryLabel})
+			if err != nil {
+				t.Fatalf("NewClient() error = %v", err)
+			}
+			limiter := c.clientset.CoreV1().RESTClient().GetRateLimiter()
+			if limiter.QPS() != tt.qps {
+				t.Errorf("QPS = %v, want %v", limiter.QPS(), tt.qps)
+			}
+			accepted := 0
+			for limiter.TryAccept() {
+				accepted++
+			}
+			if accepted != tt.burst {
+				t.Errorf("burst = %d, want %d", accepted, tt.burst)
+			}
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/log"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/cache"
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+// DNSEndpointResource is the ExternalDNS DNSEndpoint resource, consumed in standalone mode.
+var DNSEndpointResource = schema.GroupVersionResource{Group: "externaldns.k8s.io", Version: "v1alpha1", Resource: "dnsendpoints"}
+
+// DNSEndpointKind is the kind of the DNSEndpoint resource.
+const DNSEndpointKind = "DNSEndpoint"
+
+// DNSEndpoints returns the endpoints declared by the DNSEndpoint resources of all namespaces, in the
+// order of the resources' namespace and name.
+//
+// They are answered from a cache fed by an informer, started on the first call, which blocks until
+// the cache is synced. The DNSEndpoint CRD of ExternalDNS must be installed.
+func (c *Client) DNSEndpoints(ctx context.Context) ([]*endpoint.Endpoint, error) {
+	informer, err := c.dynamicInformer(ctx, DNSEndpointResource)
+	if err != nil {
+		return nil, err
+	}
+
+	var resources []*endpoint.DNSEndpoint
+	for _, obj := range informer.GetStore().List() {
+		resource, err := toDNSEndpoint(obj)
+		if err != nil {
+			log.FromContext(ctx).Error("Ignoring invalid DNSEndpoint: %v", err)
+			continue
+		}
+		resources = append(resources, resource)
+	}
+	sort.Slice(resources, func(i, j int) bool {
+		if resources[i].Namespace != resources[j].Namespace {
+			return resources[i].Namespace < resources[j].Namespace
+		}
+		return resources[i].Name < resources[j].Name
+	})
+
+	var endpoints []*endpoint.Endpoint
+	for _, resource := range resources {
+		for _, ep := range resource.Spec.Endpoints {
+			if ep != nil {
+				endpoints = append(endpoints, ep)
+			}
+		}
+	}
+	return endpoints, nil
+}
+
+// OnDNSEndpointsChange calls fn whenever a DNSEndpoint is added, changed or removed. The resources
+// already present when the handler is added are ignored.
+//
+// fn is called from the informer goroutine and must not block.
+func (c *Client) OnDNSEndpointsChange(ctx context.Context, fn func(reason string)) error {
+	informer, err := c.dynamicInformer(ctx, DNSEndpointResource)
+	if err != nil {
+		return err
+	}
+
+	_, err = informer.AddEventHandler(cache.ResourceEventHandlerDetailedFuncs{
+		AddFunc: func(obj any, isInInitialList bool) {
+			if !isInInitialList {
+				fn("dnsendpoint " + objectName(obj) + " added")
+			}
+		},
+		UpdateFunc: func(_, newObj any) {
+			fn("dnsendpoint " + objectName(newObj) + " changed")
+		},
+		DeleteFunc: func(obj any) {
+			fn("dnsendpoint " + objectName(obj) + " removed")
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to watch dnsendpoints: %w", err)
+	}
+	return nil
+}
+
+// toDNSEndpoint converts a DNSEndpoint read through the dynamic client.
+func toDNSEndpoint(obj any) (*endpoint.DNSEndpoint, error) {
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return nil, fmt.Errorf("unexpected object %T", obj)
+	}
+	var resource endpoint.DNSEndpoint
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u.Object, &resource); err != nil {
+		return nil, fmt.Errorf("failed to convert dnsendpoint %s/%s: %w", u.GetNamespace(), u.GetName(), err)
+	}
+	return &resource, nil
+}
@@ -0,0 +1,53 @@
+package k8s
+
+import (
+	"context"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func testDNSEndpoint(namespace, name string, dnsNames ...string) *unstructured.Unstructured {
+	endpoints := make([]any, 0, len(dnsNames))
+	for _, dnsName := range dnsNames {
+		endpoints = append(endpoints, map[string]any{"dnsName": dnsName, "recordType": "A", "targets": []any{"192.0.2.1"}})
+	}
+	return &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": DNSEndpointResource.GroupVersion().String(),
+		"kind":       DNSEndpointKind,
+		"metadata":   map[string]any{"namespace": namespace, "name": name},
+		"spec":       map[string]any{"endpoints": endpoints},
+	}}
+}
+
+func TestClientDNSEndpoints(t *testing.T) {
+	listKinds := map[schema.GroupVersionResource]string{DNSEndpointResource: DNSEndpointKind + "List"}
+	c := newClient(fake.NewSimpleClientset())
+	c.dynamic = dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), listKinds,
+		testDNSEndpoint("web", "web", "web.cern.ch", "www.cern.ch"),
+		testDNSEndpoint("api", "api", "api.cern.ch"),
+	)
+
+	endpoints, err := c.DNSEndpoints(context.Background())
+	if err != nil {
+		t.Fatalf("DNSEndpoints() error = %v", err)
+	}
+
+	var names []string
+	for _, ep := range endpoints {
+		names = append(names, ep.DNSName)
+	}
+	expected := []string{"api.cern.ch", "web.cern.ch", "www.cern.ch"}
+	if len(names) != len(expected) {
+		t.Fatalf("DNSEndpoints() = %v, want %v", names, expected)
+	}
+	for i := range expected {
+		if names[i] != expected[i] {
+			t.Errorf("DNSEndpoints()[%d] = %s, want %s", i, names[i], expected[i])
+		}
+	}
+}
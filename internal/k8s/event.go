@@ -0,0 +1,129 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/log"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/tools/reference"
+)
+
+// EventComponent is the source component of the Events emitted by the webhook.
+const EventComponent = "external-dns-cern-webhook"
+
+// EventObjectPod is the kind of a Pod event object. DaemonSets and Deployments are accepted too.
+const EventObjectPod = "pod"
+
+// Environment variables giving the webhook's own Pod, usually set through the downward API.
+const (
+	PodNameEnv      = "POD_NAME"
+	PodNamespaceEnv = "POD_NAMESPACE"
+)
+
+// Reasons of the Events emitted by the webhook.
+const (
+	// EventReasonSynced reports the records changed by a successful sync.
+	EventReasonSynced = "RecordsSynced"
+	// EventReasonSyncFailed reports a failed sync.
+	EventReasonSyncFailed = "SyncFailed"
+)
+
+// ParseEventObject parses a `namespace/kind/name` event object reference, kind being pod,
+// daemonset or deployment.
+func ParseEventObject(object string) (namespace, kind, name string, err error) {
+	parts := strings.Split(object, "/")
+	if len(parts) != 3 || parts[0] == "" || parts[2] == "" {
+		return "", "", "", fmt.Errorf("invalid event object %q, expected namespace/kind/name", object)
+	}
+	kind = strings.ToLower(parts[1])
+	if kind != EventObjectPod && kind != WorkloadDaemonSet && kind != WorkloadDeployment {
+		return "", "", "", fmt.Errorf("invalid event object kind %q, expected %s, %s or %s", parts[1], EventObjectPod, WorkloadDaemonSet, WorkloadDeployment)
+	}
+	return parts[0], kind, parts[2], nil
+}
+
+// EventRecorder emits Kubernetes Events on a single object, so that cluster users can follow the DNS
+// activity of the webhook with `kubectl describe` or `kubectl get events`.
+//
+// A nil EventRecorder discards the events.
+type EventRecorder struct {
+	recorder record.EventRecorder
+	object   *corev1.ObjectReference
+}
+
+// NewEventRecorder creates a recorder emitting Events on the given `namespace/kind/name` object. An
+// empty object stands for the webhook's own Pod, given by the POD_NAMESPACE and POD_NAME environment
+// variables; without them no recorder is created and nil is returned.
+//
+// The object is resolved once, as the reference of an Event carries its UID.
+func (c *Client) NewEventRecorder(ctx context.Context, object string) (*EventRecorder, error) {
+	if object == "" {
+		namespace, name := os.Getenv(PodNamespaceEnv), os.Getenv(PodNameEnv)
+		if namespace == "" || name == "" {
+			log.FromContext(ctx).Warn("%s and %s are not set and no event object is configured, Kubernetes Events are disabled", PodNamespaceEnv, PodNameEnv)
+			return nil, nil
+		}
+		object = namespace + "/" + EventObjectPod + "/" + name
+	}
+
+	ref, err := c.eventObject(ctx, object)
+	if err != nil {
+		return nil, err
+	}
+
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: c.clientset.CoreV1().Events("")})
+	recorder := broadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: EventComponent})
+	return &EventRecorder{recorder: recorder, object: ref}, nil
+}
+
+// eventObject resolves the reference of a `namespace/kind/name` event object.
+func (c *Client) eventObject(ctx context.Context, object string) (*corev1.ObjectReference, error) {
+	namespace, kind, name, err := ParseEventObject(object)
+	if err != nil {
+		return nil, err
+	}
+
+	var obj runtime.Object
+	switch kind {
+	case EventObjectPod:
+		obj, err = c.clientset.CoreV1().Pods(namespace).Get(ctx, name, metav1.GetOptions{})
+	case WorkloadDaemonSet:
+		obj, err = c.clientset.AppsV1().DaemonSets(namespace).Get(ctx, name, metav1.GetOptions{})
+	default:
+		obj, err = c.clientset.AppsV1().Deployments(namespace).Get(ctx, name, metav1.GetOptions{})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get event object %s: %w", object, err)
+	}
+
+	ref, err := reference.GetReference(scheme.Scheme, obj)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reference event object %s: %w", object, err)
+	}
+	return ref, nil
+}
+
+// Normal emits an Event of type Normal.
+func (r *EventRecorder) Normal(reason, format string, args ...any) {
+	if r == nil {
+		return
+	}
+	r.recorder.Eventf(r.object, corev1.EventTypeNormal, reason, format, args...)
+}
+
+// Warning emits an Event of type Warning.
+func (r *EventRecorder) Warning(reason, format string, args ...any) {
+	if r == nil {
+		return
+	}
+	r.recorder.Eventf(r.object, corev1.EventTypeWarning, reason, format, args...)
+}
@@ -0,0 +1,81 @@
+package k8s
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestParseEventObject(t *testing.T) {
+	tests := []struct {
+		name    string
+		object  string
+		kind    string
+		wantErr bool
+	}{
+		{name: "Pod", object: "dns/Pod/webhook-0", kind: EventObjectPod},
+		{name: "Deployment", object: "dns/deployment/external-dns", kind: WorkloadDeployment},
+		{name: "Unsupported kind", object: "dns/service/external-dns", wantErr: true},
+		{name: "Missing namespace", object: "pod/webhook-0", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, kind, _, err := ParseEventObject(tt.object)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseEventObject() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if kind != tt.kind {
+				t.Errorf("ParseEventObject() kind = %q, want %q", kind, tt.kind)
+			}
+		})
+	}
+}
+
+func TestClientEventObject(t *testing.T) {
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "dns", Name: "webhook-0", UID: types.UID("uid")}}
+	c := newClient(fake.NewSimpleClientset(pod))
+
+	ref, err := c.eventObject(context.Background(), "dns/pod/webhook-0")
+	if err != nil {
+		t.Fatalf("eventObject() error = %v", err)
+	}
+	if ref.Kind != "Pod" || ref.Namespace != "dns" || ref.Name != "webhook-0" || ref.UID != pod.UID {
+		t.Errorf("eventObject() = %+v, want a reference to pod dns/webhook-0", ref)
+	}
+
+	if _, err := c.eventObject(context.Background(), "dns/pod/missing"); err == nil {
+		t.Error("expected an error for a missing object")
+	}
+}
+
+func TestNewEventRecorderWithoutPod(t *testing.T) {
+	t.Setenv(PodNameEnv, "")
+	t.Setenv(PodNamespaceEnv, "")
+
+	recorder, err := newClient(fake.NewSimpleClientset()).NewEventRecorder(context.Background(), "")
+	if err != nil || recorder != nil {
+		t.Fatalf("NewEventRecorder() = %v, %v, want a nil recorder", recorder, err)
+	}
+	// A nil recorder discards the events.
+	recorder.Normal(EventReasonSynced, "Synced")
+}
+
+func TestEventRecorder(t *testing.T) {
+	fakeRecorder := record.NewFakeRecorder(2)
+	recorder := &EventRecorder{recorder: fakeRecorder, object: &corev1.ObjectReference{Kind: "Pod"}}
+
+	recorder.Normal(EventReasonSynced, "Synced %d records", 3)
+	recorder.Warning(EventReasonSyncFailed, "Failed")
+
+	for _, expected := range []string{"Normal RecordsSynced Synced 3 records", "Warning SyncFailed Failed"} {
+		if got := <-fakeRecorder.Events; got != expected {
+			t.Errorf("event = %q, want %q", got, expected)
+		}
+	}
+}
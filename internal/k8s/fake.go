@@ -0,0 +1,134 @@
+package k8s
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/kubernetes/scheme"
+)
+
+// Supported values of the Kubernetes backend.
+const (
+	// KubeBackendCluster talks to the API server of the cluster the webhook runs in, or of KUBECONFIG.
+	KubeBackendCluster = "cluster"
+	// KubeBackendFake serves the objects of a static YAML file, for local development without a cluster.
+	KubeBackendFake = "fake"
+)
+
+// NewFakeClients creates in-memory clients holding the objects of a multi-document YAML file, e.g.
+// the Nodes, the Services, EndpointSlices, Pods or workloads used by the discovery modes, and the
+// CernAlias and DNSEndpoint resources, which are served by the dynamic client.
+func NewFakeClients(path string) (*fake.Clientset, *dynamicfake.FakeDynamicClient, error) {
+	objects, err := readObjects(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var typed, custom []runtime.Object
+	for _, object := range objects {
+		if _, ok := object.(*unstructured.Unstructured); ok {
+			custom = append(custom, object)
+		} else {
+			typed = append(typed, object)
+		}
+	}
+
+	listKinds := map[schema.GroupVersionResource]string{
+		CernAliasResource:   CernAliasKind + "List",
+		DNSEndpointResource: DNSEndpointKind + "List",
+	}
+	return fake.NewSimpleClientset(typed...), dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), listKinds, custom...), nil
+}
+
+// FakeNodes returns the Nodes of a multi-document YAML file of fake objects, e.g. to seed the other
+// in-memory clients of the fake backend with the servers backing them.
+func FakeNodes(path string) ([]corev1.Node, error) {
+	objects, err := readObjects(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var nodes []corev1.Node
+	for _, object := range objects {
+		if node, ok := object.(*corev1.Node); ok {
+			nodes = append(nodes, *node)
+		}
+	}
+	return nodes, nil
+}
+
+// readObjects reads and decodes the objects of a multi-document YAML file of fake objects.
+func readObjects(path string) ([]runtime.Object, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fake objects: %w", err)
+	}
+
+	objects, err := decodeObjects(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode fake objects from %s: %w", path, err)
+	}
+	return objects, nil
+}
+
+// customKinds are the kinds of the custom resources decoded as unstructured objects.
+var customKinds = map[schema.GroupVersionKind]struct{}{
+	CernAliasGroupVersion.WithKind(CernAliasKind):                {},
+	DNSEndpointResource.GroupVersion().WithKind(DNSEndpointKind): {},
+}
+
+// decodeObjects decodes the Kubernetes objects of a multi-document YAML or JSON stream. The
+// custom resources are decoded as unstructured objects.
+func decodeObjects(data []byte) ([]runtime.Object, error) {
+	reader := utilyaml.NewYAMLReader(bufio.NewReader(bytes.NewReader(data)))
+	decoder := scheme.Codecs.UniversalDeserializer()
+
+	var objects []runtime.Object
+	for {
+		document, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return objects, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(bytes.TrimSpace(document)) == 0 {
+			continue
+		}
+
+		object, _, err := decoder.Decode(document, nil, nil)
+		if runtime.IsNotRegisteredError(err) {
+			custom, customErr := decodeUnstructured(document)
+			if customErr == nil {
+				if _, ok := customKinds[custom.GetObjectKind().GroupVersionKind()]; ok {
+					object, err = custom, nil
+				}
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, object)
+	}
+}
+
+// decodeUnstructured decodes a YAML or JSON document as an unstructured object.
+func decodeUnstructured(document []byte) (runtime.Object, error) {
+	data, err := utilyaml.ToJSON(document)
+	if err != nil {
+		return nil, err
+	}
+	object, _, err := unstructured.UnstructuredJSONScheme.Decode(data, nil, nil)
+	return object, err
+}
@@ -0,0 +1,49 @@
+package k8s
+
+import (
+	"context"
+	"testing"
+
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/pkg/config"
+)
+
+func TestNewClientFake(t *testing.T) {
+	c, err := NewClient(&config.Config{
+		KubeBackend:     KubeBackendFake,
+		KubeFakeObjects: "../../deploy/fake-nodes.yaml",
+		NodeDiscovery:   DiscoveryLabel,
+	})
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	nodes, err := c.GetIngressNodes(context.Background(), []string{"node-role.kubernetes.io/ingress"})
+	if err != nil {
+		t.Fatalf("GetIngressNodes() error = %v", err)
+	}
+	if len(nodes) != 2 || nodes[0].Name != "ingress-node-1" || nodes[1].Spec.ProviderID != "openstack:///00000000-0000-0000-0000-000000000002" {
+		t.Errorf("GetIngressNodes() = %v, want the nodes of the fake objects file", nodes)
+	}
+}
+
+func TestDecodeObjects(t *testing.T) {
+	objects, err := decodeObjects([]byte("---\napiVersion: v1\nkind: Pod\nmetadata:\n  name: a\n---\n\n"))
+	if err != nil {
+		t.Fatalf("decodeObjects() error = %v", err)
+	}
+	if len(objects) != 1 {
+		t.Errorf("decodeObjects() = %d objects, want 1", len(objects))
+	}
+
+	objects, err = decodeObjects([]byte("apiVersion: webhook.cern.ch/v1alpha1\nkind: CernAlias\nmetadata:\n  name: a\nspec:\n  alias: a.cern.ch\n"))
+	if err != nil {
+		t.Fatalf("decodeObjects() error = %v", err)
+	}
+	if alias, err := toCernAlias(objects[0]); err != nil || alias.Spec.Alias != "a.cern.ch" {
+		t.Errorf("decodeObjects() = %v, %v, want the CernAlias a.cern.ch", alias, err)
+	}
+
+	if _, err := decodeObjects([]byte("apiVersion: v1\nkind: Unknown\n")); err == nil {
+		t.Errorf("decodeObjects() expected error for an unknown kind")
+	}
+}
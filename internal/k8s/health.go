@@ -0,0 +1,34 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// reachabilityTTL is how long the result of a Kubernetes API reachability check is reused, so that
+// frequent readiness probes do not load the API server.
+const reachabilityTTL = 30 * time.Second
+
+// Reachable checks that the Kubernetes API server answers and that the webhook may list nodes,
+// with a single-item node list. The result is cached for a short while.
+//
+// This surfaces API outages and missing RBAC permissions through the readiness probe instead of
+// through failed syncs, which the node caches would otherwise hide until their next relist.
+func (c *Client) Reachable(ctx context.Context) error {
+	c.reachMu.Lock()
+	defer c.reachMu.Unlock()
+
+	if !c.reachCheckedAt.IsZero() && time.Since(c.reachCheckedAt) < reachabilityTTL {
+		return c.reachErr
+	}
+
+	_, err := c.clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{Limit: 1})
+	if err != nil {
+		err = fmt.Errorf("failed to reach the Kubernetes API: %w", err)
+	}
+	c.reachCheckedAt, c.reachErr = time.Now(), err
+	return err
+}
@@ -0,0 +1,37 @@
+package k8s
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestClientReachable(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	calls := 0
+	clientset.PrependReactor("list", "nodes", func(k8stesting.Action) (bool, runtime.Object, error) {
+		calls++
+		return true, nil, errors.New("forbidden")
+	})
+	c := newClient(clientset)
+
+	if err := c.Reachable(context.Background()); err == nil {
+		t.Fatal("expected an error")
+	}
+	if err := c.Reachable(context.Background()); err == nil {
+		t.Fatal("expected the cached error")
+	}
+	if calls != 1 {
+		t.Errorf("expected 1 API call, got %d", calls)
+	}
+
+	c.reachCheckedAt = c.reachCheckedAt.Add(-reachabilityTTL)
+	clientset.ReactionChain = clientset.ReactionChain[1:]
+	if err := c.Reachable(context.Background()); err != nil {
+		t.Errorf("expected the API to be reachable after the cache expired, got %v", err)
+	}
+}
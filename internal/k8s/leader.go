@@ -0,0 +1,66 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/log"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+// Timings of the leader election, matching the defaults of the Kubernetes controllers.
+const (
+	leaseDuration = 15 * time.Second
+	renewDeadline = 10 * time.Second
+	retryPeriod   = 2 * time.Second
+)
+
+// RunLeaderElection competes for the given coordination.k8s.io Lease under the given identity until
+// the context is cancelled, calling onChange with true when the lease is acquired and with false
+// when it is lost. A replica that loses the lease competes for it again. onChange(true) runs in its
+// own goroutine, so it may still be running when onChange(false) is called.
+func (c *Client) RunLeaderElection(ctx context.Context, namespace, name, identity string, onChange func(leading bool)) error {
+	logger := log.FromContext(ctx)
+	lock := &resourcelock.LeaseLock{
+		LeaseMeta:  metav1.ObjectMeta{Namespace: namespace, Name: name},
+		Client:     c.clientset.CoordinationV1(),
+		LockConfig: resourcelock.ResourceLockConfig{Identity: identity},
+	}
+
+	elector, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+		Lock:            lock,
+		LeaseDuration:   leaseDuration,
+		RenewDeadline:   renewDeadline,
+		RetryPeriod:     retryPeriod,
+		ReleaseOnCancel: true,
+		Name:            name,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(context.Context) {
+				logger.Info("Acquired lease %s/%s as %s", namespace, name, identity)
+				onChange(true)
+			},
+			OnStoppedLeading: func() {
+				logger.Warn("Lost lease %s/%s", namespace, name)
+				onChange(false)
+			},
+			OnNewLeader: func(leader string) {
+				if leader != identity {
+					logger.Info("Current leader is %s", leader)
+				}
+			},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create leader elector: %w", err)
+	}
+
+	go func() {
+		for ctx.Err() == nil {
+			elector.Run(ctx)
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,65 @@
+package k8s
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// waitLeading returns the next leading transition reported on changes, failing the test after a
+// timeout.
+func waitLeading(t *testing.T, identity string, changes <-chan bool) bool {
+	t.Helper()
+	select {
+	case leading := <-changes:
+		return leading
+	case <-time.After(3 * retryPeriod):
+		t.Fatalf("%s reported no leading transition", identity)
+		return false
+	}
+}
+
+func TestRunLeaderElection(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	ctxA, cancelA := context.WithCancel(context.Background())
+	defer cancelA()
+	ctxB, cancelB := context.WithCancel(context.Background())
+	defer cancelB()
+
+	changesA, changesB := make(chan bool, 4), make(chan bool, 4)
+	if err := newClient(clientset).RunLeaderElection(ctxA, "dns", "webhook", "a", func(leading bool) { changesA <- leading }); err != nil {
+		t.Fatalf("RunLeaderElection(a) error = %v", err)
+	}
+	if !waitLeading(t, "a", changesA) {
+		t.Fatal("a did not acquire the free lease")
+	}
+
+	// The lease is held by a, b waits for it.
+	if err := newClient(clientset).RunLeaderElection(ctxB, "dns", "webhook", "b", func(leading bool) { changesB <- leading }); err != nil {
+		t.Fatalf("RunLeaderElection(b) error = %v", err)
+	}
+	select {
+	case leading := <-changesB:
+		t.Fatalf("b reported leading = %v while a holds the lease", leading)
+	case <-time.After(2 * retryPeriod):
+	}
+	lease, err := clientset.CoordinationV1().Leases("dns").Get(context.Background(), "webhook", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if holder := lease.Spec.HolderIdentity; holder == nil || *holder != "a" {
+		t.Errorf("lease holder = %v, want a", holder)
+	}
+
+	// a releases the lease when stopped, and b acquires it.
+	cancelA()
+	if waitLeading(t, "a", changesA) {
+		t.Error("a reported leading = true when stopped, want false")
+	}
+	if !waitLeading(t, "b", changesB) {
+		t.Error("b did not acquire the released lease")
+	}
+}
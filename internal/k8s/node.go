@@ -0,0 +1,105 @@
+package k8s
+
+import (
+	"context"
+	"maps"
+	"slices"
+
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/log"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// ExcludeFromExternalLoadBalancersLabel is the standard label excluding a node from the targets of
+// the cloud load balancers. Its presence, whatever its value, excludes the node.
+const ExcludeFromExternalLoadBalancersLabel = corev1.LabelNodeExcludeBalancers
+
+// Node address types selecting the address reported as the target of the aliases.
+const (
+	// AddressTypeExternalIP reports the external IP of the nodes.
+	AddressTypeExternalIP = string(corev1.NodeExternalIP)
+	// AddressTypeInternalIP reports the internal IP of the nodes.
+	AddressTypeInternalIP = string(corev1.NodeInternalIP)
+	// AddressTypeAuto reports the external IP of the nodes, or their internal IP when they have none.
+	AddressTypeAuto = "auto"
+)
+
+// NodeAddress returns the first address of the given type of a node, or an empty string when it has
+// none. With AddressTypeAuto the external IP is preferred over the internal IP.
+func NodeAddress(node corev1.Node, addressType string) string {
+	if addressType == AddressTypeAuto {
+		if address := NodeAddress(node, AddressTypeExternalIP); address != "" {
+			return address
+		}
+		return NodeAddress(node, AddressTypeInternalIP)
+	}
+	for _, address := range node.Status.Addresses {
+		if string(address.Type) == addressType {
+			return address.Address
+		}
+	}
+	return ""
+}
+
+// NodeFilter selects the nodes that can actually serve traffic, so that DNS aliases are not pointed
+// at nodes that are down or being drained.
+type NodeFilter struct {
+	// RequireReady drops the nodes whose Ready condition is not True.
+	RequireReady bool
+	// ExcludeUnschedulable drops the cordoned nodes.
+	ExcludeUnschedulable bool
+	// HonorExcludeLabel drops the nodes carrying the exclude-from-external-load-balancers label or
+	// annotation, like the cloud load-balancer controllers do.
+	HonorExcludeLabel bool
+}
+
+// Filter returns the nodes accepted by the filter, in the same order.
+func (f NodeFilter) Filter(ctx context.Context, nodes []corev1.Node) []corev1.Node {
+	logger := log.FromContext(ctx)
+	serving := make([]corev1.Node, 0, len(nodes))
+	for _, node := range nodes {
+		if f.RequireReady && !isReady(node) {
+			logger.Info("Node %s is not ready, excluding it from alias targets", node.Name)
+			continue
+		}
+		if f.ExcludeUnschedulable && node.Spec.Unschedulable {
+			logger.Info("Node %s is cordoned, excluding it from alias targets", node.Name)
+			continue
+		}
+		if f.HonorExcludeLabel && isExcluded(node) {
+			logger.Info("Node %s is excluded from external load balancers, excluding it from alias targets", node.Name)
+			continue
+		}
+		serving = append(serving, node)
+	}
+	return serving
+}
+
+// isReady reports whether the Ready condition of a node is True.
+func isReady(node corev1.Node) bool {
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == corev1.NodeReady {
+			return condition.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// isExcluded reports whether a node carries the exclude-from-external-load-balancers label or annotation.
+func isExcluded(node corev1.Node) bool {
+	if _, ok := node.Labels[ExcludeFromExternalLoadBalancersLabel]; ok {
+		return true
+	}
+	_, ok := node.Annotations[ExcludeFromExternalLoadBalancersLabel]
+	return ok
+}
+
+// servingChanged reports whether an update of a node may change whether it serves the aliases, or
+// which aliases it serves: a change of its labels, readiness, cordoning or exclusion, or of its
+// addresses reported as targets.
+func servingChanged(oldNode, newNode *corev1.Node) bool {
+	return !maps.Equal(oldNode.Labels, newNode.Labels) ||
+		!slices.Equal(oldNode.Status.Addresses, newNode.Status.Addresses) ||
+		isReady(*oldNode) != isReady(*newNode) ||
+		oldNode.Spec.Unschedulable != newNode.Spec.Unschedulable ||
+		isExcluded(*oldNode) != isExcluded(*newNode)
+}
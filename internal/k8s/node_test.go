@@ -0,0 +1,132 @@
+package k8s
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/log"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestMain(m *testing.M) {
+	// The contexts carrying no logger log through the global logger, which is normally set up by main.
+	log.GlobalLogger = log.NewLogger(log.LevelError)
+	os.Exit(m.Run())
+}
+
+func testNode(name string, ready corev1.ConditionStatus, unschedulable bool) corev1.Node {
+	node := corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: name}, Spec: corev1.NodeSpec{Unschedulable: unschedulable}}
+	if ready != "" {
+		node.Status.Conditions = []corev1.NodeCondition{{Type: corev1.NodeReady, Status: ready}}
+	}
+	return node
+}
+
+func TestNodeFilter(t *testing.T) {
+	nodes := []corev1.Node{
+		testNode("ready", corev1.ConditionTrue, false),
+		testNode("not-ready", corev1.ConditionFalse, false),
+		testNode("unknown", corev1.ConditionUnknown, false),
+		testNode("no-condition", "", false),
+		testNode("cordoned", corev1.ConditionTrue, true),
+		testNode("labeled", corev1.ConditionTrue, false),
+		testNode("annotated", corev1.ConditionTrue, false),
+	}
+	nodes[5].Labels = map[string]string{ExcludeFromExternalLoadBalancersLabel: ""}
+	nodes[6].Annotations = map[string]string{ExcludeFromExternalLoadBalancersLabel: "true"}
+
+	tests := []struct {
+		name     string
+		filter   NodeFilter
+		expected []string
+	}{
+		{name: "No filter", filter: NodeFilter{}, expected: []string{"ready", "not-ready", "unknown", "no-condition", "cordoned", "labeled", "annotated"}},
+		{name: "Ready only", filter: NodeFilter{RequireReady: true}, expected: []string{"ready", "cordoned", "labeled", "annotated"}},
+		{name: "Schedulable only", filter: NodeFilter{ExcludeUnschedulable: true}, expected: []string{"ready", "not-ready", "unknown", "no-condition", "labeled", "annotated"}},
+		{name: "Exclude label only", filter: NodeFilter{HonorExcludeLabel: true}, expected: []string{"ready", "not-ready", "unknown", "no-condition", "cordoned"}},
+		{name: "All", filter: NodeFilter{RequireReady: true, ExcludeUnschedulable: true, HonorExcludeLabel: true}, expected: []string{"ready"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, node := range tt.filter.Filter(context.Background(), nodes) {
+				got = append(got, node.Name)
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Filter() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestServingChanged(t *testing.T) {
+	base := testNode("node", corev1.ConditionTrue, false)
+	base.Labels = map[string]string{"role": "ingress"}
+
+	relabeled := *base.DeepCopy()
+	relabeled.Labels["zone"] = "a"
+	notReady := *base.DeepCopy()
+	notReady.Status.Conditions[0].Status = corev1.ConditionFalse
+	cordoned := *base.DeepCopy()
+	cordoned.Spec.Unschedulable = true
+	readdressed := *base.DeepCopy()
+	readdressed.Status.Addresses = []corev1.NodeAddress{{Type: corev1.NodeExternalIP, Address: "192.0.2.1"}}
+	heartbeat := *base.DeepCopy()
+	heartbeat.Status.Conditions[0].LastHeartbeatTime = metav1.Now()
+
+	tests := []struct {
+		name     string
+		node     corev1.Node
+		expected bool
+	}{
+		{name: "Labels", node: relabeled, expected: true},
+		{name: "Readiness", node: notReady, expected: true},
+		{name: "Cordoning", node: cordoned, expected: true},
+		{name: "Addresses", node: readdressed, expected: true},
+		{name: "Heartbeat only", node: heartbeat, expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := servingChanged(&base, &tt.node); got != tt.expected {
+				t.Errorf("servingChanged() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestNodeAddress(t *testing.T) {
+	dual := corev1.Node{Status: corev1.NodeStatus{Addresses: []corev1.NodeAddress{
+		{Type: corev1.NodeHostName, Address: "node"},
+		{Type: corev1.NodeInternalIP, Address: "10.0.0.1"},
+		{Type: corev1.NodeExternalIP, Address: "192.0.2.1"},
+	}}}
+	internal := corev1.Node{Status: corev1.NodeStatus{Addresses: []corev1.NodeAddress{
+		{Type: corev1.NodeInternalIP, Address: "10.0.0.2"},
+	}}}
+
+	tests := []struct {
+		name        string
+		node        corev1.Node
+		addressType string
+		expected    string
+	}{
+		{name: "External", node: dual, addressType: AddressTypeExternalIP, expected: "192.0.2.1"},
+		{name: "Internal", node: dual, addressType: AddressTypeInternalIP, expected: "10.0.0.1"},
+		{name: "Auto prefers external", node: dual, addressType: AddressTypeAuto, expected: "192.0.2.1"},
+		{name: "Auto falls back to internal", node: internal, addressType: AddressTypeAuto, expected: "10.0.0.2"},
+		{name: "Missing", node: internal, addressType: AddressTypeExternalIP, expected: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NodeAddress(tt.node, tt.addressType); got != tt.expected {
+				t.Errorf("NodeAddress() = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,176 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+)
+
+// Supported values of the node discovery mode.
+const (
+	// DiscoveryLabel uses the nodes matching the ingress label selectors.
+	DiscoveryLabel = "label"
+	// DiscoveryService uses the nodes behind the ingress LoadBalancer Service, for clusters that front
+	// the ingress controller with an OpenStack load balancer.
+	DiscoveryService = "service"
+	// DiscoveryEndpointSlice uses the nodes running ready endpoints of the ingress controller Service,
+	// so that only nodes actually running healthy ingress pods receive aliases.
+	DiscoveryEndpointSlice = "endpointslice"
+)
+
+// splitNamespacedName splits a `namespace/name` object reference. A bare name is in the default namespace.
+func splitNamespacedName(object string) (string, string) {
+	if namespace, name, ok := strings.Cut(object, "/"); ok {
+		return namespace, name
+	}
+	return corev1.NamespaceDefault, object
+}
+
+// serviceNodes narrows the nodes down to the ones behind the ingress LoadBalancer Service.
+//
+// The Service must have been given a load balancer address, otherwise an error is returned rather
+// than an empty node set, which would remove every alias. With the Local external traffic policy the
+// load balancer only sends traffic to the nodes running ready endpoints of the Service, so only those
+// nodes are kept. With the Cluster policy every node forwards the traffic and all are kept.
+func (c *Client) serviceNodes(ctx context.Context, nodes []corev1.Node) ([]corev1.Node, error) {
+	factory, err := c.serviceInformers(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	service, err := factory.Core().V1().Services().Lister().Services(c.serviceNamespace).Get(c.serviceName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get ingress service %s/%s: %w", c.serviceNamespace, c.serviceName, err)
+	}
+	if service.Spec.Type != corev1.ServiceTypeLoadBalancer {
+		return nil, fmt.Errorf("ingress service %s/%s is of type %s, not %s", c.serviceNamespace, c.serviceName, service.Spec.Type, corev1.ServiceTypeLoadBalancer)
+	}
+	if len(service.Status.LoadBalancer.Ingress) == 0 {
+		return nil, fmt.Errorf("ingress service %s/%s has no load balancer address yet", c.serviceNamespace, c.serviceName)
+	}
+	if service.Spec.ExternalTrafficPolicy != corev1.ServiceExternalTrafficPolicyLocal {
+		return nodes, nil
+	}
+
+	hosting, err := c.endpointNodes(factory)
+	if err != nil {
+		return nil, err
+	}
+	return nodesIn(nodes, hosting), nil
+}
+
+// endpointSliceNodes narrows the nodes down to the ones running ready endpoints of the ingress
+// controller Service, whatever its type.
+//
+// A Service without any ready endpoint returns an error rather than an empty node set, so that an
+// ingress controller outage or a botched rollout does not remove every alias.
+func (c *Client) endpointSliceNodes(ctx context.Context, nodes []corev1.Node) ([]corev1.Node, error) {
+	factory, err := c.serviceInformers(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	hosting, err := c.endpointNodes(factory)
+	if err != nil {
+		return nil, err
+	}
+	if len(hosting) == 0 {
+		return nil, fmt.Errorf("ingress service %s/%s has no ready endpoints", c.serviceNamespace, c.serviceName)
+	}
+	return nodesIn(nodes, hosting), nil
+}
+
+// nodesIn returns the nodes whose name is in the given set, in the same order.
+func nodesIn(nodes []corev1.Node, names map[string]struct{}) []corev1.Node {
+	selected := make([]corev1.Node, 0, len(nodes))
+	for _, node := range nodes {
+		if _, ok := names[node.Name]; ok {
+			selected = append(selected, node)
+		}
+	}
+	return selected
+}
+
+// endpointNodes returns the names of the nodes running ready endpoints of the ingress Service.
+// Terminating endpoints are never ready.
+func (c *Client) endpointNodes(factory informers.SharedInformerFactory) (map[string]struct{}, error) {
+	selector := labels.SelectorFromSet(labels.Set{discoveryv1.LabelServiceName: c.serviceName})
+	slices, err := factory.Discovery().V1().EndpointSlices().Lister().EndpointSlices(c.serviceNamespace).List(selector)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the endpoints of ingress service %s/%s: %w", c.serviceNamespace, c.serviceName, err)
+	}
+
+	hosting := make(map[string]struct{})
+	for _, slice := range slices {
+		for _, endpoint := range slice.Endpoints {
+			ready := endpoint.Conditions.Ready == nil || *endpoint.Conditions.Ready
+			if ready && endpoint.NodeName != nil {
+				hosting[*endpoint.NodeName] = struct{}{}
+			}
+		}
+	}
+	return hosting, nil
+}
+
+// serviceInformers returns the informer factory of the ingress Service namespace, with its Service
+// and EndpointSlice caches synced.
+func (c *Client) serviceInformers(ctx context.Context) (informers.SharedInformerFactory, error) {
+	return c.namespaceInformers(ctx, c.serviceNamespace,
+		func(factory informers.SharedInformerFactory) cache.SharedIndexInformer {
+			return factory.Core().V1().Services().Informer()
+		},
+		func(factory informers.SharedInformerFactory) cache.SharedIndexInformer {
+			return factory.Discovery().V1().EndpointSlices().Informer()
+		})
+}
+
+// onIngressServiceChange calls fn whenever the ingress Service or its EndpointSlices change.
+func (c *Client) onIngressServiceChange(ctx context.Context, fn func(reason string)) error {
+	factory, err := c.serviceInformers(ctx)
+	if err != nil {
+		return err
+	}
+
+	handler := func(matches func(obj any) bool) cache.ResourceEventHandler {
+		changed := func(obj any) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			if matches(obj) {
+				fn("ingress service " + c.serviceNamespace + "/" + c.serviceName + " changed")
+			}
+		}
+		return cache.ResourceEventHandlerDetailedFuncs{
+			AddFunc: func(obj any, isInInitialList bool) {
+				if !isInInitialList {
+					changed(obj)
+				}
+			},
+			UpdateFunc: func(_, newObj any) { changed(newObj) },
+			DeleteFunc: changed,
+		}
+	}
+
+	_, err = factory.Core().V1().Services().Informer().AddEventHandler(handler(func(obj any) bool {
+		service, ok := obj.(*corev1.Service)
+		return ok && service.Name == c.serviceName
+	}))
+	if err != nil {
+		return fmt.Errorf("failed to watch ingress service %s/%s: %w", c.serviceNamespace, c.serviceName, err)
+	}
+
+	_, err = factory.Discovery().V1().EndpointSlices().Informer().AddEventHandler(handler(func(obj any) bool {
+		slice, ok := obj.(*discoveryv1.EndpointSlice)
+		return ok && slice.Labels[discoveryv1.LabelServiceName] == c.serviceName
+	}))
+	if err != nil {
+		return fmt.Errorf("failed to watch the endpoints of ingress service %s/%s: %w", c.serviceNamespace, c.serviceName, err)
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package k8s
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestClientServiceNodes(t *testing.T) {
+	ready, notReady := true, false
+	nodeA, nodeB := "node-a", "node-b"
+	slice := &discoveryv1.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ingress", Name: "ingress-1", Labels: map[string]string{discoveryv1.LabelServiceName: "ingress"}},
+		Endpoints: []discoveryv1.Endpoint{
+			{NodeName: &nodeA, Conditions: discoveryv1.EndpointConditions{Ready: &ready}},
+			{NodeName: &nodeB, Conditions: discoveryv1.EndpointConditions{Ready: &notReady}},
+		},
+	}
+	nodes := []corev1.Node{testNode("node-a", corev1.ConditionTrue, false), testNode("node-b", corev1.ConditionTrue, false), testNode("node-c", corev1.ConditionTrue, false)}
+
+	service := func(policy corev1.ServiceExternalTrafficPolicy, addresses ...string) *corev1.Service {
+		svc := &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ingress", Name: "ingress"},
+			Spec:       corev1.ServiceSpec{Type: corev1.ServiceTypeLoadBalancer, ExternalTrafficPolicy: policy},
+		}
+		for _, address := range addresses {
+			svc.Status.LoadBalancer.Ingress = append(svc.Status.LoadBalancer.Ingress, corev1.LoadBalancerIngress{IP: address})
+		}
+		return svc
+	}
+
+	tests := []struct {
+		name     string
+		service  *corev1.Service
+		expected []string
+		wantErr  bool
+	}{
+		{name: "Cluster policy", service: service(corev1.ServiceExternalTrafficPolicyCluster, "188.184.1.1"), expected: []string{"node-a", "node-b", "node-c"}},
+		{name: "Local policy", service: service(corev1.ServiceExternalTrafficPolicyLocal, "188.184.1.1"), expected: []string{"node-a"}},
+		{name: "No load balancer address", service: service(corev1.ServiceExternalTrafficPolicyCluster), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newClient(fake.NewSimpleClientset(tt.service, slice))
+			c.discovery = DiscoveryService
+			c.serviceNamespace, c.serviceName = splitNamespacedName("ingress/ingress")
+
+			got, err := c.serviceNodes(context.Background(), nodes)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("serviceNodes() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			var names []string
+			for _, node := range got {
+				names = append(names, node.Name)
+			}
+			if !reflect.DeepEqual(names, tt.expected) {
+				t.Errorf("serviceNodes() = %v, want %v", names, tt.expected)
+			}
+		})
+	}
+}
+
+func TestClientEndpointSliceNodes(t *testing.T) {
+	ready := true
+	nodeA := "node-a"
+	slice := &discoveryv1.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ingress", Name: "ingress-1", Labels: map[string]string{discoveryv1.LabelServiceName: "ingress"}},
+		Endpoints:  []discoveryv1.Endpoint{{NodeName: &nodeA, Conditions: discoveryv1.EndpointConditions{Ready: &ready}}},
+	}
+	nodes := []corev1.Node{testNode("node-a", corev1.ConditionTrue, false), testNode("node-b", corev1.ConditionTrue, false)}
+
+	c := newClient(fake.NewSimpleClientset(slice))
+	c.serviceNamespace, c.serviceName = splitNamespacedName("ingress/ingress")
+	got, err := c.endpointSliceNodes(context.Background(), nodes)
+	if err != nil {
+		t.Fatalf("endpointSliceNodes() error = %v", err)
+	}
+	if len(got) != 1 || got[0].Name != "node-a" {
+		t.Errorf("endpointSliceNodes() = %v, want [node-a]", got)
+	}
+
+	c = newClient(fake.NewSimpleClientset())
+	c.serviceNamespace, c.serviceName = splitNamespacedName("ingress/ingress")
+	if _, err := c.endpointSliceNodes(context.Background(), nodes); err == nil {
+		t.Errorf("endpointSliceNodes() expected error without ready endpoints")
+	}
+}
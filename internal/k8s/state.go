@@ -0,0 +1,74 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ConfigMapStore persists documents under the keys of a ConfigMap, giving the webhook a durable
+// source of truth across restarts.
+type ConfigMapStore struct {
+	client          *Client
+	namespace, name string
+}
+
+// NewConfigMapStore creates a store backed by the given `namespace/name` ConfigMap. A bare name is
+// in the default namespace. The ConfigMap is created on the first save.
+func (c *Client) NewConfigMapStore(configMap string) *ConfigMapStore {
+	namespace, name := splitNamespacedName(configMap)
+	return &ConfigMapStore{client: c, namespace: namespace, name: name}
+}
+
+// String returns the `namespace/name` of the ConfigMap.
+func (s *ConfigMapStore) String() string {
+	return s.namespace + "/" + s.name
+}
+
+// Load returns the document stored under a key, or nil if the ConfigMap or the key does not exist.
+func (s *ConfigMapStore) Load(ctx context.Context, key string) ([]byte, error) {
+	configMap, err := s.client.clientset.CoreV1().ConfigMaps(s.namespace).Get(ctx, s.name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get configmap %s: %w", s, err)
+	}
+	data, ok := configMap.Data[key]
+	if !ok {
+		return nil, nil
+	}
+	return []byte(data), nil
+}
+
+// Save stores a document under a key, creating the ConfigMap if needed. The other keys are kept.
+func (s *ConfigMapStore) Save(ctx context.Context, key string, data []byte) error {
+	configMaps := s.client.clientset.CoreV1().ConfigMaps(s.namespace)
+
+	configMap, err := configMaps.Get(ctx, s.name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		configMap = &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: s.namespace, Name: s.name},
+			Data:       map[string]string{key: string(data)},
+		}
+		if _, err := configMaps.Create(ctx, configMap, metav1.CreateOptions{}); err != nil {
+			return fmt.Errorf("failed to create configmap %s: %w", s, err)
+		}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get configmap %s: %w", s, err)
+	}
+
+	if configMap.Data == nil {
+		configMap.Data = make(map[string]string)
+	}
+	configMap.Data[key] = string(data)
+	if _, err := configMaps.Update(ctx, configMap, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("failed to update configmap %s: %w", s, err)
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package k8s
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestConfigMapStore(t *testing.T) {
+	ctx := context.Background()
+	clientset := fake.NewSimpleClientset()
+	store := newClient(clientset).NewConfigMapStore("dns/webhook-state")
+
+	data, err := store.Load(ctx, "state.json")
+	if err != nil || data != nil {
+		t.Fatalf("Load() = %q, %v, want nothing before the first save", data, err)
+	}
+
+	for _, value := range []string{`{"v":1}`, `{"v":2}`} {
+		if err := store.Save(ctx, "state.json", []byte(value)); err != nil {
+			t.Fatalf("Save() error = %v", err)
+		}
+		data, err := store.Load(ctx, "state.json")
+		if err != nil || string(data) != value {
+			t.Errorf("Load() = %q, %v, want %q", data, err, value)
+		}
+	}
+
+	// Other keys of the ConfigMap are kept.
+	configMap, err := clientset.CoreV1().ConfigMaps("dns").Get(ctx, "webhook-state", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	configMap.Data["other"] = "kept"
+	if _, err := clientset.CoreV1().ConfigMaps("dns").Update(ctx, configMap, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Save(ctx, "state.json", []byte(`{"v":3}`)); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if data, _ := store.Load(ctx, "other"); string(data) != "kept" {
+		t.Errorf("Load(other) = %q, want kept", data)
+	}
+}
+
+func TestConfigMapStoreMissingKey(t *testing.T) {
+	configMap := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "state"}}
+	store := newClient(fake.NewSimpleClientset(configMap)).NewConfigMapStore("state")
+
+	data, err := store.Load(context.Background(), "state.json")
+	if err != nil || data != nil {
+		t.Errorf("Load() = %q, %v, want nothing for a missing key", data, err)
+	}
+}
@@ -0,0 +1,160 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+)
+
+// DiscoveryWorkload uses the nodes where the ingress controller DaemonSet or Deployment has Running
+// pods, so that DNS follows where the controller is actually scheduled.
+const DiscoveryWorkload = "workload"
+
+// Supported kinds of the ingress controller workload.
+const (
+	WorkloadDaemonSet  = "daemonset"
+	WorkloadDeployment = "deployment"
+)
+
+// ParseWorkload parses a `namespace/kind/name` workload reference, kind being daemonset or deployment.
+func ParseWorkload(workload string) (namespace, kind, name string, err error) {
+	parts := strings.Split(workload, "/")
+	if len(parts) != 3 || parts[0] == "" || parts[2] == "" {
+		return "", "", "", fmt.Errorf("invalid workload %q, expected namespace/kind/name", workload)
+	}
+	kind = strings.ToLower(parts[1])
+	if kind != WorkloadDaemonSet && kind != WorkloadDeployment {
+		return "", "", "", fmt.Errorf("invalid workload kind %q, expected %s or %s", parts[1], WorkloadDaemonSet, WorkloadDeployment)
+	}
+	return parts[0], kind, parts[2], nil
+}
+
+// workloadNodes narrows the nodes down to the ones where the ingress controller workload has
+// Running pods.
+//
+// A workload without any Running pod returns an error rather than an empty node set, so that an
+// ingress controller outage does not remove every alias.
+func (c *Client) workloadNodes(ctx context.Context, nodes []corev1.Node) ([]corev1.Node, error) {
+	factory, err := c.workloadInformers(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	selector, err := c.workloadSelector(factory)
+	if err != nil {
+		return nil, err
+	}
+	pods, err := factory.Core().V1().Pods().Lister().Pods(c.workloadNamespace).List(selector)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the pods of %s: %w", c.workloadRef(), err)
+	}
+
+	running := make(map[string]struct{})
+	for _, pod := range pods {
+		if isRunning(pod) {
+			running[pod.Spec.NodeName] = struct{}{}
+		}
+	}
+	if len(running) == 0 {
+		return nil, fmt.Errorf("%s has no running pods", c.workloadRef())
+	}
+	return nodesIn(nodes, running), nil
+}
+
+// workloadSelector returns the pod selector of the ingress controller workload.
+func (c *Client) workloadSelector(factory informers.SharedInformerFactory) (labels.Selector, error) {
+	var podSelector *metav1.LabelSelector
+	switch c.workloadKind {
+	case WorkloadDaemonSet:
+		daemonSet, err := factory.Apps().V1().DaemonSets().Lister().DaemonSets(c.workloadNamespace).Get(c.workloadName)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get %s: %w", c.workloadRef(), err)
+		}
+		podSelector = daemonSet.Spec.Selector
+	default:
+		deployment, err := factory.Apps().V1().Deployments().Lister().Deployments(c.workloadNamespace).Get(c.workloadName)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get %s: %w", c.workloadRef(), err)
+		}
+		podSelector = deployment.Spec.Selector
+	}
+
+	selector, err := metav1.LabelSelectorAsSelector(podSelector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pod selector of %s: %w", c.workloadRef(), err)
+	}
+	return selector, nil
+}
+
+// isRunning reports whether a pod is Running on a node and not being deleted.
+func isRunning(pod *corev1.Pod) bool {
+	return pod.Status.Phase == corev1.PodRunning && pod.Spec.NodeName != "" && pod.DeletionTimestamp == nil
+}
+
+// workloadRef returns the `namespace/kind/name` reference of the ingress controller workload.
+func (c *Client) workloadRef() string {
+	return c.workloadNamespace + "/" + c.workloadKind + "/" + c.workloadName
+}
+
+// workloadInformers returns the informer factory of the ingress controller workload namespace, with
+// its workload and Pod caches synced.
+func (c *Client) workloadInformers(ctx context.Context) (informers.SharedInformerFactory, error) {
+	return c.namespaceInformers(ctx, c.workloadNamespace,
+		func(factory informers.SharedInformerFactory) cache.SharedIndexInformer {
+			if c.workloadKind == WorkloadDaemonSet {
+				return factory.Apps().V1().DaemonSets().Informer()
+			}
+			return factory.Apps().V1().Deployments().Informer()
+		},
+		func(factory informers.SharedInformerFactory) cache.SharedIndexInformer {
+			return factory.Core().V1().Pods().Informer()
+		})
+}
+
+// onIngressWorkloadChange calls fn whenever a pod of the ingress controller workload changes.
+func (c *Client) onIngressWorkloadChange(ctx context.Context, fn func(reason string)) error {
+	factory, err := c.workloadInformers(ctx)
+	if err != nil {
+		return err
+	}
+
+	changed := func(obj any) {
+		if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+			obj = tombstone.Obj
+		}
+		pod, ok := obj.(*corev1.Pod)
+		if !ok {
+			return
+		}
+		selector, err := c.workloadSelector(factory)
+		if err == nil && selector.Matches(labels.Set(pod.Labels)) {
+			fn("pod " + pod.Name + " of " + c.workloadRef() + " changed")
+		}
+	}
+
+	_, err = factory.Core().V1().Pods().Informer().AddEventHandler(cache.ResourceEventHandlerDetailedFuncs{
+		AddFunc: func(obj any, isInInitialList bool) {
+			if !isInInitialList {
+				changed(obj)
+			}
+		},
+		UpdateFunc: func(oldObj, newObj any) {
+			oldPod, oldOK := oldObj.(*corev1.Pod)
+			newPod, newOK := newObj.(*corev1.Pod)
+			if oldOK && newOK && (isRunning(oldPod) != isRunning(newPod) || oldPod.Spec.NodeName != newPod.Spec.NodeName) {
+				changed(newObj)
+			}
+		},
+		DeleteFunc: changed,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to watch the pods of %s: %w", c.workloadRef(), err)
+	}
+	return nil
+}
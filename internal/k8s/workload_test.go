@@ -0,0 +1,73 @@
+package k8s
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestParseWorkload(t *testing.T) {
+	tests := []struct {
+		name     string
+		workload string
+		expected [3]string
+		wantErr  bool
+	}{
+		{name: "DaemonSet", workload: "ingress/daemonset/controller", expected: [3]string{"ingress", "daemonset", "controller"}},
+		{name: "Deployment kind case", workload: "ingress/Deployment/controller", expected: [3]string{"ingress", "deployment", "controller"}},
+		{name: "Unsupported kind", workload: "ingress/statefulset/controller", wantErr: true},
+		{name: "Missing namespace", workload: "daemonset/controller", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			namespace, kind, name, err := ParseWorkload(tt.workload)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseWorkload() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && [3]string{namespace, kind, name} != tt.expected {
+				t.Errorf("ParseWorkload() = %v, want %v", [3]string{namespace, kind, name}, tt.expected)
+			}
+		})
+	}
+}
+
+func TestClientWorkloadNodes(t *testing.T) {
+	daemonSet := &appsv1.DaemonSet{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ingress", Name: "controller"},
+		Spec:       appsv1.DaemonSetSpec{Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "ingress"}}},
+	}
+	pod := func(name, node string, phase corev1.PodPhase, podLabels map[string]string) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ingress", Name: name, Labels: podLabels},
+			Spec:       corev1.PodSpec{NodeName: node},
+			Status:     corev1.PodStatus{Phase: phase},
+		}
+	}
+	ingress := map[string]string{"app": "ingress"}
+	clientset := fake.NewSimpleClientset(daemonSet,
+		pod("running", "node-a", corev1.PodRunning, ingress),
+		pod("pending", "node-b", corev1.PodPending, ingress),
+		pod("other", "node-c", corev1.PodRunning, map[string]string{"app": "other"}),
+	)
+	nodes := []corev1.Node{testNode("node-a", corev1.ConditionTrue, false), testNode("node-b", corev1.ConditionTrue, false), testNode("node-c", corev1.ConditionTrue, false)}
+
+	c := newClient(clientset)
+	c.workloadNamespace, c.workloadKind, c.workloadName = "ingress", WorkloadDaemonSet, "controller"
+	got, err := c.workloadNodes(context.Background(), nodes)
+	if err != nil {
+		t.Fatalf("workloadNodes() error = %v", err)
+	}
+	var names []string
+	for _, node := range got {
+		names = append(names, node.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"node-a"}) {
+		t.Errorf("workloadNodes() = %v, want [node-a]", names)
+	}
+}
@@ -0,0 +1,65 @@
+package log
+
+import (
+	"path"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// Fields locating the source of a message.
+const (
+	// ComponentField holds the component a message comes from: server, provider, cern or k8s.
+	ComponentField = "component"
+	// CallerField holds the file and line a message comes from, e.g. `cern/manager.go:123`.
+	CallerField = "caller"
+)
+
+// componentNames maps the packages whose name differs from their component.
+var componentNames = map[string]string{
+	"webhook": "server",
+}
+
+// logPackage is the import path of this package, whose frames are skipped to find the caller.
+var logPackage = reflect.TypeOf(LevelVar{}).PkgPath()
+
+// callerFrame returns the frame of the code calling the logger, skipping the frames of this package,
+// e.g. of the loggers wrapping others.
+func callerFrame() runtime.Frame {
+	var pcs [16]uintptr
+	// Skip runtime.Callers and callerFrame itself.
+	n := runtime.Callers(2, pcs[:])
+	frames := runtime.CallersFrames(pcs[:n])
+	for {
+		frame, more := frames.Next()
+		if !more || packageOf(frame.Function) != logPackage || strings.HasSuffix(frame.File, "_test.go") {
+			return frame
+		}
+	}
+}
+
+// packageOf returns the import path of the package of a function, as named in a runtime.Frame, e.g.
+// `example.com/internal/cern.(*Manager).SyncState`.
+func packageOf(function string) string {
+	slash := strings.LastIndex(function, "/")
+	if dot := strings.Index(function[slash+1:], "."); dot >= 0 {
+		return function[:slash+1+dot]
+	}
+	return function
+}
+
+// componentOf returns the component of the code of a frame, named after its package.
+func componentOf(frame runtime.Frame) string {
+	name := path.Base(packageOf(frame.Function))
+	if component, ok := componentNames[name]; ok {
+		return component
+	}
+	return name
+}
+
+// callerOf returns the file and line of a frame, with the directory of the file, e.g.
+// `cern/manager.go:123`.
+func callerOf(frame runtime.Frame) string {
+	return path.Join(path.Base(path.Dir(frame.File)), path.Base(frame.File)) + ":" + strconv.Itoa(frame.Line)
+}
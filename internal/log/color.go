@@ -0,0 +1,58 @@
+package log
+
+import (
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// ColorMode defines when the console format uses colors.
+type ColorMode string
+
+// Defines the available color modes.
+const (
+	// ColorAuto uses colors when writing to a terminal, unless the NO_COLOR environment variable is
+	// set, following https://no-color.org.
+	ColorAuto ColorMode = "auto"
+
+	// ColorAlways uses colors, whatever the output and NO_COLOR.
+	ColorAlways ColorMode = "always"
+
+	// ColorNever never uses colors.
+	ColorNever ColorMode = "never"
+)
+
+// NoColorEnv is the environment variable disabling colors in the ColorAuto mode when set and not
+// empty.
+const NoColorEnv = "NO_COLOR"
+
+// ColorModeFromString parses a string and returns the corresponding color mode.
+//
+// This function is case-insensitive. If the string does not match any known
+// mode, it returns false.
+func ColorModeFromString(name string) (ColorMode, bool) {
+	switch mode := ColorMode(strings.ToLower(name)); mode {
+	case ColorAuto, ColorAlways, ColorNever:
+		return mode, true
+	default:
+		return "", false
+	}
+}
+
+// useColor reports whether the console format writes colors to out in the given mode, the empty
+// mode standing for ColorAuto. Logs piped to a file or a CI runner are never colored in that mode.
+func useColor(mode ColorMode, out io.Writer) bool {
+	switch mode {
+	case ColorAlways:
+		return true
+	case ColorNever:
+		return false
+	}
+	if os.Getenv(NoColorEnv) != "" {
+		return false
+	}
+	f, ok := out.(*os.File)
+	return ok && term.IsTerminal(int(f.Fd()))
+}
@@ -0,0 +1,50 @@
+package log
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestUseColor(t *testing.T) {
+	file, err := os.CreateTemp(t.TempDir(), "log")
+	if err != nil {
+		t.Fatalf("failed to create a file: %v", err)
+	}
+	defer file.Close()
+
+	tests := []struct {
+		name     string
+		mode     ColorMode
+		noColor  string
+		out      io.Writer
+		expected bool
+	}{
+		{name: "Always", mode: ColorAlways, noColor: "1", out: &bytes.Buffer{}, expected: true},
+		{name: "Never", mode: ColorNever, out: os.Stdout, expected: false},
+		{name: "Auto to a buffer", mode: ColorAuto, out: &bytes.Buffer{}, expected: false},
+		{name: "Auto to a file", out: file, expected: false},
+		{name: "Auto with NO_COLOR", mode: ColorAuto, noColor: "1", out: os.Stdout, expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(NoColorEnv, tt.noColor)
+			if got := useColor(tt.mode, tt.out); got != tt.expected {
+				t.Errorf("useColor() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestConsoleColor(t *testing.T) {
+	for mode, colored := range map[ColorMode]bool{ColorAlways: true, ColorNever: false, ColorAuto: false} {
+		var buf bytes.Buffer
+		NewLoggerWithOptions(Options{Level: LevelInfo, Output: &buf, Color: mode}).Info("synced")
+		if got := strings.Contains(buf.String(), "\x1b["); got != colored {
+			t.Errorf("mode %s: output %q has colors %v, want %v", mode, buf.String(), got, colored)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package log
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"slices"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Fields identifying the unit of work a message belongs to.
+const (
+	// RequestIDField holds the ID of a request, or of a reconciliation.
+	RequestIDField = "request_id"
+	// EndpointField holds the endpoint of a request, e.g. `POST /records`.
+	EndpointField = "endpoint"
+	// TraceIDField holds the ID of the trace of the span carried by the context.
+	TraceIDField = "trace_id"
+	// SpanIDField holds the ID of the span carried by the context.
+	SpanIDField = "span_id"
+)
+
+// contextKey is the key of the Logger stored in a context.
+type contextKey struct{}
+
+// fieldsKey is the key of the request-scoped fields stored in a context.
+type fieldsKey struct{}
+
+// field is a request-scoped field stored in a context.
+type field struct {
+	key   string
+	value any
+}
+
+// WithField returns a copy of ctx carrying a request-scoped field, e.g. the ID of the request being
+// served. The field is added to the messages logged with the ctx-taking methods of any Logger, and
+// by the logger returned by FromContext.
+func WithField(ctx context.Context, key string, value any) context.Context {
+	parent, _ := ctx.Value(fieldsKey{}).([]field)
+	fields := make([]field, 0, len(parent)+1)
+	for _, f := range parent {
+		if f.key != key {
+			fields = append(fields, f)
+		}
+	}
+	return context.WithValue(ctx, fieldsKey{}, append(fields, field{key: key, value: value}))
+}
+
+// contextFields returns the request-scoped fields carried by ctx, in the order they were added,
+// followed by the trace and span IDs of the span carried by ctx, if any, so that the messages can
+// be correlated with the traces.
+func contextFields(ctx context.Context) []field {
+	fields, _ := ctx.Value(fieldsKey{}).([]field)
+	if spanContext := trace.SpanContextFromContext(ctx); spanContext.IsValid() {
+		fields = append(slices.Clip(fields),
+			field{key: TraceIDField, value: spanContext.TraceID().String()},
+			field{key: SpanIDField, value: spanContext.SpanID().String()})
+	}
+	return fields
+}
+
+// NewContext returns a copy of ctx carrying the given logger.
+//
+// This is how the components pass the Logger they were given down to the code they call. The
+// fields identifying a request are added to the context with WithField.
+func NewContext(ctx context.Context, logger Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, logger)
+}
+
+// FromContext returns the logger carried by ctx, or the GlobalLogger if there is none, with the
+// request-scoped fields of ctx.
+func FromContext(ctx context.Context) Logger {
+	logger, ok := ctx.Value(contextKey{}).(Logger)
+	if !ok {
+		logger = GlobalLogger
+	}
+	for _, f := range contextFields(ctx) {
+		logger = logger.With(f.key, f.value)
+	}
+	return logger
+}
+
+// NewRequestID returns a random ID for a request, 16 hexadecimal characters long.
+func NewRequestID() string {
+	var id [8]byte
+	// crypto/rand never fails on the supported platforms.
+	_, _ = rand.Read(id[:])
+	return hex.EncodeToString(id[:])
+}
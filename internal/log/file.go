@@ -0,0 +1,38 @@
+package log
+
+import (
+	"io"
+	"math"
+	"time"
+
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// FileOptions configures a rotated log file created by NewFileWriter.
+type FileOptions struct {
+	// Path is the log file. Its directory is created if needed.
+	Path string
+	// MaxSize is the size in megabytes at which the file is rotated.
+	MaxSize int
+	// MaxAge is how long rotated files are kept, forever if zero. It is rounded up to whole days.
+	MaxAge time.Duration
+	// MaxBackups is the number of rotated files kept, all if zero.
+	MaxBackups int
+	// Compress gzips the rotated files.
+	Compress bool
+}
+
+// NewFileWriter creates a writer appending to a log file, rotated when it reaches its maximum size.
+// The rotated files are renamed with a timestamp, and removed once too old or too many.
+//
+// It is meant for bare-VM deployments without a container log collector. The file is opened on the
+// first write.
+func NewFileWriter(opts FileOptions) io.WriteCloser {
+	return &lumberjack.Logger{
+		Filename:   opts.Path,
+		MaxSize:    opts.MaxSize,
+		MaxAge:     int(math.Ceil(opts.MaxAge.Hours() / 24)),
+		MaxBackups: opts.MaxBackups,
+		Compress:   opts.Compress,
+	}
+}
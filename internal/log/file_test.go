@@ -0,0 +1,24 @@
+package log
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNewFileWriter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "webhook.log")
+	out := NewFileWriter(FileOptions{Path: path, MaxSize: 1, MaxBackups: 2})
+	defer out.Close()
+
+	NewLoggerWithOptions(Options{Level: LevelInfo, Format: FormatJSON, Output: out}).Info("synced")
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read the log file: %v", err)
+	}
+	if !strings.Contains(string(data), `"message":"synced"`) {
+		t.Errorf("log file = %q, want the message", data)
+	}
+}
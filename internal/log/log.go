@@ -3,13 +3,19 @@
 // This package provides the core types and contracts for creating and using structured logging.
 // The design is centered around the Logger interface, which decouples the application from any specific
 // logging implementation. This allows for easy swapping of logging backends (e.g., zerolog, logrus)
-// without changing the application code.
+// without changing the application code. Two implementations are provided: ZeroLogger, used by the
+// webhook, and SlogLogger, backed by any log/slog handler for the code embedding the webhook.
 //
-// The package also defines a set of standard log levels and provides a global logger instance
-// for convenience.
+// The package also defines a set of standard log levels and provides a global logger instance,
+// only used as the fallback of the contexts carrying no logger.
 package log
 
-import "strings"
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync/atomic"
+)
 
 // Level defines the severity of a log message.
 // Using a custom type for log levels provides type safety and allows for easy extension.
@@ -19,9 +25,14 @@ type Level int
 // The iota keyword is used to create a set of incrementing integer constants,
 // which is a common and efficient way to define enums in Go.
 const (
+	// LevelTrace is for full payloads, e.g. the changes received from ExternalDNS and the
+	// metadata written to OpenStack. It is kept out of LevelDebug so that normal
+	// troubleshooting sessions are not flooded.
+	LevelTrace Level = iota
+
 	// LevelDebug is for detailed, diagnostic information, typically only
 	// useful during development and debugging.
-	LevelDebug Level = iota
+	LevelDebug
 
 	// LevelInfo is for general, informational messages that highlight
 	// the progress or state of the application.
@@ -44,6 +55,7 @@ var (
 	// LevelNames is a map of log levels to their string representations.
 	// This is useful for parsing log levels from configuration and for printing log levels in a human-readable format.
 	LevelNames = map[Level]string{
+		LevelTrace: "trace",
 		LevelDebug: "debug",
 		LevelInfo:  "info",
 		LevelWarn:  "warn",
@@ -51,12 +63,63 @@ var (
 	}
 
 	// GlobalLogger is a global instance of the Logger interface.
-	// This is provided for convenience, allowing any part of the application to log messages
-	// without needing to explicitly pass a logger instance.
-	// It is the responsibility of the main application to initialize this logger.
+	// It is the responsibility of the main application to initialize this logger. It is only used
+	// by FromContext for the contexts carrying no logger.
+	//
+	// Deprecated: the components are given their Logger by their constructors, and pass it down
+	// through their contexts with NewContext. Use FromContext or the injected Logger instead.
 	GlobalLogger Logger
 )
 
+// LevelVar is a log level that can be changed at runtime, safely for concurrent use.
+// The zero value is LevelTrace.
+type LevelVar struct {
+	level atomic.Int32
+}
+
+// Level returns the current level.
+func (v *LevelVar) Level() Level {
+	return Level(v.level.Load())
+}
+
+// Set changes the current level.
+func (v *LevelVar) Set(level Level) {
+	v.level.Store(int32(level))
+}
+
+// Enabled reports whether messages of the given level are written at the current level.
+func (v *LevelVar) Enabled(level Level) bool {
+	return level >= v.Level()
+}
+
+// Format defines how log messages are written.
+type Format string
+
+// Defines the available log output formats.
+const (
+	// FormatConsole writes human-readable, colored lines, convenient during development.
+	FormatConsole Format = "console"
+
+	// FormatJSON writes one JSON object per message, for central log aggregation.
+	FormatJSON Format = "json"
+
+	// DefaultFormat represents the fallback output format for all the application.
+	DefaultFormat = FormatConsole
+)
+
+// FormatFromString parses a string and returns the corresponding output format.
+//
+// This function is case-insensitive. If the string does not match any known
+// format, it returns false.
+func FormatFromString(name string) (Format, bool) {
+	switch format := Format(strings.ToLower(name)); format {
+	case FormatConsole, FormatJSON:
+		return format, true
+	default:
+		return "", false
+	}
+}
+
 // levelValues is a reverse map of log level names to their Level values.
 // This is used for efficient parsing of log levels from strings.
 var levelValues = make(map[string]Level)
@@ -78,6 +141,11 @@ func init() {
 // logging library. This allows for greater flexibility and makes it easier to
 // switch to a different logging implementation in the future if needed.
 type Logger interface {
+	// Trace logs a formatted message at the Trace level.
+	// Arguments are handled in the manner of fmt.Sprintf, and only formatted if the
+	// message is logged, so payloads can be passed through JSON cheaply.
+	Trace(format string, args ...any)
+
 	// Debug logs a formatted message at the Debug level.
 	// Arguments are handled in the manner of fmt.Sprintf.
 	Debug(format string, args ...any)
@@ -93,6 +161,26 @@ type Logger interface {
 	// Error logs a formatted message at the Error level.
 	// Arguments are handled in the manner of fmt.Sprintf.
 	Error(format string, args ...any)
+
+	// TraceCtx, DebugCtx, InfoCtx, WarnCtx and ErrorCtx log a formatted message like their
+	// counterparts, adding the request-scoped fields of ctx, set with WithField, e.g. the ID of the
+	// request being served.
+	TraceCtx(ctx context.Context, format string, args ...any)
+	DebugCtx(ctx context.Context, format string, args ...any)
+	InfoCtx(ctx context.Context, format string, args ...any)
+	WarnCtx(ctx context.Context, format string, args ...any)
+	ErrorCtx(ctx context.Context, format string, args ...any)
+
+	// With returns a child logger adding the given field to every message.
+	// The receiver is left unchanged.
+	With(key string, value any) Logger
+
+	// GetLevel returns the minimum level of the messages written.
+	GetLevel() Level
+
+	// SetLevel changes the minimum level of the messages written, at runtime.
+	// It applies to the logger and to every logger derived from it with With.
+	SetLevel(level Level)
 }
 
 // LevelFromString parses a string and returns the corresponding log level.
@@ -104,3 +192,25 @@ func LevelFromString(name string) (Level, bool) {
 	level, ok := levelValues[strings.ToLower(name)]
 	return level, ok
 }
+
+// JSON wraps a value so that the %s and %v verbs format it as JSON.
+//
+// The value is only encoded when the message is actually written, which makes it suitable
+// for logging full payloads at the Trace level.
+func JSON(v any) any {
+	return jsonValue{v: v}
+}
+
+// jsonValue is a value formatted as JSON.
+type jsonValue struct {
+	v any
+}
+
+// String implements the fmt.Stringer interface.
+func (j jsonValue) String() string {
+	data, err := json.Marshal(j.v)
+	if err != nil {
+		return "!(json: " + err.Error() + ")"
+	}
+	return string(data)
+}
@@ -0,0 +1,145 @@
+package log
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+)
+
+// SlogLevelTrace is the slog level of the Trace messages, below slog.LevelDebug.
+const SlogLevelTrace = slog.Level(-8)
+
+// slogLevels maps the application's log levels to the slog levels.
+var slogLevels = map[Level]slog.Level{
+	LevelTrace: SlogLevelTrace,
+	LevelDebug: slog.LevelDebug,
+	LevelInfo:  slog.LevelInfo,
+	LevelWarn:  slog.LevelWarn,
+	LevelError: slog.LevelError,
+}
+
+// SlogLogger is an adapter that implements the Logger interface on top of a slog.Handler.
+//
+// It lets the code embedding the webhook plug in its existing slog handlers, e.g. to share their
+// output and configuration. Messages are written when enabled both by the logger's own level, which
+// can be changed at runtime, and by the handler. The component of every message is added in the
+// component field, and its source is set for the handlers adding it.
+type SlogLogger struct {
+	handler slog.Handler
+	// level is shared with the child loggers, so that changing it at runtime applies to all.
+	level *LevelVar
+	// keys are the fields added with With, which the request-scoped fields of a context do not repeat.
+	keys []string
+}
+
+// NewSlogLogger creates a Logger writing to the given slog handler, from the given level.
+func NewSlogLogger(handler slog.Handler, level Level) *SlogLogger {
+	l := &SlogLogger{handler: handler, level: new(LevelVar)}
+	l.level.Set(level)
+	return l
+}
+
+// Handler returns the underlying slog handler, with the fields added with With, for advanced
+// configuration or to create a slog.Logger sharing the output.
+func (l *SlogLogger) Handler() slog.Handler {
+	return l.handler
+}
+
+// Trace logs a formatted message at the Trace level.
+func (l *SlogLogger) Trace(format string, args ...any) {
+	l.log(context.Background(), LevelTrace, format, args)
+}
+
+// Debug logs a formatted message at the Debug level.
+func (l *SlogLogger) Debug(format string, args ...any) {
+	l.log(context.Background(), LevelDebug, format, args)
+}
+
+// Info logs a formatted message at the Info level.
+func (l *SlogLogger) Info(format string, args ...any) {
+	l.log(context.Background(), LevelInfo, format, args)
+}
+
+// Warn logs a formatted message at the Warn level.
+func (l *SlogLogger) Warn(format string, args ...any) {
+	l.log(context.Background(), LevelWarn, format, args)
+}
+
+// Error logs a formatted message at the Error level.
+func (l *SlogLogger) Error(format string, args ...any) {
+	l.log(context.Background(), LevelError, format, args)
+}
+
+// TraceCtx logs a formatted message at the Trace level, with the request-scoped fields of ctx.
+func (l *SlogLogger) TraceCtx(ctx context.Context, format string, args ...any) {
+	l.logCtx(ctx, LevelTrace, format, args)
+}
+
+// DebugCtx logs a formatted message at the Debug level, with the request-scoped fields of ctx.
+func (l *SlogLogger) DebugCtx(ctx context.Context, format string, args ...any) {
+	l.logCtx(ctx, LevelDebug, format, args)
+}
+
+// InfoCtx logs a formatted message at the Info level, with the request-scoped fields of ctx.
+func (l *SlogLogger) InfoCtx(ctx context.Context, format string, args ...any) {
+	l.logCtx(ctx, LevelInfo, format, args)
+}
+
+// WarnCtx logs a formatted message at the Warn level, with the request-scoped fields of ctx.
+func (l *SlogLogger) WarnCtx(ctx context.Context, format string, args ...any) {
+	l.logCtx(ctx, LevelWarn, format, args)
+}
+
+// ErrorCtx logs a formatted message at the Error level, with the request-scoped fields of ctx.
+func (l *SlogLogger) ErrorCtx(ctx context.Context, format string, args ...any) {
+	l.logCtx(ctx, LevelError, format, args)
+}
+
+// logCtx logs a message with the request-scoped fields of ctx, except those the logger already
+// adds. The context is also passed to the handler.
+func (l *SlogLogger) logCtx(ctx context.Context, level Level, format string, args []any, attrs ...slog.Attr) {
+	for _, f := range contextFields(ctx) {
+		if !slices.Contains(l.keys, f.key) {
+			attrs = append(attrs, slog.Any(f.key, f.value))
+		}
+	}
+	l.log(ctx, level, format, args, attrs...)
+}
+
+// log hands a message to the handler if enabled. The arguments are only formatted then.
+func (l *SlogLogger) log(ctx context.Context, level Level, format string, args []any, attrs ...slog.Attr) {
+	slogLevel := slogLevels[level]
+	if !l.level.Enabled(level) || !l.handler.Enabled(ctx, slogLevel) {
+		return
+	}
+	// The source of the record is the code calling the logger, for the handlers adding it.
+	frame := callerFrame()
+	record := slog.NewRecord(time.Now(), slogLevel, fmt.Sprintf(format, args...), frame.PC+1)
+	record.AddAttrs(slog.String(ComponentField, componentOf(frame)))
+	record.AddAttrs(attrs...)
+	// Like the standard slog.Logger, the errors of the handler are ignored.
+	_ = l.handler.Handle(ctx, record)
+}
+
+// With returns a child logger adding the given field to every message.
+// It uses the WithAttrs method of the handler, so the field is encoded only once.
+func (l *SlogLogger) With(key string, value any) Logger {
+	return &SlogLogger{
+		handler: l.handler.WithAttrs([]slog.Attr{slog.Any(key, value)}),
+		level:   l.level,
+		keys:    append(slices.Clip(l.keys), key),
+	}
+}
+
+// GetLevel returns the minimum level of the messages written.
+func (l *SlogLogger) GetLevel() Level {
+	return l.level.Level()
+}
+
+// SetLevel changes the minimum level of the messages written, for the logger and the loggers
+// derived from it. The handler may still drop the messages below its own level.
+func (l *SlogLogger) SetLevel(level Level) {
+	l.level.Set(level)
+}
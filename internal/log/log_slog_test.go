@@ -0,0 +1,77 @@
+package log
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestSlogLogger(t *testing.T) {
+	var buf bytes.Buffer
+	handler := slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: SlogLevelTrace})
+	logger := NewSlogLogger(handler, LevelInfo)
+	var _ Logger = logger
+
+	ctx := WithField(context.Background(), RequestIDField, "abc")
+	ctx = WithField(ctx, EndpointField, "POST /records")
+
+	tests := []struct {
+		name     string
+		log      func()
+		expected map[string]any
+	}{
+		{
+			name: "Below the level",
+			log:  func() { logger.Debug("hidden %d", 1) },
+		},
+		{
+			name:     "Formatted message",
+			log:      func() { logger.Warn("synced %d records", 3) },
+			expected: map[string]any{"level": "WARN", "msg": "synced 3 records"},
+		},
+		{
+			name:     "Context fields",
+			log:      func() { logger.With(RequestIDField, "abc").ErrorCtx(ctx, "failed") },
+			expected: map[string]any{"level": "ERROR", "msg": "failed", RequestIDField: "abc", EndpointField: "POST /records"},
+		},
+		{
+			name: "Level changed at runtime",
+			log: func() {
+				child := logger.With("node", "ingress-1")
+				logger.SetLevel(LevelTrace)
+				defer logger.SetLevel(LevelInfo)
+				child.Trace("payload")
+			},
+			expected: map[string]any{"level": "DEBUG-4", "msg": "payload", "node": "ingress-1", ComponentField: "log"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf.Reset()
+			tt.log()
+
+			if tt.expected == nil {
+				if buf.Len() != 0 {
+					t.Errorf("output = %q, want nothing", buf.String())
+				}
+				return
+			}
+			if n := strings.Count(buf.String(), RequestIDField); n > 1 {
+				t.Errorf("output %q repeats the request ID", buf.String())
+			}
+			var entry map[string]any
+			if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+				t.Fatalf("output %q is not a single JSON object: %v", buf.String(), err)
+			}
+			for key, value := range tt.expected {
+				if entry[key] != value {
+					t.Errorf("entry[%s] = %v, want %v", key, entry[key], value)
+				}
+			}
+		})
+	}
+}
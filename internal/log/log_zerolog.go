@@ -2,8 +2,11 @@
 package log
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"os"
+	"slices"
 	"time"
 
 	"github.com/rs/zerolog"
@@ -17,6 +20,31 @@ import (
 // specifics of the zerolog library.
 type ZeroLogger struct {
 	logger zerolog.Logger
+	// level is shared with the child loggers, so that changing it at runtime applies to all.
+	level *LevelVar
+	// caller adds the file and line of the code logging every message.
+	caller bool
+	// keys are the fields added with With, which the request-scoped fields of a context do not repeat.
+	keys []string
+}
+
+// Options configures a Logger created by NewLoggerWithOptions.
+type Options struct {
+	// Level is the minimum level of the messages written.
+	Level Level
+	// Format is the output format, FormatConsole if empty.
+	Format Format
+	// Output is where the messages are written, os.Stdout if nil.
+	Output io.Writer
+	// Caller adds the file and line of the code logging every message, in the caller field. The
+	// component field is always added.
+	Caller bool
+	// Color defines when the console format uses colors, ColorAuto if empty.
+	Color ColorMode
+	// Secrets are scrubbed from every message, e.g. the configured passwords and tokens, along with
+	// the secrets added with AddSecret. The values of the Authorization and token headers are always
+	// scrubbed.
+	Secrets []string
 }
 
 // NewLogger creates a new Logger implementation that uses zerolog as the backend.
@@ -26,47 +54,168 @@ type ZeroLogger struct {
 // The choice of zerolog was based on its performance and structured logging capabilities,
 // which are well-suited for a production environment.
 func NewLogger(level Level) Logger {
-	// Parse the application's log level into a zerolog-compatible level.
-	loggerLevel, err := zerolog.ParseLevel(LevelNames[level])
-	if err != nil {
+	return NewLoggerWithOptions(Options{Level: level})
+}
+
+// NewNopLogger creates a Logger discarding every message, e.g. for tests.
+func NewNopLogger() Logger {
+	return NewLoggerWithOptions(Options{Level: LevelError, Format: FormatJSON, Output: io.Discard})
+}
+
+// NewLoggerWithOptions creates a new zerolog Logger from the given options.
+//
+// With FormatJSON every message is written as a JSON object with the `level`, `time` and `message`
+// fields, which log aggregators can parse without any configuration.
+func NewLoggerWithOptions(opts Options) Logger {
+	// Check that the application's log level maps to a zerolog-compatible level.
+	if _, err := zerolog.ParseLevel(LevelNames[opts.Level]); err != nil {
 		// If the log level is invalid, print an error and continue.
 		// This is a rare case that should only happen if the LevelNames map is out of sync.
-		fmt.Printf("Error creating logger with level %s\n", LevelNames[level])
+		fmt.Printf("Error creating logger with level %s\n", LevelNames[opts.Level])
+	}
+
+	out := opts.Output
+	if out == nil {
+		out = os.Stdout
+	}
+	color := useColor(opts.Color, out)
+	// The messages are scrubbed as they are finally written, whatever the format.
+	out = newRedactWriter(out, opts.Secrets)
+	// The console format is meant for humans, JSON is zerolog's native output. The outputs handling
+	// levels, like the syslog one, receive JSON and format the messages themselves.
+	if _, ok := opts.Output.(zerolog.LevelWriter); !ok && opts.Format != FormatJSON {
+		out = zerolog.ConsoleWriter{Out: out, TimeFormat: time.RFC3339, NoColor: !color}
 	}
 
-	// Create a new zerolog.Logger instance.
-	// We use a ConsoleWriter for human-readable output during development.
-	// For a production environment, this could be switched to a JSON writer for easier parsing by log aggregators.
-	logger := zerolog.New(zerolog.ConsoleWriter{Out: os.Stdout, TimeFormat: time.RFC3339}).
-		Level(loggerLevel).
+	// The level is enforced by the ZeroLogger rather than by zerolog, so it can be changed at runtime.
+	level := new(LevelVar)
+	level.Set(opts.Level)
+	logger := zerolog.New(out).
+		Level(zerolog.TraceLevel).
 		With().
 		Timestamp().
 		Logger()
 
 	// Return a new ZeroLogger instance that wraps the configured zerolog.Logger.
-	return &ZeroLogger{logger: logger}
+	return &ZeroLogger{logger: logger, level: level, caller: opts.Caller}
+}
+
+// Trace logs a formatted message at the Trace level.
+// It uses the Msgf method of the underlying zerolog.Logger to format the message.
+func (z *ZeroLogger) Trace(format string, args ...any) {
+	z.event(LevelTrace).Msgf(format, args...)
 }
 
 // Debug logs a formatted message at the Debug level.
 // It uses the Msgf method of the underlying zerolog.Logger to format the message.
 func (z *ZeroLogger) Debug(format string, args ...any) {
-	z.logger.Debug().Msgf(format, args...)
+	z.event(LevelDebug).Msgf(format, args...)
 }
 
 // Info logs a formatted message at the Info level.
 // It uses the Msgf method of the underlying zerolog.Logger to format the message.
 func (z *ZeroLogger) Info(format string, args ...any) {
-	z.logger.Info().Msgf(format, args...)
+	z.event(LevelInfo).Msgf(format, args...)
 }
 
 // Warn logs a formatted message at the Warn level.
 // It uses the Msgf method of the underlying zerolog.Logger to format the message.
 func (z *ZeroLogger) Warn(format string, args ...any) {
-	z.logger.Warn().Msgf(format, args...)
+	z.event(LevelWarn).Msgf(format, args...)
 }
 
 // Error logs a formatted message at the Error level.
 // It uses the Msgf method of the underlying zerolog.Logger to format the message.
 func (z *ZeroLogger) Error(format string, args ...any) {
-	z.logger.Error().Msgf(format, args...)
+	z.event(LevelError).Msgf(format, args...)
+}
+
+// TraceCtx logs a formatted message at the Trace level, with the request-scoped fields of ctx.
+func (z *ZeroLogger) TraceCtx(ctx context.Context, format string, args ...any) {
+	z.withContext(ctx, z.event(LevelTrace)).Msgf(format, args...)
+}
+
+// DebugCtx logs a formatted message at the Debug level, with the request-scoped fields of ctx.
+func (z *ZeroLogger) DebugCtx(ctx context.Context, format string, args ...any) {
+	z.withContext(ctx, z.event(LevelDebug)).Msgf(format, args...)
+}
+
+// InfoCtx logs a formatted message at the Info level, with the request-scoped fields of ctx.
+func (z *ZeroLogger) InfoCtx(ctx context.Context, format string, args ...any) {
+	z.withContext(ctx, z.event(LevelInfo)).Msgf(format, args...)
+}
+
+// WarnCtx logs a formatted message at the Warn level, with the request-scoped fields of ctx.
+func (z *ZeroLogger) WarnCtx(ctx context.Context, format string, args ...any) {
+	z.withContext(ctx, z.event(LevelWarn)).Msgf(format, args...)
+}
+
+// ErrorCtx logs a formatted message at the Error level, with the request-scoped fields of ctx.
+func (z *ZeroLogger) ErrorCtx(ctx context.Context, format string, args ...any) {
+	z.withContext(ctx, z.event(LevelError)).Msgf(format, args...)
+}
+
+// event returns the zerolog event of a message at the given level, with the component and caller
+// of the message, nil when the level is disabled.
+// The methods of a nil event do nothing, so the arguments of a disabled message are never formatted.
+func (z *ZeroLogger) event(level Level) *zerolog.Event {
+	if !z.level.Enabled(level) {
+		return nil
+	}
+	var e *zerolog.Event
+	switch level {
+	case LevelTrace:
+		e = z.logger.Trace()
+	case LevelDebug:
+		e = z.logger.Debug()
+	case LevelInfo:
+		e = z.logger.Info()
+	case LevelWarn:
+		e = z.logger.Warn()
+	default:
+		e = z.logger.Error()
+	}
+
+	frame := callerFrame()
+	e = e.Str(ComponentField, componentOf(frame))
+	if z.caller {
+		e = e.Str(CallerField, callerOf(frame))
+	}
+	return e
+}
+
+// withContext adds the request-scoped fields of ctx to an event, except those the logger already
+// adds, e.g. when it was itself obtained with FromContext.
+func (z *ZeroLogger) withContext(ctx context.Context, e *zerolog.Event) *zerolog.Event {
+	if e == nil {
+		return nil
+	}
+	for _, f := range contextFields(ctx) {
+		if !slices.Contains(z.keys, f.key) {
+			e = e.Interface(f.key, f.value)
+		}
+	}
+	return e
+}
+
+// With returns a child logger adding the given field to every message.
+// It uses the With context of the underlying zerolog.Logger, so the field is encoded only once.
+func (z *ZeroLogger) With(key string, value any) Logger {
+	return &ZeroLogger{
+		logger: z.logger.With().Interface(key, value).Logger(),
+		level:  z.level,
+		caller: z.caller,
+		keys:   append(slices.Clip(z.keys), key),
+	}
+}
+
+// GetLevel returns the minimum level of the messages written.
+func (z *ZeroLogger) GetLevel() Level {
+	return z.level.Level()
+}
+
+// SetLevel changes the minimum level of the messages written, for the logger and the loggers
+// derived from it.
+func (z *ZeroLogger) SetLevel(level Level) {
+	z.level.Set(level)
 }
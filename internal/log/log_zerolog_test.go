@@ -0,0 +1,200 @@
+package log
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestNewLoggerWithOptionsJSON(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLoggerWithOptions(Options{Level: LevelInfo, Format: FormatJSON, Output: &buf})
+
+	logger.Debug("hidden")
+	logger.Info("synced %d records", 3)
+
+	var entry map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("output %q is not a single JSON object: %v", buf.String(), err)
+	}
+	if entry["level"] != "info" || entry["message"] != "synced 3 records" || entry["time"] == nil {
+		t.Errorf("entry = %v, want level, message and time fields", entry)
+	}
+}
+
+func TestNewLoggerWithOptionsConsole(t *testing.T) {
+	var buf bytes.Buffer
+	NewLoggerWithOptions(Options{Level: LevelInfo, Output: &buf}).Info("synced")
+
+	if !strings.Contains(buf.String(), "synced") || strings.HasPrefix(buf.String(), "{") {
+		t.Errorf("output = %q, want a console line", buf.String())
+	}
+}
+
+func TestFormatFromString(t *testing.T) {
+	for name, expected := range map[string]Format{"json": FormatJSON, "Console": FormatConsole} {
+		if format, ok := FormatFromString(name); !ok || format != expected {
+			t.Errorf("FormatFromString(%q) = %q, %v, want %q", name, format, ok, expected)
+		}
+	}
+	if _, ok := FormatFromString("xml"); ok {
+		t.Error("FormatFromString(xml) should fail")
+	}
+}
+
+func TestFromContext(t *testing.T) {
+	var buf bytes.Buffer
+	GlobalLogger = NewLoggerWithOptions(Options{Level: LevelInfo, Format: FormatJSON, Output: &buf})
+
+	if FromContext(context.Background()) != GlobalLogger {
+		t.Error("FromContext() without a logger should return the GlobalLogger")
+	}
+
+	ctx := NewContext(context.Background(), GlobalLogger.With(RequestIDField, "abc").With(EndpointField, "POST /records"))
+	FromContext(ctx).Info("applied")
+
+	var entry map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("output %q is not a single JSON object: %v", buf.String(), err)
+	}
+	if entry[RequestIDField] != "abc" || entry[EndpointField] != "POST /records" {
+		t.Errorf("entry = %v, want the request fields", entry)
+	}
+}
+
+func TestTraceLevel(t *testing.T) {
+	var buf bytes.Buffer
+	NewLoggerWithOptions(Options{Level: LevelDebug, Format: FormatJSON, Output: &buf}).Trace("payload %s", JSON(map[string]int{"a": 1}))
+	if buf.Len() != 0 {
+		t.Errorf("trace message logged at debug level: %q", buf.String())
+	}
+
+	NewLoggerWithOptions(Options{Level: LevelTrace, Format: FormatJSON, Output: &buf}).Trace("payload %s", JSON(map[string]int{"a": 1}))
+	var entry map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("output %q is not a single JSON object: %v", buf.String(), err)
+	}
+	if entry["level"] != "trace" || entry["message"] != `payload {"a":1}` {
+		t.Errorf("entry = %v, want the trace payload", entry)
+	}
+
+	if level, ok := LevelFromString("TRACE"); !ok || level != LevelTrace {
+		t.Errorf("LevelFromString(TRACE) = %v, %v", level, ok)
+	}
+}
+
+func TestCtxMethods(t *testing.T) {
+	var buf bytes.Buffer
+	GlobalLogger = NewLoggerWithOptions(Options{Level: LevelInfo, Format: FormatJSON, Output: &buf})
+
+	ctx := WithField(context.Background(), RequestIDField, "abc")
+	ctx = WithField(ctx, EndpointField, "POST /records")
+	ctx = WithField(ctx, RequestIDField, "def")
+
+	tests := []struct {
+		name   string
+		logger Logger
+	}{
+		{name: "GlobalLogger", logger: GlobalLogger},
+		{name: "Logger from the context", logger: FromContext(ctx)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf.Reset()
+			tt.logger.DebugCtx(ctx, "hidden")
+			tt.logger.ErrorCtx(ctx, "failed")
+
+			if n := strings.Count(buf.String(), RequestIDField); n != 1 {
+				t.Errorf("output %q has %d request IDs, want 1", buf.String(), n)
+			}
+			var entry map[string]any
+			if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+				t.Fatalf("output %q is not a single JSON object: %v", buf.String(), err)
+			}
+			if entry[RequestIDField] != "def" || entry[EndpointField] != "POST /records" || entry["message"] != "failed" {
+				t.Errorf("entry = %v, want the request fields", entry)
+			}
+		})
+	}
+}
+
+func TestTraceFields(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLoggerWithOptions(Options{Level: LevelInfo, Format: FormatJSON, Output: &buf})
+
+	spanContext := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{0x4b, 0xf9, 0x2f, 0x35, 0x77, 0xb3, 0x4d, 0xa6, 0xa3, 0xce, 0x92, 0x9d, 0x0e, 0x0e, 0x47, 0x36},
+		SpanID:     trace.SpanID{0x00, 0xf0, 0x67, 0xaa, 0x0b, 0xa9, 0x02, 0xb7},
+		TraceFlags: trace.FlagsSampled,
+	})
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		want map[string]any
+	}{
+		{
+			name: "span in the context",
+			ctx:  trace.ContextWithSpanContext(context.Background(), spanContext),
+			want: map[string]any{TraceIDField: "4bf92f3577b34da6a3ce929d0e0e4736", SpanIDField: "00f067aa0ba902b7"},
+		},
+		{
+			name: "no span",
+			ctx:  context.Background(),
+			want: map[string]any{TraceIDField: nil, SpanIDField: nil},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf.Reset()
+			logger.InfoCtx(WithField(tt.ctx, RequestIDField, "abc"), "synced")
+
+			var entry map[string]any
+			if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+				t.Fatalf("output %q is not a single JSON object: %v", buf.String(), err)
+			}
+			for key, want := range tt.want {
+				if entry[key] != want {
+					t.Errorf("%s = %v, want %v", key, entry[key], want)
+				}
+			}
+		})
+	}
+}
+
+func TestComponentAndCaller(t *testing.T) {
+	tests := []struct {
+		name   string
+		caller bool
+		log    func(Logger)
+	}{
+		{name: "Without caller", log: func(l Logger) { l.Info("synced") }},
+		{name: "With caller", caller: true, log: func(l Logger) { l.Info("synced") }},
+		{name: "Through a wrapper", caller: true, log: func(l Logger) { WithMinLevel(l, LevelInfo).With("node", "a").Info("synced") }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			tt.log(NewLoggerWithOptions(Options{Level: LevelInfo, Format: FormatJSON, Output: &buf, Caller: tt.caller}))
+
+			var entry map[string]any
+			if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+				t.Fatalf("output %q is not a single JSON object: %v", buf.String(), err)
+			}
+			if entry[ComponentField] != "log" {
+				t.Errorf("component = %v, want log", entry[ComponentField])
+			}
+			caller, _ := entry[CallerField].(string)
+			if tt.caller != strings.HasPrefix(caller, "log/log_zerolog_test.go:") {
+				t.Errorf("caller = %q, want the test file: %v", caller, tt.caller)
+			}
+		})
+	}
+}
@@ -0,0 +1,148 @@
+package log
+
+import (
+	"encoding/json"
+	"io"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/rs/zerolog"
+)
+
+// Redacted replaces the secrets scrubbed from the log messages.
+const Redacted = "[REDACTED]"
+
+// credentialHeaderPattern matches the value of the HTTP headers carrying credentials, as written by
+// fmt (`Authorization: Bearer x`, `map[X-Auth-Token:[x]]`) or in JSON (`"Authorization":["Basic x"]`),
+// possibly escaped in the JSON output.
+// The authentication scheme is kept so that the messages remain useful for debugging.
+var credentialHeaderPattern = regexp.MustCompile(`(?i)((?:proxy-)?authorization|x-auth-token|x-subject-token)(\\?"?\s*[:=]\s*\[?\\?"?)((?:bearer|basic|negotiate)\s+)?[^\s"'\\,\]}]+`)
+
+// addedSecrets holds the secrets added with AddSecret, scrubbed by every logger on top of the
+// secrets of its options.
+var addedSecrets struct {
+	mu sync.Mutex
+	// forms are the forms of the added secrets, see secretForms.
+	forms []string
+	// generation is incremented whenever a secret is added, so the loggers rebuild their replacer.
+	generation atomic.Uint64
+}
+
+// AddSecret scrubs the given secrets from the messages of every logger, including the loggers
+// already created, e.g. the credentials read from a file, which can be rotated while running.
+// Empty secrets are ignored. Secrets are never removed, as a rotated credential may still be valid.
+func AddSecret(secrets ...string) {
+	addedSecrets.mu.Lock()
+	defer addedSecrets.mu.Unlock()
+
+	forms := secretForms(addedSecrets.forms, secrets)
+	if len(forms) != len(addedSecrets.forms) {
+		addedSecrets.forms = forms
+		addedSecrets.generation.Add(1)
+	}
+}
+
+// secretForms appends to forms the forms in which the given secrets appear in the messages and
+// are not in forms yet. Empty secrets are ignored.
+func secretForms(forms []string, secrets []string) []string {
+	for _, secret := range secrets {
+		if secret == "" {
+			continue
+		}
+		// In the JSON output, the quotes, backslashes and control characters of a secret are escaped.
+		encoded, _ := json.Marshal(secret)
+		for _, form := range []string{secret, strings.Trim(string(encoded), `"`)} {
+			if !slices.Contains(forms, form) {
+				forms = append(forms, form)
+			}
+		}
+	}
+	return forms
+}
+
+// redactWriter is the output hook of the loggers, scrubbing the secrets from every message before
+// it is written: the configured and added secrets wherever they appear, and the credential headers.
+//
+// It is applied to the final output, so the fields added with With are scrubbed too.
+type redactWriter struct {
+	out io.Writer
+	// forms are the forms of the configured secrets, see secretForms.
+	forms []string
+	// replacer replaces the configured and added secrets, rebuilt once secrets are added.
+	replacer atomic.Pointer[secretReplacer]
+}
+
+// secretReplacer replaces the secrets known at a generation of the added secrets.
+type secretReplacer struct {
+	generation uint64
+	// replacer is nil when there is no secret.
+	replacer *strings.Replacer
+}
+
+// newRedactWriter wraps out to scrub the given secrets, the ones added with AddSecret and the
+// credential headers. Empty secrets are ignored.
+func newRedactWriter(out io.Writer, secrets []string) *redactWriter {
+	return &redactWriter{out: out, forms: secretForms(nil, secrets)}
+}
+
+// secrets returns the replacer of the configured and added secrets, nil when there is none.
+func (w *redactWriter) secrets() *strings.Replacer {
+	generation := addedSecrets.generation.Load()
+	if cached := w.replacer.Load(); cached != nil && cached.generation == generation {
+		return cached.replacer
+	}
+
+	addedSecrets.mu.Lock()
+	forms := secretForms(slices.Clone(w.forms), addedSecrets.forms)
+	generation = addedSecrets.generation.Load()
+	addedSecrets.mu.Unlock()
+
+	cached := &secretReplacer{generation: generation}
+	if len(forms) > 0 {
+		// The longest secrets are replaced first, so that a secret containing another one is not
+		// partially left.
+		sort.SliceStable(forms, func(i, j int) bool { return len(forms[i]) > len(forms[j]) })
+		pairs := make([]string, 0, 2*len(forms))
+		for _, form := range forms {
+			pairs = append(pairs, form, Redacted)
+		}
+		cached.replacer = strings.NewReplacer(pairs...)
+	}
+	w.replacer.Store(cached)
+	return cached.replacer
+}
+
+// Write scrubs a message and writes it to the underlying output.
+func (w *redactWriter) Write(p []byte) (int, error) {
+	if _, err := w.out.Write(w.scrub(p)); err != nil {
+		return 0, err
+	}
+	// The length of the original message is reported, as zerolog treats short writes as errors.
+	return len(p), nil
+}
+
+// WriteLevel scrubs a message and writes it to the underlying output, with its level when the
+// output handles levels, like the syslog one.
+func (w *redactWriter) WriteLevel(level zerolog.Level, p []byte) (int, error) {
+	lw, ok := w.out.(zerolog.LevelWriter)
+	if !ok {
+		return w.Write(p)
+	}
+	if _, err := lw.WriteLevel(level, w.scrub(p)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// scrub returns a message without the secrets and the values of the credential headers.
+func (w *redactWriter) scrub(p []byte) []byte {
+	message := string(p)
+	if secrets := w.secrets(); secrets != nil {
+		message = secrets.Replace(message)
+	}
+	return []byte(credentialHeaderPattern.ReplaceAllString(message, "${1}${2}${3}"+Redacted))
+}
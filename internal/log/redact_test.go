@@ -0,0 +1,97 @@
+package log
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestRedactWriter(t *testing.T) {
+	tests := []struct {
+		name     string
+		format   Format
+		message  string
+		expected string
+		leaked   string
+	}{
+		{
+			name:     "Password",
+			message:  "authenticating with password s3cr3t!",
+			expected: "authenticating with password [REDACTED]",
+			leaked:   "s3cr3t!",
+		},
+		{
+			name:     "Password in JSON",
+			format:   FormatJSON,
+			message:  `password pa"ss`,
+			expected: `password [REDACTED]`,
+			leaked:   `pa\"ss`,
+		},
+		{
+			name:     "Bearer header",
+			message:  "request headers map[Authorization:[Bearer eyJhbGciOi] Accept:[*/*]]",
+			expected: "map[Authorization:[Bearer [REDACTED]] Accept:[*/*]]",
+			leaked:   "eyJhbGciOi",
+		},
+		{
+			name:     "Token header in JSON",
+			format:   FormatJSON,
+			message:  `headers {"X-Auth-Token":"gAAAAABk"}`,
+			expected: `X-Auth-Token\":\"[REDACTED]`,
+			leaked:   "gAAAAABk",
+		},
+		{
+			name:     "Unrelated message",
+			message:  "authorization failed for user admin",
+			expected: "authorization failed for user admin",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			logger := NewLoggerWithOptions(Options{
+				Level:   LevelInfo,
+				Format:  tt.format,
+				Output:  &buf,
+				Secrets: []string{"s3cr3t!", `pa"ss`, ""},
+			})
+			logger.Info("%s", tt.message)
+
+			if !strings.Contains(buf.String(), tt.expected) {
+				t.Errorf("output = %q, want it to contain %q", buf.String(), tt.expected)
+			}
+			if tt.leaked != "" && strings.Contains(buf.String(), tt.leaked) {
+				t.Errorf("output = %q leaks %q", buf.String(), tt.leaked)
+			}
+		})
+	}
+}
+
+func TestRedactWriterFields(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLoggerWithOptions(Options{Level: LevelInfo, Format: FormatJSON, Output: &buf, Secrets: []string{"hunter2"}})
+	logger.With("password", "hunter2").Info("connected")
+
+	if strings.Contains(buf.String(), "hunter2") {
+		t.Errorf("output = %q leaks a field", buf.String())
+	}
+}
+
+func TestAddSecret(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLoggerWithOptions(Options{Level: LevelInfo, Output: &buf, Secrets: []string{"configured-secret"}})
+	logger.Info("token added-secret-1")
+	if !strings.Contains(buf.String(), "added-secret-1") {
+		t.Fatalf("output = %q, want the secret not added yet", buf.String())
+	}
+
+	// The loggers already created scrub the secrets added later, along with their own.
+	AddSecret("added-secret-1", "")
+	AddSecret("added-secret-1-rotated")
+	buf.Reset()
+	logger.Info("tokens added-secret-1 added-secret-1-rotated configured-secret")
+	if got, want := buf.String(), "tokens [REDACTED] [REDACTED] [REDACTED]"; !strings.Contains(got, want) {
+		t.Errorf("output = %q, want it to contain %q", got, want)
+	}
+}
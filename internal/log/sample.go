@@ -0,0 +1,99 @@
+package log
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// Sampler picks 1 in N events, e.g. the requests of a high-frequency endpoint whose logs are
+// identical from one request to the next. It is safe for concurrent use.
+type Sampler struct {
+	n     uint64
+	count atomic.Uint64
+}
+
+// NewSampler creates a sampler picking 1 in n events, starting with the first one. A sampler with
+// n below 2 picks every event.
+func NewSampler(n int) *Sampler {
+	return &Sampler{n: uint64(max(n, 1))}
+}
+
+// Sample reports whether the next event is picked.
+func (s *Sampler) Sample() bool {
+	return (s.count.Add(1)-1)%s.n == 0
+}
+
+// minLevelLogger drops the messages below its minimum level, whatever the level of the logger it
+// wraps.
+type minLevelLogger struct {
+	Logger
+	min Level
+}
+
+// WithMinLevel returns a logger dropping the messages below the given level, and passing the others
+// to logger, e.g. to keep only the warnings and errors of a request that is not sampled. The level of
+// logger itself is left unchanged.
+func WithMinLevel(logger Logger, level Level) Logger {
+	return &minLevelLogger{Logger: logger, min: level}
+}
+
+// Trace logs a formatted message at the Trace level, if not below the minimum level.
+func (l *minLevelLogger) Trace(format string, args ...any) {
+	if LevelTrace >= l.min {
+		l.Logger.Trace(format, args...)
+	}
+}
+
+// Debug logs a formatted message at the Debug level, if not below the minimum level.
+func (l *minLevelLogger) Debug(format string, args ...any) {
+	if LevelDebug >= l.min {
+		l.Logger.Debug(format, args...)
+	}
+}
+
+// Info logs a formatted message at the Info level, if not below the minimum level.
+func (l *minLevelLogger) Info(format string, args ...any) {
+	if LevelInfo >= l.min {
+		l.Logger.Info(format, args...)
+	}
+}
+
+// Warn logs a formatted message at the Warn level, if not below the minimum level.
+func (l *minLevelLogger) Warn(format string, args ...any) {
+	if LevelWarn >= l.min {
+		l.Logger.Warn(format, args...)
+	}
+}
+
+// TraceCtx logs a formatted message at the Trace level, if not below the minimum level.
+func (l *minLevelLogger) TraceCtx(ctx context.Context, format string, args ...any) {
+	if LevelTrace >= l.min {
+		l.Logger.TraceCtx(ctx, format, args...)
+	}
+}
+
+// DebugCtx logs a formatted message at the Debug level, if not below the minimum level.
+func (l *minLevelLogger) DebugCtx(ctx context.Context, format string, args ...any) {
+	if LevelDebug >= l.min {
+		l.Logger.DebugCtx(ctx, format, args...)
+	}
+}
+
+// InfoCtx logs a formatted message at the Info level, if not below the minimum level.
+func (l *minLevelLogger) InfoCtx(ctx context.Context, format string, args ...any) {
+	if LevelInfo >= l.min {
+		l.Logger.InfoCtx(ctx, format, args...)
+	}
+}
+
+// WarnCtx logs a formatted message at the Warn level, if not below the minimum level.
+func (l *minLevelLogger) WarnCtx(ctx context.Context, format string, args ...any) {
+	if LevelWarn >= l.min {
+		l.Logger.WarnCtx(ctx, format, args...)
+	}
+}
+
+// With returns a child logger adding the given field to every message, with the same minimum level.
+func (l *minLevelLogger) With(key string, value any) Logger {
+	return &minLevelLogger{Logger: l.Logger.With(key, value), min: l.min}
+}
@@ -0,0 +1,47 @@
+package log
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestSampler(t *testing.T) {
+	tests := []struct {
+		name     string
+		n        int
+		expected []bool
+	}{
+		{name: "Every event", n: 1, expected: []bool{true, true, true}},
+		{name: "Zero", n: 0, expected: []bool{true, true}},
+		{name: "One in three", n: 3, expected: []bool{true, false, false, true, false}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sampler := NewSampler(tt.n)
+			for i, expected := range tt.expected {
+				if got := sampler.Sample(); got != expected {
+					t.Errorf("Sample() #%d = %v, want %v", i, got, expected)
+				}
+			}
+		})
+	}
+}
+
+func TestWithMinLevel(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLoggerWithOptions(Options{Level: LevelDebug, Format: FormatJSON, Output: &buf})
+	sampled := WithMinLevel(logger, LevelWarn).With(RequestIDField, "abc")
+
+	sampled.Info("received request")
+	sampled.Error("failed")
+	logger.Debug("unchanged")
+
+	if strings.Contains(buf.String(), "received request") {
+		t.Errorf("output = %q, want no info message", buf.String())
+	}
+	if !strings.Contains(buf.String(), `"message":"failed"`) || !strings.Contains(buf.String(), "unchanged") {
+		t.Errorf("output = %q, want the error and the unchanged logger's message", buf.String())
+	}
+}
@@ -0,0 +1,89 @@
+//go:build !windows && !plan9
+
+package log
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log/syslog"
+	"strings"
+
+	"github.com/rs/zerolog"
+)
+
+// DefaultSyslogTag is the default tag of the messages sent to syslog.
+const DefaultSyslogTag = "external-dns-cern-webhook"
+
+// syslogSink is the part of a syslog.Writer used by the syslog output.
+type syslogSink interface {
+	Debug(m string) error
+	Info(m string) error
+	Warning(m string) error
+	Err(m string) error
+	Close() error
+}
+
+// syslogWriter sends the messages to syslog, at the priority of their level.
+type syslogWriter struct {
+	sink syslogSink
+	// console formats the messages like the console format, without the time and level that syslog
+	// records itself, instead of sending them as JSON.
+	console bool
+}
+
+// NewSyslogWriter connects to the local syslog daemon, or journald through its syslog socket, and
+// returns an output sending the messages with the given tag, in the daemon facility.
+//
+// The messages are sent at the syslog priority of their level, as JSON with FormatJSON and as a
+// single uncolored line otherwise.
+func NewSyslogWriter(tag string, format Format) (io.WriteCloser, error) {
+	sink, err := syslog.New(syslog.LOG_INFO|syslog.LOG_DAEMON, tag)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to syslog: %w", err)
+	}
+	return &syslogWriter{sink: sink, console: format != FormatJSON}, nil
+}
+
+// Write sends a message without level at the info priority.
+func (w *syslogWriter) Write(p []byte) (int, error) {
+	return w.WriteLevel(zerolog.NoLevel, p)
+}
+
+// WriteLevel sends a message at the syslog priority of its level.
+func (w *syslogWriter) WriteLevel(level zerolog.Level, p []byte) (int, error) {
+	message := p
+	if w.console {
+		var buf bytes.Buffer
+		cw := zerolog.ConsoleWriter{
+			Out:          &buf,
+			NoColor:      true,
+			PartsExclude: []string{zerolog.TimestampFieldName, zerolog.LevelFieldName},
+		}
+		if _, err := cw.Write(p); err == nil {
+			message = buf.Bytes()
+		}
+	}
+
+	m := strings.TrimSpace(string(message))
+	var err error
+	switch level {
+	case zerolog.TraceLevel, zerolog.DebugLevel:
+		err = w.sink.Debug(m)
+	case zerolog.WarnLevel:
+		err = w.sink.Warning(m)
+	case zerolog.ErrorLevel, zerolog.FatalLevel, zerolog.PanicLevel:
+		err = w.sink.Err(m)
+	default:
+		err = w.sink.Info(m)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Close closes the connection to syslog.
+func (w *syslogWriter) Close() error {
+	return w.sink.Close()
+}
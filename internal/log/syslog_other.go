@@ -0,0 +1,16 @@
+//go:build windows || plan9
+
+package log
+
+import (
+	"errors"
+	"io"
+)
+
+// DefaultSyslogTag is the default tag of the messages sent to syslog.
+const DefaultSyslogTag = "external-dns-cern-webhook"
+
+// NewSyslogWriter fails, as syslog is not supported on this platform.
+func NewSyslogWriter(tag string, format Format) (io.WriteCloser, error) {
+	return nil, errors.New("syslog is not supported on this platform")
+}
@@ -0,0 +1,54 @@
+//go:build !windows && !plan9
+
+package log
+
+import (
+	"strings"
+	"testing"
+)
+
+// fakeSyslog records the messages sent to syslog, prefixed by their priority.
+type fakeSyslog struct {
+	messages []string
+}
+
+func (f *fakeSyslog) record(priority, m string) error {
+	f.messages = append(f.messages, priority+" "+m)
+	return nil
+}
+
+func (f *fakeSyslog) Debug(m string) error   { return f.record("debug", m) }
+func (f *fakeSyslog) Info(m string) error    { return f.record("info", m) }
+func (f *fakeSyslog) Warning(m string) error { return f.record("warning", m) }
+func (f *fakeSyslog) Err(m string) error     { return f.record("err", m) }
+func (f *fakeSyslog) Close() error           { return nil }
+
+func TestSyslogWriter(t *testing.T) {
+	tests := []struct {
+		name     string
+		console  bool
+		log      func(Logger)
+		expected string
+	}{
+		{name: "Debug", console: true, log: func(l Logger) { l.Debug("listing") }, expected: "debug listing component=log"},
+		{name: "Warn", console: true, log: func(l Logger) { l.Warn("retrying") }, expected: "warning retrying component=log"},
+		{name: "Error as JSON", log: func(l Logger) { l.Error("failed") }, expected: `err {"level":"error","component":"log"`},
+		{name: "Secret", console: true, log: func(l Logger) { l.Info("password hunter2") }, expected: "info password [REDACTED]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sink := &fakeSyslog{}
+			logger := NewLoggerWithOptions(Options{
+				Level:   LevelDebug,
+				Output:  &syslogWriter{sink: sink, console: tt.console},
+				Secrets: []string{"hunter2"},
+			})
+			tt.log(logger)
+
+			if len(sink.messages) != 1 || !strings.HasPrefix(sink.messages[0], tt.expected) {
+				t.Errorf("messages = %q, want one starting with %q", sink.messages, tt.expected)
+			}
+		})
+	}
+}
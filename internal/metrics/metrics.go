@@ -0,0 +1,264 @@
+// Package metrics defines the Prometheus metrics exposed by the webhook.
+//
+// All metrics are registered on a dedicated registry, served on the /metrics endpoint, so that
+// only the metrics of the webhook itself (plus the Go and process collectors) are exposed.
+package metrics
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gophercloud/gophercloud/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// namespace prefixes the name of every metric.
+const namespace = "cern_webhook"
+
+// Registry holds all the metrics of the webhook.
+var Registry = prometheus.NewRegistry()
+
+var (
+	// OpenStackRequestDuration observes the duration of every OpenStack API call, by operation.
+	OpenStackRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "openstack",
+		Name:      "request_duration_seconds",
+		Help:      "Duration of OpenStack API calls, by operation.",
+		Buckets:   prometheus.ExponentialBuckets(0.05, 2, 10),
+	}, []string{"operation"})
+
+	// OpenStackRequestErrors counts the failed OpenStack API calls, by operation and HTTP status code.
+	OpenStackRequestErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "openstack",
+		Name:      "request_errors_total",
+		Help:      "Failed OpenStack API calls, by operation and HTTP status code (empty when unknown).",
+	}, []string{"operation", "code"})
+
+	// OpenStackAuthHealthy reports whether the last periodic check of the OpenStack credentials succeeded.
+	OpenStackAuthHealthy = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "openstack",
+		Name:      "auth_healthy",
+		Help:      "Whether the last periodic check of the OpenStack credentials succeeded (1) or failed (0).",
+	})
+
+	// Errors counts the errors by source, so that alerting rules can tell expired credentials from
+	// API outages.
+	Errors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "errors_total",
+		Help:      "Errors, by source (keystone-auth, nova-list, nova-metadata, k8s-list, decode).",
+	}, []string{"source"})
+
+	// HTTPRequests counts the requests served by the webhook, by method, path and status code.
+	HTTPRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "requests_total",
+		Help:      "HTTP requests served, by method, path and status code.",
+	}, []string{"method", "path", "code"})
+
+	// HTTPRequestDuration observes the duration of the requests served by the webhook, by method,
+	// path and status code.
+	HTTPRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "Duration of the HTTP requests served, by method, path and status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "path", "code"})
+
+	// LastSuccess reports the Unix time of the last successful call of the Records and ApplyChanges
+	// endpoints, by operation.
+	LastSuccess = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "sync",
+		Name:      "last_success_timestamp_seconds",
+		Help:      "Unix time of the last successful call of the webhook by ExternalDNS, by operation (records, apply_changes).",
+	}, []string{"operation"})
+
+	// ApplyChangesDuration observes the end-to-end duration of the ApplyChanges calls, by outcome.
+	ApplyChangesDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "sync",
+		Name:      "apply_changes_duration_seconds",
+		Help:      "End-to-end duration of ApplyChanges calls, by outcome (success, error, noop).",
+		Buckets:   prometheus.ExponentialBuckets(0.1, 2, 12),
+	}, []string{"outcome"})
+
+	// NodeUpdateDuration observes the duration of the update of every ingress node during a sync, by outcome.
+	NodeUpdateDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "sync",
+		Name:      "node_update_duration_seconds",
+		Help:      "Duration of the update of an ingress node during a sync, retries and verification included, by outcome (success, error).",
+		Buckets:   prometheus.ExponentialBuckets(0.05, 2, 12),
+	}, []string{"outcome"})
+
+	// ManagedNames reports the number of DNS names aliased on the ingress nodes.
+	ManagedNames = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "managed_names",
+		Help:      "Number of DNS names aliased on the ingress nodes.",
+	})
+
+	// Aliases reports the number of aliases carried by the ingress nodes, i.e. the managed names
+	// times the nodes serving them.
+	Aliases = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "aliases",
+		Help:      "Number of aliases carried by the ingress nodes.",
+	})
+
+	// NodeAliases reports the number of aliases carried by every ingress node.
+	NodeAliases = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "node_aliases",
+		Help:      "Number of aliases carried by an ingress node, by node.",
+	}, []string{"node"})
+
+	// NodeMetadataKeys reports the number of `landb-alias*` metadata keys used by every ingress node.
+	NodeMetadataKeys = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "node_metadata_keys",
+		Help:      "Number of landb-alias metadata keys used by an ingress node, by node.",
+	}, []string{"node"})
+
+	// NodeMetadataKeysUtilization reports the share of the metadata items allowed by the Nova quota
+	// used by the `landb-alias*` keys of every ingress node.
+	NodeMetadataKeysUtilization = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "node_metadata_keys_utilization_ratio",
+		Help:      "Share of the metadata items allowed by the Nova quota used by the landb-alias keys of an ingress node, by node.",
+	}, []string{"node"})
+
+	// NodeMetadataLengthUtilization reports the share of the metadata characters allowed by the Nova
+	// quota, i.e. the allowed items times the maximum length of a value, used by the
+	// `landb-alias*` values of every ingress node.
+	NodeMetadataLengthUtilization = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "node_metadata_length_utilization_ratio",
+		Help:      "Share of the metadata characters allowed by the Nova quota used by the landb-alias values of an ingress node, by node.",
+	}, []string{"node"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		OpenStackRequestDuration,
+		OpenStackRequestErrors,
+		OpenStackAuthHealthy,
+		Errors,
+		HTTPRequests,
+		HTTPRequestDuration,
+		LastSuccess,
+		ApplyChangesDuration,
+		NodeUpdateDuration,
+		ManagedNames,
+		Aliases,
+		NodeAliases,
+		NodeMetadataKeys,
+		NodeMetadataKeysUtilization,
+		NodeMetadataLengthUtilization,
+	)
+
+	// The error series exist from the start, so that rate-based alerts work before the first error.
+	for _, source := range ErrorSources {
+		Errors.WithLabelValues(source)
+	}
+}
+
+// Handler returns the HTTP handler serving the metrics.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+// InstrumentHandler wraps the handler of a path to count its requests and observe their duration,
+// labelled with the given path rather than the requested one, so that unknown paths served by a
+// catch-all handler do not create new series.
+func InstrumentHandler(path string, handler http.Handler) http.Handler {
+	labels := prometheus.Labels{"path": path}
+	return promhttp.InstrumentHandlerDuration(HTTPRequestDuration.MustCurryWith(labels),
+		promhttp.InstrumentHandlerCounter(HTTPRequests.MustCurryWith(labels), handler))
+}
+
+// ObserveOpenStackCall runs fn and records its duration and, if it fails, its error.
+func ObserveOpenStackCall(operation string, fn func() error) error {
+	start := time.Now()
+	err := fn()
+	OpenStackRequestDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+	if err != nil {
+		OpenStackRequestErrors.WithLabelValues(operation, statusCode(err)).Inc()
+	}
+	return err
+}
+
+// Operations of LastSuccess.
+const (
+	OperationRecords      = "records"
+	OperationApplyChanges = "apply_changes"
+)
+
+// MarkSuccess records that an operation of LastSuccess just succeeded.
+func MarkSuccess(operation string) {
+	LastSuccess.WithLabelValues(operation).SetToCurrentTime()
+}
+
+// Sources of the errors counted in Errors.
+const (
+	// ErrorSourceKeystoneAuth counts the OpenStack credentials rejected by Keystone.
+	ErrorSourceKeystoneAuth = "keystone-auth"
+	// ErrorSourceNovaList counts the failed listings of the OpenStack servers.
+	ErrorSourceNovaList = "nova-list"
+	// ErrorSourceNovaMetadata counts the failed reads and writes of the server metadata.
+	ErrorSourceNovaMetadata = "nova-metadata"
+	// ErrorSourceK8sList counts the failed listings of the Kubernetes ingress nodes.
+	ErrorSourceK8sList = "k8s-list"
+	// ErrorSourceDecode counts the requests whose body could not be decoded.
+	ErrorSourceDecode = "decode"
+)
+
+// ErrorSources lists the sources of the errors counted in Errors.
+var ErrorSources = []string{ErrorSourceKeystoneAuth, ErrorSourceNovaList, ErrorSourceNovaMetadata, ErrorSourceK8sList, ErrorSourceDecode}
+
+// CountError counts an error of the given source.
+func CountError(source string) {
+	Errors.WithLabelValues(source).Inc()
+}
+
+// Outcomes of a sync, or of the update of a node.
+const (
+	OutcomeSuccess = "success"
+	OutcomeError   = "error"
+	// OutcomeNoop is the outcome of an ApplyChanges call that changes no managed endpoint.
+	OutcomeNoop = "noop"
+)
+
+// Outcome returns the outcome of an operation given its error.
+func Outcome(err error) string {
+	if err != nil {
+		return OutcomeError
+	}
+	return OutcomeSuccess
+}
+
+// ObserveDuration records the time elapsed since start in a histogram, under the given outcome.
+func ObserveDuration(histogram *prometheus.HistogramVec, outcome string, start time.Time) {
+	histogram.WithLabelValues(outcome).Observe(time.Since(start).Seconds())
+}
+
+// statusCode returns the HTTP status code of a gophercloud error, or an empty string.
+func statusCode(err error) string {
+	var codeErr gophercloud.ErrUnexpectedResponseCode
+	if errors.As(err, &codeErr) {
+		return strconv.Itoa(codeErr.Actual)
+	}
+	return ""
+}
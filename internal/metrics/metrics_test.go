@@ -0,0 +1,95 @@
+package metrics
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gophercloud/gophercloud/v2"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestObserveOpenStackCall(t *testing.T) {
+	unavailable := gophercloud.ErrUnexpectedResponseCode{Actual: 503}
+
+	if err := ObserveOpenStackCall("test-op", func() error { return nil }); err != nil {
+		t.Fatalf("ObserveOpenStackCall() error = %v", err)
+	}
+	if err := ObserveOpenStackCall("test-op", func() error { return unavailable }); !errors.As(err, &unavailable) {
+		t.Fatalf("ObserveOpenStackCall() error = %v, want the call error", err)
+	}
+	_ = ObserveOpenStackCall("test-op", func() error { return errors.New("connection refused") })
+
+	if got := testutil.CollectAndCount(OpenStackRequestDuration, "cern_webhook_openstack_request_duration_seconds"); got != 1 {
+		t.Errorf("expected 1 duration series, got %d", got)
+	}
+	if got := testutil.ToFloat64(OpenStackRequestErrors.WithLabelValues("test-op", "503")); got != 1 {
+		t.Errorf("expected 1 error with code 503, got %v", got)
+	}
+	if got := testutil.ToFloat64(OpenStackRequestErrors.WithLabelValues("test-op", "")); got != 1 {
+		t.Errorf("expected 1 error without code, got %v", got)
+	}
+}
+
+func TestObserveDuration(t *testing.T) {
+	tests := []struct {
+		name    string
+		err     error
+		outcome string
+	}{
+		{name: "success", outcome: OutcomeSuccess},
+		{name: "error", err: errors.New("nova unavailable"), outcome: OutcomeError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outcome := Outcome(tt.err)
+			if outcome != tt.outcome {
+				t.Fatalf("Outcome(%v) = %s, want %s", tt.err, outcome, tt.outcome)
+			}
+			ObserveDuration(NodeUpdateDuration, outcome, time.Now().Add(-time.Second))
+			if got := testutil.CollectAndCount(NodeUpdateDuration); got == 0 {
+				t.Errorf("no node update duration series")
+			}
+		})
+	}
+	if got := testutil.CollectAndCount(NodeUpdateDuration); got != 2 {
+		t.Errorf("expected 2 node update duration series, got %d", got)
+	}
+}
+
+func TestMarkSuccess(t *testing.T) {
+	before := float64(time.Now().Unix())
+	MarkSuccess(OperationRecords)
+
+	if got := testutil.ToFloat64(LastSuccess.WithLabelValues(OperationRecords)); got < before {
+		t.Errorf("last records success = %v, want at least %v", got, before)
+	}
+	if got := testutil.ToFloat64(LastSuccess.WithLabelValues(OperationApplyChanges)); got != 0 {
+		t.Errorf("last apply changes success = %v, want 0", got)
+	}
+}
+
+func TestInstrumentHandler(t *testing.T) {
+	handler := InstrumentHandler("/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+		}
+	}))
+
+	for _, path := range []string{"/", "/unknown", "/other"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	if got := testutil.ToFloat64(HTTPRequests.WithLabelValues("get", "/", "200")); got != 1 {
+		t.Errorf("expected 1 successful request, got %v", got)
+	}
+	if got := testutil.ToFloat64(HTTPRequests.WithLabelValues("get", "/", "404")); got != 2 {
+		t.Errorf("expected 2 requests of unknown paths under /, got %v", got)
+	}
+	if got := testutil.CollectAndCount(HTTPRequestDuration); got != 2 {
+		t.Errorf("expected 2 duration series, got %d", got)
+	}
+}
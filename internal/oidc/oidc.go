@@ -0,0 +1,329 @@
+// Package oidc verifies the JSON Web Tokens issued by an OpenID Connect provider, e.g. the
+// Kubernetes service account tokens, so the webhook API can authenticate ExternalDNS when it runs
+// in another namespace or cluster.
+//
+// The signing keys are discovered from the issuer here, while the JSON Web Keys, signatures and
+// claims are decoded and verified with go-jose. The RS256, RS384, RS512, ES256, ES384 and ES512
+// signature algorithms are accepted.
+package oidc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
+)
+
+const (
+	// clockSkew is the leeway given to the expiry and not-before times of the tokens.
+	clockSkew = time.Minute
+	// keysRefreshInterval is how often the signing keys may be fetched again, when a token is
+	// signed with an unknown key, so bogus tokens cannot make the webhook flood the issuer.
+	keysRefreshInterval = time.Minute
+	// fetchTimeout bounds the discovery of the signing keys.
+	fetchTimeout = 10 * time.Second
+)
+
+// ErrInvalidToken is wrapped by the errors of the tokens that are rejected.
+var ErrInvalidToken = errors.New("invalid token")
+
+// signatureAlgorithms are the accepted signature algorithms.
+var signatureAlgorithms = []jose.SignatureAlgorithm{jose.RS256, jose.RS384, jose.RS512, jose.ES256, jose.ES384, jose.ES512}
+
+// algorithmCurves are the curves of the keys of the ECDSA signature algorithms, which RFC 7518
+// section 3.4 binds to a single curve each.
+var algorithmCurves = map[string]elliptic.Curve{
+	string(jose.ES256): elliptic.P256(),
+	string(jose.ES384): elliptic.P384(),
+	string(jose.ES512): elliptic.P521(),
+}
+
+// Claims are the claims of a verified token.
+type Claims struct {
+	// Issuer is the iss claim, the URL of the issuer.
+	Issuer string
+	// Subject is the sub claim, e.g. system:serviceaccount:<namespace>:<name> for the Kubernetes
+	// service accounts.
+	Subject string
+	// Audience is the aud claim.
+	Audience []string
+	// Expiry is the exp claim.
+	Expiry time.Time
+}
+
+// Verifier verifies the tokens of an issuer, intended for an audience.
+//
+// The signing keys are discovered from the issuer on the first verification, and fetched again
+// when a token is signed with an unknown key, e.g. after the issuer rotated its keys.
+type Verifier struct {
+	issuer   string
+	audience string
+	// subjects are the accepted subjects, any subject being accepted when empty.
+	subjects []string
+	// caFile is the file of the CA certificates of the issuer, the system ones when empty. It is
+	// read every time the keys are fetched, so a renewed CA is picked up.
+	caFile string
+	// tlsConfig is the TLS configuration of the requests to the issuer, Go's default when nil.
+	tlsConfig *tls.Config
+	now       func() time.Time
+
+	// mu guards the fields below. It is not held during the fetches of the keys.
+	mu   sync.Mutex
+	keys map[string]*jose.JSONWebKey
+	// fetchedAt is the time of the last fetch of the keys, failed or not, and fetchErr its error.
+	fetchedAt time.Time
+	fetchErr  error
+	// fetching is closed when the fetch in progress, if any, completes. The verifications waiting
+	// for the same keys share it.
+	fetching chan struct{}
+}
+
+// NewVerifier creates a verifier of the tokens of the issuer at the given URL, intended for the
+// given audience and, unless subjects is empty, for one of the given subjects. caFile is the file
+// of the CA certificates of the issuer, the system ones being used when empty, and tlsConfig the
+// TLS configuration of the requests to the issuer, Go's default when nil.
+func NewVerifier(issuer, audience string, subjects []string, caFile string, tlsConfig *tls.Config) *Verifier {
+	return &Verifier{
+		issuer:    strings.TrimSuffix(issuer, "/"),
+		audience:  audience,
+		subjects:  subjects,
+		caFile:    caFile,
+		tlsConfig: tlsConfig,
+		now:       time.Now,
+	}
+}
+
+// Verify checks the signature and the claims of the raw token, and returns its claims. The errors
+// of the tokens that are rejected wrap ErrInvalidToken, the other errors being those of the
+// discovery of the keys.
+func (v *Verifier) Verify(ctx context.Context, token string) (*Claims, error) {
+	parsed, err := jwt.ParseSigned(token, signatureAlgorithms)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	// A compact token carries a single signature.
+	header := parsed.Headers[0]
+
+	key, err := v.key(ctx, header.KeyID)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkKey(header.Algorithm, key); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	var claims jwt.Claims
+	if err := parsed.Claims(key.Key, &claims); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	if err := v.checkClaims(&claims); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	return &Claims{Issuer: claims.Issuer, Subject: claims.Subject, Audience: claims.Audience, Expiry: claims.Expiry.Time()}, nil
+}
+
+// checkKey checks that a signature with the given algorithm may be verified with the key: the
+// algorithm the key is restricted to, if any, must be the same, and the algorithm must be one of
+// the key type, on the curve of the key for ECDSA.
+func checkKey(algorithm string, key *jose.JSONWebKey) error {
+	if key.Algorithm != "" && key.Algorithm != algorithm {
+		return fmt.Errorf("algorithm %s does not match the algorithm %s of key %q", algorithm, key.Algorithm, key.KeyID)
+	}
+
+	switch public := key.Key.(type) {
+	case *rsa.PublicKey:
+		if !strings.HasPrefix(algorithm, "RS") {
+			return fmt.Errorf("algorithm %s does not match the RSA key %q", algorithm, key.KeyID)
+		}
+	case *ecdsa.PublicKey:
+		if curve, ok := algorithmCurves[algorithm]; !ok || public.Curve != curve {
+			return fmt.Errorf("algorithm %s does not match the %s key %q", algorithm, public.Curve.Params().Name, key.KeyID)
+		}
+	default:
+		return fmt.Errorf("unsupported key %q of type %T", key.KeyID, key.Key)
+	}
+	return nil
+}
+
+// checkClaims checks the issuer, audience, subject and validity period of a token.
+func (v *Verifier) checkClaims(claims *jwt.Claims) error {
+	if strings.TrimSuffix(claims.Issuer, "/") != v.issuer {
+		return fmt.Errorf("issued by %q, want %q", claims.Issuer, v.issuer)
+	}
+	if len(v.subjects) > 0 && !slices.Contains(v.subjects, claims.Subject) {
+		return fmt.Errorf("subject %q is not allowed", claims.Subject)
+	}
+	if claims.Expiry == nil {
+		return errors.New("no expiry")
+	}
+	return claims.ValidateWithLeeway(jwt.Expected{AnyAudience: jwt.Audience{v.audience}, Time: v.now()}, clockSkew)
+}
+
+// key returns the signing key with the given ID, fetching the keys of the issuer when it is
+// unknown. A token without key ID is accepted when the issuer has a single key.
+//
+// The keys are fetched at most once per refresh interval, whether the fetch fails or not, and the
+// concurrent verifications wait for the fetch in progress rather than starting their own.
+func (v *Verifier) key(ctx context.Context, id string) (*jose.JSONWebKey, error) {
+	v.mu.Lock()
+	for v.fetching != nil {
+		fetching := v.fetching
+		v.mu.Unlock()
+		select {
+		case <-fetching:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		v.mu.Lock()
+	}
+
+	if key, ok := v.lookup(id); ok {
+		v.mu.Unlock()
+		return key, nil
+	}
+	if !v.fetchedAt.IsZero() && v.now().Sub(v.fetchedAt) < keysRefreshInterval {
+		err := v.fetchErr
+		v.mu.Unlock()
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch the signing keys of %s: %w", v.issuer, err)
+		}
+		return nil, fmt.Errorf("%w: unknown signing key %q", ErrInvalidToken, id)
+	}
+	fetching := make(chan struct{})
+	v.fetching = fetching
+	v.mu.Unlock()
+
+	// The fetch is shared, so it is not cancelled with the request that started it.
+	keys, err := v.fetchKeys(context.WithoutCancel(ctx))
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.fetching = nil
+	close(fetching)
+	v.fetchedAt, v.fetchErr = v.now(), err
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch the signing keys of %s: %w", v.issuer, err)
+	}
+	v.keys = keys
+
+	if key, ok := v.lookup(id); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("%w: unknown signing key %q", ErrInvalidToken, id)
+}
+
+// lookup returns the known signing key with the given ID.
+func (v *Verifier) lookup(id string) (*jose.JSONWebKey, bool) {
+	if id == "" && len(v.keys) == 1 {
+		for _, key := range v.keys {
+			return key, true
+		}
+	}
+	key, ok := v.keys[id]
+	return key, ok
+}
+
+// fetchKeys discovers the JSON Web Key Set of the issuer from its OpenID configuration, and returns
+// its public signing keys by ID. The keys that are invalid, or of an unsupported type, are skipped.
+func (v *Verifier) fetchKeys(ctx context.Context) (map[string]*jose.JSONWebKey, error) {
+	ctx, cancel := context.WithTimeout(ctx, fetchTimeout)
+	defer cancel()
+
+	client, err := v.client()
+	if err != nil {
+		return nil, err
+	}
+
+	var discovery struct {
+		Issuer  string `json:"issuer"`
+		JWKSURI string `json:"jwks_uri"`
+	}
+	if err := getJSON(ctx, client, v.issuer+"/.well-known/openid-configuration", &discovery); err != nil {
+		return nil, err
+	}
+	if strings.TrimSuffix(discovery.Issuer, "/") != v.issuer {
+		return nil, fmt.Errorf("the OpenID configuration is for issuer %q", discovery.Issuer)
+	}
+
+	// The keys are decoded one by one, so a single key go-jose rejects does not reject the set.
+	var set struct {
+		Keys []json.RawMessage `json:"keys"`
+	}
+	if err := getJSON(ctx, client, discovery.JWKSURI, &set); err != nil {
+		return nil, err
+	}
+	keys := make(map[string]*jose.JSONWebKey, len(set.Keys))
+	for _, data := range set.Keys {
+		var key jose.JSONWebKey
+		if err := key.UnmarshalJSON(data); err != nil {
+			continue
+		}
+		if (key.Use != "" && key.Use != "sig") || !key.IsPublic() || !key.Valid() {
+			continue
+		}
+		keys[key.KeyID] = &key
+	}
+	return keys, nil
+}
+
+// client returns the HTTP client of the requests to the issuer, with the configured TLS
+// configuration and trusting the configured CA.
+func (v *Verifier) client() (*http.Client, error) {
+	if v.caFile == "" && v.tlsConfig == nil {
+		return http.DefaultClient, nil
+	}
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if v.tlsConfig != nil {
+		tlsConfig = v.tlsConfig.Clone()
+	}
+	if v.caFile != "" {
+		pem, err := os.ReadFile(v.caFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in the CA file %s", v.caFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	return &http.Client{Transport: transport}, nil
+}
+
+// getJSON decodes the JSON document at the given URL into out.
+func getJSON(ctx context.Context, client *http.Client, url string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s returned %s", url, resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode %s: %w", url, err)
+	}
+	return nil
+}
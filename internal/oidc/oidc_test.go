@@ -0,0 +1,295 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// issuer is an OpenID Connect provider serving its configuration and signing keys.
+type issuer struct {
+	server     *httptest.Server
+	caFile     string
+	rsaKey     *rsa.PrivateKey
+	ecKey      *ecdsa.PrivateKey
+	ec384Key   *ecdsa.PrivateKey
+	keyFetches atomic.Int32
+	// failing makes the issuer fail to serve its keys.
+	failing atomic.Bool
+}
+
+func newIssuer(t *testing.T) *issuer {
+	t.Helper()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ec384Key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	iss := &issuer{rsaKey: rsaKey, ecKey: ecKey, ec384Key: ec384Key}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{"issuer": iss.server.URL, "jwks_uri": iss.server.URL + "/keys"})
+	})
+	mux.HandleFunc("GET /keys", func(w http.ResponseWriter, r *http.Request) {
+		iss.keyFetches.Add(1)
+		if iss.failing.Load() {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{
+			{"kty": "RSA", "kid": "rsa", "use": "sig", "n": encodeInt(rsaKey.N), "e": encodeInt(big.NewInt(int64(rsaKey.E)))},
+			{"kty": "RSA", "kid": "rsa-pinned", "alg": "RS512", "n": encodeInt(rsaKey.N), "e": encodeInt(big.NewInt(int64(rsaKey.E)))},
+			{"kty": "EC", "kid": "ec", "crv": "P-256", "x": encodeCoordinate(ecKey.X, 32), "y": encodeCoordinate(ecKey.Y, 32)},
+			{"kty": "EC", "kid": "ec384", "crv": "P-384", "x": encodeCoordinate(ec384Key.X, 48), "y": encodeCoordinate(ec384Key.Y, 48)},
+			{"kty": "oct", "kid": "symmetric", "k": "c2VjcmV0"},
+		}})
+	})
+	iss.server = httptest.NewTLSServer(mux)
+	t.Cleanup(iss.server.Close)
+
+	iss.caFile = filepath.Join(t.TempDir(), "ca.crt")
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: iss.server.Certificate().Raw})
+	if err := os.WriteFile(iss.caFile, ca, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return iss
+}
+
+// sign returns a token with the given claims, signed with the algorithm and the key with the given
+// ID, whatever the algorithm of the key, so tokens mixing up algorithms and keys can be forged.
+func (iss *issuer) sign(t *testing.T, algorithm, keyID string, claims map[string]any) string {
+	t.Helper()
+	header, _ := json.Marshal(map[string]string{"alg": algorithm, "kid": keyID, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+
+	var hash crypto.Hash
+	var digest []byte
+	switch algorithm[2:] {
+	case "384":
+		sum := sha512.Sum384([]byte(signed))
+		hash, digest = crypto.SHA384, sum[:]
+	case "512":
+		sum := sha512.Sum512([]byte(signed))
+		hash, digest = crypto.SHA512, sum[:]
+	default:
+		sum := sha256.Sum256([]byte(signed))
+		hash, digest = crypto.SHA256, sum[:]
+	}
+
+	var signature []byte
+	switch keyID {
+	case "ec", "ec384":
+		key := iss.ecKey
+		if keyID == "ec384" {
+			key = iss.ec384Key
+		}
+		r, s, err := ecdsa.Sign(rand.Reader, key, digest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		size := (key.Curve.Params().BitSize + 7) / 8
+		signature = make([]byte, 2*size)
+		r.FillBytes(signature[:size])
+		s.FillBytes(signature[size:])
+	default:
+		var err error
+		signature, err = rsa.SignPKCS1v15(rand.Reader, iss.rsaKey, hash, digest)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// claims returns valid claims for the issuer, with the given overrides.
+func (iss *issuer) claims(overrides map[string]any) map[string]any {
+	claims := map[string]any{
+		"iss": iss.server.URL,
+		"sub": "system:serviceaccount:external-dns:external-dns",
+		"aud": []string{"external-dns-webhook"},
+		"exp": time.Now().Add(time.Hour).Unix(),
+		"nbf": time.Now().Add(-time.Minute).Unix(),
+	}
+	for name, value := range overrides {
+		claims[name] = value
+	}
+	return claims
+}
+
+func encodeInt(i *big.Int) string {
+	return base64.RawURLEncoding.EncodeToString(i.Bytes())
+}
+
+// encodeCoordinate encodes a coordinate of an elliptic curve point, padded to the size of the curve.
+func encodeCoordinate(i *big.Int, size int) string {
+	return base64.RawURLEncoding.EncodeToString(i.FillBytes(make([]byte, size)))
+}
+
+func TestVerify(t *testing.T) {
+	iss := newIssuer(t)
+	verifier := NewVerifier(iss.server.URL+"/", "external-dns-webhook", []string{"system:serviceaccount:external-dns:external-dns"}, iss.caFile, nil)
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr bool
+	}{
+		{name: "RS256", token: iss.sign(t, "RS256", "rsa", iss.claims(nil))},
+		{name: "ES256", token: iss.sign(t, "ES256", "ec", iss.claims(nil))},
+		{name: "ES384", token: iss.sign(t, "ES384", "ec384", iss.claims(nil))},
+		{name: "RS512 with a key restricted to it", token: iss.sign(t, "RS512", "rsa-pinned", iss.claims(nil))},
+		{name: "single audience", token: iss.sign(t, "RS256", "rsa", iss.claims(map[string]any{"aud": "external-dns-webhook"}))},
+		{name: "other audience", token: iss.sign(t, "RS256", "rsa", iss.claims(map[string]any{"aud": "kubernetes"})), wantErr: true},
+		{name: "other issuer", token: iss.sign(t, "RS256", "rsa", iss.claims(map[string]any{"iss": "https://example.org"})), wantErr: true},
+		{name: "other subject", token: iss.sign(t, "RS256", "rsa", iss.claims(map[string]any{"sub": "system:serviceaccount:default:default"})), wantErr: true},
+		{name: "expired", token: iss.sign(t, "RS256", "rsa", iss.claims(map[string]any{"exp": time.Now().Add(-time.Hour).Unix()})), wantErr: true},
+		{name: "not valid yet", token: iss.sign(t, "RS256", "rsa", iss.claims(map[string]any{"nbf": time.Now().Add(time.Hour).Unix()})), wantErr: true},
+		{name: "no expiry", token: iss.sign(t, "RS256", "rsa", iss.claims(map[string]any{"exp": 0})), wantErr: true},
+		{name: "algorithm of another key", token: iss.sign(t, "ES256", "rsa", iss.claims(nil)), wantErr: true},
+		{name: "ES256 with a P-384 key", token: iss.sign(t, "ES256", "ec384", iss.claims(nil)), wantErr: true},
+		{name: "ES384 with a P-256 key", token: iss.sign(t, "ES384", "ec", iss.claims(nil)), wantErr: true},
+		{name: "ES512 with a P-256 key", token: iss.sign(t, "ES512", "ec", iss.claims(nil)), wantErr: true},
+		{name: "algorithm other than the one of the key", token: iss.sign(t, "RS256", "rsa-pinned", iss.claims(nil)), wantErr: true},
+		{name: "symmetric algorithm", token: iss.sign(t, "HS256", "rsa", iss.claims(nil)), wantErr: true},
+		{name: "symmetric key", token: iss.sign(t, "HS256", "symmetric", iss.claims(nil)), wantErr: true},
+		{name: "no algorithm", token: iss.sign(t, "none", "rsa", iss.claims(nil)), wantErr: true},
+		{name: "tampered claims", token: tamper(iss.sign(t, "RS256", "rsa", iss.claims(nil)), iss.claims(map[string]any{"sub": "admin"})), wantErr: true},
+		{name: "malformed", token: "not-a-token", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := verifier.Verify(context.Background(), tt.token)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidToken) {
+					t.Errorf("Verify() error = %v, want %v", err, ErrInvalidToken)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Verify() error = %v", err)
+			}
+			if claims.Subject != "system:serviceaccount:external-dns:external-dns" {
+				t.Errorf("Verify() subject = %q", claims.Subject)
+			}
+		})
+	}
+
+	if fetches := iss.keyFetches.Load(); fetches != 1 {
+		t.Errorf("keys fetched %d times, want 1", fetches)
+	}
+}
+
+// tamper replaces the claims of a signed token.
+func tamper(token string, claims map[string]any) string {
+	parts := strings.Split(token, ".")
+	payload, _ := json.Marshal(claims)
+	parts[1] = base64.RawURLEncoding.EncodeToString(payload)
+	return strings.Join(parts, ".")
+}
+
+func TestVerifyUnknownKey(t *testing.T) {
+	iss := newIssuer(t)
+	verifier := NewVerifier(iss.server.URL, "external-dns-webhook", nil, iss.caFile, nil)
+	now := time.Now()
+	verifier.now = func() time.Time { return now }
+
+	for range 3 {
+		_, err := verifier.Verify(context.Background(), iss.sign(t, "RS256", "rotated", iss.claims(nil)))
+		if !errors.Is(err, ErrInvalidToken) {
+			t.Fatalf("Verify() error = %v, want %v", err, ErrInvalidToken)
+		}
+	}
+	if fetches := iss.keyFetches.Load(); fetches != 1 {
+		t.Errorf("keys fetched %d times within the refresh interval, want 1", fetches)
+	}
+
+	now = now.Add(keysRefreshInterval)
+	if _, err := verifier.Verify(context.Background(), iss.sign(t, "RS256", "rotated", iss.claims(nil))); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("Verify() error = %v, want %v", err, ErrInvalidToken)
+	}
+	if fetches := iss.keyFetches.Load(); fetches != 2 {
+		t.Errorf("keys fetched %d times after the refresh interval, want 2", fetches)
+	}
+}
+
+func TestVerifyFailingIssuer(t *testing.T) {
+	iss := newIssuer(t)
+	iss.failing.Store(true)
+	verifier := NewVerifier(iss.server.URL, "external-dns-webhook", nil, iss.caFile, nil)
+	now := time.Now()
+	verifier.now = func() time.Time { return now }
+	token := iss.sign(t, "RS256", "rsa", iss.claims(nil))
+
+	// Concurrent verifications share a single fetch, and its failure is remembered until the
+	// refresh interval elapses.
+	var wg sync.WaitGroup
+	errs := make([]error, 10)
+	for i := range errs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, errs[i] = verifier.Verify(context.Background(), token)
+		}()
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err == nil || errors.Is(err, ErrInvalidToken) {
+			t.Fatalf("Verify() error = %v, want a discovery error", err)
+		}
+	}
+	if _, err := verifier.Verify(context.Background(), token); err == nil {
+		t.Fatal("Verify() error = nil within the refresh interval, want the failure of the last fetch")
+	}
+	if fetches := iss.keyFetches.Load(); fetches != 1 {
+		t.Errorf("keys fetched %d times within the refresh interval, want 1", fetches)
+	}
+
+	// Once the refresh interval elapsed, the keys are fetched again.
+	iss.failing.Store(false)
+	now = now.Add(keysRefreshInterval)
+	if _, err := verifier.Verify(context.Background(), token); err != nil {
+		t.Fatalf("Verify() error = %v after the issuer recovered", err)
+	}
+	if fetches := iss.keyFetches.Load(); fetches != 2 {
+		t.Errorf("keys fetched %d times after the refresh interval, want 2", fetches)
+	}
+}
+
+func TestVerifyUntrustedIssuer(t *testing.T) {
+	iss := newIssuer(t)
+	verifier := NewVerifier(iss.server.URL, "external-dns-webhook", nil, "", nil)
+
+	_, err := verifier.Verify(context.Background(), iss.sign(t, "RS256", "rsa", iss.claims(nil)))
+	if err == nil || errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Verify() error = %v, want a discovery error", err)
+	}
+}
@@ -0,0 +1,82 @@
+// Package security runs the security self-checks of the webhook on startup, finding the
+// deployments that run as root, leave their secret files readable by other users, skip the
+// verification of the certificates of OpenStack, or expose the unauthenticated webhook API on every
+// network interface.
+package security
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/pkg/config"
+)
+
+// Supported values of the security checks mode.
+const (
+	// ModeOff skips the checks.
+	ModeOff = "off"
+	// ModeWarn logs a warning for every finding.
+	ModeWarn = "warn"
+	// ModeStrict refuses to start when there is any finding.
+	ModeStrict = "strict"
+)
+
+// Modes are the supported security checks modes.
+var Modes = []string{ModeOff, ModeWarn, ModeStrict}
+
+// unsafeFileMode are the permission bits that make a secret file unsafe: any permission for the
+// other users, or write permission for the group. A Secret mounted with the default mode of
+// Kubernetes, 0644, is therefore reported; mount it with a defaultMode of 0400 or 0440.
+const unsafeFileMode = 0o027
+
+// Check runs the security self-checks against the configuration and returns what they found, empty
+// when nothing is wrong.
+func Check(cfg *config.Config) []string {
+	var findings []string
+	if !cfg.AllowRoot && geteuid() == 0 {
+		findings = append(findings, "running as root; run as an unprivileged user, or set --allow-root")
+	}
+	for _, file := range secretFiles(cfg) {
+		info, err := os.Stat(file)
+		if err != nil {
+			// A missing file is reported when it is used, with a clearer error.
+			continue
+		}
+		if mode := info.Mode().Perm(); mode&unsafeFileMode != 0 {
+			findings = append(findings, fmt.Sprintf("secret file %s has mode %04o, readable or writable by other users; restrict it to 0400 or 0440", file, mode))
+		}
+	}
+	if cfg.OpenStackInsecureSkipVerify {
+		findings = append(findings, "the TLS certificates of the OpenStack APIs are not verified; unset --os-insecure-skip-verify, and set --os-ca-file if they are signed by a private CA")
+	}
+	if cfg.OIDCIssuerURL == "" && listensOnAllInterfaces(cfg.ListenAddress) {
+		findings = append(findings, fmt.Sprintf("the webhook API listens on every interface (%q) without authentication; listen on 127.0.0.1 or set --oidc-issuer-url", cfg.ListenAddress))
+	}
+	return findings
+}
+
+// geteuid returns the effective user ID of the process, replaced in tests.
+var geteuid = os.Geteuid
+
+// secretFiles returns the configured files holding credentials.
+func secretFiles(cfg *config.Config) []string {
+	var files []string
+	for _, file := range []string{cfg.OpenStackPasswordFile, cfg.OpenStackAccessTokenFile, cfg.OpenStackKeytab} {
+		if file != "" {
+			files = append(files, file)
+		}
+	}
+	return files
+}
+
+// listensOnAllInterfaces reports whether the listen address is the unspecified address, on which
+// every interface is listened on.
+func listensOnAllInterfaces(address string) bool {
+	if address == "" {
+		return true
+	}
+	ip := net.ParseIP(strings.Trim(address, "[]"))
+	return ip != nil && ip.IsUnspecified()
+}
@@ -0,0 +1,106 @@
+package security
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/pkg/config"
+)
+
+func TestCheck(t *testing.T) {
+	dir := t.TempDir()
+	safe := filepath.Join(dir, "safe")
+	unsafe := filepath.Join(dir, "unsafe")
+	for file, mode := range map[string]os.FileMode{safe: 0o400, unsafe: 0o644} {
+		if err := os.WriteFile(file, []byte("secret"), mode); err != nil {
+			t.Fatal(err)
+		}
+		// The mode is set explicitly, as the umask of the test may restrict it.
+		if err := os.Chmod(file, mode); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		cfg  *config.Config
+		euid int
+		want []string
+	}{
+		{
+			name: "safe",
+			cfg:  &config.Config{ListenAddress: "127.0.0.1", OpenStackPasswordFile: safe},
+			euid: 1000,
+		},
+		{
+			name: "root",
+			cfg:  &config.Config{ListenAddress: "127.0.0.1"},
+			euid: 0,
+			want: []string{"running as root"},
+		},
+		{
+			name: "root allowed",
+			cfg:  &config.Config{ListenAddress: "127.0.0.1", AllowRoot: true},
+			euid: 0,
+		},
+		{
+			name: "secret file readable by other users",
+			cfg:  &config.Config{ListenAddress: "127.0.0.1", OpenStackAccessTokenFile: unsafe},
+			euid: 1000,
+			want: []string{"secret file " + unsafe + " has mode 0644"},
+		},
+		{
+			name: "missing secret file",
+			cfg:  &config.Config{ListenAddress: "127.0.0.1", OpenStackKeytab: filepath.Join(dir, "missing")},
+			euid: 1000,
+		},
+		{
+			name: "OpenStack certificates not verified",
+			cfg:  &config.Config{ListenAddress: "127.0.0.1", OpenStackInsecureSkipVerify: true},
+			euid: 1000,
+			want: []string{"--os-insecure-skip-verify"},
+		},
+		{
+			name: "every IPv4 interface without authentication",
+			cfg:  &config.Config{ListenAddress: "0.0.0.0"},
+			euid: 1000,
+			want: []string{"listens on every interface"},
+		},
+		{
+			name: "every IPv6 interface without authentication",
+			cfg:  &config.Config{ListenAddress: "[::]"},
+			euid: 1000,
+			want: []string{"listens on every interface"},
+		},
+		{
+			name: "every interface with authentication",
+			cfg:  &config.Config{ListenAddress: "0.0.0.0", OIDCIssuerURL: "https://issuer.example.org"},
+			euid: 1000,
+		},
+		{
+			name: "everything",
+			cfg:  &config.Config{OpenStackPasswordFile: unsafe},
+			euid: 0,
+			want: []string{"running as root", "has mode 0644", "listens on every interface"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			geteuid = func() int { return tt.euid }
+			t.Cleanup(func() { geteuid = os.Geteuid })
+
+			got := Check(tt.cfg)
+			if len(got) != len(tt.want) {
+				t.Fatalf("Check() = %q, want %d findings", got, len(tt.want))
+			}
+			for i, want := range tt.want {
+				if !strings.Contains(got[i], want) {
+					t.Errorf("Check()[%d] = %q, want it to contain %q", i, got[i], want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,120 @@
+// Package tlsconfig builds the TLS configuration of the connections of the webhook to the external
+// APIs from the configured minimum version, cipher suites and profile, so security teams can
+// enforce their policy without patching the code.
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"fmt"
+	"slices"
+
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/pkg/config"
+)
+
+// Supported values of the TLS profile.
+const (
+	// ProfileDefault uses the cipher suites and curves selected by Go.
+	ProfileDefault = "default"
+	// ProfileStrict restricts the TLS 1.2 cipher suites to ECDHE with AES-GCM and the key exchanges
+	// to the NIST P-256 and P-384 curves, the algorithms approved by FIPS 140. The TLS 1.3 cipher
+	// suites are not configurable in Go, a FIPS build being required to exclude ChaCha20-Poly1305.
+	ProfileStrict = "strict"
+)
+
+// Supported values of the minimum TLS version.
+const (
+	Version12 = "1.2"
+	Version13 = "1.3"
+)
+
+// Profiles are the supported TLS profiles.
+var Profiles = []string{ProfileDefault, ProfileStrict}
+
+// Versions are the supported minimum TLS versions.
+var Versions = []string{Version12, Version13}
+
+// strictCipherSuites are the TLS 1.2 cipher suites of the strict profile.
+var strictCipherSuites = []uint16{
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+}
+
+// strictCurves are the key exchanges of the strict profile.
+var strictCurves = []tls.CurveID{tls.CurveP256, tls.CurveP384}
+
+// New returns the TLS configuration selected by the configuration: the minimum version, then the
+// cipher suites of the profile, replaced by the configured ones if any. Only the secure TLS 1.2
+// cipher suites known to Go can be selected, by their IANA name, e.g.
+// TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256; the strict profile only accepts its own.
+func New(cfg *config.Config) (*tls.Config, error) {
+	tlsConfig := &tls.Config{}
+
+	switch cfg.TLSMinVersion {
+	case "", Version12:
+		tlsConfig.MinVersion = tls.VersionTLS12
+	case Version13:
+		tlsConfig.MinVersion = tls.VersionTLS13
+	default:
+		return nil, fmt.Errorf("unsupported minimum TLS version %q", cfg.TLSMinVersion)
+	}
+
+	switch cfg.TLSProfile {
+	case "", ProfileDefault:
+	case ProfileStrict:
+		tlsConfig.CipherSuites = slices.Clone(strictCipherSuites)
+		tlsConfig.CurvePreferences = slices.Clone(strictCurves)
+	default:
+		return nil, fmt.Errorf("unsupported TLS profile %q", cfg.TLSProfile)
+	}
+
+	if len(cfg.TLSCipherSuites) > 0 {
+		if tlsConfig.MinVersion == tls.VersionTLS13 {
+			return nil, fmt.Errorf("the cipher suites cannot be configured with TLS %s", Version13)
+		}
+		suites, err := cipherSuites(cfg.TLSCipherSuites)
+		if err != nil {
+			return nil, err
+		}
+		if tlsConfig.CipherSuites != nil {
+			for _, suite := range suites {
+				if !slices.Contains(tlsConfig.CipherSuites, suite) {
+					return nil, fmt.Errorf("cipher suite %s is not allowed by the %s TLS profile", tls.CipherSuiteName(suite), cfg.TLSProfile)
+				}
+			}
+		}
+		tlsConfig.CipherSuites = suites
+	}
+	return tlsConfig, nil
+}
+
+// cipherSuites returns the IDs of the cipher suites with the given names.
+func cipherSuites(names []string) ([]uint16, error) {
+	suites := make([]uint16, 0, len(names))
+	for _, name := range names {
+		index := slices.IndexFunc(tls.CipherSuites(), func(suite *tls.CipherSuite) bool {
+			return suite.Name == name
+		})
+		if index < 0 {
+			return nil, fmt.Errorf("unsupported or insecure cipher suite %q", name)
+		}
+		suite := tls.CipherSuites()[index]
+		if !slices.Contains(suite.SupportedVersions, tls.VersionTLS12) {
+			return nil, fmt.Errorf("cipher suite %s is a TLS 1.3 suite, which cannot be configured", name)
+		}
+		suites = append(suites, suite.ID)
+	}
+	return suites, nil
+}
+
+// CipherSuiteNames returns the names of the cipher suites that can be configured.
+func CipherSuiteNames() []string {
+	var names []string
+	for _, suite := range tls.CipherSuites() {
+		if slices.Contains(suite.SupportedVersions, tls.VersionTLS12) {
+			names = append(names, suite.Name)
+		}
+	}
+	return names
+}
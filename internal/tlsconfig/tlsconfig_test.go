@@ -0,0 +1,102 @@
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"slices"
+	"testing"
+
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/pkg/config"
+)
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name             string
+		cfg              *config.Config
+		wantMinVersion   uint16
+		wantCipherSuites []uint16
+		wantCurves       []tls.CurveID
+		wantErr          bool
+	}{
+		{
+			name:           "defaults",
+			cfg:            &config.Config{},
+			wantMinVersion: tls.VersionTLS12,
+		},
+		{
+			name:           "TLS 1.3",
+			cfg:            &config.Config{TLSMinVersion: Version13},
+			wantMinVersion: tls.VersionTLS13,
+		},
+		{
+			name:             "strict profile",
+			cfg:              &config.Config{TLSMinVersion: Version12, TLSProfile: ProfileStrict},
+			wantMinVersion:   tls.VersionTLS12,
+			wantCipherSuites: strictCipherSuites,
+			wantCurves:       strictCurves,
+		},
+		{
+			name:             "cipher suites",
+			cfg:              &config.Config{TLSCipherSuites: []string{"TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256", "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"}},
+			wantMinVersion:   tls.VersionTLS12,
+			wantCipherSuites: []uint16{tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256, tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256},
+		},
+		{
+			name:             "cipher suites of the strict profile",
+			cfg:              &config.Config{TLSProfile: ProfileStrict, TLSCipherSuites: []string{"TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384"}},
+			wantMinVersion:   tls.VersionTLS12,
+			wantCipherSuites: []uint16{tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384},
+			wantCurves:       strictCurves,
+		},
+		{
+			name:    "cipher suite outside of the strict profile",
+			cfg:     &config.Config{TLSProfile: ProfileStrict, TLSCipherSuites: []string{"TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256"}},
+			wantErr: true,
+		},
+		{
+			name:    "insecure cipher suite",
+			cfg:     &config.Config{TLSCipherSuites: []string{"TLS_RSA_WITH_RC4_128_SHA"}},
+			wantErr: true,
+		},
+		{
+			name:    "TLS 1.3 cipher suite",
+			cfg:     &config.Config{TLSCipherSuites: []string{"TLS_AES_128_GCM_SHA256"}},
+			wantErr: true,
+		},
+		{
+			name:    "cipher suites with TLS 1.3",
+			cfg:     &config.Config{TLSMinVersion: Version13, TLSCipherSuites: []string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"}},
+			wantErr: true,
+		},
+		{
+			name:    "TLS 1.1",
+			cfg:     &config.Config{TLSMinVersion: "1.1"},
+			wantErr: true,
+		},
+		{
+			name:    "unknown profile",
+			cfg:     &config.Config{TLSProfile: "modern"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := New(tt.cfg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("New() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got.MinVersion != tt.wantMinVersion {
+				t.Errorf("MinVersion = %x, want %x", got.MinVersion, tt.wantMinVersion)
+			}
+			if !slices.Equal(got.CipherSuites, tt.wantCipherSuites) {
+				t.Errorf("CipherSuites = %v, want %v", got.CipherSuites, tt.wantCipherSuites)
+			}
+			if !slices.Equal(got.CurvePreferences, tt.wantCurves) {
+				t.Errorf("CurvePreferences = %v, want %v", got.CurvePreferences, tt.wantCurves)
+			}
+		})
+	}
+}
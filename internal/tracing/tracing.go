@@ -0,0 +1,132 @@
+// Package tracing sets up the OpenTelemetry tracing of the webhook.
+//
+// The spans are exported over OTLP/HTTP to a collector or tracing backend, so that a slow
+// ApplyChanges can be broken down into its Kubernetes node listing, per-node diff and per-node Nova
+// writes. Until Setup is called, or when no endpoint is configured, the spans are no-ops and cost
+// next to nothing.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// InstrumentationName is the name of the tracer of the webhook.
+const InstrumentationName = "github.com/thewillyhuman/external-dns-cern-cloud-webhook"
+
+// ServiceName is the service name the spans are reported under.
+const ServiceName = "external-dns-cern-webhook"
+
+// Options configures the export of the spans.
+type Options struct {
+	// Endpoint is the URL of the OTLP/HTTP endpoint, e.g. `http://otel-collector:4318`. The
+	// `/v1/traces` path is appended when the URL has no path. Empty disables tracing.
+	Endpoint string
+	// SampleRatio is the fraction of the traces started by the webhook that are recorded, between 0
+	// and 1. The traces started by a caller propagating a sampled trace are always recorded.
+	SampleRatio float64
+}
+
+// Setup installs the global tracer provider exporting the spans to the configured endpoint, and the
+// W3C Trace Context propagator. It returns a function flushing the pending spans and stopping the
+// export, to be called on shutdown.
+//
+// Nothing is installed when no endpoint is configured, and the returned function does nothing.
+func Setup(ctx context.Context, opts Options) (func(context.Context) error, error) {
+	if opts.Endpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporter, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(opts.Endpoint))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the otlp trace exporter: %w", err)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(semconv.ServiceName(ServiceName)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the trace resource: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(opts.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	return provider.Shutdown, nil
+}
+
+// Start starts a span with the given attributes, child of the span carried by ctx if any, and
+// returns a copy of ctx carrying it. The span must be ended, usually with End.
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(InstrumentationName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// End ends a span, recording err and flagging the span as failed if it is not nil.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// Handler wraps an HTTP handler to serve every request in a server span named after its endpoint,
+// e.g. `POST /records`. The trace context sent by the client, if any, is continued.
+func Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := otel.Tracer(InstrumentationName).Start(ctx, r.Method+" "+r.URL.Path,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(r.Method),
+				semconv.URLPath(r.URL.Path),
+			))
+		defer span.End()
+
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r.WithContext(ctx))
+
+		span.SetAttributes(semconv.HTTPResponseStatusCode(recorder.status))
+		if recorder.status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(recorder.status))
+		}
+	})
+}
+
+// statusRecorder records the status code of a response.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+// WriteHeader records the status code before writing it.
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Flush flushes the underlying response writer, if it supports it, so that streamed responses such
+// as the Records one keep being flushed.
+func (r *statusRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap returns the underlying response writer, for http.ResponseController.
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
@@ -0,0 +1,138 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// recordSpans installs a tracer provider recording the ended spans for the duration of the test.
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	previous, previousPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(previous)
+		otel.SetTextMapPropagator(previousPropagator)
+	})
+	return recorder
+}
+
+func TestSetupDisabled(t *testing.T) {
+	shutdown, err := Setup(context.Background(), Options{})
+	if err != nil {
+		t.Fatalf("Setup() error = %v", err)
+	}
+	if err := shutdown(context.Background()); err != nil {
+		t.Errorf("shutdown() error = %v", err)
+	}
+}
+
+func TestStartEnd(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus codes.Code
+	}{
+		{name: "success", wantStatus: codes.Unset},
+		{name: "failure", err: errors.New("nova unavailable"), wantStatus: codes.Error},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := recordSpans(t)
+
+			ctx, parent := Start(context.Background(), "cern.SyncState")
+			_, span := Start(ctx, "cern.SyncNode", attribute.String("server.id", "abc"))
+			End(span, tt.err)
+			End(parent, nil)
+
+			spans := recorder.Ended()
+			if len(spans) != 2 {
+				t.Fatalf("recorded %d spans, want 2", len(spans))
+			}
+			node := spans[0]
+			if node.Name() != "cern.SyncNode" || node.Parent().SpanID() != parent.SpanContext().SpanID() {
+				t.Errorf("span %s has parent %s, want cern.SyncNode child of %s", node.Name(), node.Parent().SpanID(), parent.SpanContext().SpanID())
+			}
+			if node.Status().Code != tt.wantStatus {
+				t.Errorf("status = %v, want %v", node.Status().Code, tt.wantStatus)
+			}
+			if got := node.Attributes(); len(got) != 1 || got[0] != attribute.String("server.id", "abc") {
+				t.Errorf("attributes = %v, want server.id", got)
+			}
+		})
+	}
+}
+
+func TestHandler(t *testing.T) {
+	tests := []struct {
+		name        string
+		traceparent string
+		status      int
+		wantTraceID string
+		wantStatus  codes.Code
+	}{
+		{name: "new trace", status: http.StatusOK, wantStatus: codes.Unset},
+		{
+			name:        "continued trace",
+			traceparent: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			status:      http.StatusOK,
+			wantTraceID: "4bf92f3577b34da6a3ce929d0e0e4736",
+			wantStatus:  codes.Unset,
+		},
+		{name: "server error", status: http.StatusInternalServerError, wantStatus: codes.Error},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := recordSpans(t)
+
+			var inner trace.SpanContext
+			handler := Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				inner = trace.SpanContextFromContext(r.Context())
+				if _, ok := w.(http.Flusher); !ok {
+					t.Error("response writer is not a http.Flusher")
+				}
+				w.WriteHeader(tt.status)
+			}))
+
+			req := httptest.NewRequest(http.MethodPost, "/records", nil)
+			if tt.traceparent != "" {
+				req.Header.Set("traceparent", tt.traceparent)
+			}
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			spans := recorder.Ended()
+			if len(spans) != 1 {
+				t.Fatalf("recorded %d spans, want 1", len(spans))
+			}
+			span := spans[0]
+			if span.Name() != "POST /records" || span.SpanKind() != trace.SpanKindServer {
+				t.Errorf("span = %s (%v), want the POST /records server span", span.Name(), span.SpanKind())
+			}
+			if span.SpanContext().SpanID() != inner.SpanID() {
+				t.Errorf("handler context carries span %s, want %s", inner.SpanID(), span.SpanContext().SpanID())
+			}
+			if tt.wantTraceID != "" && span.SpanContext().TraceID().String() != tt.wantTraceID {
+				t.Errorf("trace ID = %s, want %s", span.SpanContext().TraceID(), tt.wantTraceID)
+			}
+			if span.Status().Code != tt.wantStatus {
+				t.Errorf("status = %v, want %v", span.Status().Code, tt.wantStatus)
+			}
+		})
+	}
+}
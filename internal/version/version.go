@@ -0,0 +1,66 @@
+// Package version holds the build metadata of the webhook.
+//
+// The version, commit and build date are set at build time with the linker, e.g.
+//
+//	go build -ldflags "-X github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/version.Version=v1.2.3" ./cmd/webhook
+//
+// The Makefile and the Dockerfile set them from git. Without them, the commit and build date are
+// taken from the VCS information embedded by the Go toolchain, if any.
+package version
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+)
+
+// Build metadata, set with -ldflags "-X ...".
+var (
+	// Version is the released version of the webhook, e.g. v1.2.3.
+	Version = "dev"
+	// Commit is the git commit the webhook was built from.
+	Commit = ""
+	// BuildDate is when the webhook was built, in RFC 3339 format.
+	BuildDate = ""
+)
+
+// WebhookAPIVersion is the version of the ExternalDNS webhook provider API implemented by the
+// webhook, as negotiated through the `application/external.dns.webhook+json;version=1` media type.
+const WebhookAPIVersion = "1"
+
+// Info is the build metadata of the running webhook.
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildDate string `json:"buildDate"`
+	GoVersion string `json:"goVersion"`
+	// WebhookAPIVersion is the version of the ExternalDNS webhook API implemented.
+	WebhookAPIVersion string `json:"webhookAPIVersion"`
+}
+
+// Get returns the build metadata of the running webhook.
+func Get() Info {
+	info := Info{Version: Version, Commit: Commit, BuildDate: BuildDate, GoVersion: runtime.Version(), WebhookAPIVersion: WebhookAPIVersion}
+	if buildInfo, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range buildInfo.Settings {
+			switch {
+			case setting.Key == "vcs.revision" && info.Commit == "":
+				info.Commit = setting.Value
+			case setting.Key == "vcs.time" && info.BuildDate == "":
+				info.BuildDate = setting.Value
+			}
+		}
+	}
+	if info.Commit == "" {
+		info.Commit = "unknown"
+	}
+	if info.BuildDate == "" {
+		info.BuildDate = "unknown"
+	}
+	return info
+}
+
+// String formats the build metadata on a single line.
+func (i Info) String() string {
+	return fmt.Sprintf("%s (commit %s, built %s, %s, webhook API v%s)", i.Version, i.Commit, i.BuildDate, i.GoVersion, i.WebhookAPIVersion)
+}
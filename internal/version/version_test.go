@@ -0,0 +1,26 @@
+package version
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGet(t *testing.T) {
+	Version, Commit, BuildDate = "v1.2.3", "abc1234", "2026-01-02T03:04:05Z"
+	t.Cleanup(func() { Version, Commit, BuildDate = "dev", "", "" })
+
+	info := Get()
+	if info.Version != "v1.2.3" || info.Commit != "abc1234" || info.BuildDate != "2026-01-02T03:04:05Z" || info.GoVersion == "" {
+		t.Errorf("Get() = %+v, want the linker values", info)
+	}
+	if got := info.String(); !strings.HasPrefix(got, "v1.2.3 (commit abc1234, built 2026-01-02T03:04:05Z, go") || !strings.HasSuffix(got, ", webhook API v1)") {
+		t.Errorf("String() = %q", got)
+	}
+}
+
+func TestGetDefaults(t *testing.T) {
+	info := Get()
+	if info.Version != "dev" || info.Commit == "" || info.BuildDate == "" {
+		t.Errorf("Get() = %+v, want dev with a commit and build date", info)
+	}
+}
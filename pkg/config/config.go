@@ -5,6 +5,8 @@
 // and makes it easier to manage the application's settings.
 package config
 
+import "time"
+
 // Config holds all the configuration for the application.
 //
 // This struct is a single source of truth for all application settings.
@@ -16,8 +18,88 @@ type Config struct {
 	ListenAddress string
 	// ListenPort is the port that the webhook server will listen on.
 	ListenPort int
+	// HealthListenPort is the port of a separate listener for the health, metrics and debug
+	// endpoints, 0 to serve them on ListenPort.
+	HealthListenPort int
+	// DebugToken is the bearer token protecting the /debug/loglevel endpoint, disabled when empty.
+	DebugToken string
+	// OIDCIssuerURL is the URL of the OpenID Connect issuer whose tokens the requests to the webhook
+	// API must carry, e.g. the Kubernetes service account issuer. The requests are not
+	// authenticated when empty.
+	OIDCIssuerURL string
+	// OIDCAudience is the audience the tokens must be intended for.
+	OIDCAudience string
+	// OIDCSubjects are the subjects whose tokens are accepted, any subject when empty.
+	OIDCSubjects []string
+	// OIDCCAFile is the file of the CA certificates of the OIDC issuer, the system ones when empty.
+	OIDCCAFile string
+	// TLSMinVersion is the minimum TLS version of the connections to the external APIs: 1.2 or 1.3.
+	TLSMinVersion string
+	// TLSCipherSuites are the names of the TLS 1.2 cipher suites of the connections to the external
+	// APIs, those of TLSProfile when empty.
+	TLSCipherSuites []string
+	// TLSProfile selects the cipher suites and curves of the connections to the external APIs:
+	// default, or strict for the FIPS-approved ones.
+	TLSProfile string
+	// SecurityChecks is what the security self-checks do on startup: off, warn, or strict to refuse
+	// to start when they find anything.
+	SecurityChecks string
+	// AllowRoot allows the webhook to run as root without the security self-checks reporting it.
+	AllowRoot bool
 	// LogLevel is the logging level for the application.
 	LogLevel string
+	// LogFormat is the log output format: console or json.
+	LogFormat string
+	// LogColor defines when the console log format uses colors: auto, always or never.
+	LogColor string
+	// LogCaller adds the file and line of the code logging every message.
+	LogCaller bool
+	// LogSampling logs only 1 in LogSampling requests to the high-frequency endpoints below the
+	// warning level.
+	LogSampling int
+	// LogFile is the file the logs are written to, stdout when empty.
+	LogFile string
+	// LogSyslog sends the logs to the local syslog daemon or journald instead of stdout.
+	LogSyslog bool
+	// LogSyslogTag is the tag of the logs sent to syslog.
+	LogSyslogTag string
+	// LogFileMaxSize is the size in megabytes at which the log file is rotated.
+	LogFileMaxSize int
+	// LogFileMaxAge is how long rotated log files are kept, forever if zero.
+	LogFileMaxAge time.Duration
+	// LogFileMaxBackups is the number of rotated log files kept, all if zero.
+	LogFileMaxBackups int
+	// LogFileCompress compresses the rotated log files with gzip.
+	LogFileCompress bool
+	// HealthCritical lists the components whose failure fails /healthz. The other components only
+	// degrade it.
+	HealthCritical []string
+	// HealthMaxCacheAge is how old the last listing of the OpenStack servers may get before the
+	// cache component is reported as failing, zero for no limit.
+	HealthMaxCacheAge time.Duration
+	// TracingEndpoint is the URL of the OTLP/HTTP endpoint the traces are exported to, tracing being
+	// disabled when empty.
+	TracingEndpoint string
+	// TracingSampleRatio is the fraction of the traces started by the webhook that are exported.
+	TracingSampleRatio float64
+	// Backend selects where aliases are stored: nova (instance metadata), landb (LanDB API) or fake
+	// (in-memory servers).
+	Backend string
+	// FakeFixture is the YAML file of the Kubernetes objects seeding the fake backend, the Nodes
+	// also defining the in-memory servers backing them.
+	FakeFixture string
+	// LanDBURL is the URL of the LanDB SOAP API used by the landb backend.
+	LanDBURL string
+	// LanDBInterface names the LanDB interface carrying the aliases, with {device} replaced by the device name.
+	LanDBInterface string
+	// LanDBUsername is the username for authenticating with LanDB.
+	LanDBUsername string
+	// LanDBPassword is the password for authenticating with LanDB.
+	LanDBPassword string
+	// BareMetalBackend selects where the aliases of Ironic bare-metal nodes are stored: nova or landb.
+	BareMetalBackend string
+	// BareMetalFlavors lists flavor names of bare-metal nodes, for clouds hiding flavor extra specs.
+	BareMetalFlavors []string
 	// OpenStackAuthURL is the URL of the OpenStack Keystone authentication service.
 	OpenStackAuthURL string
 	// OpenStackProjectName is the name of the OpenStack project to use.
@@ -26,20 +108,76 @@ type Config struct {
 	OpenStackUserDomainName string
 	// OpenStackProjectDomainID is the ID of the OpenStack project's domain.
 	OpenStackProjectDomainID string
+	// OpenStackAuthType is the authentication method: password, v3kerberos or v3oidcaccesstoken.
+	OpenStackAuthType string
+	// OpenStackKeytab is the path of the Kerberos keytab used by the v3kerberos auth type.
+	OpenStackKeytab string
+	// OpenStackKerberosPrincipal is the Kerberos principal (user@REALM) used by the v3kerberos auth type.
+	OpenStackKerberosPrincipal string
+	// OpenStackKrb5Config is the path of the Kerberos configuration file.
+	OpenStackKrb5Config string
+	// OpenStackIdentityProvider is the Keystone federation identity provider for federated auth types.
+	OpenStackIdentityProvider string
+	// OpenStackProtocol is the Keystone federation protocol for federated auth types.
+	OpenStackProtocol string
+	// OpenStackAccessToken is the OIDC access token used by the v3oidcaccesstoken auth type.
+	OpenStackAccessToken string
+	// OpenStackAccessTokenFile is a file containing the OIDC access token, read on every authentication
+	// and watched for rotations.
+	OpenStackAccessTokenFile string
 	// OpenStackUsername is the username for authenticating with OpenStack.
 	OpenStackUsername string
 	// OpenStackPassword is the password for authenticating with OpenStack.
 	OpenStackPassword string
+	// OpenStackPasswordFile is a file containing the OpenStack password, watched for rotations.
+	OpenStackPasswordFile string
 	// OpenStackRegionName is the name of the OpenStack region to use.
 	OpenStackRegionName string
+	// OpenStackFailoverAuthURLs are Keystone URLs tried in order when OpenStackAuthURL is unavailable.
+	OpenStackFailoverAuthURLs []string
+	// OpenStackFailoverRegions are regions tried in order when OpenStackRegionName is unavailable.
+	OpenStackFailoverRegions []string
 	// OpenStackInterface is the network interface to use for OpenStack services.
 	OpenStackInterface string
+	// OpenStackComputeMicroversion is the compute API microversion to pin, or "latest".
+	OpenStackComputeMicroversion string
+	// OpenStackCAFile is the file of the CA certificates of the OpenStack APIs, the system ones when empty.
+	OpenStackCAFile string
+	// OpenStackInsecureSkipVerify disables the verification of the TLS certificates of the OpenStack APIs.
+	OpenStackInsecureSkipVerify bool
 	// OpenStackIdentityAPIVersion is the version of the OpenStack Identity API to use.
 	OpenStackIdentityAPIVersion string
 	// DryRun enables dry-run mode, where no changes are applied.
 	DryRun bool
-	// IngressLabel is the label used to filter ingress nodes in OpenStack.
-	IngressLabel string
+	// IngressLabels are the Kubernetes label selectors of the ingress nodes, in the full selector
+	// syntax. Nodes matching any of them are ingress nodes.
+	IngressLabels []string
+	// KubeBackend is the Kubernetes backend: cluster or fake.
+	KubeBackend string
+	// KubeFakeObjects is the YAML file of the objects served by the fake Kubernetes backend.
+	KubeFakeObjects string
+	// KubeAPIQPS is the maximum rate of Kubernetes API requests per second.
+	KubeAPIQPS float32
+	// KubeAPIBurst is the number of Kubernetes API requests allowed above KubeAPIQPS in bursts.
+	KubeAPIBurst int
+	// NodeDiscovery is the node discovery mode: label, service, endpointslice or workload.
+	NodeDiscovery string
+	// NodeAddressType is the type of the node address reported as a target of the aliases:
+	// ExternalIP, InternalIP or auto.
+	NodeAddressType string
+	// IngressService is the `namespace/name` of the ingress controller Service in the service and
+	// endpointslice discovery modes.
+	IngressService string
+	// IngressWorkload is the `namespace/kind/name` of the ingress controller DaemonSet or Deployment
+	// in the workload discovery mode.
+	IngressWorkload string
+	// RequireNodeReady excludes the ingress nodes whose Ready condition is not True.
+	RequireNodeReady bool
+	// ExcludeUnschedulableNodes excludes the cordoned ingress nodes.
+	ExcludeUnschedulableNodes bool
+	// HonorExcludeFromLoadBalancers excludes the ingress nodes carrying the
+	// node.kubernetes.io/exclude-from-external-load-balancers label or annotation.
+	HonorExcludeFromLoadBalancers bool
 	// DomainFilter is a list of domains to filter.
 	DomainFilter []string
 	// ExcludeDomains is a list of domains to exclude.
@@ -48,4 +186,93 @@ type Config struct {
 	TXTPrefix string
 	// TXTSuffix is the suffix for TXT records.
 	TXTSuffix string
+	// ServerStatuses are the OpenStack server statuses accepted for ingress nodes.
+	ServerStatuses []string
+	// ServerCacheTTL is how long the listing of OpenStack servers is cached. Zero disables the cache.
+	ServerCacheTTL time.Duration
+	// SnapshotTTL is how long the ingress nodes read by Records are reused by the following
+	// ApplyChanges. Zero disables the snapshot.
+	SnapshotTTL time.Duration
+	// WarmUp lists the ingress nodes and servers at startup, the readiness probe failing until done.
+	WarmUp bool
+	// WarmUpTimeout is how long the warm-up is retried before the webhook becomes ready anyway.
+	WarmUpTimeout time.Duration
+	// RetryMaxAttempts is the total number of attempts for OpenStack operations failing with transient errors.
+	RetryMaxAttempts int
+	// RetryInitialBackoff is the maximum delay before the first retry of an OpenStack operation.
+	RetryInitialBackoff time.Duration
+	// RetryMaxBackoff caps the delay between two attempts of an OpenStack operation.
+	RetryMaxBackoff time.Duration
+	// OpenStackCassette is the YAML file the OpenStack interactions are recorded to or replayed from.
+	OpenStackCassette string
+	// OpenStackCassetteMode is off, record or replay.
+	OpenStackCassetteMode string
+	// APIRateLimit is the maximum number of OpenStack API requests per second. Zero disables the limit.
+	APIRateLimit float64
+	// APIRateBurst is the number of OpenStack API requests allowed above the rate limit in a burst.
+	APIRateBurst int
+	// SyncConcurrency is the maximum number of ingress nodes whose metadata is updated in parallel.
+	SyncConcurrency int
+	// RollbackOnFailure restores the previous metadata of updated nodes when a sync fails halfway.
+	RollbackOnFailure bool
+	// MetadataReplaceThreshold is the number of per-key Nova calls from which a node's metadata is
+	// replaced in a single call instead. Zero disables replacing.
+	MetadataReplaceThreshold int
+	// MetadataMaxItems is the maximum number of metadata items of a server allowed by the Nova
+	// quota, against which the metadata utilization of the ingress nodes is reported.
+	MetadataMaxItems int
+	// WriteVerifyAttempts is the number of times the metadata of a node is read back after a write
+	// to check it against the desired state. Zero disables the verification.
+	WriteVerifyAttempts int
+	// OwnerID identifies this webhook instance in the owner metadata key of the managed servers.
+	OwnerID string
+	// OrphanScan is the orphan scan mode: off, report or repair.
+	OrphanScan string
+	// VerifyPropagation enables checking that applied changes show up in DNS.
+	VerifyPropagation bool
+	// DNSServers are the DNS servers (host:port) queried to verify propagation. Empty uses the system resolver.
+	DNSServers []string
+	// PropagationTimeout is how long to wait for changes to show up in DNS.
+	PropagationTimeout time.Duration
+	// PropagationInterval is the delay between two DNS lookups while verifying propagation.
+	PropagationInterval time.Duration
+	// LeaderElect enables leader election, so that only one replica writes to OpenStack.
+	LeaderElect bool
+	// LeaderElectNamespace is the namespace of the leader election Lease.
+	LeaderElectNamespace string
+	// LeaderElectLeaseName is the name of the leader election Lease.
+	LeaderElectLeaseName string
+	// Standalone reconciles the aliases against the ExternalDNS DNSEndpoint resources, without an
+	// ExternalDNS deployment.
+	Standalone bool
+	// StandaloneResyncInterval is the delay between two reconciliations in standalone mode, on top of
+	// the ones triggered by DNSEndpoint changes.
+	StandaloneResyncInterval time.Duration
+	// CernAliasCRD enables the per-alias settings declared by CernAlias resources.
+	CernAliasCRD bool
+	// StateConfigMap is the `namespace/name` of the ConfigMap persisting the last applied state,
+	// empty to keep it in memory only.
+	StateConfigMap string
+	// Events enables the Kubernetes Events summarizing the outcome of every sync.
+	Events bool
+	// EventObject is the `namespace/kind/name` of the object the Events are emitted on, empty for
+	// the webhook's own Pod.
+	EventObject string
+	// NodeEventSync reconciles the aliases when the set of ingress nodes changes, without waiting for ExternalDNS.
+	NodeEventSync bool
+	// NodeEventDebounce is how long node events must settle before a reconciliation.
+	NodeEventDebounce time.Duration
+	// AuthCheckInterval is the delay between two checks of the OpenStack credentials. Zero disables the checks.
+	AuthCheckInterval time.Duration
+	// ProtectedAliases is a list of DNS names or /regex/ patterns that are never deleted.
+	ProtectedAliases []string
+	// ChaosNovaErrorRate is the fraction of the OpenStack API requests failed on purpose, to exercise
+	// the retries and the partial-failure handling in staging. Zero disables the failures.
+	ChaosNovaErrorRate float64
+	// ChaosNovaLatency is the maximum random delay added to every OpenStack API request.
+	ChaosNovaLatency time.Duration
+	// ChaosK8sErrorRate is the fraction of the Kubernetes API requests failed on purpose.
+	ChaosK8sErrorRate float64
+	// ChaosK8sLatency is the maximum random delay added to every Kubernetes API request.
+	ChaosK8sLatency time.Duration
 }
@@ -0,0 +1,224 @@
+// Package testing provides a harness running the webhook server against the fake backend, to write
+// end-to-end scenario tests of the ExternalDNS webhook API without CERN credentials nor cluster.
+//
+// The harness serves the webhook with httptest and drives it the way ExternalDNS does, through the
+// Records, AdjustEndpoints and ApplyChanges calls, or a whole Sync loop:
+//
+//	h := testing.New(t, testing.NewConfig("testdata/nodes.yaml"))
+//	if err := h.Sync(endpoint.NewEndpoint("app.cern.ch", endpoint.RecordTypeA, "10.0.0.1")); err != nil {
+//		t.Fatal(err)
+//	}
+//	records := h.Records()
+//
+// The fixture is the YAML file of Kubernetes objects of the fake backend, see --fake-fixture.
+package testing
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	gotesting "testing"
+
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/cern"
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/k8s"
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/log"
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/pkg/config"
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/pkg/webhook"
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/provider"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+// mediaType is the media type of the requests and responses of the webhook API.
+const mediaType = "application/external.dns.webhook+json;version=1"
+
+// NewConfig returns the configuration of a webhook using the fake backend seeded from the fixture,
+// with the defaults of the flags, except that the server listing is not cached, every OpenStack
+// call is attempted once, and no background work is started, so that the scenarios are
+// deterministic. It may be changed before being passed to New.
+func NewConfig(fixture string) *config.Config {
+	return &config.Config{
+		LogLevel:                      "error",
+		LogSampling:                   1,
+		Backend:                       cern.BackendFake,
+		FakeFixture:                   fixture,
+		BareMetalBackend:              cern.BackendNova,
+		KubeBackend:                   k8s.KubeBackendFake,
+		KubeFakeObjects:               fixture,
+		KubeAPIQPS:                    5,
+		KubeAPIBurst:                  10,
+		IngressLabels:                 []string{"node-role.kubernetes.io/ingress"},
+		NodeDiscovery:                 k8s.DiscoveryLabel,
+		NodeAddressType:               k8s.AddressTypeAuto,
+		RequireNodeReady:              true,
+		ExcludeUnschedulableNodes:     true,
+		HonorExcludeFromLoadBalancers: true,
+		ServerStatuses:                cern.DefaultServerStatuses,
+		RetryMaxAttempts:              1,
+		SyncConcurrency:               4,
+		RollbackOnFailure:             true,
+		MetadataReplaceThreshold:      3,
+		MetadataMaxItems:              128,
+		WriteVerifyAttempts:           2,
+		OwnerID:                       "default",
+		OrphanScan:                    cern.OrphanScanOff,
+		HealthCritical:                provider.DefaultHealthCritical,
+	}
+}
+
+// Harness serves the webhook against the fake backend, and drives it as ExternalDNS does.
+//
+// Its methods fail the test on transport and decoding errors, while the errors of the webhook
+// ApplyChanges may be asserted.
+type Harness struct {
+	// Server serves the webhook API, along with the health, metrics and debug endpoints.
+	Server *httptest.Server
+	// Config is the configuration of the webhook.
+	Config *config.Config
+
+	t gotesting.TB
+}
+
+// New starts the webhook with the given configuration, e.g. returned by NewConfig, and stops it
+// when the test ends.
+func New(t gotesting.TB, cfg *config.Config) *Harness {
+	t.Helper()
+	logger := log.NewNopLogger()
+	p, err := provider.New(cfg, logger)
+	if err != nil {
+		t.Fatalf("failed to create the provider: %v", err)
+	}
+	server := httptest.NewServer(webhook.NewServer(p, cfg, logger).Handler())
+	t.Cleanup(server.Close)
+	return &Harness{Server: server, Config: cfg, t: t}
+}
+
+// Negotiate calls GET /, as ExternalDNS does on startup, and returns the status code.
+func (h *Harness) Negotiate() int {
+	h.t.Helper()
+	resp := h.do(http.MethodGet, "/", nil)
+	defer resp.Body.Close()
+	return resp.StatusCode
+}
+
+// Records calls GET /records and returns the endpoints managed on the ingress nodes.
+func (h *Harness) Records() []*endpoint.Endpoint {
+	h.t.Helper()
+	var endpoints []*endpoint.Endpoint
+	h.decode(h.do(http.MethodGet, "/records", nil), &endpoints)
+	return endpoints
+}
+
+// AdjustEndpoints calls POST /adjustendpoints and returns the endpoints accepted by the webhook.
+func (h *Harness) AdjustEndpoints(endpoints []*endpoint.Endpoint) []*endpoint.Endpoint {
+	h.t.Helper()
+	var adjusted []*endpoint.Endpoint
+	h.decode(h.do(http.MethodPost, "/adjustendpoints", endpoints), &adjusted)
+	return adjusted
+}
+
+// ApplyChanges calls POST /records with the changes, returning the error answered by the webhook.
+func (h *Harness) ApplyChanges(changes *plan.Changes) error {
+	h.t.Helper()
+	resp := h.do(http.MethodPost, "/records", changes)
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("ApplyChanges answered %s: %s", resp.Status, bytes.TrimSpace(body))
+	}
+	return nil
+}
+
+// Sync runs a loop of ExternalDNS bringing the webhook to the desired endpoints: it adjusts them,
+// lists the current records, and applies the changes between both, if any.
+func (h *Harness) Sync(desired ...*endpoint.Endpoint) error {
+	h.t.Helper()
+	changes := Changes(h.Records(), h.AdjustEndpoints(desired))
+	if !changes.HasChanges() {
+		return nil
+	}
+	return h.ApplyChanges(changes)
+}
+
+// Changes returns the changes bringing the current endpoints to the desired ones, matched by DNS
+// name, record type and set identifier, as planned by ExternalDNS without a registry.
+func Changes(current, desired []*endpoint.Endpoint) *plan.Changes {
+	key := func(ep *endpoint.Endpoint) string {
+		return ep.DNSName + "/" + ep.RecordType + "/" + ep.SetIdentifier
+	}
+	currentByKey := make(map[string]*endpoint.Endpoint, len(current))
+	for _, ep := range current {
+		currentByKey[key(ep)] = ep
+	}
+
+	changes := &plan.Changes{}
+	for _, ep := range desired {
+		existing, ok := currentByKey[key(ep)]
+		switch {
+		case !ok:
+			changes.Create = append(changes.Create, ep)
+		case !existing.Targets.Same(ep.Targets) || !sameProviderSpecific(existing.ProviderSpecific, ep.ProviderSpecific):
+			changes.UpdateOld = append(changes.UpdateOld, existing)
+			changes.UpdateNew = append(changes.UpdateNew, ep)
+		}
+		delete(currentByKey, key(ep))
+	}
+	for _, ep := range current {
+		if _, ok := currentByKey[key(ep)]; ok {
+			changes.Delete = append(changes.Delete, ep)
+		}
+	}
+	return changes
+}
+
+// sameProviderSpecific reports whether two sets of provider-specific properties are equal, missing
+// and empty ones being the same.
+func sameProviderSpecific(a, b endpoint.ProviderSpecific) bool {
+	return len(a) == 0 && len(b) == 0 || reflect.DeepEqual(a, b)
+}
+
+// do sends a request to the webhook, with body encoded as JSON unless nil.
+func (h *Harness) do(method, path string, body any) *http.Response {
+	h.t.Helper()
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			h.t.Fatalf("failed to encode the %s %s request: %v", method, path, err)
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, h.Server.URL+path, reader)
+	if err != nil {
+		h.t.Fatalf("failed to create the %s %s request: %v", method, path, err)
+	}
+	req.Header.Set("Accept", mediaType)
+	if body != nil {
+		req.Header.Set("Content-Type", mediaType)
+	}
+	resp, err := h.Server.Client().Do(req)
+	if err != nil {
+		h.t.Fatalf("failed to send the %s %s request: %v", method, path, err)
+	}
+	return resp
+}
+
+// decode decodes the JSON body of a successful response into v.
+func (h *Harness) decode(resp *http.Response, v any) {
+	h.t.Helper()
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		h.t.Fatalf("failed to read the response of %s: %v", resp.Request.URL.Path, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		h.t.Fatalf("%s answered %s: %s", resp.Request.URL.Path, resp.Status, bytes.TrimSpace(body))
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		h.t.Fatalf("failed to decode the response of %s: %v", resp.Request.URL.Path, err)
+	}
+}
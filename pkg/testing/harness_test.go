@@ -0,0 +1,184 @@
+package testing
+
+import (
+	"encoding/json"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/cern"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+// recordNames returns the sorted DNS names of the endpoints.
+func recordNames(endpoints []*endpoint.Endpoint) []string {
+	var names []string
+	for _, ep := range endpoints {
+		names = append(names, ep.DNSName)
+	}
+	slices.Sort(names)
+	return names
+}
+
+func TestHarness(t *testing.T) {
+	// The scenario runs with and without the snapshot shared by Records and ApplyChanges, which must
+	// not serve stale aliases after a write.
+	for _, snapshotTTL := range []time.Duration{0, time.Minute} {
+		t.Run(snapshotTTL.String(), func(t *testing.T) {
+			cfg := NewConfig("../../deploy/fake-nodes.yaml")
+			cfg.SnapshotTTL = snapshotTTL
+			h := New(t, cfg)
+
+			if status := h.Negotiate(); status != 200 {
+				t.Fatalf("Negotiate() = %d, want 200", status)
+			}
+			if got := recordNames(h.Records()); !slices.Equal(got, []string{"app.cern.ch"}) {
+				t.Fatalf("Records() = %v, want the aliases of the fixture", got)
+			}
+
+			err := h.Sync(
+				endpoint.NewEndpoint("app.cern.ch", endpoint.RecordTypeA),
+				endpoint.NewEndpoint("new.cern.ch", endpoint.RecordTypeA),
+				endpoint.NewEndpoint("invalid_name.cern.ch", endpoint.RecordTypeA),
+			)
+			if err != nil {
+				t.Fatalf("Sync() error = %v", err)
+			}
+			if got := recordNames(h.Records()); !slices.Equal(got, []string{"app.cern.ch", "new.cern.ch"}) {
+				t.Errorf("Records() after Sync() = %v, want app.cern.ch and new.cern.ch", got)
+			}
+
+			if err := h.ApplyChanges(&plan.Changes{Delete: []*endpoint.Endpoint{endpoint.NewEndpoint("app.cern.ch", endpoint.RecordTypeA)}}); err != nil {
+				t.Fatalf("ApplyChanges() error = %v", err)
+			}
+			if got := recordNames(h.Records()); !slices.Equal(got, []string{"new.cern.ch"}) {
+				t.Errorf("Records() after ApplyChanges() = %v, want new.cern.ch", got)
+			}
+		})
+	}
+}
+
+func TestHarnessProviderSpecificRoundTrip(t *testing.T) {
+	for _, snapshotTTL := range []time.Duration{0, time.Minute} {
+		t.Run(snapshotTTL.String(), func(t *testing.T) {
+			cfg := NewConfig("testdata/zones.yaml")
+			cfg.SnapshotTTL = snapshotTTL
+			h := New(t, cfg)
+
+			zoned := endpoint.NewEndpoint("zoned.cern.ch", endpoint.RecordTypeA, "10.0.0.1").
+				WithProviderSpecific(cern.NodeSelectorProperty, "topology.kubernetes.io/zone=zone-a")
+			counted := endpoint.NewEndpoint("counted.cern.ch", endpoint.RecordTypeA, "10.0.0.1").
+				WithProviderSpecific(cern.NodeCountProperty, "1")
+			if err := h.Sync(zoned, counted); err != nil {
+				t.Fatalf("Sync() error = %v", err)
+			}
+
+			// The properties are reported by Records, so ExternalDNS plans no update.
+			records := h.Records()
+			if changes := Changes(records, h.AdjustEndpoints([]*endpoint.Endpoint{zoned, counted})); changes.HasChanges() {
+				t.Errorf("changes after Sync() = %+v, want none", changes)
+			}
+
+			// A change that does not list the zoned endpoint keeps it on its subset.
+			created := endpoint.NewEndpoint("created.cern.ch", endpoint.RecordTypeA, "10.0.0.1", "10.0.0.2")
+			if err := h.ApplyChanges(&plan.Changes{Create: []*endpoint.Endpoint{created}}); err != nil {
+				t.Fatalf("ApplyChanges() error = %v", err)
+			}
+			records = h.Records()
+			for _, ep := range records {
+				if ep.DNSName == "zoned.cern.ch" && !ep.Targets.Same(endpoint.Targets{"10.0.0.1"}) {
+					t.Errorf("zoned.cern.ch targets = %v, want the node of zone-a only", ep.Targets)
+				}
+				if ep.DNSName == "counted.cern.ch" && len(ep.Targets) != 1 {
+					t.Errorf("counted.cern.ch targets = %v, want a single node", ep.Targets)
+				}
+			}
+			if changes := Changes(records, h.AdjustEndpoints([]*endpoint.Endpoint{zoned, counted, created})); changes.HasChanges() {
+				t.Errorf("changes after ApplyChanges() = %+v, want none", changes)
+			}
+		})
+	}
+}
+
+func TestHarnessConcurrentRecords(t *testing.T) {
+	h := New(t, NewConfig("../../deploy/fake-nodes.yaml"))
+
+	// Concurrent Records calls are coalesced onto a single read of the nodes, each getting the records.
+	var wg sync.WaitGroup
+	names := make([][]string, 8)
+	errs := make([]error, len(names))
+	for i := range names {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := h.Server.Client().Get(h.Server.URL + "/records")
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			defer resp.Body.Close()
+			var endpoints []*endpoint.Endpoint
+			errs[i] = json.NewDecoder(resp.Body).Decode(&endpoints)
+			names[i] = recordNames(endpoints)
+		}()
+	}
+	wg.Wait()
+
+	for i := range names {
+		if errs[i] != nil {
+			t.Fatalf("GET /records error = %v", errs[i])
+		}
+		if !slices.Equal(names[i], []string{"app.cern.ch"}) {
+			t.Errorf("GET /records = %v, want the aliases of the fixture", names[i])
+		}
+	}
+}
+
+func TestHarnessWarmUp(t *testing.T) {
+	cfg := NewConfig("../../deploy/fake-nodes.yaml")
+	cfg.WarmUp, cfg.WarmUpTimeout = true, time.Minute
+	h := New(t, cfg)
+
+	// The webhook becomes ready once the ingress nodes have been read.
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		resp, err := h.Server.Client().Get(h.Server.URL + "/readyz")
+		if err != nil {
+			t.Fatalf("GET /readyz error = %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode == 200 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("GET /readyz = %d after the warm-up, want 200", resp.StatusCode)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestChanges(t *testing.T) {
+	current := []*endpoint.Endpoint{
+		endpoint.NewEndpoint("kept.cern.ch", endpoint.RecordTypeA, "10.0.0.1"),
+		endpoint.NewEndpoint("moved.cern.ch", endpoint.RecordTypeA, "10.0.0.1"),
+		endpoint.NewEndpoint("deleted.cern.ch", endpoint.RecordTypeA, "10.0.0.1"),
+	}
+	desired := []*endpoint.Endpoint{
+		endpoint.NewEndpoint("kept.cern.ch", endpoint.RecordTypeA, "10.0.0.1"),
+		endpoint.NewEndpoint("moved.cern.ch", endpoint.RecordTypeA, "10.0.0.2"),
+		endpoint.NewEndpoint("created.cern.ch", endpoint.RecordTypeA, "10.0.0.1"),
+	}
+
+	changes := Changes(current, desired)
+	if got := recordNames(changes.Create); !slices.Equal(got, []string{"created.cern.ch"}) {
+		t.Errorf("Create = %v, want created.cern.ch", got)
+	}
+	if got := recordNames(changes.UpdateNew); !slices.Equal(got, []string{"moved.cern.ch"}) {
+		t.Errorf("UpdateNew = %v, want moved.cern.ch", got)
+	}
+	if got := recordNames(changes.Delete); !slices.Equal(got, []string{"deleted.cern.ch"}) {
+		t.Errorf("Delete = %v, want deleted.cern.ch", got)
+	}
+}
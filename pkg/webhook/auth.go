@@ -0,0 +1,56 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/log"
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/oidc"
+)
+
+// tokenVerifier verifies the bearer tokens of the requests to the webhook API, see oidc.Verifier.
+type tokenVerifier interface {
+	Verify(ctx context.Context, token string) (*oidc.Claims, error)
+}
+
+// authenticated wraps a handler of the webhook API, requiring the requests to carry a bearer token
+// accepted by the verifier of the server. The handler is returned as is when no OIDC issuer is
+// configured.
+//
+// Rejected tokens are answered with a 401 Unauthorized. When the signing keys of the issuer cannot
+// be fetched, the request is answered with a 503 Service Unavailable, so ExternalDNS retries it.
+func (s *Server) authenticated(handler http.HandlerFunc) http.HandlerFunc {
+	if s.verifier == nil {
+		return handler
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := log.FromContext(r.Context())
+
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok {
+			logger.Warn("Unauthenticated request from %s", r.RemoteAddr)
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		claims, err := s.verifier.Verify(r.Context(), token)
+		switch {
+		case errors.Is(err, oidc.ErrInvalidToken):
+			logger.Warn("Rejected the token of a request from %s: %v", r.RemoteAddr, err)
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		case err != nil:
+			logger.Error("Failed to verify the token of a request from %s: %v", r.RemoteAddr, err)
+			http.Error(w, "failed to verify the token", http.StatusServiceUnavailable)
+			return
+		}
+
+		logger.Trace("Authenticated request from %s as %s", r.RemoteAddr, claims.Subject)
+		handler(w, r)
+	}
+}
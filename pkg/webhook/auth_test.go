@@ -0,0 +1,100 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/log"
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/oidc"
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/pkg/config"
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/provider"
+)
+
+// stubVerifier accepts the token "valid", rejects the others, and fails with err when set.
+type stubVerifier struct {
+	err error
+}
+
+func (v stubVerifier) Verify(_ context.Context, token string) (*oidc.Claims, error) {
+	switch {
+	case v.err != nil:
+		return nil, v.err
+	case token != "valid":
+		return nil, fmt.Errorf("%w: bad signature", oidc.ErrInvalidToken)
+	}
+	return &oidc.Claims{Subject: "system:serviceaccount:external-dns:external-dns"}, nil
+}
+
+func TestAuthenticated(t *testing.T) {
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) }
+
+	tests := []struct {
+		name          string
+		verifier      tokenVerifier
+		authorization string
+		status        int
+	}{
+		{name: "No verifier", status: http.StatusNoContent},
+		{name: "Valid token", verifier: stubVerifier{}, authorization: "Bearer valid", status: http.StatusNoContent},
+		{name: "Missing token", verifier: stubVerifier{}, status: http.StatusUnauthorized},
+		{name: "Not a bearer token", verifier: stubVerifier{}, authorization: "Basic dXNlcjpwYXNz", status: http.StatusUnauthorized},
+		{name: "Rejected token", verifier: stubVerifier{}, authorization: "Bearer forged", status: http.StatusUnauthorized},
+		{name: "Issuer unavailable", verifier: stubVerifier{err: errors.New("connection refused")}, authorization: "Bearer valid", status: http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Server{logger: log.NewNopLogger(), verifier: tt.verifier}
+			req := httptest.NewRequest(http.MethodGet, "/records", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			w := httptest.NewRecorder()
+			withRequestLogger(s.logger, 1, s.authenticated(ok)).ServeHTTP(w, req)
+
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d", w.Code, tt.status)
+			}
+			if tt.status == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") == "" {
+				t.Errorf("401 response has no WWW-Authenticate header")
+			}
+		})
+	}
+}
+
+func TestDebugEndpointsAuthenticated(t *testing.T) {
+	tests := []struct {
+		name          string
+		api           bool
+		authorization string
+		status        int
+	}{
+		// No plan has been computed yet, so the requests reaching the handler are answered with a 404.
+		{name: "Shared with the API", api: true, status: http.StatusUnauthorized},
+		{name: "Shared with the API, valid token", api: true, authorization: "Bearer valid", status: http.StatusNotFound},
+		{name: "Separate health listener", status: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Server{provider: &provider.Provider{}, config: &config.Config{}, logger: log.NewNopLogger(), verifier: stubVerifier{}}
+			mux := http.NewServeMux()
+			s.handleHealth(mux, tt.api)
+
+			req := httptest.NewRequest(http.MethodGet, "/debug/plan", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			w := httptest.NewRecorder()
+			withRequestLogger(s.logger, 1, mux).ServeHTTP(w, req)
+
+			if w.Code != tt.status {
+				t.Errorf("GET /debug/plan status = %d, want %d", w.Code, tt.status)
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package webhook
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/log"
+)
+
+// maxLogLevelBody bounds the size of a PUT /debug/loglevel request body.
+const maxLogLevelBody = 64
+
+// logLevelHandler implements the /debug/loglevel endpoint, protected by a bearer token.
+//
+// GET returns the current log level. PUT changes it to the level name sent as the request body,
+// e.g. `curl -X PUT -H "Authorization: Bearer $TOKEN" -d debug`, without restarting, so operators
+// can temporarily turn on debug logs while investigating a stuck sync. The change applies to the
+// given logger and every logger derived from it, and is lost on restart.
+func logLevelHandler(root log.Logger, token string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := log.FromContext(r.Context())
+
+		if !authorized(r, token) {
+			logger.Warn("Unauthorized request for the log level from %s", r.RemoteAddr)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPut:
+			body, err := io.ReadAll(io.LimitReader(r.Body, maxLogLevelBody))
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			level, ok := log.LevelFromString(strings.TrimSpace(string(body)))
+			if !ok {
+				http.Error(w, fmt.Sprintf("invalid log level %q", strings.TrimSpace(string(body))), http.StatusBadRequest)
+				return
+			}
+			previous := root.GetLevel()
+			root.SetLevel(level)
+			logger.Warn("Log level changed from %s to %s by %s", log.LevelNames[previous], log.LevelNames[level], r.RemoteAddr)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/plain")
+		fmt.Fprintln(w, log.LevelNames[root.GetLevel()])
+	}
+}
+
+// authorized reports whether a request carries the bearer token.
+func authorized(r *http.Request, token string) bool {
+	given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(given), []byte(token)) == 1
+}
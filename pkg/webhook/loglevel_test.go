@@ -0,0 +1,55 @@
+package webhook
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/log"
+)
+
+func TestLogLevelHandler(t *testing.T) {
+	root := log.NewLoggerWithOptions(log.Options{Level: log.LevelInfo, Output: io.Discard})
+	child := root.With(log.RequestIDField, "abc")
+	handler := withRequestLogger(root, 1, logLevelHandler(root, "secret"))
+
+	tests := []struct {
+		name     string
+		method   string
+		token    string
+		body     string
+		status   int
+		expected log.Level
+	}{
+		{name: "Missing token", method: http.MethodPut, body: "debug", status: http.StatusUnauthorized, expected: log.LevelInfo},
+		{name: "Wrong token", method: http.MethodPut, token: "wrong", body: "debug", status: http.StatusUnauthorized, expected: log.LevelInfo},
+		{name: "Invalid level", method: http.MethodPut, token: "secret", body: "verbose", status: http.StatusBadRequest, expected: log.LevelInfo},
+		{name: "Get", method: http.MethodGet, token: "secret", status: http.StatusOK, expected: log.LevelInfo},
+		{name: "Put", method: http.MethodPut, token: "secret", body: "debug\n", status: http.StatusOK, expected: log.LevelDebug},
+		{name: "Delete", method: http.MethodDelete, token: "secret", status: http.StatusMethodNotAllowed, expected: log.LevelDebug},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "/debug/loglevel", strings.NewReader(tt.body))
+			if tt.token != "" {
+				r.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d", w.Code, tt.status)
+			}
+			if got := root.GetLevel(); got != tt.expected {
+				t.Errorf("level = %v, want %v", got, tt.expected)
+			}
+			// The loggers derived from the root logger follow the change.
+			if got := child.GetLevel(); got != tt.expected {
+				t.Errorf("child level = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
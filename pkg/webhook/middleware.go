@@ -0,0 +1,52 @@
+package webhook
+
+import (
+	"net/http"
+
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/log"
+)
+
+// RequestIDHeader is the HTTP header carrying the ID of a request. An ID sent by the client is
+// kept, otherwise one is generated. It is echoed in the response.
+const RequestIDHeader = "X-Request-ID"
+
+// sampledEndpoints are the high-frequency endpoints, called on every ExternalDNS interval or probe,
+// whose logs are sampled.
+var sampledEndpoints = []string{
+	"GET /records",
+	"POST /adjustendpoints",
+	"GET /healthz",
+	"GET /readyz",
+	"GET /metrics",
+}
+
+// withRequestLogger stores the logger, and the request ID and endpoint as request-scoped log fields,
+// in the context of every request, so that every line logged while serving it, e.g. a whole
+// ApplyChanges, can be grepped together.
+//
+// With a sampling above 1, only 1 in sampling requests to each of the sampledEndpoints is logged
+// below the warning level. The warnings and errors are always logged.
+func withRequestLogger(logger log.Logger, sampling int, next http.Handler) http.Handler {
+	samplers := make(map[string]*log.Sampler, len(sampledEndpoints))
+	for _, endpoint := range sampledEndpoints {
+		samplers[endpoint] = log.NewSampler(sampling)
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if id == "" {
+			id = log.NewRequestID()
+		}
+		w.Header().Set(RequestIDHeader, id)
+
+		endpoint := r.Method + " " + r.URL.Path
+		requestLogger := logger
+		if sampler, ok := samplers[endpoint]; ok && !sampler.Sample() {
+			requestLogger = log.WithMinLevel(logger, log.LevelWarn)
+		}
+
+		ctx := log.WithField(log.NewContext(r.Context(), requestLogger), log.RequestIDField, id)
+		ctx = log.WithField(ctx, log.EndpointField, endpoint)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
@@ -0,0 +1,50 @@
+package webhook
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/log"
+)
+
+func TestWithRequestLoggerSampling(t *testing.T) {
+	var buf bytes.Buffer
+	logger := log.NewLoggerWithOptions(log.Options{Level: log.LevelInfo, Format: log.FormatJSON, Output: &buf})
+	handler := withRequestLogger(logger, 3, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		log.FromContext(r.Context()).Info("received request")
+		log.FromContext(r.Context()).Error("failed")
+	}))
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		logged int
+	}{
+		{name: "Sampled endpoint", method: http.MethodGet, path: "/records", logged: 2},
+		{name: "Other endpoint", method: http.MethodPost, path: "/records", logged: 6},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf.Reset()
+			for range 6 {
+				w := httptest.NewRecorder()
+				handler.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, nil))
+				if w.Header().Get(RequestIDHeader) == "" {
+					t.Errorf("response has no %s header", RequestIDHeader)
+				}
+			}
+
+			if got := strings.Count(buf.String(), "received request"); got != tt.logged {
+				t.Errorf("info messages = %d, want %d", got, tt.logged)
+			}
+			if got := strings.Count(buf.String(), "failed"); got != 6 {
+				t.Errorf("error messages = %d, want 6", got)
+			}
+		})
+	}
+}
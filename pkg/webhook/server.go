@@ -13,6 +13,10 @@ import (
 	"os"
 
 	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/log"
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/metrics"
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/oidc"
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/tlsconfig"
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/tracing"
 	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/pkg/config"
 	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/provider"
 )
@@ -27,15 +31,26 @@ import (
 type Server struct {
 	provider *provider.Provider
 	config   *config.Config
+	// logger is carried by the context of every request.
+	logger log.Logger
+	// verifier verifies the tokens of the requests to the webhook API, nil when they are not
+	// authenticated.
+	verifier tokenVerifier
 }
 
 // NewServer creates a new instance of the webhook server.
 //
-// It takes a provider and a configuration object as input and returns a new Server.
+// It takes a provider, a configuration object and a logger as input and returns a new Server.
 // This is the preferred way to create a new server, as it ensures that the server
 // is properly initialized with all its dependencies.
-func NewServer(p *provider.Provider, cfg *config.Config) *Server {
-	return &Server{provider: p, config: cfg}
+func NewServer(p *provider.Provider, cfg *config.Config, logger log.Logger) *Server {
+	s := &Server{provider: p, config: cfg, logger: logger}
+	if cfg.OIDCIssuerURL != "" {
+		// The TLS configuration is validated with the rest of the configuration.
+		tlsConfig, _ := tlsconfig.New(cfg)
+		s.verifier = oidc.NewVerifier(cfg.OIDCIssuerURL, cfg.OIDCAudience, cfg.OIDCSubjects, cfg.OIDCCAFile, tlsConfig)
+	}
+	return s
 }
 
 // Run starts the webhook server and begins listening for incoming requests.
@@ -45,6 +60,35 @@ func NewServer(p *provider.Provider, cfg *config.Config) *Server {
 // The routing is designed to match the ExternalDNS webhook provider specification,
 // ensuring compatibility with ExternalDNS.
 func (s *Server) Run() {
+	api := http.NewServeMux()
+	s.handleAPI(api)
+
+	// The health, metrics and debug endpoints are served on the main listener, or on a separate
+	// one when a health port is configured, e.g. to expose them to the kubelet and Prometheus while
+	// the webhook API only listens on localhost.
+	health := api
+	if s.config.HealthListenPort != 0 {
+		health = http.NewServeMux()
+	}
+	s.handleHealth(health, health == api)
+
+	if s.config.HealthListenPort != 0 {
+		go s.listen(s.config.HealthListenPort, health)
+	}
+	s.listen(s.config.ListenPort, api)
+}
+
+// Handler returns the handler of the webhook API, the health, metrics and debug endpoints
+// included, with the middlewares of the listeners, e.g. to serve it with httptest in tests.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	s.handleAPI(mux)
+	s.handleHealth(mux, true)
+	return s.middlewares(mux)
+}
+
+// handleAPI registers the handlers of the webhook API on the mux.
+func (s *Server) handleAPI(mux *http.ServeMux) {
 	// The /records endpoint is special as it handles both GET and POST requests.
 	// A dedicated handler is used to switch on the request method and delegate to the
 	// appropriate provider method. This is a clean way to handle multiple methods
@@ -64,26 +108,65 @@ func (s *Server) Run() {
 	// Register the HTTP handlers for the various endpoints.
 	// Each handler is a method on the provider, which keeps the business logic
 	// separate from the server logic.
-	http.HandleFunc("/", s.provider.Negotiate)
-	http.HandleFunc("/records", recordsHandler)
-	http.HandleFunc("/adjustendpoints", s.provider.AdjustEndpoints)
-	http.HandleFunc("/healthz", s.provider.Healthz)
+	// They require a token of the OIDC issuer when one is configured.
+	handle(mux, "/", s.authenticated(s.provider.Negotiate))
+	handle(mux, "/records", s.authenticated(recordsHandler))
+	handle(mux, "/adjustendpoints", s.authenticated(s.provider.AdjustEndpoints))
+}
+
+// handleHealth registers the handlers of the health, metrics and debug endpoints on the mux, which
+// is shared with the webhook API when api is true.
+//
+// The plan and state debug endpoints expose the desired endpoints, so on the listener of the webhook
+// API they require a token of the OIDC issuer too, when one is configured. The probes, metrics and
+// version stay open to the kubelet and Prometheus.
+func (s *Server) handleHealth(health *http.ServeMux, api bool) {
+	debug := func(handler http.HandlerFunc) http.HandlerFunc { return handler }
+	if api {
+		debug = s.authenticated
+	}
+
+	handle(health, "/healthz", s.provider.Healthz)
+	handle(health, "/readyz", s.provider.Readyz)
+	handle(health, "/debug/plan", debug(s.provider.DebugPlan))
+	handle(health, "/debug/state", debug(s.provider.DebugState))
+	handle(health, "/metrics", metrics.Handler().ServeHTTP)
+	handle(health, "/version", versionHandler)
+	if s.config.DebugToken != "" {
+		handle(health, "/debug/loglevel", logLevelHandler(s.logger, s.config.DebugToken))
+	}
+}
+
+// middlewares wraps the handler of a listener with the tracing of the requests and their logger.
+func (s *Server) middlewares(handler http.Handler) http.Handler {
+	return tracing.Handler(withRequestLogger(s.logger, s.config.LogSampling, handler))
+}
+
+// handle registers the handler of a path on the mux, counting its requests and observing their
+// duration by path and status code.
+func handle(mux *http.ServeMux, path string, handler http.HandlerFunc) {
+	mux.Handle(path, metrics.InstrumentHandler(path, handler))
+}
 
+// listen serves the handler on the given port of the configured listen address.
+// It is a blocking call, and the application exits if the server fails.
+func (s *Server) listen(port int, handler http.Handler) {
 	// Create the server address from the configured listen address and port.
-	addr := fmt.Sprintf("%s:%d", s.config.ListenAddress, s.config.ListenPort)
+	addr := fmt.Sprintf("%s:%d", s.config.ListenAddress, port)
 
 	// Create a new http.Server instance.
 	// This allows for more control over the server's configuration in the future,
 	// such as setting timeouts or enabling TLS.
 	server := &http.Server{
-		Addr: addr,
+		Addr:    addr,
+		Handler: s.middlewares(handler),
 	}
 
 	// Start the HTTP server and log a message to indicate that it is running.
-	log.GlobalLogger.Info("Listening on %s", addr)
+	s.logger.Info("Listening on %s", addr)
 	if err := server.ListenAndServe(); err != nil {
 		// If the server fails to start, log the error and exit the application.
-		log.GlobalLogger.Error("failed to start server: %v", err)
+		s.logger.Error("failed to start server: %v", err)
 		os.Exit(1)
 	}
 }
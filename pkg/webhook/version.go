@@ -0,0 +1,20 @@
+package webhook
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/version"
+)
+
+// versionHandler serves the build metadata of the webhook as JSON, so operators can tell which
+// image is running.
+func versionHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	// The status is already sent, an encoding error can only be dropped.
+	_ = json.NewEncoder(w).Encode(version.Get())
+}
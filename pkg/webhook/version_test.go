@@ -0,0 +1,42 @@
+package webhook
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/version"
+)
+
+func TestVersionHandler(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		status int
+	}{
+		{name: "Get", method: http.MethodGet, status: http.StatusOK},
+		{name: "Post", method: http.MethodPost, status: http.StatusMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			versionHandler(w, httptest.NewRequest(tt.method, "/version", nil))
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d", w.Code, tt.status)
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+
+			var info version.Info
+			if err := json.Unmarshal(w.Body.Bytes(), &info); err != nil {
+				t.Fatalf("body %q is not JSON: %v", w.Body.String(), err)
+			}
+			if info != version.Get() {
+				t.Errorf("body = %+v, want %+v", info, version.Get())
+			}
+		})
+	}
+}
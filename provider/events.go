@@ -0,0 +1,36 @@
+package provider
+
+import (
+	"fmt"
+	"strings"
+
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+// eventNamesLimit is the number of DNS names listed per change type in an Event message, which
+// Kubernetes truncates to 1 KiB.
+const eventNamesLimit = 5
+
+// summarizeChanges describes the records created, updated and deleted by a set of changes, e.g.
+// `records: created 1 (foo.cern.ch), updated 0, deleted 0`.
+func summarizeChanges(changes *plan.Changes) string {
+	return fmt.Sprintf("records: created %s, updated %s, deleted %s",
+		summarizeEndpoints(changes.Create), summarizeEndpoints(changes.UpdateNew), summarizeEndpoints(changes.Delete))
+}
+
+// summarizeEndpoints returns the number of endpoints followed by their first DNS names.
+func summarizeEndpoints(endpoints []*endpoint.Endpoint) string {
+	if len(endpoints) == 0 {
+		return "0"
+	}
+
+	names := make([]string, 0, eventNamesLimit)
+	for _, ep := range endpoints[:min(len(endpoints), eventNamesLimit)] {
+		names = append(names, ep.DNSName)
+	}
+	if len(endpoints) > eventNamesLimit {
+		names = append(names, fmt.Sprintf("and %d more", len(endpoints)-eventNamesLimit))
+	}
+	return fmt.Sprintf("%d (%s)", len(endpoints), strings.Join(names, ", "))
+}
@@ -0,0 +1,50 @@
+package provider
+
+import (
+	"context"
+	"time"
+
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/cern"
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/k8s"
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/pkg/config"
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+// Export is the alias state dumped by the export command and applied by the import command, to back
+// up and restore the aliases of a cluster or migrate them to another one.
+type Export struct {
+	// Time is when the state was exported.
+	Time time.Time `json:"time"`
+	// Owner is the owner ID of the webhook instance the state was exported from.
+	Owner string `json:"owner"`
+	// Records are the managed endpoints found in the metadata of the ingress nodes, with the nodes
+	// carrying them.
+	Records []cern.ManagedRecord `json:"records"`
+	// Desired are the desired endpoints of the persisted state, with their provider-specific
+	// properties, when a state ConfigMap is configured and holds the state of the same owner.
+	Desired []*endpoint.Endpoint `json:"desired,omitempty"`
+}
+
+// NewExport exports the aliases of the nodes, along with the desired endpoints of the persisted
+// state, if any.
+func NewExport(ctx context.Context, cfg *config.Config, k8sClient *k8s.Client, nodes []cern.IngressNode) (*Export, error) {
+	desired, err := StateDesired(ctx, cfg, k8sClient)
+	if err != nil {
+		return nil, err
+	}
+	return &Export{Time: time.Now().UTC(), Owner: cfg.OwnerID, Records: cern.ManagedRecords(nodes, cfg.OwnerID), Desired: desired}, nil
+}
+
+// DesiredEndpoints returns the endpoints an import brings the ingress nodes to: the desired
+// endpoints of the persisted state when exported, as they keep the provider-specific properties,
+// and the exported records otherwise.
+func (e *Export) DesiredEndpoints() []*endpoint.Endpoint {
+	if len(e.Desired) > 0 {
+		return e.Desired
+	}
+	desired := make([]*endpoint.Endpoint, 0, len(e.Records))
+	for _, record := range e.Records {
+		desired = append(desired, endpoint.NewEndpoint(record.Name, record.Type, record.Targets...))
+	}
+	return desired
+}
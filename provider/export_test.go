@@ -0,0 +1,84 @@
+package provider
+
+import (
+	"context"
+	"testing"
+
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/cern"
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/log"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/yaml"
+)
+
+func TestExportImportRoundTrip(t *testing.T) {
+	cfg := testConfig()
+	cfg.StateConfigMap = "dns/webhook-state"
+	p := newTestProvider(t, cfg)
+	ctx := log.NewContext(context.Background(), log.NewNopLogger())
+
+	// app.cern.ch is synced to ingress-node-1 only, as its node selector asks, and persisted.
+	desired := []*endpoint.Endpoint{
+		endpoint.NewEndpoint("app.cern.ch", endpoint.RecordTypeA).
+			WithProviderSpecific(cern.NodeSelectorProperty, "topology.kubernetes.io/zone=cern-geneva-a"),
+	}
+	nodes, err := p.ingressNodes(ctx)
+	if err != nil {
+		t.Fatalf("ingressNodes() error = %v", err)
+	}
+	if err := SyncDesired(ctx, cfg, p.manager, p.k8sClient, nodes, desired); err != nil {
+		t.Fatalf("SyncDesired() error = %v", err)
+	}
+	if err := SaveDesired(ctx, cfg, p.k8sClient, desired); err != nil {
+		t.Fatalf("SaveDesired() error = %v", err)
+	}
+	if nodes, err = p.ingressNodes(ctx); err != nil {
+		t.Fatalf("ingressNodes() error = %v", err)
+	}
+
+	exported, err := NewExport(ctx, cfg, p.k8sClient, nodes)
+	if err != nil {
+		t.Fatalf("NewExport() error = %v", err)
+	}
+	data, err := yaml.Marshal(exported)
+	if err != nil {
+		t.Fatalf("yaml.Marshal() error = %v", err)
+	}
+	var imported Export
+	if err := yaml.UnmarshalStrict(data, &imported); err != nil {
+		t.Fatalf("yaml.UnmarshalStrict() error = %v", err)
+	}
+
+	plans, err := PlanDesired(ctx, cfg, p.manager, p.k8sClient, nodes, imported.DesiredEndpoints())
+	if err != nil {
+		t.Fatalf("PlanDesired() error = %v", err)
+	}
+	if len(plans) != 0 {
+		t.Errorf("importing the export planned %v, want no changes", plans)
+	}
+
+	// Without the desired endpoints, the records alone spread the alias over every node.
+	imported.Desired = nil
+	plans, err = PlanDesired(ctx, cfg, p.manager, p.k8sClient, nodes, imported.DesiredEndpoints())
+	if err != nil {
+		t.Fatalf("PlanDesired() error = %v", err)
+	}
+	if len(plans) != 1 || plans[0].Server != "ingress-node-2" {
+		t.Errorf("importing the records planned %v, want app.cern.ch added to ingress-node-2", plans)
+	}
+}
+
+func TestExportDesiredEndpoints(t *testing.T) {
+	records := []cern.ManagedRecord{{Name: "app.cern.ch", Type: endpoint.RecordTypeA, Targets: []string{"10.0.0.1"}, Nodes: []string{"ingress-node-1"}}}
+	selected := endpoint.NewEndpoint("app.cern.ch", endpoint.RecordTypeA).WithProviderSpecific(cern.NodeCountProperty, "1")
+
+	export := &Export{Records: records, Desired: []*endpoint.Endpoint{selected}}
+	if got := export.DesiredEndpoints(); len(got) != 1 || got[0] != selected {
+		t.Errorf("DesiredEndpoints() = %v, want the desired endpoints of the state", got)
+	}
+
+	export.Desired = nil
+	got := export.DesiredEndpoints()
+	if len(got) != 1 || got[0].DNSName != "app.cern.ch" || len(got[0].ProviderSpecific) != 0 || !got[0].Targets.Same(endpoint.Targets{"10.0.0.1"}) {
+		t.Errorf("DesiredEndpoints() = %v, want the exported records", got)
+	}
+}
@@ -0,0 +1,46 @@
+package provider
+
+import (
+	"context"
+
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/cern"
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/health"
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/k8s"
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/pkg/config"
+)
+
+// Components reported by /healthz.
+const (
+	// HealthOpenStackAuth reports the last periodic check of the OpenStack credentials.
+	HealthOpenStackAuth = "openstack-auth"
+	// HealthComputeAPI reports whether the compute API answered the last OpenStack call.
+	HealthComputeAPI = "compute-api"
+	// HealthKubernetesAPI reports whether the Kubernetes API answers, and the nodes may be listed.
+	HealthKubernetesAPI = "kubernetes-api"
+	// HealthCache reports whether the OpenStack servers were listed recently.
+	HealthCache = "cache"
+)
+
+// HealthComponents lists the components reported by /healthz.
+var HealthComponents = []string{HealthOpenStackAuth, HealthComputeAPI, HealthKubernetesAPI, HealthCache}
+
+// DefaultHealthCritical lists the components whose failure fails /healthz by default.
+var DefaultHealthCritical = []string{HealthOpenStackAuth, HealthKubernetesAPI}
+
+// newHealthRegistry registers the checks of the components in use. The OpenStack components are
+// only registered with the nova backend, and the credentials only when they are checked
+// periodically.
+func newHealthRegistry(cfg *config.Config, k8sClient *k8s.Client, manager *cern.Manager, authChecker *cern.AuthChecker) *health.Registry {
+	registry := health.NewRegistry(cfg.HealthCritical)
+	if authChecker != nil {
+		registry.Register(HealthOpenStackAuth, func(context.Context) error { return authChecker.Err() })
+	}
+	if manager != nil {
+		registry.Register(HealthComputeAPI, manager.ComputeHealth)
+	}
+	registry.Register(HealthKubernetesAPI, k8sClient.Reachable)
+	if manager != nil && cfg.HealthMaxCacheAge > 0 {
+		registry.Register(HealthCache, manager.CacheHealth)
+	}
+	return registry
+}
@@ -0,0 +1,76 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/cern"
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/k8s"
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/pkg/config"
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+// withCernAliases applies the settings of the CernAlias resources to the desired endpoints, when
+// the CernAlias CRD is enabled.
+func withCernAliases(ctx context.Context, cfg *config.Config, k8sClient *k8s.Client, current, desired []*endpoint.Endpoint) ([]*endpoint.Endpoint, error) {
+	if !cfg.CernAliasCRD {
+		return desired, nil
+	}
+	aliases, err := k8sClient.CernAliases(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return cern.ApplyCernAliases(ctx, current, desired, aliases), nil
+}
+
+// completeDesired completes the desired endpoints of the nodes through the same steps as
+// ApplyChanges: the protected aliases missing from them are kept, and the settings of the
+// CernAlias resources are applied.
+func completeDesired(ctx context.Context, cfg *config.Config, k8sClient *k8s.Client, nodes []cern.IngressNode, desired []*endpoint.Endpoint) ([]*endpoint.Endpoint, error) {
+	protected, err := cern.NewProtectedAliases(cfg.ProtectedAliases)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse protected aliases: %w", err)
+	}
+
+	current := cern.ParseEndpointsFromMetadata(nodes, cfg.OwnerID)
+	desired = protected.RetainProtected(ctx, current, desired)
+	return withCernAliases(ctx, cfg, k8sClient, current, desired)
+}
+
+// PlanDesired computes the per-node changes bringing the nodes to the desired endpoints, without
+// applying them, as ApplyChanges would.
+//
+// It lets one-off commands review a change before ExternalDNS, or an operator, applies it.
+func PlanDesired(ctx context.Context, cfg *config.Config, backend cern.Backend, k8sClient *k8s.Client, nodes []cern.IngressNode, desired []*endpoint.Endpoint) ([]cern.NodePlan, error) {
+	desired, err := completeDesired(ctx, cfg, k8sClient, nodes, desired)
+	if err != nil {
+		return nil, err
+	}
+	return backend.Plan(nodes, desired), nil
+}
+
+// SyncDesired brings the nodes to the desired endpoints, as ApplyChanges would, for one-off
+// commands.
+func SyncDesired(ctx context.Context, cfg *config.Config, backend cern.Backend, k8sClient *k8s.Client, nodes []cern.IngressNode, desired []*endpoint.Endpoint) error {
+	desired, err := completeDesired(ctx, cfg, k8sClient, nodes, desired)
+	if err != nil {
+		return err
+	}
+	return backend.SyncState(ctx, nodes, desired)
+}
+
+// CleanupDesired splits the current endpoints of the nodes into the ones matching the configured
+// domain filter, all of them without a domain filter, which a cleanup removes, and the others, which
+// it keeps as the desired endpoints.
+func CleanupDesired(cfg *config.Config, nodes []cern.IngressNode) (desired, removed []*endpoint.Endpoint) {
+	domainFilter := endpoint.NewDomainFilterWithExclusions(cfg.DomainFilter, cfg.ExcludeDomains)
+	desired = []*endpoint.Endpoint{}
+	for _, ep := range cern.ParseEndpointsFromMetadata(nodes, cfg.OwnerID) {
+		if domainFilter.Match(ep.DNSName) {
+			removed = append(removed, ep)
+		} else {
+			desired = append(desired, ep)
+		}
+	}
+	return desired, removed
+}
@@ -10,13 +10,23 @@
 package provider
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"os"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/cern"
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/health"
 	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/k8s"
 	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/log"
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/metrics"
 	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/pkg/config"
 	"sigs.k8s.io/external-dns/endpoint"
 	"sigs.k8s.io/external-dns/plan"
@@ -24,142 +34,643 @@ import (
 
 // Provider is the main struct for the webhook provider.
 type Provider struct {
-	config  *config.Config
-	manager *cern.Manager
+	config *config.Config
+	// logger logs the messages not tied to a request, and is carried by the contexts of the
+	// background work. The requests log to the logger of their context.
+	logger    log.Logger
+	manager   cern.Backend
+	protected *cern.ProtectedAliases
+	// verifier checks DNS propagation after a sync, nil when disabled.
+	verifier *cern.PropagationVerifier
+	// state persists the last applied state, nil when disabled.
+	state *k8s.ConfigMapStore
+	// events emits the Kubernetes Events summarizing the syncs, nil when disabled.
+	events *k8s.EventRecorder
+	// k8sClient is checked for reachability by the readiness probe.
+	k8sClient *k8s.Client
+	// authChecker periodically checks the OpenStack credentials, nil when disabled.
+	authChecker *cern.AuthChecker
+	// health aggregates the health of the components, served on /healthz.
+	health *health.Registry
+	// snapshot shares the ingress nodes read by Records with the following ApplyChanges.
+	snapshot *nodeSnapshot
+	// warm reports whether the caches were warmed up at startup, or the warm-up is disabled. The
+	// readiness probe fails until then.
+	warm atomic.Bool
+
+	// leading reports whether this replica holds the leader lease, and may write to OpenStack.
+	// It is always true without leader election. It is only set once the state is reloaded, and
+	// checked again before every write.
+	leading atomic.Bool
+	// leaseMu guards leaseTerm, and orders the stores to leading.
+	leaseMu sync.Mutex
+	// leaseTerm counts the changes of leadership, so that acquiring a lease that was lost while the
+	// state was reloading does not set leading.
+	leaseTerm uint64
+
+	// syncMu serializes the syncs, and guards lastDesired.
+	syncMu sync.Mutex
+	// lastDesired holds the desired endpoints of the last applied sync, or planned in dry-run mode,
+	// with their provider-specific properties, which cannot be recovered from the node metadata.
+	lastDesired []*endpoint.Endpoint
+	// properties indexes the provider-specific properties of lastDesired, read by Records without
+	// waiting for the sync in progress.
+	properties atomic.Pointer[cern.EndpointProperties]
+
+	// planMu guards lastPlan.
+	planMu sync.Mutex
+	// lastPlan holds the per-node changes planned by the last ApplyChanges call.
+	lastPlan *Plan
 }
 
-// NewProvider creates a new instance of the Provider.
-func NewProvider(cfg *config.Config) *Provider {
-	client, err := cern.NewClient(cfg)
+// Plan is the set of per-node changes planned by an ApplyChanges call.
+type Plan struct {
+	// Time is when the plan was computed.
+	Time time.Time `json:"time"`
+	// DryRun reports whether the plan was only logged instead of applied.
+	DryRun bool `json:"dryRun"`
+	// Nodes holds the changes of every node that changes.
+	Nodes []cern.NodePlan `json:"nodes"`
+}
+
+// cernAliasSyncTimeout bounds the initial sync of the CernAlias cache.
+const cernAliasSyncTimeout = 30 * time.Second
+
+// NewProvider creates a new instance of the Provider, logging to the given logger, and exits when
+// it cannot be created. See New.
+func NewProvider(cfg *config.Config, logger log.Logger) *Provider {
+	p, err := New(cfg, logger)
 	if err != nil {
-		log.GlobalLogger.Error("Failed to create OpenStack client: %v", err)
+		logger.Error("%v", err)
 		os.Exit(1)
 	}
+	return p
+}
+
+// New creates a new instance of the Provider, logging to the given logger, and starts its background
+// work, e.g. the periodic credential checks, leader election and the watches of the configuration.
+//
+// The logger is passed down to the clients and to the background work through the contexts.
+func New(cfg *config.Config, logger log.Logger) (*Provider, error) {
+	ctx := log.NewContext(context.Background(), logger)
 
-	k8sClient, err := k8s.NewClient()
+	if cfg.ChaosNovaErrorRate > 0 || cfg.ChaosNovaLatency > 0 || cfg.ChaosK8sErrorRate > 0 || cfg.ChaosK8sLatency > 0 {
+		logger.Warn("Failure injection enabled: failing %.0f%% of the OpenStack requests (latency up to %s) and %.0f%% of the Kubernetes requests (latency up to %s)",
+			cfg.ChaosNovaErrorRate*100, cfg.ChaosNovaLatency, cfg.ChaosK8sErrorRate*100, cfg.ChaosK8sLatency)
+	}
+
+	k8sClient, err := k8s.NewClient(cfg)
 	if err != nil {
-		log.GlobalLogger.Error("Failed to create Kubernetes client: %v", err)
-		os.Exit(1)
+		return nil, fmt.Errorf("failed to create Kubernetes client: %w", err)
 	}
 
-	return &Provider{
-		config:  cfg,
-		manager: cern.NewManager(client, k8sClient),
+	backend, client, err := NewBackend(ctx, cfg, k8sClient, logger)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the backend: %w", err)
+	}
+	// The compute health and cache are only tracked by the nova backend.
+	manager, _ := backend.(*cern.Manager)
+	var authChecker *cern.AuthChecker
+	if client != nil && cfg.AuthCheckInterval > 0 {
+		authChecker = cern.NewAuthChecker(client, cfg)
+		go authChecker.Run(ctx)
+	}
+	if cfg.Backend == cern.BackendNova {
+		if err := cern.WatchCredentials(ctx, client, cfg); err != nil {
+			return nil, fmt.Errorf("failed to watch the credential files: %w", err)
+		}
+	}
+
+	protected, err := cern.NewProtectedAliases(cfg.ProtectedAliases)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse protected aliases: %w", err)
+	}
+
+	var verifier *cern.PropagationVerifier
+	if cfg.VerifyPropagation {
+		verifier = cern.NewPropagationVerifier(cfg)
+	}
+
+	var events *k8s.EventRecorder
+	if cfg.Events {
+		events, err = k8sClient.NewEventRecorder(ctx, cfg.EventObject)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create the Kubernetes event recorder: %w", err)
+		}
 	}
+
+	p := &Provider{
+		config:      cfg,
+		logger:      logger,
+		manager:     backend,
+		protected:   protected,
+		verifier:    verifier,
+		events:      events,
+		k8sClient:   k8sClient,
+		authChecker: authChecker,
+		health:      newHealthRegistry(cfg, k8sClient, manager, authChecker),
+		snapshot:    &nodeSnapshot{ttl: cfg.SnapshotTTL},
+	}
+
+	if cfg.CernAliasCRD {
+		// The CernAlias cache is synced at startup, failing fast when the CRD is not installed.
+		syncCtx, cancel := context.WithTimeout(ctx, cernAliasSyncTimeout)
+		_, err := k8sClient.CernAliases(syncCtx)
+		cancel()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the CernAlias resources (is the CRD installed?): %w", err)
+		}
+	}
+
+	if cfg.StateConfigMap != "" {
+		p.state = k8sClient.NewConfigMapStore(cfg.StateConfigMap)
+		if err := p.loadState(ctx); err != nil {
+			return nil, fmt.Errorf("failed to load the state: %w", err)
+		}
+	}
+
+	if cfg.LeaderElect {
+		identity, err := os.Hostname()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get the leader election identity: %w", err)
+		}
+		err = k8sClient.RunLeaderElection(ctx, cfg.LeaderElectNamespace, cfg.LeaderElectLeaseName, identity, func(leading bool) {
+			p.setLeading(ctx, leading)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to start leader election: %w", err)
+		}
+	} else {
+		p.leading.Store(true)
+	}
+
+	if cfg.Standalone {
+		if err := p.watchDNSEndpoints(ctx, k8sClient); err != nil {
+			return nil, fmt.Errorf("failed to watch DNSEndpoints: %w", err)
+		}
+	}
+
+	if cfg.NodeEventSync {
+		if err := p.watchNodes(ctx, k8sClient); err != nil {
+			return nil, fmt.Errorf("failed to watch ingress nodes: %w", err)
+		}
+	}
+
+	if cfg.WarmUp {
+		go p.warmUp(ctx)
+	} else {
+		p.warm.Store(true)
+	}
+
+	return p, nil
+}
+
+// NewBackend creates the backend storing the aliases selected by the configuration, logging to the
+// given logger, along with the OpenStack client it uses, nil with the landb backend.
+//
+// Unlike New, it starts no background work, so that one-off commands can read and write the
+// aliases of the ingress nodes.
+func NewBackend(ctx context.Context, cfg *config.Config, k8sClient *k8s.Client, logger log.Logger) (cern.Backend, *cern.Client, error) {
+	if cfg.Backend == cern.BackendLanDB {
+		client, err := cern.NewLanDBClient(ctx, cfg)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create LanDB client: %w", err)
+		}
+		return cern.NewLanDBBackend(client, k8sClient, cfg, logger), nil, nil
+	}
+
+	client, err := NewOpenStackClient(ctx, cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	manager := cern.NewManager(client, k8sClient, cfg, logger)
+	if cern.NeedsLanDB(cfg) {
+		landbClient, err := cern.NewLanDBClient(ctx, cfg)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create LanDB client: %w", err)
+		}
+		manager.SetLanDBBackend(cern.NewLanDBBackend(landbClient, k8sClient, cfg, logger))
+	}
+	return manager, client, nil
+}
+
+// NewOpenStackClient creates the OpenStack client of the nova backend, or the client of the in-memory
+// servers of the fake backend, seeded from the Nodes of the fixture.
+func NewOpenStackClient(ctx context.Context, cfg *config.Config) (*cern.Client, error) {
+	if cfg.Backend == cern.BackendFake {
+		nodes, err := k8s.FakeNodes(cfg.FakeFixture)
+		if err != nil {
+			return nil, err
+		}
+		client, err := cern.NewFakeClient(nodes, cfg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create fake OpenStack client: %w", err)
+		}
+		return client, nil
+	}
+
+	client, err := cern.NewClient(ctx, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OpenStack client: %w", err)
+	}
+	return client, nil
 }
 
 // Records implements the GET /records endpoint.
 func (p *Provider) Records(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
-	log.GlobalLogger.Info("received request for Records from %s", r.RemoteAddr)
+	log.FromContext(ctx).Info("received request for Records from %s", r.RemoteAddr)
 
-	nodes, err := p.manager.GetIngressNodes(ctx, p.config.IngressLabel)
+	nodes, err := p.snapshot.get(ctx, p.ingressNodes)
 	if err != nil {
-		log.GlobalLogger.Error("Failed to get ingress nodes: %v", err)
+		log.FromContext(ctx).Error("Failed to get ingress nodes: %v", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	endpoints := cern.ParseEndpointsFromMetadata(nodes)
-
 	w.Header().Set("Content-Type", "application/vnd.external-dns.error+json; version=1")
-	if err := json.NewEncoder(w).Encode(endpoints); err != nil {
-		log.GlobalLogger.Error("Failed to encode records: %v", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if err := writeEndpoints(w, nodes, p.config.OwnerID, p.endpointProperties()); err != nil {
+		// The status code has already been sent at this point, so the error can only be logged.
+		log.FromContext(ctx).Error("Failed to encode records: %v", err)
+		return
+	}
+	metrics.MarkSuccess(metrics.OperationRecords)
+}
+
+// ingressNodes reads the ingress nodes with their current aliases.
+func (p *Provider) ingressNodes(ctx context.Context) ([]cern.IngressNode, error) {
+	return p.manager.GetIngressNodes(ctx, p.config.IngressLabels)
+}
+
+// recordsFlushInterval is the number of endpoints written to a Records response between flushes.
+const recordsFlushInterval = 500
+
+// writeEndpoints streams the endpoints managed by the webhook instance with the given owner ID on the
+// given nodes as a JSON array, with their provider-specific properties restored from the given ones.
+//
+// Endpoints are encoded one by one and the response is flushed periodically, so neither the full
+// list of endpoints nor the full JSON document has to be held in memory for very large record sets.
+func writeEndpoints(w http.ResponseWriter, nodes []cern.IngressNode, ownerID string, properties cern.EndpointProperties) error {
+	flusher, _ := w.(http.Flusher)
+	encoder := json.NewEncoder(w)
+
+	if _, err := io.WriteString(w, "["); err != nil {
+		return err
+	}
+
+	count := 0
+	err := cern.EachEndpointFromMetadata(nodes, ownerID, func(ep *endpoint.Endpoint) error {
+		if count > 0 {
+			if _, err := io.WriteString(w, ","); err != nil {
+				return err
+			}
+		}
+		if err := encoder.Encode(properties.Restore(ep)); err != nil {
+			return err
+		}
+		count++
+		if flusher != nil && count%recordsFlushInterval == 0 {
+			flusher.Flush()
+		}
+		return nil
+	})
+	if err != nil {
+		return err
 	}
+
+	_, err = io.WriteString(w, "]\n")
+	return err
 }
 
 // AdjustEndpoints implements the POST /adjustendpoints endpoint.
 func (p *Provider) AdjustEndpoints(w http.ResponseWriter, r *http.Request) {
-	log.GlobalLogger.Info("received request for AdjustEndpoints from %s", r.RemoteAddr)
+	logger := log.FromContext(r.Context())
+	logger.Info("received request for AdjustEndpoints from %s", r.RemoteAddr)
 
 	var endpoints []*endpoint.Endpoint
 	if err := json.NewDecoder(r.Body).Decode(&endpoints); err != nil {
-		log.GlobalLogger.Error("Failed to decode endpoints: %v", err)
+		metrics.CountError(metrics.ErrorSourceDecode)
+		logger.Error("Failed to decode endpoints: %v", err)
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	logger.Trace("AdjustEndpoints payload: %s", log.JSON(endpoints))
+
+	// LanDB aliases have no TTL concept, so any TTL set through annotations is dropped.
+	// Reporting it here lets users understand why their TTL annotation has no effect.
+	if dropped := cern.StripTTL(endpoints); len(dropped) > 0 {
+		logger.Info("Dropped TTL from %d endpoints, LanDB aliases do not support TTLs", len(dropped))
+		logger.Debug("Endpoints with dropped TTL: %v", dropped)
+	}
+
+	// Endpoints that cannot be written as LanDB aliases are rejected here, so ExternalDNS never
+	// plans them instead of failing on every apply.
+	valid := endpoints[:0]
+	for _, ep := range endpoints {
+		if ep.RecordType == endpoint.RecordTypeA {
+			if err := cern.ValidateAlias(ep.DNSName); err != nil {
+				logger.Error("Rejecting endpoint %s: %v", ep.DNSName, err)
+				continue
+			}
+		}
+		valid = append(valid, ep)
+	}
 
-	// For now, we return the endpoints as is.
-	// In the future, we could implement logic to filter or modify them.
 	w.Header().Set("Content-Type", "application/vnd.external-dns.error+json; version=1")
-	if err := json.NewEncoder(w).Encode(endpoints); err != nil {
-		log.GlobalLogger.Error("Failed to encode adjusted endpoints: %v", err)
+	if err := json.NewEncoder(w).Encode(valid); err != nil {
+		logger.Error("Failed to encode adjusted endpoints: %v", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 	}
 }
 
 // ApplyChanges implements the POST /records endpoint.
+//
+// Its duration is recorded by outcome, the calls rejected before any sync is attempted excepted.
 func (p *Provider) ApplyChanges(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
-	log.GlobalLogger.Info("received request for ApplyChanges from %s", r.RemoteAddr)
+	log.FromContext(ctx).Info("received request for ApplyChanges from %s", r.RemoteAddr)
+	start := time.Now()
 
 	var changes plan.Changes
 	if err := json.NewDecoder(r.Body).Decode(&changes); err != nil {
-		log.GlobalLogger.Error("Failed to decode changes: %v", err)
+		metrics.CountError(metrics.ErrorSourceDecode)
+		log.FromContext(ctx).Error("Failed to decode changes: %v", err)
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	log.FromContext(ctx).Trace("ApplyChanges payload: %s", log.JSON(&changes))
 
-	// 1. Get current nodes
-	nodes, err := p.manager.GetIngressNodes(ctx, p.config.IngressLabel)
+	// In standalone mode the aliases follow the DNSEndpoint resources only.
+	if p.config.Standalone {
+		log.FromContext(ctx).Warn("Standalone mode, refusing to apply changes from %s", r.RemoteAddr)
+		http.Error(w, "standalone mode, changes are read from DNSEndpoint resources", http.StatusConflict)
+		return
+	}
+
+	// Only the leader writes to OpenStack. ExternalDNS retries the changes on its next loop.
+	if !p.leading.Load() {
+		log.FromContext(ctx).Info("Not the leader, refusing to apply changes")
+		http.Error(w, "not the leader", http.StatusServiceUnavailable)
+		return
+	}
+
+	// Syncs are serialized with the reconciliations triggered by node events.
+	p.syncMu.Lock()
+	defer p.syncMu.Unlock()
+
+	// 1. Get current nodes, usually from the snapshot taken by the preceding Records call
+	nodes, err := p.snapshot.get(ctx, p.ingressNodes)
 	if err != nil {
-		log.GlobalLogger.Error("Failed to get ingress nodes: %v", err)
+		log.FromContext(ctx).Error("Failed to get ingress nodes: %v", err)
+		metrics.ObserveDuration(metrics.ApplyChangesDuration, metrics.OutcomeError, start)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	// 2. Get current endpoints
-	currentEndpoints := cern.ParseEndpointsFromMetadata(nodes)
+	// 2. Get current endpoints, with the provider-specific properties of the last sync, so that the
+	// endpoints untouched by the changes keep them
+	currentEndpoints := p.currentEndpoints(nodes)
 
 	// 3. Calculate desired endpoints
-	// Helper map to deduplicate and manage state
-	desiredMap := make(map[string]*endpoint.Endpoint)
-	for _, ep := range currentEndpoints {
-		desiredMap[ep.DNSName] = ep
+	desiredEndpoints, changed := cern.DesiredEndpoints(currentEndpoints, &changes)
+	if !changed {
+		log.FromContext(ctx).Debug("Changes do not affect any managed endpoint, skipping sync")
+		metrics.ObserveDuration(metrics.ApplyChangesDuration, metrics.OutcomeNoop, start)
+		metrics.MarkSuccess(metrics.OperationApplyChanges)
+		w.WriteHeader(http.StatusNoContent)
+		return
 	}
+	desiredEndpoints = p.protected.RetainProtected(ctx, currentEndpoints, desiredEndpoints)
 
-	// Apply deletions
-	for _, ep := range changes.Delete {
-		delete(desiredMap, ep.DNSName)
+	// 4. Sync state
+	err = p.sync(ctx, nodes, currentEndpoints, desiredEndpoints)
+	metrics.ObserveDuration(metrics.ApplyChangesDuration, metrics.Outcome(err), start)
+	if errors.Is(err, errNotLeading) {
+		log.FromContext(ctx).Info("Lost the lease, refusing to apply changes")
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
 	}
+	if err != nil {
+		log.FromContext(ctx).Error("Failed to sync state: %v", err)
+		p.events.Warning(k8s.EventReasonSyncFailed, "Failed to sync %s: %v", summarizeChanges(&changes), err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if p.config.DryRun {
+		p.events.Normal(k8s.EventReasonSynced, "Dry run, would have synced %s", summarizeChanges(&changes))
+	} else {
+		p.events.Normal(k8s.EventReasonSynced, "Synced %s", summarizeChanges(&changes))
+	}
+
+	metrics.MarkSuccess(metrics.OperationApplyChanges)
+	w.WriteHeader(http.StatusNoContent)
+}
 
-	// Apply updates (remove old, add new)
-	for _, ep := range changes.UpdateOld {
-		delete(desiredMap, ep.DNSName)
+// sync records the plan bringing the nodes to the desired endpoints and applies it, or only logs it
+// in dry-run mode. The caller must hold syncMu.
+func (p *Provider) sync(ctx context.Context, nodes []cern.IngressNode, current, desired []*endpoint.Endpoint) error {
+	// The desired endpoints are remembered without the CernAlias settings, which are applied again
+	// on every sync so that changes of the CernAlias resources are picked up. They are only
+	// remembered once planned in dry-run mode, or applied, so a failed sync does not make the
+	// reconciliations and Records report endpoints that were never written.
+	requested := desired
+	desired, err := withCernAliases(ctx, p.config, p.k8sClient, current, desired)
+	if err != nil {
+		return err
 	}
-	for _, ep := range changes.UpdateNew {
-		desiredMap[ep.DNSName] = ep
+
+	nodePlans := p.manager.Plan(nodes, desired)
+	p.planMu.Lock()
+	p.lastPlan = &Plan{Time: time.Now(), DryRun: p.config.DryRun, Nodes: nodePlans}
+	p.planMu.Unlock()
+
+	if p.config.DryRun {
+		log.FromContext(ctx).Info("Dry run enabled, skipping actual update of %d nodes", len(nodePlans))
+		for _, nodePlan := range nodePlans {
+			log.FromContext(ctx).Info("Dry run: server %s (%s) would update %v and delete %v", nodePlan.Server, nodePlan.ID, nodePlan.Update, nodePlan.Delete)
+		}
+		p.setLastDesired(requested)
+		return nil
 	}
 
-	// Apply creations
-	for _, ep := range changes.Create {
-		desiredMap[ep.DNSName] = ep
+	// The lease may have been lost while the nodes were read, the new leader is then the only writer.
+	if !p.leading.Load() {
+		return errNotLeading
 	}
 
-	// Convert map back to slice
-	var desiredEndpoints []*endpoint.Endpoint
-	for _, ep := range desiredMap {
-		desiredEndpoints = append(desiredEndpoints, ep)
+	// Any write makes the snapshot stale, even if the sync fails halfway.
+	defer p.snapshot.invalidate()
+	if err := p.manager.SyncState(ctx, nodes, desired); err != nil {
+		return err
 	}
+	p.setLastDesired(requested)
+	p.saveState(ctx, requested)
+	p.verifyPropagation(current, desired)
+	return nil
+}
 
-	// 4. Sync state
-	if p.config.DryRun {
-		log.GlobalLogger.Info("Dry run enabled, skipping actual update")
-	} else {
-		if err := p.manager.SyncState(ctx, nodes, desiredEndpoints); err != nil {
-			log.GlobalLogger.Error("Failed to sync state: %v", err)
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+// errNotLeading is returned by the syncs of a replica that does not hold the leader lease.
+var errNotLeading = errors.New("not the leader")
+
+// setLeading records whether this replica holds the leader lease.
+//
+// The desired endpoints of the last sync of this replica are stale once another replica led, so
+// on acquiring the lease they are dropped, and the state saved by the previous leader is reloaded,
+// before this replica may write. Otherwise its first reconciliation would revert the syncs done by
+// the previous leader in the meantime. Failing to load the state, the aliases are only re-distributed
+// as found in the node metadata until the next ApplyChanges call. The lease may be lost while waiting
+// for the sync in progress or reloading the state, in which case leading is left false.
+func (p *Provider) setLeading(ctx context.Context, leading bool) {
+	p.leaseMu.Lock()
+	p.leaseTerm++
+	term := p.leaseTerm
+	if !leading {
+		p.leading.Store(false)
+	}
+	p.leaseMu.Unlock()
+	if !leading {
+		return
+	}
+
+	p.syncMu.Lock()
+	defer p.syncMu.Unlock()
+
+	p.setLastDesired(nil)
+	if p.state != nil {
+		if err := p.loadState(ctx); err != nil {
+			log.FromContext(ctx).Error("Failed to reload the state on acquiring the lease: %v", err)
+		}
+	}
+
+	p.leaseMu.Lock()
+	defer p.leaseMu.Unlock()
+	if p.leaseTerm != term {
+		log.FromContext(ctx).Warn("Lost the lease while reloading the state")
+		return
+	}
+	p.leading.Store(true)
+}
+
+// setLastDesired remembers the desired endpoints of a sync, and indexes their provider-specific
+// properties for Records. The caller must hold syncMu.
+func (p *Provider) setLastDesired(desired []*endpoint.Endpoint) {
+	p.lastDesired = desired
+	properties := cern.NewEndpointProperties(desired)
+	p.properties.Store(&properties)
+}
+
+// endpointProperties returns the provider-specific properties of the desired endpoints of the last
+// sync, nil when no sync happened yet.
+func (p *Provider) endpointProperties() cern.EndpointProperties {
+	if properties := p.properties.Load(); properties != nil {
+		return *properties
+	}
+	return nil
+}
+
+// currentEndpoints reconstructs the endpoints from the metadata of the nodes, with the
+// provider-specific properties of the desired endpoints of the last sync.
+func (p *Provider) currentEndpoints(nodes []cern.IngressNode) []*endpoint.Endpoint {
+	properties := p.endpointProperties()
+	current := cern.ParseEndpointsFromMetadata(nodes, p.config.OwnerID)
+	for _, ep := range current {
+		properties.Restore(ep)
+	}
+	return current
+}
+
+// verifyPropagation checks in the background that the created and deleted names show up in DNS.
+func (p *Provider) verifyPropagation(current, desired []*endpoint.Endpoint) {
+	if p.verifier == nil {
+		return
+	}
+
+	created, deleted := cern.ChangedNames(current, desired)
+	if len(created) == 0 && len(deleted) == 0 {
+		return
+	}
+	// The verification outlives the request, so it does not use the request context.
+	go func() {
+		if failed := p.verifier.Verify(log.NewContext(context.Background(), p.logger), created, deleted); len(failed) > 0 {
+			p.logger.Error("DNS propagation failed for %d names: %v", len(failed), failed)
+		}
+	}()
+}
+
+// DebugPlan implements the GET /debug/plan endpoint.
+// It reports the per-node changes planned by the last ApplyChanges call, so operators can audit how
+// aliases are distributed, in particular in dry-run mode.
+func (p *Provider) DebugPlan(w http.ResponseWriter, r *http.Request) {
+	log.FromContext(r.Context()).Info("received request for DebugPlan from %s", r.RemoteAddr)
+
+	p.planMu.Lock()
+	lastPlan := p.lastPlan
+	p.planMu.Unlock()
+
+	if lastPlan == nil {
+		http.Error(w, "no changes have been planned yet", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(lastPlan); err != nil {
+		log.FromContext(r.Context()).Error("Failed to encode plan: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// DebugState implements the GET /debug/state endpoint.
+// It reports, for every ingress node, its current managed metadata, the metadata it should carry
+// given the desired endpoints of the last sync, and the diff between them, so operators can tell
+// why an alias is on a node without opening the OpenStack dashboard. The `node` query parameter
+// restricts the report to the node with the given server name or ID.
+//
+// The desired endpoints are the current ones when no sync happened yet, as in a reconciliation.
+func (p *Provider) DebugState(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	log.FromContext(ctx).Info("received request for DebugState from %s", r.RemoteAddr)
+
+	nodes, err := p.manager.GetIngressNodes(ctx, p.config.IngressLabels)
+	if err != nil {
+		log.FromContext(ctx).Error("Failed to get ingress nodes: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	current := p.currentEndpoints(nodes)
+	p.syncMu.Lock()
+	desired := p.lastDesired
+	p.syncMu.Unlock()
+	if desired == nil {
+		desired = current
+	}
+	desired, err = withCernAliases(ctx, p.config, p.k8sClient, current, desired)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	states := p.manager.State(nodes, desired)
+	if node := r.URL.Query().Get("node"); node != "" {
+		states = slices.DeleteFunc(states, func(state cern.NodeState) bool {
+			return state.Server != node && state.ID != node
+		})
+		if len(states) == 0 {
+			http.Error(w, "no ingress node "+node, http.StatusNotFound)
 			return
 		}
 	}
 
-	w.WriteHeader(http.StatusNoContent)
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(states); err != nil {
+		log.FromContext(ctx).Error("Failed to encode state: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
 }
 
 // Negotiate implements the GET / endpoint.
 func (p *Provider) Negotiate(w http.ResponseWriter, r *http.Request) {
-	log.GlobalLogger.Info("received request for Negotiate from %s", r.RemoteAddr)
+	log.FromContext(r.Context()).Info("received request for Negotiate from %s", r.RemoteAddr)
 	// Return basic info. ExternalDNS usually expects specific headers or body
 	// for negotiation if it was a sophisticated plugin, but for basic webhook
 	// it often just checks connectivity.
@@ -169,7 +680,31 @@ func (p *Provider) Negotiate(w http.ResponseWriter, r *http.Request) {
 }
 
 // Healthz implements the GET /healthz endpoint.
+// It reports the health of every component as JSON, and fails when a critical component fails.
 func (p *Provider) Healthz(w http.ResponseWriter, r *http.Request) {
-	log.GlobalLogger.Info("received request for Healthz from %s", r.RemoteAddr)
+	log.FromContext(r.Context()).Info("received request for Healthz from %s", r.RemoteAddr)
+	p.health.ServeHTTP(w, r)
+}
+
+// Readyz implements the GET /readyz endpoint.
+// It fails while the Kubernetes API cannot be reached, or the last check of the OpenStack
+// credentials failed.
+func (p *Provider) Readyz(w http.ResponseWriter, r *http.Request) {
+	if !p.warm.Load() {
+		http.Error(w, "warming up the caches", http.StatusServiceUnavailable)
+		return
+	}
+
+	if err := p.k8sClient.Reachable(r.Context()); err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
+	if p.authChecker != nil {
+		if err := p.authChecker.Err(); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+	}
 	w.WriteHeader(http.StatusOK)
 }
@@ -0,0 +1,271 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gophercloud/gophercloud/v2/openstack/compute/v2/servers"
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/cern"
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/k8s"
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/log"
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/pkg/config"
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+// testConfig returns the configuration of a provider using the fake backend seeded from the
+// fixture of the deployment, without background work.
+func testConfig() *config.Config {
+	fixture := "../deploy/fake-nodes.yaml"
+	return &config.Config{
+		Backend:          cern.BackendFake,
+		FakeFixture:      fixture,
+		BareMetalBackend: cern.BackendNova,
+		KubeBackend:      k8s.KubeBackendFake,
+		KubeFakeObjects:  fixture,
+		IngressLabels:    []string{"node-role.kubernetes.io/ingress"},
+		NodeDiscovery:    k8s.DiscoveryLabel,
+		NodeAddressType:  k8s.AddressTypeAuto,
+		ServerStatuses:   cern.DefaultServerStatuses,
+		RetryMaxAttempts: 1,
+		SyncConcurrency:  1,
+		MetadataMaxItems: 128,
+		OwnerID:          "default",
+		OrphanScan:       cern.OrphanScanOff,
+		HealthCritical:   DefaultHealthCritical,
+	}
+}
+
+// newTestProvider creates a provider with the given configuration, e.g. returned by testConfig.
+func newTestProvider(t *testing.T, cfg *config.Config) *Provider {
+	t.Helper()
+	p, err := New(cfg, log.NewNopLogger())
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	return p
+}
+
+// aliasNames returns the DNS names of the endpoints found in the metadata of the ingress nodes.
+func aliasNames(t *testing.T, p *Provider) []string {
+	t.Helper()
+	nodes, err := p.ingressNodes(context.Background())
+	if err != nil {
+		t.Fatalf("ingressNodes() error = %v", err)
+	}
+	var names []string
+	for _, ep := range cern.ParseEndpointsFromMetadata(nodes, "default") {
+		names = append(names, ep.DNSName)
+	}
+	return names
+}
+
+func TestApplyChangesNotLeading(t *testing.T) {
+	p := &Provider{config: &config.Config{}}
+
+	req := httptest.NewRequest(http.MethodPost, "/records", strings.NewReader(`{"Create": [{"dnsName": "new.cern.ch", "recordType": "A"}]}`))
+	req = req.WithContext(log.NewContext(req.Context(), log.NewNopLogger()))
+	rec := httptest.NewRecorder()
+	p.ApplyChanges(rec, req)
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("ApplyChanges() status = %d, want %d when not leading", rec.Code, http.StatusServiceUnavailable)
+	}
+}
+
+func TestWriteEndpoints(t *testing.T) {
+	tests := []struct {
+		name        string
+		aliases     int
+		wantFlushed bool
+	}{
+		{name: "No endpoints"},
+		{name: "Single endpoint", aliases: 1},
+		{name: "Flushed periodically", aliases: 2*recordsFlushInterval + 1, wantFlushed: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var nodes []cern.IngressNode
+			for i := range tt.aliases {
+				nodes = append(nodes, cern.IngressNode{Server: servers.Server{
+					Name:     fmt.Sprintf("node-%d", i),
+					Metadata: map[string]string{"landb-alias": fmt.Sprintf("app-%d.cern.ch--load-0-", i)},
+				}})
+			}
+			properties := cern.NewEndpointProperties([]*endpoint.Endpoint{
+				endpoint.NewEndpoint("app-0.cern.ch", endpoint.RecordTypeA).WithProviderSpecific(cern.NodeCountProperty, "1"),
+			})
+
+			rec := httptest.NewRecorder()
+			if err := writeEndpoints(rec, nodes, "default", properties); err != nil {
+				t.Fatalf("writeEndpoints() error = %v", err)
+			}
+			var got []*endpoint.Endpoint
+			if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+				t.Fatalf("writeEndpoints() wrote invalid JSON %q: %v", rec.Body.String(), err)
+			}
+			if len(got) != tt.aliases {
+				t.Errorf("writeEndpoints() wrote %d endpoints, want %d", len(got), tt.aliases)
+			}
+			for _, ep := range got {
+				if ep.DNSName == "app-0.cern.ch" && len(ep.ProviderSpecific) == 0 {
+					t.Errorf("endpoint %s written without its provider-specific properties", ep.DNSName)
+				}
+			}
+			if rec.Flushed != tt.wantFlushed {
+				t.Errorf("flushed = %v, want %v", rec.Flushed, tt.wantFlushed)
+			}
+		})
+	}
+}
+
+func TestSyncNotLeading(t *testing.T) {
+	p := newTestProvider(t, testConfig())
+	ctx := log.NewContext(context.Background(), log.NewNopLogger())
+	nodes, err := p.ingressNodes(ctx)
+	if err != nil {
+		t.Fatalf("ingressNodes() error = %v", err)
+	}
+
+	// The lease is lost while a sync is in progress: it stops before writing.
+	p.leading.Store(false)
+	desired := []*endpoint.Endpoint{endpoint.NewEndpoint("new.cern.ch", endpoint.RecordTypeA)}
+	if err := p.sync(ctx, nodes, cern.ParseEndpointsFromMetadata(nodes, "default"), desired); !errors.Is(err, errNotLeading) {
+		t.Errorf("sync() error = %v, want %v", err, errNotLeading)
+	}
+	if got := aliasNames(t, p); len(got) != 1 || got[0] != "app.cern.ch" {
+		t.Errorf("aliases after sync() = %v, want the ones of the fixture", got)
+	}
+}
+
+func TestSyncFailureKeepsLastDesired(t *testing.T) {
+	cfg := testConfig()
+	cfg.StateConfigMap = "dns/webhook-state"
+	p := newTestProvider(t, cfg)
+	ctx := log.NewContext(context.Background(), log.NewNopLogger())
+	nodes, err := p.ingressNodes(ctx)
+	if err != nil {
+		t.Fatalf("ingressNodes() error = %v", err)
+	}
+	current := cern.ParseEndpointsFromMetadata(nodes, "default")
+
+	synced := []*endpoint.Endpoint{
+		endpoint.NewEndpoint("app.cern.ch", endpoint.RecordTypeA).WithProviderSpecific(cern.NodeCountProperty, "1"),
+	}
+	p.syncMu.Lock()
+	defer p.syncMu.Unlock()
+	if err := p.sync(ctx, nodes, current, synced); err != nil {
+		t.Fatalf("sync() error = %v", err)
+	}
+
+	// The servers are gone, so the next sync fails.
+	gone := slices.Clone(nodes)
+	for i := range gone {
+		gone[i].ID = "missing-" + gone[i].ID
+	}
+	failed := []*endpoint.Endpoint{endpoint.NewEndpoint("new.cern.ch", endpoint.RecordTypeA)}
+	if err := p.sync(ctx, gone, current, failed); err == nil {
+		t.Fatal("sync() of missing servers expected an error")
+	}
+	// So does a sync losing the lease.
+	p.leading.Store(false)
+	if err := p.sync(ctx, nodes, current, failed); !errors.Is(err, errNotLeading) {
+		t.Fatalf("sync() error = %v, want %v", err, errNotLeading)
+	}
+
+	if len(p.lastDesired) != 1 || p.lastDesired[0] != synced[0] {
+		t.Errorf("lastDesired = %v after the failed syncs, want the endpoints of the last applied one", p.lastDesired)
+	}
+	if _, ok := p.endpointProperties()[synced[0].Key()]; !ok {
+		t.Errorf("endpointProperties() = %v, want the properties of the last applied sync", p.endpointProperties())
+	}
+	saved, err := StateDesired(ctx, cfg, p.k8sClient)
+	if err != nil {
+		t.Fatalf("StateDesired() error = %v", err)
+	}
+	if len(saved) != 1 || saved[0].DNSName != "app.cern.ch" {
+		t.Errorf("saved state = %v, want the endpoints of the last applied sync", saved)
+	}
+}
+
+func TestSetLeadingReloadsState(t *testing.T) {
+	cfg := testConfig()
+	cfg.StateConfigMap = "dns/webhook-state"
+	p := newTestProvider(t, cfg)
+	ctx := log.NewContext(context.Background(), log.NewNopLogger())
+
+	// This replica synced as the leader, then lost the lease. The next leader synced since.
+	p.syncMu.Lock()
+	p.setLastDesired([]*endpoint.Endpoint{endpoint.NewEndpoint("stale.cern.ch", endpoint.RecordTypeA)})
+	p.syncMu.Unlock()
+	p.setLeading(ctx, false)
+	synced := []*endpoint.Endpoint{
+		endpoint.NewEndpoint("synced.cern.ch", endpoint.RecordTypeA).WithProviderSpecific(cern.NodeCountProperty, "1"),
+	}
+	if err := SaveDesired(ctx, cfg, p.k8sClient, synced); err != nil {
+		t.Fatalf("SaveDesired() error = %v", err)
+	}
+
+	// On acquiring the lease again, the state of the previous leader replaces the stale one.
+	p.setLeading(ctx, true)
+	if !p.leading.Load() {
+		t.Fatal("leading = false after acquiring the lease")
+	}
+	if len(p.lastDesired) != 1 || p.lastDesired[0].DNSName != "synced.cern.ch" {
+		t.Errorf("lastDesired = %v, want the state saved by the previous leader", p.lastDesired)
+	}
+	if _, ok := p.endpointProperties()[synced[0].Key()]; !ok {
+		t.Errorf("endpointProperties() = %v, want the properties of the reloaded state", p.endpointProperties())
+	}
+
+	// Without a state, the stale endpoints are dropped all the same.
+	p.state = nil
+	p.setLeading(ctx, false)
+	p.setLeading(ctx, true)
+	if p.lastDesired != nil {
+		t.Errorf("lastDesired = %v without a state, want none", p.lastDesired)
+	}
+}
+
+func TestSetLeadingLostWhileReloading(t *testing.T) {
+	p := newTestProvider(t, testConfig())
+	ctx := log.NewContext(context.Background(), log.NewNopLogger())
+	p.setLeading(ctx, false)
+
+	// The lease is acquired during a sync, and lost before the sync ends.
+	p.syncMu.Lock()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		p.setLeading(ctx, true)
+	}()
+	for {
+		p.leaseMu.Lock()
+		started := p.leaseTerm == 2
+		p.leaseMu.Unlock()
+		if started {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	p.setLeading(ctx, false)
+	p.syncMu.Unlock()
+	<-done
+
+	if p.leading.Load() {
+		t.Error("leading = true after losing the lease, want false")
+	}
+
+	// Acquiring it again afterwards sets leading.
+	p.setLeading(ctx, true)
+	if !p.leading.Load() {
+		t.Error("leading = false after acquiring the lease again, want true")
+	}
+}
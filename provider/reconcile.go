@@ -0,0 +1,128 @@
+package provider
+
+import (
+	"context"
+	"time"
+
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/k8s"
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/log"
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/tracing"
+)
+
+// reconcileTimeout bounds a reconciliation triggered by node events.
+const reconcileTimeout = 5 * time.Minute
+
+// watchNodes reconciles the aliases whenever the set of ingress nodes changes, instead of waiting
+// for the next ApplyChanges call, so that scaling the ingress node pool converges DNS in seconds.
+// Changes of the CernAlias resources trigger a reconciliation too.
+//
+// Bursts of node events, e.g. while a node pool is scaled, are coalesced into a single
+// reconciliation once no event has been received for the configured debounce delay.
+func (p *Provider) watchNodes(ctx context.Context, k8sClient *k8s.Client) error {
+	events := make(chan struct{}, 1)
+	err := k8sClient.OnIngressNodesChange(ctx, p.config.IngressLabels, func(reason string) {
+		log.FromContext(ctx).Debug("Ingress nodes changed: %s", reason)
+		select {
+		case events <- struct{}{}:
+		default:
+		}
+	})
+	if err != nil {
+		return err
+	}
+	if p.config.CernAliasCRD {
+		err = k8sClient.OnCernAliasesChange(ctx, func(reason string) {
+			log.FromContext(ctx).Debug("CernAliases changed: %s", reason)
+			select {
+			case events <- struct{}{}:
+			default:
+			}
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	go p.reconcileOn(ctx, events, 0, p.Reconcile)
+	return nil
+}
+
+// reconcileOn calls reconcile whenever events are received, and every interval if it is positive.
+//
+// Bursts of events are coalesced into a single call once no event has been received for the
+// configured debounce delay. Failures are logged, the next event or interval retries.
+func (p *Provider) reconcileOn(ctx context.Context, events <-chan struct{}, interval time.Duration, reconcile func(context.Context) error) {
+	var tick <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick:
+		case <-events:
+			// Wait until the events settle.
+			timer := time.NewTimer(p.config.NodeEventDebounce)
+		settle:
+			for {
+				select {
+				case <-ctx.Done():
+					timer.Stop()
+					return
+				case <-events:
+					timer.Reset(p.config.NodeEventDebounce)
+				case <-timer.C:
+					break settle
+				}
+			}
+		}
+
+		// Every reconciliation is logged under its own ID, like the requests.
+		reconcileCtx := log.WithField(ctx, log.RequestIDField, log.NewRequestID())
+		reconcileCtx = log.WithField(reconcileCtx, log.EndpointField, "reconcile")
+		reconcileCtx, cancel := context.WithTimeout(reconcileCtx, reconcileTimeout)
+		// Every reconciliation is the root of its own trace.
+		reconcileCtx, span := tracing.Start(reconcileCtx, "reconcile")
+		err := reconcile(reconcileCtx)
+		if err != nil {
+			p.logger.ErrorCtx(reconcileCtx, "Failed to reconcile aliases: %v", err)
+		}
+		tracing.End(span, err)
+		cancel()
+	}
+}
+
+// Reconcile re-distributes the current aliases over the current ingress nodes.
+//
+// The desired endpoints are the ones of the last sync, which keep their provider-specific
+// properties, restored from the state ConfigMap after a restart, or the endpoints found in the
+// node metadata if no sync happened yet.
+// Only the leader reconciles.
+func (p *Provider) Reconcile(ctx context.Context) error {
+	if !p.leading.Load() {
+		log.FromContext(ctx).Debug("Not the leader, skipping reconciliation")
+		return nil
+	}
+
+	p.syncMu.Lock()
+	defer p.syncMu.Unlock()
+
+	nodes, err := p.manager.GetIngressNodes(ctx, p.config.IngressLabels)
+	if err != nil {
+		return err
+	}
+
+	current := p.currentEndpoints(nodes)
+	desired := p.lastDesired
+	if desired == nil {
+		desired = current
+	}
+	desired = p.protected.RetainProtected(ctx, current, desired)
+
+	log.FromContext(ctx).Info("Reconciling %d aliases over %d ingress nodes", len(desired), len(nodes))
+	return p.sync(ctx, nodes, current, desired)
+}
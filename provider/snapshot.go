@@ -0,0 +1,105 @@
+package provider
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/cern"
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/log"
+)
+
+// nodeSnapshot holds the ingress nodes, with their metadata, read during a sync cycle of ExternalDNS.
+//
+// ExternalDNS calls Records then ApplyChanges within the same sync cycle, and both read the ingress
+// nodes. Sharing a snapshot between them saves listing the Kubernetes nodes, the OpenStack servers
+// and the LanDB devices a second time. The snapshot is dropped after every write, and expires after
+// a short TTL, so the nodes written by another webhook instance or by hand are picked up on the
+// next cycle. A zero TTL disables it.
+//
+// Concurrent reads are coalesced, whether the snapshot is enabled or not: callers arriving while
+// the nodes are being read, e.g. the Records calls of two ExternalDNS replicas, wait for that read
+// instead of listing the nodes again.
+type nodeSnapshot struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	nodes   []cern.IngressNode
+	expires time.Time
+	// generation is incremented on every invalidation, so a read racing a write is not stored.
+	generation uint64
+	// inflight is the read in progress, nil when none is. It is detached on invalidation, so the
+	// callers arriving after a write do not get the nodes read before it.
+	inflight *snapshotRead
+}
+
+// snapshotRead is a read of the ingress nodes shared by concurrent callers.
+type snapshotRead struct {
+	// done is closed once nodes and err are set.
+	done  chan struct{}
+	nodes []cern.IngressNode
+	err   error
+}
+
+// get returns the nodes of the snapshot if it has not expired yet, waits for the read in progress
+// if any, or reads the nodes with load and stores them in the snapshot. The returned nodes are
+// shared and must not be modified.
+//
+// The read runs on behalf of all the callers waiting for it, so it is not canceled with the
+// context of the caller that started it. A caller whose context is done stops waiting.
+func (s *nodeSnapshot) get(ctx context.Context, load func(context.Context) ([]cern.IngressNode, error)) ([]cern.IngressNode, error) {
+	s.mu.Lock()
+	if s.ttl > 0 && s.nodes != nil && time.Now().Before(s.expires) {
+		nodes := s.nodes
+		s.mu.Unlock()
+		return nodes, nil
+	}
+	read := s.inflight
+	if read == nil {
+		read = &snapshotRead{done: make(chan struct{})}
+		s.inflight = read
+		go s.read(context.WithoutCancel(ctx), read, s.generation, load)
+	} else {
+		log.FromContext(ctx).Debug("Waiting for the read of the ingress nodes in progress")
+	}
+	s.mu.Unlock()
+
+	select {
+	case <-read.done:
+		return read.nodes, read.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// read reads the nodes for the waiting callers, and stores them in the snapshot unless it was
+// invalidated in the meantime.
+func (s *nodeSnapshot) read(ctx context.Context, read *snapshotRead, generation uint64, load func(context.Context) ([]cern.IngressNode, error)) {
+	nodes, err := load(ctx)
+	if err == nil && nodes == nil {
+		nodes = []cern.IngressNode{}
+	}
+
+	s.mu.Lock()
+	if s.inflight == read {
+		s.inflight = nil
+	}
+	if err == nil && s.ttl > 0 && s.generation == generation {
+		s.nodes = nodes
+		s.expires = time.Now().Add(s.ttl)
+	}
+	s.mu.Unlock()
+
+	read.nodes, read.err = nodes, err
+	close(read.done)
+}
+
+// invalidate drops the snapshot, forcing the next read to list the nodes again.
+func (s *nodeSnapshot) invalidate() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.nodes = nil
+	s.generation++
+	s.inflight = nil
+}
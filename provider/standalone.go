@@ -0,0 +1,83 @@
+package provider
+
+import (
+	"context"
+
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/cern"
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/k8s"
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/log"
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+// watchDNSEndpoints runs the standalone mode: the aliases are reconciled against the DNSEndpoint
+// resources whenever they change and every resync interval, without an ExternalDNS deployment.
+func (p *Provider) watchDNSEndpoints(ctx context.Context, k8sClient *k8s.Client) error {
+	events := make(chan struct{}, 1)
+	err := k8sClient.OnDNSEndpointsChange(ctx, func(reason string) {
+		log.FromContext(ctx).Debug("DNSEndpoints changed: %s", reason)
+		select {
+		case events <- struct{}{}:
+		default:
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	// The DNSEndpoints present at startup are applied right away.
+	events <- struct{}{}
+	go p.reconcileOn(ctx, events, p.config.StandaloneResyncInterval, p.ReconcileDNSEndpoints)
+	return nil
+}
+
+// ReconcileDNSEndpoints brings the aliases to the A endpoints declared by the DNSEndpoint resources,
+// like ExternalDNS would with its crd source and the sync policy: the managed aliases missing from
+// every DNSEndpoint are deleted, unless protected.
+//
+// The endpoints go through the same checks as in AdjustEndpoints, and the domain filters of the
+// configuration apply. Only the leader reconciles.
+func (p *Provider) ReconcileDNSEndpoints(ctx context.Context) error {
+	if !p.leading.Load() {
+		log.FromContext(ctx).Debug("Not the leader, skipping reconciliation")
+		return nil
+	}
+
+	declared, err := p.k8sClient.DNSEndpoints(ctx)
+	if err != nil {
+		return err
+	}
+
+	domainFilter := endpoint.NewDomainFilterWithExclusions(p.config.DomainFilter, p.config.ExcludeDomains)
+	seen := make(map[endpoint.EndpointKey]struct{}, len(declared))
+	desired := make([]*endpoint.Endpoint, 0, len(declared))
+	for _, ep := range declared {
+		if ep.RecordType != endpoint.RecordTypeA || !domainFilter.Match(ep.DNSName) {
+			continue
+		}
+		if err := cern.ValidateAlias(ep.DNSName); err != nil {
+			log.FromContext(ctx).Error("Rejecting endpoint %s: %v", ep.DNSName, err)
+			continue
+		}
+		if _, ok := seen[ep.Key()]; ok {
+			log.FromContext(ctx).Warn("Endpoint %s is declared by several DNSEndpoints, using the first one", ep.DNSName)
+			continue
+		}
+		seen[ep.Key()] = struct{}{}
+		desired = append(desired, ep.DeepCopy())
+	}
+	cern.StripTTL(desired)
+
+	p.syncMu.Lock()
+	defer p.syncMu.Unlock()
+
+	nodes, err := p.manager.GetIngressNodes(ctx, p.config.IngressLabels)
+	if err != nil {
+		return err
+	}
+
+	current := p.currentEndpoints(nodes)
+	desired = p.protected.RetainProtected(ctx, current, desired)
+
+	log.FromContext(ctx).Info("Reconciling %d aliases declared by DNSEndpoints over %d ingress nodes", len(desired), len(nodes))
+	return p.sync(ctx, nodes, current, desired)
+}
@@ -0,0 +1,125 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/k8s"
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/log"
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/pkg/config"
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+// stateKey is the ConfigMap key holding the persisted state.
+const stateKey = "state.json"
+
+// State is the state persisted after every applied sync.
+//
+// The node metadata only records which names are aliased where. The state keeps what cannot be
+// reverse-engineered from it: the desired endpoints with their provider-specific properties, and
+// the aliases owned by this webhook instance.
+type State struct {
+	// Time is when the state was saved.
+	Time time.Time `json:"time"`
+	// Owner is the owner ID of the webhook instance that saved the state.
+	Owner string `json:"owner"`
+	// Aliases are the DNS names owned by the webhook instance, sorted.
+	Aliases []string `json:"aliases"`
+	// Desired are the desired endpoints last applied.
+	Desired []*endpoint.Endpoint `json:"desired"`
+}
+
+// loadState restores the desired endpoints of the state persisted by a previous run, so that
+// reconciliations after a restart keep their provider-specific properties. A state saved by another
+// owner is ignored.
+func (p *Provider) loadState(ctx context.Context) error {
+	state, err := readState(ctx, p.state, p.config.OwnerID)
+	if err != nil || state == nil {
+		return err
+	}
+
+	p.setLastDesired(state.Desired)
+	log.FromContext(ctx).Info("Restored %d desired endpoints saved at %s from configmap %s", len(state.Desired), state.Time.Format(time.RFC3339), p.state)
+	return nil
+}
+
+// readState reads the state persisted in the store, nil when there is none or when it was saved by
+// another owner than ownerID.
+func readState(ctx context.Context, store *k8s.ConfigMapStore, ownerID string) (*State, error) {
+	data, err := store.Load(ctx, stateKey)
+	if err != nil {
+		return nil, err
+	}
+	if data == nil {
+		log.FromContext(ctx).Info("No state found in configmap %s", store)
+		return nil, nil
+	}
+
+	var state State
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("failed to decode the state of configmap %s: %w", store, err)
+	}
+	if state.Owner != ownerID {
+		log.FromContext(ctx).Warn("State of configmap %s belongs to owner %q, ignoring it", store, state.Owner)
+		return nil, nil
+	}
+	return &state, nil
+}
+
+// saveState persists the desired endpoints just applied. Failures are only logged, as the aliases
+// themselves have been written.
+func (p *Provider) saveState(ctx context.Context, desired []*endpoint.Endpoint) {
+	if p.state == nil {
+		return
+	}
+	if err := writeState(ctx, p.state, p.config.OwnerID, desired); err != nil {
+		log.FromContext(ctx).Error("Failed to save the state: %v", err)
+	}
+}
+
+// writeState persists the desired endpoints applied by ownerID in the store.
+func writeState(ctx context.Context, store *k8s.ConfigMapStore, ownerID string, desired []*endpoint.Endpoint) error {
+	state := State{Time: time.Now(), Owner: ownerID, Desired: desired}
+	seen := make(map[string]struct{})
+	for _, ep := range desired {
+		if ep.RecordType != endpoint.RecordTypeA {
+			continue
+		}
+		if _, ok := seen[ep.DNSName]; !ok {
+			seen[ep.DNSName] = struct{}{}
+			state.Aliases = append(state.Aliases, ep.DNSName)
+		}
+	}
+	sort.Strings(state.Aliases)
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("failed to encode the state: %w", err)
+	}
+	return store.Save(ctx, stateKey, data)
+}
+
+// StateDesired returns the desired endpoints of the state persisted in the configured state
+// ConfigMap, nil when none is configured or it holds no state of the configured owner.
+func StateDesired(ctx context.Context, cfg *config.Config, k8sClient *k8s.Client) ([]*endpoint.Endpoint, error) {
+	if cfg.StateConfigMap == "" {
+		return nil, nil
+	}
+	state, err := readState(ctx, k8sClient.NewConfigMapStore(cfg.StateConfigMap), cfg.OwnerID)
+	if err != nil || state == nil {
+		return nil, err
+	}
+	return state.Desired, nil
+}
+
+// SaveDesired persists the desired endpoints applied by a one-off command in the configured state
+// ConfigMap, if any, so that the server picks them up.
+func SaveDesired(ctx context.Context, cfg *config.Config, k8sClient *k8s.Client, desired []*endpoint.Endpoint) error {
+	if cfg.StateConfigMap == "" {
+		return nil
+	}
+	return writeState(ctx, k8sClient.NewConfigMapStore(cfg.StateConfigMap), cfg.OwnerID, desired)
+}
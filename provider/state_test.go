@@ -0,0 +1,71 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/cern"
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/k8s"
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/log"
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+func TestSaveDesired(t *testing.T) {
+	cfg := testConfig()
+	k8sClient, err := k8s.NewClient(cfg)
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	ctx := log.NewContext(context.Background(), log.NewNopLogger())
+	desired := []*endpoint.Endpoint{
+		endpoint.NewEndpoint("web.cern.ch", endpoint.RecordTypeA).WithProviderSpecific(cern.NodeCountProperty, "1"),
+		endpoint.NewEndpoint("app.cern.ch", endpoint.RecordTypeA),
+		endpoint.NewEndpoint("app.cern.ch", endpoint.RecordTypeA).WithSetIdentifier("b"),
+		endpoint.NewEndpoint("app.cern.ch", endpoint.RecordTypeTXT, `"heritage=external-dns"`),
+	}
+
+	// Without a state ConfigMap, nothing is saved nor read.
+	if err := SaveDesired(ctx, cfg, k8sClient, desired); err != nil {
+		t.Fatalf("SaveDesired() error = %v", err)
+	}
+	if got, err := StateDesired(ctx, cfg, k8sClient); err != nil || got != nil {
+		t.Fatalf("StateDesired() = %v, %v without a state ConfigMap, want nothing", got, err)
+	}
+
+	cfg.StateConfigMap = "dns/webhook-state"
+	if got, err := StateDesired(ctx, cfg, k8sClient); err != nil || got != nil {
+		t.Fatalf("StateDesired() = %v, %v before any save, want nothing", got, err)
+	}
+	if err := SaveDesired(ctx, cfg, k8sClient, desired); err != nil {
+		t.Fatalf("SaveDesired() error = %v", err)
+	}
+
+	got, err := StateDesired(ctx, cfg, k8sClient)
+	if err != nil {
+		t.Fatalf("StateDesired() error = %v", err)
+	}
+	if len(got) != len(desired) {
+		t.Fatalf("StateDesired() = %v, want %v", got, desired)
+	}
+	for i, ep := range got {
+		if ep.Key() != desired[i].Key() || !ep.Targets.Same(desired[i].Targets) || len(ep.ProviderSpecific) != len(desired[i].ProviderSpecific) {
+			t.Errorf("StateDesired()[%d] = %v, want %v", i, ep, desired[i])
+		}
+	}
+
+	// The aliases are the A records, sorted and once each.
+	state, err := readState(ctx, k8sClient.NewConfigMapStore(cfg.StateConfigMap), cfg.OwnerID)
+	if err != nil {
+		t.Fatalf("readState() error = %v", err)
+	}
+	if aliases, _ := json.Marshal(state.Aliases); string(aliases) != `["app.cern.ch","web.cern.ch"]` {
+		t.Errorf("state aliases = %s, want app.cern.ch and web.cern.ch", aliases)
+	}
+
+	// The state of another owner is ignored.
+	cfg.OwnerID = "other"
+	if got, err := StateDesired(ctx, cfg, k8sClient); err != nil || got != nil {
+		t.Errorf("StateDesired() = %v, %v for another owner, want nothing", got, err)
+	}
+}
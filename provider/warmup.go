@@ -0,0 +1,42 @@
+package provider
+
+import (
+	"context"
+	"time"
+
+	"github.com/thewillyhuman/external-dns-cern-cloud-webhook/internal/log"
+)
+
+// warmUpRetryInterval is the delay between two attempts of the warm-up.
+const warmUpRetryInterval = 5 * time.Second
+
+// warmUp reads the ingress nodes once at startup, filling the caches of the Kubernetes nodes, the
+// cached listing of the OpenStack servers and the snapshot of the ingress nodes, so that the first
+// sync of ExternalDNS after a restart does not pay the latency of cold caches and time out.
+// /readyz fails until it is done.
+//
+// Failed reads are retried until the warm-up timeout, after which the webhook becomes ready
+// anyway, the first sync then reading the nodes itself.
+func (p *Provider) warmUp(ctx context.Context) {
+	defer p.warm.Store(true)
+
+	ctx, cancel := context.WithTimeout(ctx, p.config.WarmUpTimeout)
+	defer cancel()
+
+	start := time.Now()
+	for {
+		nodes, err := p.snapshot.get(ctx, p.ingressNodes)
+		if err == nil {
+			log.FromContext(ctx).Info("Warmed up the caches with %d ingress nodes in %s", len(nodes), time.Since(start).Round(time.Millisecond))
+			return
+		}
+		log.FromContext(ctx).Warn("Failed to warm up the caches: %v", err)
+
+		select {
+		case <-ctx.Done():
+			log.FromContext(ctx).Warn("Gave up warming up the caches after %s, the first sync reads the ingress nodes itself", p.config.WarmUpTimeout)
+			return
+		case <-time.After(warmUpRetryInterval):
+		}
+	}
+}